@@ -0,0 +1,261 @@
+package micro
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+/**********************************/
+/*           ACCESS LOG           */
+/**********************************/
+
+// Access log formats
+const (
+	// AccessLogCombined is the Apache combined log format
+	AccessLogCombined = "combined"
+	// AccessLogJSON writes an entry per line as a JSON object
+	AccessLogJSON = "json"
+)
+
+// AccessLogEntry is a request written to the access log
+type AccessLogEntry struct {
+	Time       time.Time
+	RemoteAddr string
+	Method     string
+	URI        string
+	Protocol   string
+	Status     int
+	Size       int
+	Duration   time.Duration
+	Referer    string
+	UserAgent  string
+	// Route is the name of the route which handled the request
+	Route string
+	// RequestID is the X-Request-ID header of the response or of the request
+	RequestID string
+	// UserID is the user returned by AccessLogConfig.UserID
+	UserID string
+}
+
+// fields returns the fields of the entry by JSON name
+func (entry *AccessLogEntry) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"time":        entry.Time.Format(time.RFC3339Nano),
+		"remote_addr": entry.RemoteAddr,
+		"method":      entry.Method,
+		"uri":         entry.URI,
+		"protocol":    entry.Protocol,
+		"status":      entry.Status,
+		"size":        entry.Size,
+		"duration_ms": float64(entry.Duration) / float64(time.Millisecond),
+		"referer":     entry.Referer,
+		"user_agent":  entry.UserAgent,
+		"route":       entry.Route,
+		"request_id":  entry.RequestID,
+		"user_id":     entry.UserID,
+	}
+}
+
+// AccessLogConfig configures the AccessLog middleware
+type AccessLogConfig struct {
+	// Format is AccessLogCombined, AccessLogJSON, or a text/template executed with an AccessLogEntry,
+	// AccessLogCombined if empty
+	Format string
+	// Fields are the JSON names of the fields written in the AccessLogJSON format, all fields if empty:
+	// time, remote_addr, method, uri, protocol, status, size, duration_ms, referer, user_agent,
+	// route, request_id and user_id
+	Fields []string
+	// Output is where entries are written, os.Stdout if nil
+	Output io.Writer
+	// UserID returns the identifier of the user of the request, resolved from the request injector
+	UserID func(injector *Injector) string
+	// SampleRates are the proportions of the requests logged by route name, between 0 and 1,
+	// to sample high-traffic routes. Routes without a rate are always logged,
+	// as are server errors.
+	SampleRates map[string]float64
+}
+
+// accessLog writes the entries of an AccessLogConfig
+type accessLog struct {
+	config   AccessLogConfig
+	template *template.Template
+	mutex    sync.Mutex
+}
+
+// AccessLog returns a middleware writing an entry in the access log for each request:
+//
+//	app.Use("/", micro.AccessLog(micro.AccessLogConfig{
+//		Format: micro.AccessLogJSON,
+//		Fields: []string{"time", "method", "uri", "status", "duration_ms", "user_id"},
+//		UserID: func(injector *micro.Injector) string {
+//			if user, err := micro.Resolve[*User](injector); err == nil {
+//				return user.ID
+//			}
+//			return ""
+//		},
+//		SampleRates: map[string]float64{"health": 0.01},
+//	}))
+//
+// It should be the first middleware, so the duration of the other middlewares is measured.
+// Requests whose handler panics are logged with a 500 status.
+//
+// Can Panic! if the format is not a valid template
+func AccessLog(config AccessLogConfig) HandlerFunction {
+	log := &accessLog{config: config}
+	if log.config.Format == "" {
+		log.config.Format = AccessLogCombined
+	}
+	if log.config.Output == nil {
+		log.config.Output = os.Stdout
+	}
+	if log.config.Format != AccessLogCombined && log.config.Format != AccessLogJSON {
+		log.template = template.Must(template.New("access log").Parse(log.config.Format))
+	}
+	return func(ctx *Context, rw *ResponseWriterWithCode, injector *Injector, next Next) {
+		start, completed := time.Now(), false
+		defer func() {
+			entry := log.entry(ctx, rw, injector, start)
+			if !completed {
+				// the handler panicked, the error is answered once the middleware returns
+				entry.Status = http.StatusInternalServerError
+			}
+			if log.sampled(entry) {
+				log.write(entry)
+			}
+		}()
+		next()
+		completed = true
+	}
+}
+
+// entry returns the entry of the request of ctx
+func (log *accessLog) entry(ctx *Context, rw *ResponseWriterWithCode, injector *Injector, start time.Time) *AccessLogEntry {
+	request := ctx.Request
+	entry := &AccessLogEntry{
+		Time:       start,
+		RemoteAddr: request.RemoteAddr,
+		Method:     request.Method,
+		URI:        request.RequestURI,
+		Protocol:   request.Proto,
+		Status:     rw.Code(),
+		Size:       rw.Length(),
+		Duration:   time.Since(start),
+		Referer:    request.Referer(),
+		UserAgent:  request.UserAgent(),
+		RequestID:  rw.Header().Get("X-Request-ID"),
+	}
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		entry.RemoteAddr = host
+	}
+	if entry.URI == "" {
+		entry.URI = request.URL.RequestURI()
+	}
+	if entry.Status == 0 {
+		entry.Status = http.StatusOK
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = request.Header.Get("X-Request-ID")
+	}
+	if route := ctx.Route(); route != nil {
+		entry.Route = route.Name()
+	}
+	if log.config.UserID != nil {
+		entry.UserID = log.config.UserID(injector)
+	}
+	return entry
+}
+
+// sampled returns true if entry must be written
+func (log *accessLog) sampled(entry *AccessLogEntry) bool {
+	rate, ok := log.config.SampleRates[entry.Route]
+	return !ok || entry.Status >= http.StatusInternalServerError || rand.Float64() < rate
+}
+
+// write writes entry to the output in the configured format
+func (log *accessLog) write(entry *AccessLogEntry) {
+	var line strings.Builder
+	switch {
+	case log.template != nil:
+		if err := log.template.Execute(&line, entry); err != nil {
+			line.Reset()
+			fmt.Fprintf(&line, "access log template failed : %v", err)
+		}
+	case log.config.Format == AccessLogJSON:
+		fields := entry.fields()
+		if len(log.config.Fields) > 0 {
+			selected := map[string]interface{}{}
+			for _, name := range log.config.Fields {
+				if value, ok := fields[name]; ok {
+					selected[name] = value
+				}
+			}
+			fields = selected
+		}
+		encoded, _ := json.Marshal(fields)
+		line.Write(encoded)
+	default:
+		fmt.Fprintf(&line, `%s - %s [%s] "%s %s %s" %d %s "%s" "%s"`,
+			entry.RemoteAddr, orDash(entry.UserID), entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			escapeLogItem(entry.Method), escapeLogItem(entry.URI), escapeLogItem(entry.Protocol), entry.Status,
+			orDash(sizeString(entry.Size)), orDash(escapeLogItem(entry.Referer)), orDash(escapeLogItem(entry.UserAgent)))
+	}
+	if !strings.HasSuffix(line.String(), "\n") {
+		line.WriteString("\n")
+	}
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	io.WriteString(log.config.Output, line.String())
+}
+
+// escapeLogItem escapes the quotes, backslashes and non printable bytes of a value sent by the client
+// as Apache does, so it cannot forge log lines or break the quoted fields of the combined format
+func escapeLogItem(value string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '"' || c == '\\':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(c)
+		case c == '\b':
+			escaped.WriteString(`\b`)
+		case c == '\n':
+			escaped.WriteString(`\n`)
+		case c == '\r':
+			escaped.WriteString(`\r`)
+		case c == '\t':
+			escaped.WriteString(`\t`)
+		case c == '\v':
+			escaped.WriteString(`\v`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&escaped, `\x%02x`, c)
+		default:
+			escaped.WriteByte(c)
+		}
+	}
+	return escaped.String()
+}
+
+// orDash returns value, or "-" if it is empty as in Apache logs
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// sizeString returns the size of a response body, empty if it is 0 as in Apache logs
+func sizeString(size int) string {
+	if size == 0 {
+		return ""
+	}
+	return fmt.Sprint(size)
+}
@@ -0,0 +1,312 @@
+// Package auth logs users in with OAuth2 and OpenID Connect providers such as Google or GitHub,
+// following the authorization code flow with state and PKCE verification:
+//
+//	app.Use("/", micro.Sessions(micro.SessionConfig{Store: micro.NewCookieStore(key)}))
+//	app.Use("/", auth.Middleware())
+//	app.Mount("/auth", auth.Routes(auth.Config{
+//		Providers: []*auth.Provider{
+//			auth.Google(googleID, googleSecret, "https://example.com/auth/google/callback"),
+//			auth.GitHub(githubID, githubSecret, "https://example.com/auth/github/callback"),
+//		},
+//	}))
+//	app.Get("/me", func(ctx *micro.Context, identity *auth.Identity) error {
+//		if identity == nil {
+//			return micro.Unauthorized("")
+//		}
+//		return ctx.WriteJSON(identity)
+//	})
+//
+// Users log in at /auth/{provider}/login, optionally with a return query parameter, and log out
+// by posting to /auth/logout. Their identity is kept in their session, which requires the Sessions middleware.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/interactiv/micro"
+)
+
+/**********************************/
+/*             LOGIN              */
+/**********************************/
+
+// Session keys of the login state and of the identity
+const (
+	stateKey    = "auth.state"
+	verifierKey = "auth.verifier"
+	returnKey   = "auth.return"
+	identityKey = "auth.identity"
+)
+
+// Identity is a user logged in with a provider
+type Identity struct {
+	// Provider is the name of the provider the user logged in with
+	Provider string `json:"provider"`
+	// Subject identifies the user at the provider
+	Subject string `json:"subject"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Picture string `json:"picture,omitempty"`
+}
+
+// UserID returns the user ID of the sessions of the identity, see micro.Session.SetUserID
+func (identity *Identity) UserID() string {
+	return identity.Provider + ":" + identity.Subject
+}
+
+// Token is the token returned by a provider in exchange for an authorization code
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	// IDToken is the OpenID Connect ID token, empty for OAuth2 providers
+	IDToken   string `json:"id_token"`
+	ExpiresIn int    `json:"expires_in"`
+	// Expiry is when the access token expires, zero if the provider did not tell
+	Expiry time.Time `json:"-"`
+}
+
+// Config configures the login routes
+type Config struct {
+	Providers []*Provider
+	// HomeURL is where users are redirected after logging out, or after logging in without a return path,
+	// / if empty
+	HomeURL string
+	// OnLogin is called with the identity and the token of the users logging in, to create their accounts
+	// or keep their tokens. Logins are denied if it returns an error.
+	OnLogin func(ctx *micro.Context, identity *Identity, token *Token) error
+	// HTTPClient sends the requests to the providers, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// Routes returns the login routes of the providers of config, to be mounted on a path:
+// GET /{provider}/login, GET /{provider}/callback and POST /logout
+func Routes(config Config) *micro.ControllerCollection {
+	if config.HomeURL == "" {
+		config.HomeURL = "/"
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	providers := map[string]*Provider{}
+	for _, provider := range config.Providers {
+		providers[provider.Name] = provider
+	}
+	routes := micro.NewControllerCollection()
+	routes.Get("/:provider/login", func(ctx *micro.Context, session *micro.Session) error {
+		provider := providers[ctx.RequestVars["provider"]]
+		if provider == nil {
+			return micro.NotFound("unknown provider")
+		}
+		config.login(ctx, session, provider)
+		return nil
+	}).SetName("auth.login")
+	routes.Get("/:provider/callback", func(ctx *micro.Context, session *micro.Session) error {
+		provider := providers[ctx.RequestVars["provider"]]
+		if provider == nil {
+			return micro.NotFound("unknown provider")
+		}
+		return config.callback(ctx, session, provider)
+	}).SetName("auth.callback")
+	routes.Post("/logout", func(ctx *micro.Context, session *micro.Session) {
+		session.Destroy()
+		ctx.Redirect(config.HomeURL, http.StatusSeeOther)
+	}).SetName("auth.logout")
+	return routes
+}
+
+// login redirects the user to the authorization endpoint of provider
+func (config *Config) login(ctx *micro.Context, session *micro.Session, provider *Provider) {
+	state, verifier := randomString(), randomString()
+	challenge := sha256.Sum256([]byte(verifier))
+	session.Set(stateKey, state)
+	session.Set(verifierKey, verifier)
+	session.Set(returnKey, returnPath(ctx.Request.URL.Query().Get("return"), config.HomeURL))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.ClientID},
+		"redirect_uri":          {provider.RedirectURL},
+		"scope":                 {strings.Join(provider.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(provider.AuthURL, "?") {
+		separator = "&"
+	}
+	ctx.Redirect(provider.AuthURL+separator+query.Encode(), http.StatusFound)
+}
+
+// callback verifies the state of the authorization response, exchanges its code for a token,
+// and logs in the user the token belongs to
+func (config *Config) callback(ctx *micro.Context, session *micro.Session, provider *Provider) error {
+	query := ctx.Request.URL.Query()
+	state, verifier, redirect := session.Get(stateKey), session.Get(verifierKey), session.Get(returnKey)
+	session.Delete(stateKey)
+	session.Delete(verifierKey)
+	session.Delete(returnKey)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+		return micro.BadRequest("invalid login state")
+	}
+	if err := query.Get("error"); err != "" {
+		message := query.Get("error_description")
+		if message == "" {
+			message = err
+		}
+		return micro.Unauthorized(message)
+	}
+	token, err := config.exchange(ctx, provider, query.Get("code"), verifier)
+	if err != nil {
+		return &micro.HTTPError{Code: http.StatusBadGateway, Message: "login failed", Internal: err}
+	}
+	identity, err := config.userInfo(ctx, provider, token)
+	if err != nil {
+		return &micro.HTTPError{Code: http.StatusBadGateway, Message: "login failed", Internal: err}
+	}
+	if config.OnLogin != nil {
+		if err := config.OnLogin(ctx, identity, token); err != nil {
+			return err
+		}
+	}
+	encoded, err := json.Marshal(identity)
+	if err != nil {
+		return err
+	}
+	// the privileges of the session change, its ID is renewed to prevent session fixation
+	session.RenewID()
+	session.Set(identityKey, string(encoded))
+	session.SetUserID(identity.UserID())
+	ctx.Redirect(returnPath(redirect, config.HomeURL), http.StatusFound)
+	return nil
+}
+
+// exchange exchanges code for a token at the token endpoint of provider
+func (config *Config) exchange(ctx *micro.Context, provider *Provider, code string, verifier string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.RedirectURL},
+		"client_id":     {provider.ClientID},
+		"client_secret": {provider.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	request, err := http.NewRequestWithContext(ctx.Request.Context(), http.MethodPost, provider.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	token := &Token{}
+	if err := config.do(request, token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("POST %s : no access token", provider.TokenURL)
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// userInfo returns the identity of the user token belongs to
+func (config *Config) userInfo(ctx *micro.Context, provider *Provider, token *Token) (*Identity, error) {
+	request, err := http.NewRequestWithContext(ctx.Request.Context(), http.MethodGet, provider.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	request.Header.Set("Accept", "application/json")
+	info := map[string]interface{}{}
+	if err := config.do(request, &info); err != nil {
+		return nil, err
+	}
+	identityOf := provider.Identity
+	if identityOf == nil {
+		identityOf = OIDCIdentity
+	}
+	identity := identityOf(info)
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("GET %s : no subject in user info", provider.UserInfoURL)
+	}
+	identity.Provider = provider.Name
+	return identity, nil
+}
+
+// do sends request and decodes its JSON response in v
+func (config *Config) do(request *http.Request, v interface{}) error {
+	response, err := config.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s : %s", request.Method, request.URL, response.Status)
+	}
+	if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s %s : %w", request.Method, request.URL, err)
+	}
+	return nil
+}
+
+// CurrentIdentity returns the identity of the user logged in session, nil if the user is anonymous
+func CurrentIdentity(session *micro.Session) *Identity {
+	encoded := session.Get(identityKey)
+	if encoded == "" {
+		return nil
+	}
+	identity := &Identity{}
+	if json.Unmarshal([]byte(encoded), identity) != nil {
+		return nil
+	}
+	return identity
+}
+
+// Middleware returns a middleware registering the *Identity of the user in the request injector,
+// a nil *Identity for anonymous users. It must be registered after the Sessions middleware.
+func Middleware() micro.HandlerFunction {
+	return func(session *micro.Session, injector *micro.Injector, next micro.Next) {
+		injector.Register(CurrentIdentity(session))
+		next()
+	}
+}
+
+// RequireLogin returns a middleware redirecting anonymous users to loginURL, with the path they requested
+// as return query parameter:
+//
+//	admin.Use("/", auth.RequireLogin("/auth/google/login"))
+func RequireLogin(loginURL string) micro.HandlerFunction {
+	return func(ctx *micro.Context, session *micro.Session, next micro.Next) {
+		if CurrentIdentity(session) != nil {
+			next()
+			return
+		}
+		ctx.Redirect(loginURL+"?"+url.Values{"return": {ctx.Request.URL.RequestURI()}}.Encode(), http.StatusFound)
+	}
+}
+
+// returnPath returns path if it is a local path users can be redirected to, fallback otherwise,
+// so the login cannot redirect to another site
+func returnPath(path string, fallback string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return fallback
+	}
+	return path
+}
+
+// randomString returns a random base64 string suitable for states and PKCE verifiers
+func randomString() string {
+	random := make([]byte, 32)
+	rand.Read(random)
+	return base64.RawURLEncoding.EncodeToString(random)
+}
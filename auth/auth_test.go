@@ -0,0 +1,107 @@
+package auth_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/interactiv/micro"
+	"github.com/interactiv/micro/auth"
+	"github.com/interactiv/micro/microtest"
+)
+
+// fakeProvider is an authorization server issuing a token for the code "code"
+// if the PKCE verifier matches the challenge of the authorization request
+func fakeProvider(t *testing.T, challenge *string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != *challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "token_type": "Bearer", "expires_in": 3600})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"sub": "1234", "email": "jane@example.com", "name": "Jane"})
+	})
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"authorization_endpoint": "http://" + r.Host + "/authorize",
+			"token_endpoint":         "http://" + r.Host + "/token",
+			"userinfo_endpoint":      "http://" + r.Host + "/userinfo",
+		})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLogin(t *testing.T) {
+	challenge := ""
+	server := fakeProvider(t, &challenge)
+	provider, err := auth.OIDC(t.Context(), "fake", server.URL, "client", "secret", "http://app/auth/fake/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logins := []string{}
+	app := micro.New()
+	app.Use("/", micro.Sessions(micro.SessionConfig{Store: micro.NewCookieStore(make([]byte, 16))}))
+	app.Use("/", auth.Middleware())
+	app.Mount("/auth", auth.Routes(auth.Config{
+		Providers: []*auth.Provider{provider},
+		OnLogin: func(ctx *micro.Context, identity *auth.Identity, token *auth.Token) error {
+			logins = append(logins, identity.UserID()+" "+token.AccessToken)
+			return nil
+		},
+	}))
+	admin := micro.NewControllerCollection()
+	admin.Use("/", auth.RequireLogin("/auth/fake/login"))
+	admin.Get("/", func(ctx *micro.Context, identity *auth.Identity) error {
+		return ctx.WriteJSON(identity)
+	})
+	app.Mount("/admin", admin)
+	client := microtest.NewClient(app)
+
+	client.GET("/admin").Expect(t).Status(http.StatusFound).Header("Location", "/auth/fake/login?return=%2Fadmin")
+	response := client.GET("/auth/fake/login").WithQuery("return", "/admin").Expect(t).Status(http.StatusFound)
+	location, err := url.Parse(response.Response.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := location.Query()
+	if !strings.HasPrefix(location.String(), server.URL+"/authorize?") || query.Get("client_id") != "client" ||
+		query.Get("code_challenge_method") != "S256" || query.Get("scope") != "openid email profile" {
+		t.Fatalf("unexpected authorization request %s", location)
+	}
+	client.GET("/auth/fake/callback").WithQuery("code", "code").WithQuery("state", "forged").
+		Expect(t).Status(http.StatusBadRequest)
+
+	// return paths to other sites are ignored
+	response = client.GET("/auth/fake/login").WithQuery("return", "//evil.example.com").Expect(t)
+	location, _ = url.Parse(response.Response.Header.Get("Location"))
+	challenge = location.Query().Get("code_challenge")
+	client.GET("/auth/fake/callback").WithQuery("code", "code").WithQuery("state", location.Query().Get("state")).
+		Expect(t).Status(http.StatusFound).Header("Location", "/")
+	if strings.Join(logins, ",") != "fake:1234 token" {
+		t.Errorf("unexpected logins %v", logins)
+	}
+	identity := &auth.Identity{}
+	client.GET("/admin").Expect(t).Status(http.StatusOK).JSON(identity)
+	if *identity != (auth.Identity{Provider: "fake", Subject: "1234", Email: "jane@example.com", Name: "Jane"}) {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	client.POST("/auth/logout").Expect(t).Status(http.StatusSeeOther).Header("Location", "/")
+	client.GET("/admin").Expect(t).Status(http.StatusFound)
+	client.GET("/auth/unknown/login").Expect(t).Status(http.StatusNotFound)
+}
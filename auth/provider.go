@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+/**********************************/
+/*           PROVIDERS            */
+/**********************************/
+
+// Provider is an OAuth2 authorization server users log in with
+type Provider struct {
+	// Name identifies the provider in the login and callback paths
+	Name         string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute URL of the callback route of the provider, registered with the provider
+	RedirectURL string
+	// AuthURL, TokenURL and UserInfoURL are the endpoints of the provider
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	Scopes      []string
+	// Identity returns the identity of the user info returned by the provider, OIDCIdentity if nil
+	Identity func(info map[string]interface{}) *Identity
+}
+
+// Google returns a provider logging users in with their Google account
+func Google(clientID string, clientSecret string, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "google",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		UserInfoURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+// GitHub returns a provider logging users in with their GitHub account
+func GitHub(clientID string, clientSecret string, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "github",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		UserInfoURL:  "https://api.github.com/user",
+		Scopes:       []string{"read:user", "user:email"},
+		Identity: func(info map[string]interface{}) *Identity {
+			identity := &Identity{
+				Subject: claim(info, "id"),
+				Email:   claim(info, "email"),
+				Name:    claim(info, "name"),
+				Picture: claim(info, "avatar_url"),
+			}
+			if identity.Name == "" {
+				identity.Name = claim(info, "login")
+			}
+			return identity
+		},
+	}
+}
+
+// OIDC returns a provider named name whose endpoints are read from the discovery document of issuer,
+// at issuer/.well-known/openid-configuration
+func OIDC(ctx context.Context, name string, issuer string, clientID string, clientSecret string, redirectURL string) (*Provider, error) {
+	discoveryURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s : %s", discoveryURL, response.Status)
+	}
+	discovery := struct {
+		AuthURL     string `json:"authorization_endpoint"`
+		TokenURL    string `json:"token_endpoint"`
+		UserInfoURL string `json:"userinfo_endpoint"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("GET %s : %w", discoveryURL, err)
+	}
+	return &Provider{
+		Name:         name,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      discovery.AuthURL,
+		TokenURL:     discovery.TokenURL,
+		UserInfoURL:  discovery.UserInfoURL,
+		Scopes:       []string{"openid", "email", "profile"},
+	}, nil
+}
+
+// OIDCIdentity returns the identity of the standard claims of OpenID Connect user info
+func OIDCIdentity(info map[string]interface{}) *Identity {
+	return &Identity{
+		Subject: claim(info, "sub"),
+		Email:   claim(info, "email"),
+		Name:    claim(info, "name"),
+		Picture: claim(info, "picture"),
+	}
+}
+
+// claim returns the claim name of info as a string
+func claim(info map[string]interface{}, name string) string {
+	switch value := info[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return fmt.Sprintf("%.0f", value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,96 @@
+//go:build adapters
+
+// Package autotls serves micro applications over HTTPS
+// with certificates obtained automatically from Let's Encrypt.
+//
+//	app := micro.New()
+//	log.Fatal(autotls.Run(app, "example.com", "www.example.com"))
+//
+// Certificates are requested on the first TLS handshake for one of the domains and renewed before they expire.
+// They are cached on disk, so restarts do not run into the rate limits of Let's Encrypt.
+// The HTTP-01 challenges are answered on port 80, which must be reachable from the internet.
+package autotls
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/interactiv/micro"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+/**********************************/
+/*            AUTO TLS            */
+/**********************************/
+
+// Config configures how certificates are obtained
+type Config struct {
+	// Domains are the host names certificates are requested for, other hosts are rejected
+	Domains []string
+	// CacheDir is the directory certificates are stored in, DefaultCacheDir() if empty
+	CacheDir string
+	// Email is the contact address of the Let's Encrypt account, optional
+	Email string
+	// Addr is the address of the HTTPS server, ":https" if empty
+	Addr string
+	// HTTPAddr is the address of the server answering the HTTP-01 challenges
+	// and redirecting to HTTPS, ":http" if empty
+	HTTPAddr string
+}
+
+// DefaultCacheDir returns the default certificate cache directory,
+// autocert in the user cache directory or in the temporary directory
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "autocert")
+}
+
+// NewManager returns the certificate manager of config
+func NewManager(config Config) *autocert.Manager {
+	cacheDir := config.CacheDir
+	if cacheDir == "" {
+		cacheDir = DefaultCacheDir()
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(config.Domains...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      config.Email,
+	}
+}
+
+// Run serves app over HTTPS on :https with certificates for domains cached in DefaultCacheDir().
+// It always returns a non-nil error.
+func Run(app *micro.Micro, domains ...string) error {
+	return RunWithConfig(app, Config{Domains: domains})
+}
+
+// RunWithConfig serves app over HTTPS according to config, the HTTP server answering
+// the challenges of Let's Encrypt and redirecting other requests to HTTPS runs in the background.
+// It always returns a non-nil error.
+func RunWithConfig(app *micro.Micro, config Config) error {
+	addr, httpAddr := config.Addr, config.HTTPAddr
+	if addr == "" {
+		addr = ":https"
+	}
+	if httpAddr == "" {
+		httpAddr = ":http"
+	}
+	manager := NewManager(config)
+	errs := make(chan error, 2)
+	go func() { errs <- http.ListenAndServe(httpAddr, manager.HTTPHandler(nil)) }()
+	go func() { errs <- app.RunTLSConfig(addr, TLSConfig(manager)) }()
+	return <-errs
+}
+
+// TLSConfig returns the TLS configuration getting certificates from manager
+func TLSConfig(manager *autocert.Manager) *tls.Config {
+	config := manager.TLSConfig()
+	config.MinVersion = tls.VersionTLS12
+	return config
+}
@@ -0,0 +1,26 @@
+//go:build adapters
+
+package autotls_test
+
+import (
+	"context"
+	"crypto/tls"
+	"path/filepath"
+	"testing"
+
+	"github.com/interactiv/expect"
+	"github.com/interactiv/micro/autotls"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestNewManager(t *testing.T) {
+	e := expect.New(t)
+	dir := t.TempDir()
+	manager := autotls.NewManager(autotls.Config{Domains: []string{"example.com"}, CacheDir: dir, Email: "admin@example.com"})
+	e.Expect(manager.Email).ToBe("admin@example.com")
+	e.Expect(manager.Cache).ToEqual(autocert.DirCache(dir))
+	e.Expect(manager.HostPolicy(context.Background(), "example.com")).ToBeNil()
+	e.Expect(manager.HostPolicy(context.Background(), "attacker.com")).Not().ToBeNil()
+	e.Expect(autotls.TLSConfig(manager).MinVersion).ToBe(uint16(tls.VersionTLS12))
+	e.Expect(filepath.Base(autotls.DefaultCacheDir())).ToBe("autocert")
+}
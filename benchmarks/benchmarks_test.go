@@ -0,0 +1,178 @@
+package benchmarks_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/interactiv/micro"
+)
+
+// discardResponseWriter is a ResponseWriter discarding the response,
+// so benchmarks measure the framework rather than the recorder
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (rw *discardResponseWriter) Header() http.Header         { return rw.header }
+func (rw *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (rw *discardResponseWriter) WriteHeader(int)             {}
+
+// allocationBudgets are the maximum number of allocations per request of the benchmarks
+var allocationBudgets = map[string]struct {
+	budget float64
+	setup  func() (*micro.Micro, *http.Request)
+}{
+	"static":     {11, static},
+	"params":     {12, params},
+	"injection":  {14, injection},
+	"write json": {15, writeJSON},
+}
+
+func TestAllocationBudgets(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not representative with the race detector")
+	}
+	for name, budget := range allocationBudgets {
+		app, request := budget.setup()
+		rw := &discardResponseWriter{header: http.Header{}}
+		allocs := testing.AllocsPerRun(100, func() {
+			clear(rw.header)
+			app.ServeHTTP(rw, request)
+		})
+		if allocs > budget.budget {
+			t.Errorf("%s : %v allocations per request, the budget is %v", name, allocs, budget.budget)
+		}
+	}
+}
+
+// serve benchmarks app serving request
+func serve(b *testing.B, app *micro.Micro, request *http.Request) {
+	rw := &discardResponseWriter{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		clear(rw.header)
+		app.ServeHTTP(rw, request)
+	}
+}
+
+type Repository struct{}
+
+type Service struct {
+	repository *Repository
+}
+
+type User struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Email string   `json:"email"`
+	Roles []string `json:"roles"`
+}
+
+func static() (*micro.Micro, *http.Request) {
+	app := micro.New()
+	app.Get("/", func(ctx *micro.Context) {})
+	return app, httptest.NewRequest("GET", "/", nil)
+}
+
+func BenchmarkStatic(b *testing.B) {
+	app, request := static()
+	serve(b, app, request)
+}
+
+// BenchmarkRouting matches the last of 10, 100 and 1000 routes
+func BenchmarkRouting(b *testing.B) {
+	for _, count := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("%d routes", count), func(b *testing.B) {
+			app := micro.New()
+			for i := 0; i < count; i++ {
+				app.Get(fmt.Sprintf("/resources%d/:id", i), func(ctx *micro.Context) {})
+			}
+			serve(b, app, httptest.NewRequest("GET", fmt.Sprintf("/resources%d/1", count-1), nil))
+		})
+	}
+}
+
+func params() (*micro.Micro, *http.Request) {
+	app := micro.New()
+	app.Get("/users/:user/posts/:post/comments/:comment", func(params micro.Params) {
+		_ = params["user"] + params["post"] + params["comment"]
+	})
+	return app, httptest.NewRequest("GET", "/users/1/posts/2/comments/3", nil)
+}
+
+func BenchmarkParams(b *testing.B) {
+	app, request := params()
+	serve(b, app, request)
+}
+
+func BenchmarkParamsStruct(b *testing.B) {
+	type CommentParams struct {
+		micro.In
+		User    int `param:"user"`
+		Post    int `param:"post"`
+		Comment int `param:"comment"`
+	}
+	app := micro.New()
+	app.Get("/users/:user/posts/:post/comments/:comment", func(params CommentParams) {})
+	serve(b, app, httptest.NewRequest("GET", "/users/1/posts/2/comments/3", nil))
+}
+
+func injection() (*micro.Micro, *http.Request) {
+	app := micro.New()
+	app.Injector().Register(&Repository{})
+	app.Injector().Provide(func(repository *Repository) *Service { return &Service{repository} })
+	app.Get("/", func(ctx *micro.Context, service *Service, repository *Repository) {})
+	return app, httptest.NewRequest("GET", "/", nil)
+}
+
+func BenchmarkInjection(b *testing.B) {
+	app, request := injection()
+	serve(b, app, request)
+}
+
+func BenchmarkScopedInjection(b *testing.B) {
+	app := micro.New()
+	app.Injector().Register(&Repository{})
+	app.Injector().ProvideScoped(func(repository *Repository) *Service { return &Service{repository} })
+	app.Get("/", func(ctx *micro.Context, service *Service) {})
+	serve(b, app, httptest.NewRequest("GET", "/", nil))
+}
+
+func BenchmarkMiddlewares(b *testing.B) {
+	app := micro.New()
+	for i := 0; i < 5; i++ {
+		app.Use("/", func(next micro.Next) { next() })
+	}
+	app.Get("/", func(ctx *micro.Context) {})
+	serve(b, app, httptest.NewRequest("GET", "/", nil))
+}
+
+func writeJSON() (*micro.Micro, *http.Request) {
+	user := &User{ID: 1, Name: "John Doe", Email: "john@example.com", Roles: []string{"admin", "editor"}}
+	app := micro.New()
+	app.Get("/users/:id", func(ctx *micro.Context) { ctx.WriteJSON(user) })
+	return app, httptest.NewRequest("GET", "/users/1", nil)
+}
+
+func BenchmarkWriteJSON(b *testing.B) {
+	app, request := writeJSON()
+	serve(b, app, request)
+}
+
+func BenchmarkRespond(b *testing.B) {
+	user := &User{ID: 1, Name: "John Doe", Email: "john@example.com", Roles: []string{"admin", "editor"}}
+	app := micro.New()
+	app.Get("/users/:id", func() (*User, error) { return user, nil })
+	serve(b, app, httptest.NewRequest("GET", "/users/1", nil))
+}
+
+func BenchmarkNotFound(b *testing.B) {
+	app := micro.New()
+	for i := 0; i < 100; i++ {
+		app.Get(fmt.Sprintf("/resources%d/:id", i), func(ctx *micro.Context) {})
+	}
+	serve(b, app, httptest.NewRequest("GET", "/missing", nil))
+}
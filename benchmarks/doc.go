@@ -0,0 +1,28 @@
+// Package benchmarks is the benchmark suite of micro, optimizations are measured against it.
+// It exercises routing with 10, 100 and 1000 routes, parameter extraction, injection,
+// middlewares and JSON responses, each request being served by Micro.ServeHTTP.
+//
+// Run it on the base branch and on the branch of a change, then compare the results with benchstat:
+//
+//	go test -run '^$' -bench . -count 10 ./benchmarks > old.txt
+//	go test -run '^$' -bench . -count 10 ./benchmarks > new.txt
+//	benchstat old.txt new.txt
+//
+// TestAllocationBudgets fails when a change makes requests allocate more than their budget,
+// budgets are lowered when optimizations land.
+//
+// Baselines, go1.27 linux/amd64, Intel Xeon:
+//
+//	BenchmarkStatic                 1163 ns/op    296 B/op   11 allocs/op
+//	BenchmarkRouting/10_routes      1876 ns/op    312 B/op   11 allocs/op
+//	BenchmarkRouting/100_routes     9405 ns/op    312 B/op   11 allocs/op
+//	BenchmarkRouting/1000_routes   77338 ns/op    312 B/op   11 allocs/op
+//	BenchmarkParams                 1762 ns/op    408 B/op   12 allocs/op
+//	BenchmarkParamsStruct           2526 ns/op    488 B/op   18 allocs/op
+//	BenchmarkInjection              2031 ns/op    392 B/op   14 allocs/op
+//	BenchmarkScopedInjection        2515 ns/op    384 B/op   15 allocs/op
+//	BenchmarkMiddlewares            4292 ns/op    696 B/op   26 allocs/op
+//	BenchmarkWriteJSON              2207 ns/op    504 B/op   15 allocs/op
+//	BenchmarkRespond                2667 ns/op    568 B/op   17 allocs/op
+//	BenchmarkNotFound               6159 ns/op    552 B/op   19 allocs/op
+package benchmarks
@@ -0,0 +1,6 @@
+//go:build race
+
+package benchmarks_test
+
+// raceEnabled is true when the race detector, which allocates, is enabled
+const raceEnabled = true
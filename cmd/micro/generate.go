@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// controllerTemplate generates a controller handling a resource
+var controllerTemplate = template.Must(template.New("controller").Parse(`package {{.Package}}
+
+import (
+	"net/http"
+
+	"github.com/interactiv/micro"
+)
+
+// {{.Type}} handles the {{.Resource}} resource, mounted with:
+//
+//	app.Mount("/{{.Path}}", (&{{.Type}}{}).Routes())
+type {{.Type}} struct{}
+
+// Routes returns the routes of the controller
+func (controller *{{.Type}}) Routes() *micro.ControllerCollection {
+	routes := micro.NewControllerCollection()
+	routes.Get("/", controller.Index).SetName("{{.Route}}.index")
+	routes.Post("/", controller.Create).SetName("{{.Route}}.create")
+	routes.Get("/:id", controller.Show).SetName("{{.Route}}.show")
+	routes.Put("/:id", controller.Update).SetName("{{.Route}}.update")
+	routes.Delete("/:id", controller.Delete).SetName("{{.Route}}.delete")
+	return routes
+}
+
+// Index lists the {{.Resource}}
+func (controller *{{.Type}}) Index(ctx *micro.Context) (interface{}, error) {
+	return []interface{}{}, nil
+}
+
+// Create creates a resource from the request body
+func (controller *{{.Type}}) Create(ctx *micro.Context) (int, interface{}, error) {
+	resource := map[string]interface{}{}
+	if err := ctx.Bind(&resource); err != nil {
+		return 0, nil, micro.BadRequest(err.Error())
+	}
+	return http.StatusCreated, resource, nil
+}
+
+// Show returns the resource identified by the id parameter
+func (controller *{{.Type}}) Show(ctx *micro.Context) (interface{}, error) {
+	return nil, micro.NotFound("resource " + ctx.RequestVars["id"] + " not found")
+}
+
+// Update replaces the resource identified by the id parameter with the request body
+func (controller *{{.Type}}) Update(ctx *micro.Context) (interface{}, error) {
+	return nil, micro.NotFound("resource " + ctx.RequestVars["id"] + " not found")
+}
+
+// Delete deletes the resource identified by the id parameter
+func (controller *{{.Type}}) Delete(ctx *micro.Context) (int, interface{}, error) {
+	return 0, nil, micro.NotFound("resource " + ctx.RequestVars["id"] + " not found")
+}
+`))
+
+// middlewareTemplate generates a middleware
+var middlewareTemplate = template.Must(template.New("middleware").Parse(`package {{.Package}}
+
+import (
+	"github.com/interactiv/micro"
+)
+
+// {{.Type}} returns a middleware, registered with:
+//
+//	app.Use("/", {{.Type}}())
+func {{.Type}}() micro.HandlerFunction {
+	return func(ctx *micro.Context, next micro.Next) {
+		// code executed before the handler, return without calling next to answer the request here
+		next()
+		// code executed after the handler
+	}
+}
+`))
+
+// generated is the data of the generator templates
+type generated struct {
+	Package string
+	// Type is the name of the generated type or function
+	Type string
+	// Resource, Path and Route are the resource of a controller in a sentence, its path and its route names
+	Resource, Path, Route string
+}
+
+// newCommand generates a controller or a middleware
+func newCommand(args []string, stdout, stderr io.Writer) error {
+	if len(args) < 2 {
+		return usageError("new takes a kind, controller or middleware, and a name")
+	}
+	kind, name := args[0], args[1]
+	flags := flag.NewFlagSet("new "+kind, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dir := flags.String("dir", ".", "directory of the generated file")
+	if err := flags.Parse(args[2:]); err != nil {
+		return usageError(err.Error())
+	}
+	if !isIdentifier(name) {
+		return usageError(fmt.Sprintf("%q is not a valid Go identifier", name))
+	}
+	name = string(unicode.ToUpper(rune(name[0]))) + name[1:]
+	data := generated{Package: packageName(*dir)}
+	var (
+		tmpl *template.Template
+		file string
+	)
+	switch kind {
+	case "controller":
+		resource := strings.TrimSuffix(name, "Controller")
+		if resource == "" {
+			return usageError("the name of a controller is the name of its resource")
+		}
+		words := splitWords(resource)
+		tmpl, file = controllerTemplate, strings.Join(words, "_")+"_controller.go"
+		data.Type = resource + "Controller"
+		data.Resource = strings.Join(words, " ")
+		data.Path = strings.Join(words, "-")
+		data.Route = strings.Join(words, "_")
+	case "middleware":
+		tmpl, file = middlewareTemplate, strings.Join(splitWords(name), "_")+".go"
+		data.Type = name
+	default:
+		return usageError(fmt.Sprintf("unknown kind %q, expected controller or middleware", kind))
+	}
+	source, err := generate(tmpl, data)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(*dir, file)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err := os.WriteFile(path, source, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "created %s\n", path)
+	return nil
+}
+
+// generate executes tmpl with data and formats the generated source
+func generate(tmpl *template.Template, data generated) ([]byte, error) {
+	source := &bytes.Buffer{}
+	if err := tmpl.Execute(source, data); err != nil {
+		return nil, err
+	}
+	return format.Source(source.Bytes())
+}
+
+// packageName returns the package of the Go files of dir, or a package named after dir if it has none
+func packageName(dir string) string {
+	packages, err := parser.ParseDir(token.NewFileSet(), dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.PackageClauseOnly)
+	if err == nil {
+		for name := range packages {
+			return name
+		}
+	}
+	absolute, err := filepath.Abs(dir)
+	if err != nil {
+		return "main"
+	}
+	name := strings.Join(splitWords(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, filepath.Base(absolute))), "")
+	if !isIdentifier(name) {
+		return "main"
+	}
+	return name
+}
+
+// splitWords splits a CamelCase or space separated name into lower case words:
+// "BlogPosts" and "HTTPClient" give ["blog", "posts"] and ["http", "client"]
+func splitWords(name string) []string {
+	words, runes := []string{}, []rune(name)
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		boundary := i == len(runes) || runes[i] == ' ' ||
+			(unicode.IsUpper(runes[i]) && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))))
+		if !boundary {
+			continue
+		}
+		if word := strings.TrimSpace(string(runes[start:i])); word != "" {
+			words = append(words, strings.ToLower(word))
+		}
+		start = i
+	}
+	return words
+}
+
+// isIdentifier returns true if name is a valid Go identifier
+func isIdentifier(name string) bool {
+	if name == "" || token.IsKeyword(name) {
+		return false
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
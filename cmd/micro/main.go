@@ -0,0 +1,69 @@
+// Command micro is the command line tool of Micro applications.
+//
+// Usage:
+//
+//	micro routes [-url url] [package]
+//	micro new controller Name [-dir directory]
+//	micro new middleware Name [-dir directory]
+//
+// The routes command prints the route table of an application. Without -url, the package,
+// the current directory by default, is run with the MICRO_ROUTES environment variable set,
+// which makes Micro.Boot write the route table and exit before boot hooks are executed.
+// With -url, the route table is read from an endpoint serving Micro.ServeRouteTable.
+//
+// The new command generates a controller or a middleware in a new file of the directory,
+// the current directory by default.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage:
+
+	micro routes [-url url] [package]
+	micro new controller Name [-dir directory]
+	micro new middleware Name [-dir directory]
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command of args and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "routes":
+		err = routesCommand(args[1:], stdout, stderr)
+	case "new":
+		err = newCommand(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		err = usageError(fmt.Sprintf("unknown command %q", args[0]))
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "micro: %v\n", err)
+		if _, ok := err.(usageError); ok {
+			fmt.Fprint(stderr, usage)
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// usageError is an error in the arguments of a command
+type usageError string
+
+func (err usageError) Error() string {
+	return string(err)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/interactiv/micro"
+)
+
+func TestSplitWords(t *testing.T) {
+	for name, expected := range map[string][]string{
+		"Users":      {"users"},
+		"BlogPosts":  {"blog", "posts"},
+		"HTTPClient": {"http", "client"},
+		"userID":     {"user", "id"},
+		"my app":     {"my", "app"},
+	} {
+		if words := splitWords(name); !reflect.DeepEqual(words, expected) {
+			t.Errorf("splitWords(%q) = %v, expected %v", name, words, expected)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.go"), []byte("package blog\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		args     []string
+		file     string
+		contains []string
+	}{
+		{[]string{"new", "controller", "BlogPosts", "-dir", dir}, "blog_posts_controller.go", []string{
+			"package blog", "type BlogPostsController struct{}", `app.Mount("/blog-posts"`, `SetName("blog_posts.show")`,
+		}},
+		{[]string{"new", "middleware", "requestTimer", "-dir", dir}, "request_timer.go", []string{
+			"package blog", "func RequestTimer() micro.HandlerFunction", "next()",
+		}},
+	} {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		if code := run(test.args, stdout, stderr); code != 0 {
+			t.Fatalf("%v exited with %d : %s", test.args, code, stderr)
+		}
+		path := filepath.Join(dir, test.file)
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), path, source, 0); err != nil {
+			t.Errorf("%s is not valid Go : %v", test.file, err)
+		}
+		for _, expected := range test.contains {
+			if !strings.Contains(string(source), expected) {
+				t.Errorf("%s does not contain %q", test.file, expected)
+			}
+		}
+		if code := run(test.args, stdout, stderr); code != 1 {
+			t.Errorf("generating %s twice exited with %d, expected 1", test.file, code)
+		}
+	}
+	if code := run([]string{"new", "controller", "func"}, &bytes.Buffer{}, &bytes.Buffer{}); code != 2 {
+		t.Errorf("an invalid name exited with %d, expected 2", code)
+	}
+	if name := packageName(filepath.Join(dir, "missing-dir")); name != "missingdir" {
+		t.Errorf("packageName of an empty directory = %q, expected missingdir", name)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	app := micro.New()
+	app.Get("/users/:id", func(ctx *micro.Context) {}).SetName("users.show")
+	app.Get("/debug/routes", app.ServeRouteTable)
+	server := httptest.NewServer(app)
+	defer server.Close()
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if code := run([]string{"routes", "-url", server.URL + "/debug/routes"}, stdout, stderr); code != 0 {
+		t.Fatalf("routes exited with %d : %s", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "METHODS   PATH") {
+		t.Fatalf("unexpected route table :\n%s", stdout)
+	}
+	if fields := strings.Fields(lines[1]); fields[0] != "GET,HEAD" || fields[1] != "/users/:id" || fields[2] != "users.show" {
+		t.Errorf("unexpected route %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); fields[1] != "/debug/routes" || !strings.Contains(fields[3], "ServeRouteTable") {
+		t.Errorf("unexpected route %q", lines[2])
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/interactiv/micro"
+)
+
+// routesCommand prints the route table of an application
+func routesCommand(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("routes", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	url := flags.String("url", "", "URL of an endpoint serving the route table")
+	if err := flags.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	var (
+		table []micro.RouteInfo
+		err   error
+	)
+	switch {
+	case *url != "" && flags.NArg() > 0:
+		return usageError("routes takes either -url or a package")
+	case *url != "":
+		table, err = fetchRouteTable(*url)
+	default:
+		pkg := "."
+		if flags.NArg() > 0 {
+			pkg = flags.Arg(0)
+		}
+		table, err = runRouteTable(pkg, stderr)
+	}
+	if err != nil {
+		return err
+	}
+	return micro.PrintRouteTable(stdout, table)
+}
+
+// fetchRouteTable reads the route table served at url
+func fetchRouteTable(url string) ([]micro.RouteInfo, error) {
+	response, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s : %s", url, response.Status)
+	}
+	table := []micro.RouteInfo{}
+	if err := json.NewDecoder(response.Body).Decode(&table); err != nil {
+		return nil, fmt.Errorf("GET %s : invalid route table : %w", url, err)
+	}
+	return table, nil
+}
+
+// runRouteTable runs the application of pkg with micro.RoutesEnv set and reads the route table it writes
+func runRouteTable(pkg string, stderr io.Writer) ([]micro.RouteInfo, error) {
+	output := &bytes.Buffer{}
+	command := exec.Command("go", "run", pkg)
+	command.Env = append(os.Environ(), micro.RoutesEnv+"=1")
+	command.Stdout, command.Stderr = output, stderr
+	if err := command.Run(); err != nil {
+		return nil, fmt.Errorf("go run %s : %w", pkg, err)
+	}
+	// the route table is the last line, the application may print before booting
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	table := []micro.RouteInfo{}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &table); err != nil {
+		return nil, fmt.Errorf("go run %s : the application did not write its route table, is it booted ?", pkg)
+	}
+	return table, nil
+}
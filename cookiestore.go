@@ -0,0 +1,130 @@
+package micro
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+/**********************************/
+/*          COOKIE STORE          */
+/**********************************/
+
+// DefaultCookieStoreMaxLength is the maximum length of the cookie values of cookie stores without a maximum length,
+// browsers limit cookies to about 4096 bytes including their name and attributes
+var DefaultCookieStoreMaxLength = 3800
+
+// cookieStoreData is authenticated with the session as additional data, so a value encrypted for
+// another purpose with the same key is not accepted as a session
+var cookieStoreData = []byte("micro session")
+
+// CookieStore is a stateless SessionStore keeping the sessions in the cookies of the clients,
+// encrypted and authenticated with AES-GCM, so they can be neither read nor modified by clients.
+// Sessions cannot be deleted before they expire: a client keeping a copy of its cookie can restore it.
+type CookieStore struct {
+	// MaxLength is the maximum length of the cookie values, DefaultCookieStoreMaxLength if zero
+	MaxLength int
+	aeads     []cipher.AEAD
+}
+
+// NewCookieStore creates a cookie store encrypting sessions with the first key, and decrypting them
+// with any key. Keys are rotated by adding a new key first and removing the oldest key once
+// the sessions it encrypted have expired:
+//
+//	store := micro.NewCookieStore(newKey, currentKey)
+//
+// Keys are 16, 24 or 32 random bytes, selecting AES-128, AES-192 or AES-256.
+//
+// Can Panic! if there is no key or a key has an invalid length
+func NewCookieStore(keys ...[]byte) *CookieStore {
+	if len(keys) == 0 {
+		panic("a cookie store requires a key")
+	}
+	store := &CookieStore{}
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			panic(fmt.Sprint("invalid cookie store key : ", err))
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			panic(fmt.Sprint("invalid cookie store key : ", err))
+		}
+		store.aeads = append(store.aeads, aead)
+	}
+	return store
+}
+
+// cookieSession is the encrypted representation of a session
+type cookieSession struct {
+	ID        string            `json:"id"`
+	Values    map[string]string `json:"values"`
+	UserID    string            `json:"user_id,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Load decrypts the session of value with the keys of the store
+func (store *CookieStore) Load(ctx context.Context, value string) (*Session, error) {
+	if len(value) > store.maxLength() {
+		return nil, ErrSessionTampered
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrSessionTampered
+	}
+	for _, aead := range store.aeads {
+		if len(sealed) < aead.NonceSize() {
+			return nil, ErrSessionTampered
+		}
+		payload, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], cookieStoreData)
+		if err != nil {
+			continue
+		}
+		decoded := cookieSession{}
+		if err := json.Unmarshal(payload, &decoded); err != nil {
+			return nil, ErrSessionTampered
+		}
+		if time.Now().After(decoded.ExpiresAt) {
+			return nil, ErrSessionNotFound
+		}
+		return &Session{ID: decoded.ID, Values: decoded.Values, UserID: decoded.UserID, ExpiresAt: decoded.ExpiresAt}, nil
+	}
+	return nil, ErrSessionTampered
+}
+
+// Save encrypts session with the first key of the store,
+// it returns ErrSessionTooLarge if the encrypted session exceeds the maximum length of the store
+func (store *CookieStore) Save(ctx context.Context, session *Session) (string, error) {
+	payload, err := json.Marshal(cookieSession{ID: session.ID, Values: session.Values, UserID: session.UserID, ExpiresAt: session.ExpiresAt})
+	if err != nil {
+		return "", err
+	}
+	aead := store.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(payload)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	value := base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, payload, cookieStoreData))
+	if len(value) > store.maxLength() {
+		return "", fmt.Errorf("%w : %d bytes encrypted, the maximum is %d", ErrSessionTooLarge, len(value), store.maxLength())
+	}
+	return value, nil
+}
+
+// Delete does nothing, the Sessions middleware deletes the cookie of the client
+func (store *CookieStore) Delete(ctx context.Context, session *Session) error {
+	return nil
+}
+
+// maxLength returns the maximum length of the cookie values
+func (store *CookieStore) maxLength() int {
+	if store.MaxLength > 0 {
+		return store.MaxLength
+	}
+	return DefaultCookieStoreMaxLength
+}
@@ -0,0 +1,253 @@
+package micro
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+/**********************************/
+/*    CONTENT SECURITY POLICY     */
+/**********************************/
+
+// CSPNonceVar is the Context.Vars key under which the CSP middleware stores the nonce of the request,
+// TemplateRenderer exposes it to templates as .CSPNonce:
+//
+//	<script nonce="{{.CSPNonce}}">...</script>
+const CSPNonceVar = "csp_nonce"
+
+// CSPSource is a source of a Content Security Policy directive, a keyword or a host, scheme or URL
+// such as "https://cdn.example.com" or "data:"
+type CSPSource string
+
+// Keyword sources
+const (
+	CSPSelf           CSPSource = "'self'"
+	CSPNone           CSPSource = "'none'"
+	CSPUnsafeInline   CSPSource = "'unsafe-inline'"
+	CSPUnsafeEval     CSPSource = "'unsafe-eval'"
+	CSPStrictDynamic  CSPSource = "'strict-dynamic'"
+	CSPReportSample   CSPSource = "'report-sample'"
+	CSPWasmUnsafeEval CSPSource = "'wasm-unsafe-eval'"
+)
+
+// cspKeywords are the keywords which must be quoted, a common mistake
+var cspKeywords = map[string]bool{
+	"self": true, "none": true, "unsafe-inline": true, "unsafe-eval": true, "strict-dynamic": true,
+	"report-sample": true, "wasm-unsafe-eval": true, "unsafe-hashes": true,
+}
+
+// cspDirective is a directive of a policy
+type cspDirective struct {
+	name    string
+	sources []CSPSource
+	// nonce is true if the nonce of the request is added to the sources
+	nonce bool
+}
+
+// CSP builds a Content Security Policy and serves it with a middleware:
+//
+//	policy := micro.NewCSP().
+//		DefaultSrc(micro.CSPSelf).
+//		ScriptSrc(micro.CSPSelf, "https://cdn.example.com").ScriptNonce().
+//		ImgSrc(micro.CSPSelf, "data:").
+//		ObjectSrc(micro.CSPNone).
+//		ReportTo("csp", "https://example.com/csp-reports")
+//	app.Use("/", policy.Middleware())
+//
+// Policies are built before the application serves requests.
+type CSP struct {
+	directives []*cspDirective
+	reportOnly bool
+	// reportGroup and reportEndpoint are the Reporting API endpoint of the reports
+	reportGroup    string
+	reportEndpoint string
+}
+
+// NewCSP creates an empty policy
+func NewCSP() *CSP {
+	return &CSP{}
+}
+
+// DefaultSrc sets the default-src directive, the sources of the fetch directives not set
+func (csp *CSP) DefaultSrc(sources ...CSPSource) *CSP {
+	return csp.Directive("default-src", sources...)
+}
+
+// ScriptSrc sets the script-src directive
+func (csp *CSP) ScriptSrc(sources ...CSPSource) *CSP {
+	return csp.Directive("script-src", sources...)
+}
+
+// StyleSrc sets the style-src directive
+func (csp *CSP) StyleSrc(sources ...CSPSource) *CSP {
+	return csp.Directive("style-src", sources...)
+}
+
+// ImgSrc sets the img-src directive
+func (csp *CSP) ImgSrc(sources ...CSPSource) *CSP {
+	return csp.Directive("img-src", sources...)
+}
+
+// ConnectSrc sets the connect-src directive, the URLs scripts can fetch and connect to
+func (csp *CSP) ConnectSrc(sources ...CSPSource) *CSP {
+	return csp.Directive("connect-src", sources...)
+}
+
+// FontSrc sets the font-src directive
+func (csp *CSP) FontSrc(sources ...CSPSource) *CSP {
+	return csp.Directive("font-src", sources...)
+}
+
+// MediaSrc sets the media-src directive
+func (csp *CSP) MediaSrc(sources ...CSPSource) *CSP {
+	return csp.Directive("media-src", sources...)
+}
+
+// ObjectSrc sets the object-src directive
+func (csp *CSP) ObjectSrc(sources ...CSPSource) *CSP {
+	return csp.Directive("object-src", sources...)
+}
+
+// FrameSrc sets the frame-src directive
+func (csp *CSP) FrameSrc(sources ...CSPSource) *CSP {
+	return csp.Directive("frame-src", sources...)
+}
+
+// WorkerSrc sets the worker-src directive
+func (csp *CSP) WorkerSrc(sources ...CSPSource) *CSP {
+	return csp.Directive("worker-src", sources...)
+}
+
+// FrameAncestors sets the frame-ancestors directive, the pages which can embed the responses
+func (csp *CSP) FrameAncestors(sources ...CSPSource) *CSP {
+	return csp.Directive("frame-ancestors", sources...)
+}
+
+// BaseURI sets the base-uri directive
+func (csp *CSP) BaseURI(sources ...CSPSource) *CSP {
+	return csp.Directive("base-uri", sources...)
+}
+
+// FormAction sets the form-action directive
+func (csp *CSP) FormAction(sources ...CSPSource) *CSP {
+	return csp.Directive("form-action", sources...)
+}
+
+// UpgradeInsecureRequests adds the upgrade-insecure-requests directive
+func (csp *CSP) UpgradeInsecureRequests() *CSP {
+	return csp.Directive("upgrade-insecure-requests")
+}
+
+// ScriptNonce adds the nonce of each request to the script-src directive
+func (csp *CSP) ScriptNonce() *CSP {
+	csp.directive("script-src").nonce = true
+	return csp
+}
+
+// StyleNonce adds the nonce of each request to the style-src directive
+func (csp *CSP) StyleNonce() *CSP {
+	csp.directive("style-src").nonce = true
+	return csp
+}
+
+// Directive sets the sources of the directive name, replacing the sources previously set.
+//
+// Can Panic! if a source contains a separator or is an unquoted keyword such as self
+func (csp *CSP) Directive(name string, sources ...CSPSource) *CSP {
+	for _, source := range sources {
+		if strings.ContainsAny(string(source), ";, \t\r\n") {
+			panic(fmt.Sprintf("invalid CSP source %q in %s", source, name))
+		}
+		if cspKeywords[string(source)] {
+			panic(fmt.Sprintf("CSP keyword %q in %s must be quoted, such as micro.CSPSelf", source, name))
+		}
+	}
+	csp.directive(name).sources = sources
+	return csp
+}
+
+// ReportURI adds the report-uri directive, the URL violations are posted to by browsers
+// which do not support ReportTo
+func (csp *CSP) ReportURI(uri string) *CSP {
+	return csp.Directive("report-uri", CSPSource(uri))
+}
+
+// ReportTo adds the report-to directive reporting violations to endpoint,
+// declared in the Reporting-Endpoints header under the name group
+func (csp *CSP) ReportTo(group string, endpoint string) *CSP {
+	csp.reportGroup, csp.reportEndpoint = group, endpoint
+	return csp.Directive("report-to", CSPSource(group))
+}
+
+// ReportOnly sends the policy in the Content-Security-Policy-Report-Only header,
+// so violations are reported without being blocked
+func (csp *CSP) ReportOnly() *CSP {
+	csp.reportOnly = true
+	return csp
+}
+
+// directive returns the directive name, added to the policy if it has not been set
+func (csp *CSP) directive(name string) *cspDirective {
+	for _, directive := range csp.directives {
+		if directive.name == name {
+			return directive
+		}
+	}
+	directive := &cspDirective{name: name}
+	csp.directives = append(csp.directives, directive)
+	return directive
+}
+
+// usesNonce returns true if a directive of the policy has the nonce of the request
+func (csp *CSP) usesNonce() bool {
+	for _, directive := range csp.directives {
+		if directive.nonce {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy returns the policy with nonce, which is ignored if no directive uses a nonce
+func (csp *CSP) Policy(nonce string) string {
+	directives := make([]string, 0, len(csp.directives))
+	for _, directive := range csp.directives {
+		parts := []string{directive.name}
+		for _, source := range directive.sources {
+			parts = append(parts, string(source))
+		}
+		if directive.nonce && nonce != "" {
+			parts = append(parts, "'nonce-"+nonce+"'")
+		}
+		directives = append(directives, strings.Join(parts, " "))
+	}
+	return strings.Join(directives, "; ")
+}
+
+// Middleware returns a middleware setting the policy header of the responses.
+// If the policy uses nonces, a nonce is generated for each request and stored under CSPNonceVar.
+func (csp *CSP) Middleware() HandlerFunction {
+	header := "Content-Security-Policy"
+	if csp.reportOnly {
+		header = "Content-Security-Policy-Report-Only"
+	}
+	usesNonce := csp.usesNonce()
+	static := csp.Policy("")
+	return func(ctx *Context, next Next) {
+		policy := static
+		if usesNonce {
+			nonce := make([]byte, 16)
+			rand.Read(nonce)
+			encoded := base64.RawURLEncoding.EncodeToString(nonce)
+			SetVar(ctx, CSPNonceVar, encoded)
+			policy = csp.Policy(encoded)
+		}
+		ctx.Response.Header().Set(header, policy)
+		if csp.reportGroup != "" {
+			ctx.Response.Header().Add("Reporting-Endpoints", fmt.Sprintf("%s=%q", csp.reportGroup, csp.reportEndpoint))
+		}
+		next()
+	}
+}
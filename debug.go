@@ -0,0 +1,104 @@
+package micro
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+)
+
+/**********************************/
+/*           DEBUG PAGE           */
+/**********************************/
+
+// debugPage is the HTML page written on panics in debug mode
+var debugPage = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>500 {{.Error}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { background: #f4f4f4; padding: 1em; overflow: auto; }
+th { text-align: left; padding-right: 1em; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>500 Internal Server Error</h1>
+<h2>{{.Error}}</h2>
+<pre>{{.Stack}}</pre>
+<h2>Request</h2>
+<table>
+<tr><th>Method</th><td>{{.Request.Method}}</td></tr>
+<tr><th>URL</th><td>{{.Request.URL}}</td></tr>
+<tr><th>Protocol</th><td>{{.Request.Proto}}</td></tr>
+<tr><th>Remote address</th><td>{{.Request.RemoteAddr}}</td></tr>
+{{range $name, $values := .Request.Header}}<tr><th>{{$name}}</th><td>{{range $values}}{{.}} {{end}}</td></tr>
+{{end}}</table>
+<h2>Route</h2>
+{{with .Route}}<table>
+<tr><th>Name</th><td>{{.Name}}</td></tr>
+<tr><th>Path</th><td>{{.Path}}</td></tr>
+<tr><th>Methods</th><td>{{range .Methods}}{{.}} {{end}}</td></tr>
+{{range $name, $value := .Params}}<tr><th>:{{$name}}</th><td>{{$value}}</td></tr>
+{{end}}</table>{{else}}<p>No route matched the request.</p>{{end}}
+<h2>Injector</h2>
+{{range .Injectors}}<ul>
+{{range .}}<li>{{.}}</li>
+{{end}}</ul>{{end}}
+</body>
+</html>
+`))
+
+// debugRoute describes the route of the debug page
+type debugRoute struct {
+	Name, Path string
+	Methods    []string
+	Params     map[string]string
+}
+
+// writeDebugPage writes the debug page of a panic with the recovered value and its stack trace,
+// the request, the matched route and the services of the injectors handling the request
+func (e *Micro) writeDebugPage(ctx *Context, rw *ResponseWriterWithCode, recovered interface{}, stack []byte) {
+	data := struct {
+		Error     string
+		Stack     string
+		Request   *http.Request
+		Route     *debugRoute
+		Injectors [][]string
+	}{
+		Error:   fmt.Sprint(recovered),
+		Stack:   string(stack),
+		Request: ctx.Request,
+	}
+	if route := ctx.Route(); route != nil {
+		data.Route = &debugRoute{Name: route.name, Path: route.path, Methods: route.methods, Params: ctx.RequestVars}
+	}
+	for injector := ctx.injector; injector != nil; injector = injector.Parent() {
+		data.Injectors = append(data.Injectors, injector.describe())
+	}
+	rw.Header().Set("Content-Type", MediaTypes["html"]+"; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusInternalServerError)
+	if err := debugPage.Execute(rw, data); err != nil {
+		e.Logger().Error("cannot write debug page", "error", err)
+	}
+}
+
+// describe returns the sorted descriptions of the services and providers of the injector
+func (i *Injector) describe() []string {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	descriptions := []string{}
+	for serviceType := range i.services {
+		descriptions = append(descriptions, serviceType.String())
+	}
+	for name, service := range i.named {
+		descriptions = append(descriptions, fmt.Sprintf("%s %T", name, service))
+	}
+	for serviceType, provider := range i.providers {
+		descriptions = append(descriptions, fmt.Sprintf("%v (%v provider)", serviceType, provider.lifetime))
+	}
+	sort.Strings(descriptions)
+	return descriptions
+}
@@ -0,0 +1,109 @@
+package micro
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+/**********************************/
+/*            DISPATCH            */
+/**********************************/
+
+var (
+	// responseWriterType is the type of http.ResponseWriter
+	responseWriterType = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+	// requestServiceTypes maps the types of the arguments handlers commonly have to the type
+	// of the service every request injector registers for them
+	requestServiceTypes = map[reflect.Type]reflect.Type{
+		reflect.TypeOf(&Context{}):                reflect.TypeOf(&Context{}),
+		reflect.TypeOf(&http.Request{}):           reflect.TypeOf(&http.Request{}),
+		contextType:                               contextType,
+		reflect.TypeOf(&ResponseWriterWithCode{}): reflect.TypeOf(&ResponseWriterWithCode{}),
+		responseWriterType:                        reflect.TypeOf(&ResponseWriterWithCode{}),
+		paramsType:                                paramsType,
+		reflect.TypeOf(Next(nil)):                 reflect.TypeOf(Next(nil)),
+		reflect.TypeOf(&Injector{}):               reflect.TypeOf(&Injector{}),
+		reflect.TypeOf(&EventEmitter{}):           reflect.TypeOf(&EventEmitter{}),
+	}
+)
+
+// handlerPlan is how the arguments of a route handler are filled, computed when the route is frozen.
+// Arguments every request injector has are taken from a slot of the request injector,
+// other arguments are resolved.
+type handlerPlan struct {
+	function reflect.Value
+	types    []reflect.Type
+	// slots are the types of the request services filling the arguments, nil for resolved arguments
+	slots []reflect.Type
+}
+
+// newHandlerPlan returns the plan of handler, nil if handler is not a function
+func newHandlerPlan(handler HandlerFunction) *handlerPlan {
+	function := reflect.ValueOf(handler)
+	if function.Kind() != reflect.Func || function.IsNil() {
+		return nil
+	}
+	plan := &handlerPlan{function: function, types: argumentTypes(function.Type())}
+	plan.slots = make([]reflect.Type, len(plan.types))
+	for j, argumentType := range plan.types {
+		plan.slots[j] = requestServiceTypes[argumentType]
+	}
+	return plan
+}
+
+// call calls the handler of the plan with the services of injector, a request injector.
+// Handlers with the signatures func(*Context), func(*Context) error
+// and func(http.ResponseWriter, *http.Request) are called without reflection.
+func (plan *handlerPlan) call(injector *Injector) ([]reflect.Value, error) {
+	switch handler := plan.function.Interface().(type) {
+	case func(*Context):
+		if ctx, ok := injector.services[plan.slots[0]].(*Context); ok {
+			handler(ctx)
+			return nil, nil
+		}
+	case func(*Context) error:
+		if ctx, ok := injector.services[plan.slots[0]].(*Context); ok {
+			err := handler(ctx)
+			return []reflect.Value{reflect.ValueOf(&err).Elem()}, nil
+		}
+	case func(http.ResponseWriter, *http.Request):
+		response, responseOk := injector.services[plan.slots[0]].(http.ResponseWriter)
+		request, requestOk := injector.services[plan.slots[1]].(*http.Request)
+		if responseOk && requestOk {
+			handler(response, request)
+			return nil, nil
+		}
+	}
+	arguments := make([]reflect.Value, len(plan.types))
+	for j, argumentType := range plan.types {
+		argument, ok := injector.services[plan.slots[j]]
+		if plan.slots[j] == nil || !ok {
+			service, err := injector.resolve(argumentType, injector, nil)
+			var resolutionError *ResolutionError
+			if errors.As(err, &resolutionError) {
+				if resolutionError.Function == "" {
+					resolutionError.Function = functionLocation(plan.function)
+				}
+				return nil, err
+			} else if err != nil {
+				return nil, &ResolutionError{Function: functionLocation(plan.function), Chain: []reflect.Type{argumentType}, Err: err}
+			}
+			argument = service
+		}
+		if argument == nil {
+			arguments[j] = reflect.Zero(argumentType)
+		} else {
+			arguments[j] = reflect.ValueOf(argument)
+		}
+	}
+	return plan.function.Call(arguments), nil
+}
+
+// callHandler calls the handler of route with the services of injector, a request injector
+func callHandler(injector *Injector, route *Route) ([]reflect.Value, error) {
+	if route.plan == nil {
+		return injector.Call(route.Handler())
+	}
+	return route.plan.call(injector)
+}
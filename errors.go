@@ -0,0 +1,250 @@
+package micro
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+/**********************************/
+/*             ERRORS             */
+/**********************************/
+
+// HTTPError is an error with a status code. Handlers can return it
+// to send a response through the error handler registered for Code:
+//
+//	app.Get("/users/:id", func(params micro.Params) error {
+//		return micro.NotFound("user not found")
+//	})
+//
+// Error handlers can have it injected, and serialize it as a consistent error envelope:
+//
+//	app.Error(http.StatusNotFound, func(ctx *micro.Context, err *micro.HTTPError) {
+//		ctx.Respond(err.Code, err)
+//	})
+type HTTPError struct {
+	// Code is the status code of the response
+	Code int `json:"code" xml:"code" msgpack:"code"`
+	// Message is the message sent to the client
+	Message string `json:"message" xml:"message" msgpack:"message"`
+	// Details is additional data sent to the client, such as validation errors
+	Details interface{} `json:"details,omitempty" xml:"details,omitempty" msgpack:"details,omitempty"`
+	// Internal is the cause of the error, it is logged but never sent to the client
+	Internal error `json:"-" xml:"-" msgpack:"-"`
+}
+
+// NewHTTPError returns an HTTPError, message defaults to the status text of code
+func NewHTTPError(code int, message string) *HTTPError {
+	if message == "" {
+		message = http.StatusText(code)
+	}
+	return &HTTPError{Code: code, Message: message}
+}
+
+func (err *HTTPError) Error() string {
+	if err.Internal != nil {
+		return fmt.Sprintf("%d %s : %v", err.Code, err.Message, err.Internal)
+	}
+	return fmt.Sprintf("%d %s", err.Code, err.Message)
+}
+
+// Unwrap returns the internal error
+func (err *HTTPError) Unwrap() error {
+	return err.Internal
+}
+
+// StatusCode returns the status code of the error
+func (err *HTTPError) StatusCode() int {
+	return err.Code
+}
+
+// WithInternal sets the internal error and returns the error
+func (err *HTTPError) WithInternal(internal error) *HTTPError {
+	err.Internal = internal
+	return err
+}
+
+// WithDetails sets the details and returns the error
+func (err *HTTPError) WithDetails(details interface{}) *HTTPError {
+	err.Details = details
+	return err
+}
+
+// BadRequest returns a 400 HTTPError, message defaults to the status text
+func BadRequest(message string) *HTTPError {
+	return NewHTTPError(http.StatusBadRequest, message)
+}
+
+// Unauthorized returns a 401 HTTPError, message defaults to the status text
+func Unauthorized(message string) *HTTPError {
+	return NewHTTPError(http.StatusUnauthorized, message)
+}
+
+// Forbidden returns a 403 HTTPError, message defaults to the status text
+func Forbidden(message string) *HTTPError {
+	return NewHTTPError(http.StatusForbidden, message)
+}
+
+// NotFound returns a 404 HTTPError, message defaults to the status text
+func NotFound(message string) *HTTPError {
+	return NewHTTPError(http.StatusNotFound, message)
+}
+
+// Conflict returns a 409 HTTPError, message defaults to the status text
+func Conflict(message string) *HTTPError {
+	return NewHTTPError(http.StatusConflict, message)
+}
+
+// UnprocessableEntity returns a 422 HTTPError, message defaults to the status text
+func UnprocessableEntity(message string) *HTTPError {
+	return NewHTTPError(http.StatusUnprocessableEntity, message)
+}
+
+// TooManyRequests returns a 429 HTTPError, message defaults to the status text
+func TooManyRequests(message string) *HTTPError {
+	return NewHTTPError(http.StatusTooManyRequests, message)
+}
+
+// InternalServerError returns a 500 HTTPError, message defaults to the status text
+func InternalServerError(message string) *HTTPError {
+	return NewHTTPError(http.StatusInternalServerError, message)
+}
+
+// ServiceUnavailable returns a 503 HTTPError, message defaults to the status text
+func ServiceUnavailable(message string) *HTTPError {
+	return NewHTTPError(http.StatusServiceUnavailable, message)
+}
+
+// CaughtError is the error being handled by an error handler, which can have it injected,
+// as *CaughtError or as error, to log the cause of the error and give clients a reference to it:
+//
+//	app.Error(http.StatusInternalServerError, func(ctx *micro.Context, caught *micro.CaughtError) {
+//		logger.Error("internal error", "error", caught.Err, "reference", caught.Reference)
+//		ctx.WriteString("something went wrong, reference ", caught.Reference)
+//	})
+type CaughtError struct {
+	// HTTPError is the error sent to the client
+	HTTPError *HTTPError
+	// Err is the error that caused the response, returned by a handler or recovered from a panic, if any
+	Err error
+	// Recovered is the value recovered from a panic, if any
+	Recovered interface{}
+	// Stack is the stack trace of the panic, if any
+	Stack []byte
+	// Reference is a random identifier of the error, logged with it
+	Reference string
+}
+
+func (caught *CaughtError) Error() string {
+	if caught.Err != nil {
+		return caught.Err.Error()
+	}
+	return caught.HTTPError.Error()
+}
+
+// Unwrap returns the error that caused the response
+func (caught *CaughtError) Unwrap() error {
+	return caught.Err
+}
+
+// newCaughtError returns the caught error of httpError caused by err with a new reference
+func newCaughtError(httpError *HTTPError, err error) *CaughtError {
+	return &CaughtError{HTTPError: httpError, Err: err, Reference: newErrorReference()}
+}
+
+// newCaughtErrorFrom returns the caught error of a response with code and message caused by err,
+// the HTTPError is err if it is one
+func newCaughtErrorFrom(code int, message string, err error) *CaughtError {
+	var httpError *HTTPError
+	if !errors.As(err, &httpError) {
+		httpError = &HTTPError{Code: code, Message: message, Internal: err}
+	}
+	return newCaughtError(httpError, err)
+}
+
+// newErrorReference returns a random error reference
+func newErrorReference() string {
+	reference := make([]byte, 8)
+	rand.Read(reference)
+	return hex.EncodeToString(reference)
+}
+
+// ErrorRenderer renders the response of errors that have no error handler
+type ErrorRenderer interface {
+	RenderError(ctx *Context, err *HTTPError) error
+}
+
+// ErrorRendererFunc is a function implementing ErrorRenderer
+type ErrorRendererFunc func(ctx *Context, err *HTTPError) error
+
+// RenderError calls renderer
+func (renderer ErrorRendererFunc) RenderError(ctx *Context, err *HTTPError) error {
+	return renderer(ctx, err)
+}
+
+// DefaultErrorRenderer is the error renderer of new applications. It negotiates the format
+// of the response with the Accept header: browsers get an HTML page, API clients a JSON document,
+// a problem details document if problem details are enabled, and other clients plain text.
+var DefaultErrorRenderer ErrorRenderer = ErrorRendererFunc(renderError)
+
+// errorPage is the HTML page written by DefaultErrorRenderer
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Code}} {{.Title}}</title></head>
+<body>
+<h1>{{.Code}} {{.Title}}</h1>
+{{if ne .Message .Title}}<p>{{.Message}}</p>{{end}}
+</body>
+</html>
+`))
+
+// renderError renders err in the format negotiated with the client
+func renderError(ctx *Context, err *HTTPError) error {
+	formats := []string{"text", "html", "json"}
+	problemDetails := ctx.app != nil && ctx.app.problemDetails
+	if problemDetails {
+		formats = []string{"problem", "json", "html", "text"}
+	}
+	switch ctx.Negotiate(formats...) {
+	case "problem", "json":
+		if problemDetails {
+			ProblemDetailsErrorHandler(ctx, err)
+			return nil
+		}
+		ctx.Response.Header().Set("Content-Type", MediaTypes["json"])
+		ctx.Response.WriteHeader(err.Code)
+		return ctx.encodeJSON(err)
+	case "html":
+		ctx.Response.Header().Set("Content-Type", MediaTypes["html"]+"; charset=utf-8")
+		ctx.Response.WriteHeader(err.Code)
+		return errorPage.Execute(ctx.Response, struct {
+			Code           int
+			Title, Message string
+		}{err.Code, http.StatusText(err.Code), err.Message})
+	}
+	http.Error(ctx.Response, err.Message, err.Code)
+	return nil
+}
+
+// SetErrorRenderer sets the renderer of errors that have no error handler, class handler
+// or default handler. Errors are written as plain text if renderer is nil.
+func (e *Micro) SetErrorRenderer(renderer ErrorRenderer) {
+	e.errorRenderer = renderer
+}
+
+// ErrorRenderer returns the error renderer of the application
+func (e *Micro) ErrorRenderer() ErrorRenderer {
+	return e.errorRenderer
+}
+
+// errorRendererHandler returns the error handler calling renderer
+func errorRendererHandler(renderer ErrorRenderer) HandlerFunction {
+	return func(ctx *Context, err *HTTPError) {
+		if renderErr := renderer.RenderError(ctx, err); renderErr != nil {
+			ctx.logger().Error("cannot render error", "error", renderErr)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package micro
+
+/**********************************/
+/*          TYPED EVENTS          */
+/**********************************/
+
+// Request lifecycle events, emitted by the application EventEmitter with the request Context:
+//
+//	micro.Subscribe(app.EventEmitter, micro.RequestFinished, func(ctx *micro.Context) bool {
+//		requestDuration.Observe(time.Since(start(ctx)))
+//		return true
+//	})
+var (
+	// RequestReceived is emitted before routes are matched
+	RequestReceived = NewEvent[*Context]("request.received")
+	// RouteMatched is emitted before the handler of each matched route is called,
+	// Context.Route returns the route, which is also given as the second argument
+	RouteMatched = NewEvent[*Context]("route.matched")
+	// ResponseWritten is emitted just before the status code and headers of the response are written,
+	// listeners can still set headers
+	ResponseWritten = NewEvent[*Context]("response.written")
+	// RequestFinished is emitted once the request is handled
+	RequestFinished = NewEvent[*Context]("request.finished")
+	// RequestPanic is emitted when a handler panics, the recovered value is the second argument
+	RequestPanic = NewEvent[*Context]("request.panic")
+)
+
+// ErrorEvent is the payload of ErrorClient and ErrorServer
+type ErrorEvent struct {
+	Context *Context
+	// Code is the status code of the response
+	Code int
+	// Route is the name of the route being handled, empty if no route matched or if it has no name
+	Route string
+	// Err is the error returned by the handler or recovered from a panic,
+	// nil when the error was signaled by a status code
+	Err error
+}
+
+var (
+	// ErrorClient is emitted when the error handler of a 4xx status code is called
+	ErrorClient = NewEvent[*ErrorEvent]("error.client")
+	// ErrorServer is emitted when the error handler of a 5xx status code is called
+	ErrorServer = NewEvent[*ErrorEvent]("error.server")
+)
+
+// ListenerPanicEvent is the payload of ListenerPanic
+type ListenerPanicEvent struct {
+	// Event is the event whose listener panicked
+	Event string
+	// Recovered is the value recovered from the panic
+	Recovered interface{}
+	// Stack is the stack trace of the panic
+	Stack []byte
+}
+
+// ListenerPanic is emitted when a listener panics, the emission goes on with the next listeners
+var ListenerPanic = NewEvent[*ListenerPanicEvent]("event.listener.panic")
+
+// emitError emits ErrorClient or ErrorServer
+func (e *Micro) emitError(ctx *Context, code int, err error) {
+	event := ErrorClient
+	if code >= 500 {
+		event = ErrorServer
+	}
+	if !e.HasListener(event.Name) {
+		return
+	}
+	errorEvent := &ErrorEvent{Context: ctx, Code: code, Err: err}
+	if ctx.route != nil {
+		errorEvent.Route = ctx.route.Name()
+	}
+	Publish(e.EventEmitter, event, errorEvent)
+}
+
+// Event is an event whose listeners receive a payload of type T:
+//
+//	var UserCreated = micro.NewEvent[*User]("user.created")
+//
+//	micro.Subscribe(app.EventEmitter, UserCreated, func(user *User) bool {
+//		return sendWelcomeEmail(user) == nil
+//	})
+//	micro.Publish(app.EventEmitter, UserCreated, user)
+type Event[T any] struct {
+	// Name is the name the event is emitted with
+	Name string
+}
+
+// NewEvent returns an event named name
+func NewEvent[T any](name string) Event[T] {
+	return Event[T]{Name: name}
+}
+
+// Subscribe adds a listener of event, the listener returns false to stop the propagation of the event.
+// Emissions of the event name with a payload that is not a T are ignored.
+func Subscribe[T any](em *EventEmitter, event Event[T], listener func(payload T) bool, priority ...int) *Subscription {
+	return em.On(event.Name, func(name string, arguments ...interface{}) bool {
+		if len(arguments) == 0 {
+			return true
+		}
+		payload, ok := arguments[0].(T)
+		if !ok {
+			return true
+		}
+		return listener(payload)
+	}, priority...)
+}
+
+// Publish emits event with payload
+func Publish[T any](em *EventEmitter, event Event[T], payload T) {
+	em.Emit(event.Name, payload)
+}
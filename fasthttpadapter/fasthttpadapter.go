@@ -0,0 +1,173 @@
+//go:build adapters
+
+// Package fasthttpadapter serves micro applications with fasthttp,
+// for high-throughput internal services where the allocations of net/http are the bottleneck.
+//
+//	app := micro.New()
+//	log.Fatal(fasthttpadapter.Run(app, ":8080"))
+//
+// Requests are dispatched to the routes of the application through a net/http view of the fasthttp request,
+// so handlers, middlewares, the injector and the Context work unchanged. The views are pooled and responses
+// are written directly to the fasthttp response, in the goroutine of the request.
+// Streaming responses, server-sent events and websockets are not supported, and like fasthttp requests,
+// requests and responses must not be used once their handler returns.
+package fasthttpadapter
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/interactiv/micro"
+	"github.com/valyala/fasthttp"
+)
+
+/**********************************/
+/*            FASTHTTP            */
+/**********************************/
+
+// Handler boots app and returns a fasthttp handler dispatching requests to its routes
+func Handler(app *micro.Micro) (fasthttp.RequestHandler, error) {
+	if err := app.Boot(); err != nil {
+		return nil, err
+	}
+	return func(ctx *fasthttp.RequestCtx) {
+		exchange := exchanges.Get().(*exchange)
+		app.ServeHTTP(&exchange.writer, exchange.open(ctx))
+		exchange.writer.WriteHeader(http.StatusOK)
+		exchange.close()
+		exchanges.Put(exchange)
+	}, nil
+}
+
+// exchanges are the pooled net/http views of fasthttp requests
+var exchanges = sync.Pool{
+	New: func() interface{} {
+		return &exchange{request: http.Request{Header: http.Header{}}, writer: responseWriter{header: http.Header{}}}
+	},
+}
+
+// exchange is the net/http view of a fasthttp request and its response
+type exchange struct {
+	request http.Request
+	url     url.URL
+	body    body
+	writer  responseWriter
+}
+
+// open returns the request of ctx, its response is written to ctx
+func (exchange *exchange) open(ctx *fasthttp.RequestCtx) *http.Request {
+	header := exchange.request.Header
+	exchange.url = url.URL{Path: string(ctx.Path()), RawQuery: string(ctx.QueryArgs().QueryString())}
+	exchange.request = http.Request{
+		Method:        string(ctx.Method()),
+		URL:           &exchange.url,
+		Proto:         string(ctx.Request.Header.Protocol()),
+		ProtoMajor:    1,
+		Header:        header,
+		ContentLength: int64(len(ctx.PostBody())),
+		Host:          string(ctx.Host()),
+		RemoteAddr:    ctx.RemoteAddr().String(),
+		RequestURI:    string(ctx.RequestURI()),
+		TLS:           ctx.TLSConnectionState(),
+		Body:          &exchange.body,
+	}
+	if ctx.Request.Header.IsHTTP11() {
+		exchange.request.ProtoMinor = 1
+	}
+	for key, value := range ctx.Request.Header.All() {
+		header[string(key)] = append(header[string(key)], string(value))
+	}
+	exchange.body.Reset(ctx.PostBody())
+	exchange.writer.ctx = ctx
+	return exchange.request.WithContext(ctx)
+}
+
+// close releases the fasthttp request and clears the exchange for the next one
+func (exchange *exchange) close() {
+	clear(exchange.request.Header)
+	exchange.request = http.Request{Header: exchange.request.Header}
+	clear(exchange.writer.header)
+	exchange.body.Reset(nil)
+	exchange.writer.ctx, exchange.writer.wroteHeader = nil, false
+}
+
+// body is the body of a request, read from the fasthttp request
+type body struct {
+	bytes.Reader
+}
+
+// Close does nothing, the fasthttp request owns the body
+func (body *body) Close() error {
+	return nil
+}
+
+// responseWriter writes responses to a fasthttp response
+type responseWriter struct {
+	ctx         *fasthttp.RequestCtx
+	header      http.Header
+	wroteHeader bool
+}
+
+// Header returns the headers written to the fasthttp response with the status code
+func (rw *responseWriter) Header() http.Header {
+	return rw.header
+}
+
+// WriteHeader writes the status code and the headers to the fasthttp response, once
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+	rw.ctx.SetStatusCode(code)
+	for key, values := range rw.header {
+		for _, value := range values {
+			rw.ctx.Response.Header.Add(key, value)
+		}
+	}
+}
+
+// Write writes b to the body of the fasthttp response, its content type is detected like net/http
+// if the headers are not written yet and have none
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader && rw.header.Get("Content-Type") == "" {
+		rw.header.Set("Content-Type", http.DetectContentType(b))
+	}
+	rw.WriteHeader(http.StatusOK)
+	return rw.ctx.Write(b)
+}
+
+// NewServer returns a fasthttp server serving app, shut down by app.Shutdown
+func NewServer(app *micro.Micro) (*fasthttp.Server, error) {
+	handler, err := Handler(app)
+	if err != nil {
+		return nil, err
+	}
+	server := &fasthttp.Server{Handler: handler, Name: "micro"}
+	app.OnShutdown(func(ctx context.Context) error {
+		return server.ShutdownWithContext(ctx)
+	})
+	return server, nil
+}
+
+// Run serves app with fasthttp on the TCP address addr, it returns when app is shut down
+func Run(app *micro.Micro, addr string) error {
+	server, err := NewServer(app)
+	if err != nil {
+		return err
+	}
+	return server.ListenAndServe(addr)
+}
+
+// Serve serves app with fasthttp on listener, it returns when app is shut down
+func Serve(app *micro.Micro, listener net.Listener) error {
+	server, err := NewServer(app)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
@@ -0,0 +1,97 @@
+//go:build adapters
+
+package fasthttpadapter_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/interactiv/expect"
+	"github.com/interactiv/micro"
+	"github.com/interactiv/micro/fasthttpadapter"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// newRequestCtx returns the context of a fasthttp request of method for uri
+func newRequestCtx(method string, uri string, body string) *fasthttp.RequestCtx {
+	request := &fasthttp.Request{}
+	request.Header.SetMethod(method)
+	request.SetRequestURI(uri)
+	request.SetBodyString(body)
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(request, nil, nil)
+	return ctx
+}
+
+func TestHandler(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/greet/:name", func(ctx *micro.Context) {
+		ctx.Response.Header().Set("X-Greeting", "hello")
+		ctx.WriteString("hello " + ctx.RequestVars["name"])
+	})
+	handler, err := fasthttpadapter.Handler(app)
+	e.Expect(err).ToBeNil()
+	e.Expect(app.Booted()).ToBeTrue()
+	ctx := newRequestCtx(http.MethodGet, "http://example.com/greet/john", "")
+	handler(ctx)
+	e.Expect(ctx.Response.StatusCode()).ToBe(http.StatusOK)
+	e.Expect(string(ctx.Response.Header.Peek("X-Greeting"))).ToBe("hello")
+	e.Expect(string(ctx.Response.Header.ContentType())).ToBe("text/plain; charset=utf-8")
+	e.Expect(string(ctx.Response.Body())).ToBe("hello john")
+}
+
+func TestHandlerRequest(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Post("/echo", func(ctx *micro.Context) {
+		body, _ := io.ReadAll(ctx.Request.Body)
+		ctx.Response.Header().Set("Content-Type", "application/json")
+		ctx.Response.WriteHeader(http.StatusCreated)
+		ctx.WriteString(ctx.Request.Host + " " + ctx.Request.URL.Query().Get("page") + " " + ctx.Request.Header.Get("X-Name") + " " + string(body))
+	})
+	handler, err := fasthttpadapter.Handler(app)
+	e.Expect(err).ToBeNil()
+	for _, name := range []string{"john", "jane"} {
+		ctx := newRequestCtx(http.MethodPost, "http://example.com/echo?page=2", `{"name":"`+name+`"}`)
+		ctx.Request.Header.Set("X-Name", name)
+		handler(ctx)
+		e.Expect(ctx.Response.StatusCode()).ToBe(http.StatusCreated)
+		e.Expect(string(ctx.Response.Header.ContentType())).ToBe("application/json")
+		e.Expect(string(ctx.Response.Body())).ToBe(`example.com 2 ` + name + ` {"name":"` + name + `"}`)
+	}
+	ctx := newRequestCtx(http.MethodGet, "http://example.com/missing", "")
+	handler(ctx)
+	e.Expect(ctx.Response.StatusCode()).ToBe(http.StatusNotFound)
+}
+
+// benchmark benchmarks handler serving a request with a route param
+func benchmark(b *testing.B, handler fasthttp.RequestHandler) {
+	ctx := newRequestCtx(http.MethodGet, "http://example.com/greet/john", "")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		ctx.Response.Reset()
+		handler(ctx)
+	}
+}
+
+// newGreetApp returns an application greeting the name of its route param
+func newGreetApp() *micro.Micro {
+	app := micro.New()
+	app.Get("/greet/:name", func(ctx *micro.Context) { ctx.WriteString("hello " + ctx.RequestVars["name"]) })
+	app.Boot()
+	return app
+}
+
+func BenchmarkHandler(b *testing.B) {
+	handler, _ := fasthttpadapter.Handler(newGreetApp())
+	benchmark(b, handler)
+}
+
+// BenchmarkAdaptor is the baseline of BenchmarkHandler, the fasthttpadaptor conversion of net/http handlers
+func BenchmarkAdaptor(b *testing.B) {
+	benchmark(b, fasthttpadaptor.NewFastHTTPHandler(newGreetApp()))
+}
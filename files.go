@@ -0,0 +1,188 @@
+package micro
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+/**********************************/
+/*             FILES              */
+/**********************************/
+
+// Attachment sends the file at path so that the client downloads it as downloadName.
+// The base name of path is used when downloadName is empty.
+func (ctx *Context) Attachment(path string, downloadName string) error {
+	if downloadName == "" {
+		downloadName = filepath.Base(path)
+	}
+	return ctx.sendFile(path, "attachment", downloadName)
+}
+
+// Inline sends the file at path so that the client displays it
+func (ctx *Context) Inline(path string) error {
+	return ctx.sendFile(path, "inline", filepath.Base(path))
+}
+
+// sendFile serves a file of the file system with the given content disposition
+func (ctx *Context) sendFile(path string, disposition string, filename string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	ctx.SetContentDisposition(disposition, filename)
+	return ctx.serveContent(file, filename)
+}
+
+// SendFile serves the file name of fsys.
+// Range requests and conditional requests (If-Modified-Since, If-None-Match...)
+// are handled by http.ServeContent, a weak ETag is generated from the file size and
+// modification time unless the ETag header is already set.
+func (ctx *Context) SendFile(fsys fs.FS, name string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return ctx.serveContent(file, path.Base(name))
+}
+
+// serveContent serves an opened file, the content type is detected from the extension of name
+// or by sniffing the content of the file.
+func (ctx *Context) serveContent(file fs.File, name string) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.IsDir() {
+		return fmt.Errorf("%s is a directory", name)
+	}
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+	if ctx.Response.Header().Get("ETag") == "" {
+		etag, err := contentETag(stat, content)
+		if err != nil {
+			return err
+		}
+		ctx.Response.Header().Set("ETag", etag)
+	}
+	http.ServeContent(ctx.Response, ctx.Request, name, stat.ModTime(), content)
+	return nil
+}
+
+// contentETag returns the weak entity tag of a file from its size and modification time,
+// or from a hash of content if it has no modification time, such as the files of an embed.FS
+func contentETag(stat fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !stat.ModTime().IsZero() {
+		return fmt.Sprintf(`W/"%x-%x"`, stat.Size(), stat.ModTime().UnixNano()), nil
+	}
+	hash := fnv.New64a()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`W/"%x-%x"`, stat.Size(), hash.Sum64()), nil
+}
+
+// Static serves the files of fsys under path, such as the assets embedded in the executable with go:embed:
+//
+//	//go:embed public
+//	var public embed.FS
+//
+//	assets, _ := fs.Sub(public, "public")
+//	app.Static("/assets", app.DebugFS(assets, "public"))
+//
+// Requests for directories are served the index.html file of the directory,
+// requests for files fsys does not have are answered with 404 Not Found.
+func (rc *ControllerCollection) Static(path string, fsys fs.FS) *Route {
+	path = strings.TrimSuffix(path, "/")
+	return rc.Get(path+"(|/.*)", func(ctx *Context) error {
+		params := ctx.Route().Params()
+		return ctx.sendStatic(fsys, ctx.RequestVars[params[len(params)-1]])
+	})
+}
+
+// SPA serves a single page application from fsys under path. The files of fsys are served like Static,
+// other requests without a file extension are served the file index, so the application handles its routes:
+//
+//	app.SPA("/", app.DebugFS(dist, "frontend/dist"), "index.html")
+func (rc *ControllerCollection) SPA(path string, fsys fs.FS, index string) *Route {
+	path = strings.TrimSuffix(path, "/")
+	return rc.Get(path+"(|/.*)", func(ctx *Context) error {
+		params := ctx.Route().Params()
+		name := ctx.RequestVars[params[len(params)-1]]
+		err := ctx.sendStatic(fsys, name)
+		var httpError *HTTPError
+		if errors.As(err, &httpError) && httpError.Code == http.StatusNotFound && filepath.Ext(name) == "" {
+			return ctx.SendFile(fsys, index)
+		}
+		return err
+	})
+}
+
+// sendStatic serves the file name of fsys, or the index.html file of the directory name
+func (ctx *Context) sendStatic(fsys fs.FS, name string) error {
+	name = strings.TrimPrefix(name, "/")
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	if !fs.ValidPath(name) {
+		return NotFound("")
+	}
+	stat, err := fs.Stat(fsys, name)
+	if err == nil && stat.IsDir() {
+		name, err = path.Join(name, "index.html"), nil
+	}
+	if err == nil {
+		err = ctx.SendFile(fsys, name)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return NotFound("")
+	}
+	return err
+}
+
+// DebugFS returns a file system opening the files of fsys, or in debug mode the files of the directory dir
+// when they exist there, so assets and templates embedded in the executable are edited without rebuilding it:
+//
+//	//go:embed templates
+//	var templates embed.FS
+//
+//	app.SetRenderer(micro.NewTemplateRenderer(app.DebugFS(templates, "."), micro.TemplateOptions{}))
+func (e *Micro) DebugFS(fsys fs.FS, dir string) fs.FS {
+	return &debugFS{app: e, fsys: fsys, disk: os.DirFS(dir)}
+}
+
+// debugFS is a file system preferring the files of a directory in debug mode
+type debugFS struct {
+	app  *Micro
+	fsys fs.FS
+	disk fs.FS
+}
+
+func (debugFS *debugFS) Open(name string) (fs.File, error) {
+	if debugFS.app.Debug() {
+		file, err := debugFS.disk.Open(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return file, err
+		}
+	}
+	return debugFS.fsys.Open(name)
+}
@@ -0,0 +1,114 @@
+package micro
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+/**********************************/
+/*         FLASH MESSAGES         */
+/**********************************/
+
+// FlashCookieName is the name of the cookie flash messages are stored in between two requests
+var FlashCookieName = "micro_flash"
+
+// ErrNoSecret is returned when signing data requires a secret and the application has none
+var ErrNoSecret = errors.New("no secret set on the application, use Micro.SetSecret")
+
+// SetSecret sets the secret used to sign cookies written by the framework, such as flash messages
+func (e *Micro) SetSecret(secret []byte) {
+	e.secret = secret
+}
+
+// Flash adds a message under key, the message is available to the next request through Flashes.
+// It is usually followed by a redirect (post/redirect/get).
+// Messages are stored in a cookie signed with the application secret.
+func (ctx *Context) Flash(key string, message string) error {
+	if ctx.app == nil || len(ctx.app.secret) == 0 {
+		return ErrNoSecret
+	}
+	if ctx.outgoingFlashes == nil {
+		ctx.outgoingFlashes = map[string][]string{}
+	}
+	ctx.outgoingFlashes[key] = append(ctx.outgoingFlashes[key], message)
+	payload, err := json.Marshal(ctx.outgoingFlashes)
+	if err != nil {
+		return err
+	}
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	ctx.setFlashCookie(&http.Cookie{
+		Name:     FlashCookieName,
+		Value:    value + "." + sign(ctx.app.secret, value),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Flashes returns the flash messages added by the previous request, by key.
+// Messages are consumed: they are removed from the client once read.
+// Messages with an invalid signature are ignored.
+func (ctx *Context) Flashes() map[string][]string {
+	if ctx.flashesRead {
+		return ctx.incomingFlashes
+	}
+	ctx.flashesRead = true
+	ctx.incomingFlashes = map[string][]string{}
+	if ctx.Request == nil || ctx.app == nil || len(ctx.app.secret) == 0 {
+		return ctx.incomingFlashes
+	}
+	cookie, err := ctx.Request.Cookie(FlashCookieName)
+	if err != nil {
+		return ctx.incomingFlashes
+	}
+	if ctx.outgoingFlashes == nil {
+		ctx.setFlashCookie(&http.Cookie{Name: FlashCookieName, Path: "/", MaxAge: -1, HttpOnly: true})
+	}
+	value, signature, found := strings.Cut(cookie.Value, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(sign(ctx.app.secret, value))) {
+		return ctx.incomingFlashes
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return ctx.incomingFlashes
+	}
+	flashes := map[string][]string{}
+	if json.Unmarshal(payload, &flashes) == nil {
+		ctx.incomingFlashes = flashes
+	}
+	return ctx.incomingFlashes
+}
+
+// setFlashCookie sets the flash cookie, replacing the one previously set during the request
+func (ctx *Context) setFlashCookie(cookie *http.Cookie) {
+	header := ctx.Response.Header()
+	cookies := header.Values("Set-Cookie")
+	header.Del("Set-Cookie")
+	for _, c := range cookies {
+		if !strings.HasPrefix(c, FlashCookieName+"=") {
+			header.Add("Set-Cookie", c)
+		}
+	}
+	http.SetCookie(ctx.Response, cookie)
+}
+
+// Flashes returns the flash messages of the request being rendered
+func (data TemplateData) Flashes() map[string][]string {
+	if data.Context == nil {
+		return map[string][]string{}
+	}
+	return data.Context.Flashes()
+}
+
+// sign returns the base64 encoded HMAC-SHA256 signature of value
+func sign(secret []byte, value string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,218 @@
+package micro
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+)
+
+/**********************************/
+/*            GRAPHQL             */
+/**********************************/
+
+// DefaultGraphQLMaxBodySize is the maximum size of the bodies of GraphQL requests when GraphQLOptions has none
+const DefaultGraphQLMaxBodySize int64 = 1 << 20
+
+// GraphQLRequest is a GraphQL operation sent by a client
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	// ReadOnly is true for operations sent with GET, executors must not run their mutations
+	ReadOnly bool `json:"-"`
+}
+
+// GraphQLError is an error of a GraphQL response
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+	// Err is the error returned by a resolver, if any. Like the errors returned by handlers,
+	// the message of an *HTTPError is sent to the client with its code, and the messages of
+	// server errors are logged and replaced with a reference.
+	Err error `json:"-"`
+}
+
+// GraphQLLocation is a location in the query of a GraphQL request
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLResponse is the result of a GraphQL operation
+type GraphQLResponse struct {
+	Data   interface{}     `json:"data,omitempty"`
+	Errors []*GraphQLError `json:"errors,omitempty"`
+}
+
+// GraphQLSchema executes GraphQL operations. Adapters implement it for GraphQL libraries,
+// such as the graphql sub-package for github.com/graphql-go/graphql.
+//
+// ctx carries the request, see GraphQLContext and GraphQLInjector. Errors of the operation belong
+// to the response, Execute only returns an error when the request cannot be executed at all,
+// such as a mutation of a ReadOnly request. It is sent to the error handlers of the application.
+type GraphQLSchema interface {
+	Execute(ctx context.Context, request *GraphQLRequest) (*GraphQLResponse, error)
+}
+
+// GraphQLOptions configures a GraphQL endpoint
+type GraphQLOptions struct {
+	// MaxBodySize is the maximum size of request bodies, DefaultGraphQLMaxBodySize if zero
+	MaxBodySize int64
+	// DisableGraphiQL disables the GraphiQL IDE, served to browsers in debug mode
+	DisableGraphiQL bool
+}
+
+// graphQLContextKey is the key of the *Context in the context given to GraphQL schemas
+type graphQLContextKey struct{}
+
+// GraphQL creates a GET and POST route executing GraphQL operations with schema.
+// Operations are sent as JSON bodies or application/graphql queries with POST,
+// or as query, operationName and variables query parameters with GET, which cannot run mutations.
+// In debug mode, browsers requesting the endpoint are served the GraphiQL IDE:
+//
+//	app.GraphQL("/graphql", graphql.NewSchema(schema), micro.GraphQLOptions{})
+//
+// Resolvers are given a context holding the request, from which they can resolve services:
+//
+//	users, err := micro.Resolve[*UserRepository](micro.GraphQLInjector(params.Context))
+func (rc *ControllerCollection) GraphQL(path string, schema GraphQLSchema, options GraphQLOptions) *Route {
+	if options.MaxBodySize == 0 {
+		options.MaxBodySize = DefaultGraphQLMaxBodySize
+	}
+	route := rc.All(path, func(ctx *Context) error {
+		if ctx.Request.Method == http.MethodGet && ctx.Request.URL.Query().Get("query") == "" &&
+			!options.DisableGraphiQL && ctx.app != nil && ctx.app.Debug() && ctx.Negotiate("json", "html") == "html" {
+			return ctx.serveGraphiQL()
+		}
+		request, err := ctx.graphQLRequest(options.MaxBodySize)
+		if err != nil {
+			return err
+		}
+		response, err := schema.Execute(context.WithValue(ctx, graphQLContextKey{}, ctx), request)
+		if err != nil {
+			return err
+		}
+		for _, graphQLError := range response.Errors {
+			ctx.presentGraphQLError(graphQLError)
+		}
+		return ctx.WriteJSON(response)
+	})
+	route.SetMethods([]string{"GET", "POST"})
+	return route
+}
+
+// GraphQLContext returns the *Context of the request of a GraphQL operation,
+// nil if c is not the context of an operation
+func GraphQLContext(c context.Context) *Context {
+	ctx, _ := c.Value(graphQLContextKey{}).(*Context)
+	return ctx
+}
+
+// GraphQLInjector returns the request injector of a GraphQL operation, from which resolvers
+// resolve services. It returns nil if c is not the context of an operation.
+func GraphQLInjector(c context.Context) *Injector {
+	if ctx := GraphQLContext(c); ctx != nil {
+		return ctx.injector
+	}
+	return nil
+}
+
+// graphQLRequest reads the GraphQL request from the query or the body of the request
+func (ctx *Context) graphQLRequest(maxBodySize int64) (*GraphQLRequest, error) {
+	request := &GraphQLRequest{}
+	if ctx.Request.Method == http.MethodGet {
+		query := ctx.Request.URL.Query()
+		request.Query, request.OperationName, request.ReadOnly = query.Get("query"), query.Get("operationName"), true
+		if variables := query.Get("variables"); variables != "" {
+			if err := readJSON(bytes.NewReader([]byte(variables)), &request.Variables); err != nil {
+				return nil, BadRequest("invalid variables").WithInternal(err)
+			}
+		}
+	} else {
+		body, err := io.ReadAll(http.MaxBytesReader(ctx.Response, ctx.Request.Body, maxBodySize))
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, NewHTTPError(http.StatusRequestEntityTooLarge, "")
+		} else if err != nil {
+			return nil, err
+		}
+		switch mediaType := requestMediaType(ctx.Request); mediaType {
+		case MediaTypes["json"]:
+			if err := readJSON(bytes.NewReader(body), request); err != nil {
+				return nil, err
+			}
+		case "application/graphql":
+			request.Query = string(body)
+		default:
+			return nil, UnsupportedMediaType([]string{MediaTypes["json"], "application/graphql"}, mediaType)
+		}
+	}
+	if request.Query == "" {
+		return nil, BadRequest("missing query")
+	}
+	return request, nil
+}
+
+// presentGraphQLError sets the message of an error returned by a resolver as handlerError does,
+// with the status code and the reference of the error in its extensions
+func (ctx *Context) presentGraphQLError(graphQLError *GraphQLError) {
+	err := graphQLError.Err
+	if err == nil {
+		return
+	}
+	code := http.StatusInternalServerError
+	var coder interface{ StatusCode() int }
+	if errors.As(err, &coder) {
+		code = coder.StatusCode()
+	}
+	message, logged := err.Error(), false
+	var httpError *HTTPError
+	if errors.As(err, &httpError) {
+		message, logged = httpError.Message, httpError.Internal != nil
+	} else if code >= http.StatusInternalServerError {
+		message, logged = http.StatusText(code), true
+	}
+	if graphQLError.Extensions == nil {
+		graphQLError.Extensions = map[string]interface{}{}
+	}
+	graphQLError.Message = message
+	graphQLError.Extensions["code"] = code
+	if logged {
+		reference := newErrorReference()
+		graphQLError.Extensions["reference"] = reference
+		ctx.logger().Error("resolver error", "error", err, "path", graphQLError.Path, "reference", reference)
+	}
+}
+
+// graphiQL is the page of the GraphiQL IDE
+var graphiQL = template.Must(template.New("graphiql").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>GraphiQL</title>
+<link rel="stylesheet" href="https://unpkg.com/graphiql@3/graphiql.min.css">
+</head>
+<body style="margin: 0">
+<div id="graphiql" style="height: 100vh"></div>
+<script nonce="{{.Nonce}}" src="https://unpkg.com/react@18/umd/react.production.min.js" crossorigin></script>
+<script nonce="{{.Nonce}}" src="https://unpkg.com/react-dom@18/umd/react-dom.production.min.js" crossorigin></script>
+<script nonce="{{.Nonce}}" src="https://unpkg.com/graphiql@3/graphiql.min.js" crossorigin></script>
+<script nonce="{{.Nonce}}">
+ReactDOM.createRoot(document.getElementById("graphiql")).render(
+	React.createElement(GraphiQL, {fetcher: GraphiQL.createFetcher({url: {{.URL}}})})
+);
+</script>
+</body>
+</html>
+`))
+
+// serveGraphiQL writes the GraphiQL IDE querying the endpoint of the request
+func (ctx *Context) serveGraphiQL() error {
+	nonce, _ := GetVar[string](ctx, CSPNonceVar)
+	ctx.Response.Header().Set("Content-Type", MediaTypes["html"])
+	return graphiQL.Execute(ctx.Response, struct{ URL, Nonce string }{ctx.Request.URL.Path, nonce})
+}
@@ -0,0 +1,134 @@
+//go:build adapters
+
+// Package graphql executes the GraphQL operations of micro endpoints with github.com/graphql-go/graphql.
+// Its Schema is the micro.GraphQLSchema of micro.GraphQL, which decodes the requests and writes the responses,
+// and Resolve lets resolvers depend on the services of the request injector like handlers do:
+//
+//	schema, _ := gql.NewSchema(gql.SchemaConfig{Query: gql.NewObject(gql.ObjectConfig{
+//		Name: "Query",
+//		Fields: gql.Fields{
+//			"user": &gql.Field{
+//				Type: userType,
+//				Args: gql.FieldConfigArgument{"id": &gql.ArgumentConfig{Type: gql.ID}},
+//				Resolve: graphql.Resolve(func(params gql.ResolveParams, users *UserRepository) (interface{}, error) {
+//					return users.Find(params.Context, params.Args["id"].(string))
+//				}),
+//			},
+//		},
+//	})})
+//	app.GraphQL("/graphql", graphql.NewSchema(schema), micro.GraphQLOptions{})
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+
+	"github.com/interactiv/micro"
+)
+
+/**********************************/
+/*            GRAPHQL             */
+/**********************************/
+
+// errorType is the type of the error returned by resolvers
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Schema is a micro.GraphQLSchema executing operations with a graphql-go schema
+type Schema struct {
+	schema gql.Schema
+}
+
+// NewSchema creates a micro.GraphQLSchema executing operations with schema
+func NewSchema(schema gql.Schema) *Schema {
+	return &Schema{schema: schema}
+}
+
+// Execute executes the operation of request. It returns a 405 Method Not Allowed micro.HTTPError
+// if request is read only and its operation is a mutation.
+func (schema *Schema) Execute(ctx context.Context, request *micro.GraphQLRequest) (*micro.GraphQLResponse, error) {
+	if request.ReadOnly && isMutation(request) {
+		return nil, micro.NewHTTPError(http.StatusMethodNotAllowed, "mutations must be sent with POST")
+	}
+	result := gql.Do(gql.Params{
+		Schema:         schema.schema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        ctx,
+	})
+	response := &micro.GraphQLResponse{Data: result.Data}
+	for _, formatted := range result.Errors {
+		graphQLError := &micro.GraphQLError{
+			Message:    formatted.Message,
+			Path:       formatted.Path,
+			Extensions: formatted.Extensions,
+			Err:        formatted.OriginalError(),
+		}
+		for _, location := range formatted.Locations {
+			graphQLError.Locations = append(graphQLError.Locations, micro.GraphQLLocation{Line: location.Line, Column: location.Column})
+		}
+		response.Errors = append(response.Errors, graphQLError)
+	}
+	return response, nil
+}
+
+// isMutation returns true if the operation of request is a mutation.
+// Queries which cannot be parsed are left to the executor, which reports their errors.
+func isMutation(request *micro.GraphQLRequest) bool {
+	document, err := parser.Parse(parser.ParseParams{Source: request.Query})
+	if err != nil {
+		return false
+	}
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if request.OperationName != "" && (operation.Name == nil || operation.Name.Value != request.OperationName) {
+			continue
+		}
+		if operation.Operation == ast.OperationTypeMutation {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns a resolver calling function with its arguments resolved by the request injector,
+// and the gql.ResolveParams of the field. function returns the value of the field and an error:
+//
+//	Resolve: graphql.Resolve(func(params gql.ResolveParams, users *UserRepository) (*User, error) {
+//		return users.Find(params.Context, params.Args["id"].(string))
+//	})
+//
+// Errors are presented like the errors returned by handlers, see micro.GraphQLError.
+//
+// Can Panic! if function is not a function returning a value and an error
+func Resolve(function interface{}) gql.FieldResolveFn {
+	functionType := reflect.TypeOf(function)
+	if functionType == nil || functionType.Kind() != reflect.Func || functionType.NumOut() != 2 || functionType.Out(1) != errorType {
+		panic(fmt.Sprintf("resolver %T must be a function returning a value and an error", function))
+	}
+	return func(params gql.ResolveParams) (interface{}, error) {
+		injector := micro.GraphQLInjector(params.Context)
+		if injector == nil {
+			return nil, fmt.Errorf("resolver %T called outside of a micro GraphQL request", function)
+		}
+		injector = injector.Child()
+		injector.Register(params)
+		results, err := injector.Call(function)
+		if err != nil {
+			return nil, err
+		}
+		if err, _ := results[1].Interface().(error); err != nil {
+			return nil, err
+		}
+		return results[0].Interface(), nil
+	}
+}
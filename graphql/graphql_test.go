@@ -0,0 +1,75 @@
+//go:build adapters
+
+package graphql_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/interactiv/expect"
+
+	"github.com/interactiv/micro"
+	"github.com/interactiv/micro/graphql"
+)
+
+type Greeter struct{ Greeting string }
+
+func newSchema(t *testing.T) *graphql.Schema {
+	schema, err := gql.NewSchema(gql.SchemaConfig{
+		Query: gql.NewObject(gql.ObjectConfig{Name: "Query", Fields: gql.Fields{
+			"greeting": &gql.Field{
+				Type: gql.String,
+				Args: gql.FieldConfigArgument{"name": &gql.ArgumentConfig{Type: gql.String}},
+				Resolve: graphql.Resolve(func(params gql.ResolveParams, greeter *Greeter) (interface{}, error) {
+					return greeter.Greeting + " " + params.Args["name"].(string), nil
+				}),
+			},
+		}}),
+		Mutation: gql.NewObject(gql.ObjectConfig{Name: "Mutation", Fields: gql.Fields{
+			"greet": &gql.Field{
+				Type: gql.String,
+				Resolve: func(gql.ResolveParams) (interface{}, error) {
+					return nil, errors.New("database down")
+				},
+			},
+		}}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return graphql.NewSchema(schema)
+}
+
+func TestSchema(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Injector().Register(&Greeter{Greeting: "hello"})
+	app.GraphQL("/graphql", newSchema(t), micro.GraphQLOptions{})
+	post := func(body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+	response := post(`{"query": "query Greet($name: String) { greeting(name: $name) }", "variables": {"name": "world"}}`)
+	e.Expect(response.Code).ToBe(http.StatusOK)
+	e.Expect(strings.TrimSpace(response.Body.String())).ToBe(`{"data":{"greeting":"hello world"}}`)
+	response = post(`{"query": "mutation { greet }"}`)
+	e.Expect(response.Body.String()).ToContain(`"errors"`)
+	e.Expect(response.Body.String()).Not().ToContain("database down")
+}
+
+func TestSchemaReadOnly(t *testing.T) {
+	e := expect.New(t)
+	_, err := newSchema(t).Execute(context.Background(), &micro.GraphQLRequest{Query: "mutation { greet }", ReadOnly: true})
+	httpError := &micro.HTTPError{}
+	e.Expect(errors.As(err, &httpError)).ToBeTrue()
+	e.Expect(httpError.Code).ToBe(http.StatusMethodNotAllowed)
+	e.Expect(func() { graphql.Resolve(func() {}) }).ToPanic()
+}
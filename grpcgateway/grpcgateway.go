@@ -0,0 +1,362 @@
+//go:build adapters
+
+// Package grpcgateway serves gRPC services as JSON HTTP APIs, so micro can be the REST facade of a gRPC backend.
+// Requests are transcoded to protobuf messages and sent to the upstream service, following the
+// google.api.http annotations of its methods:
+//
+//	service Users {
+//		rpc GetUser(GetUserRequest) returns (User) {
+//			option (google.api.http) = { get: "/v1/users/{id}" };
+//		}
+//		rpc CreateUser(CreateUserRequest) returns (User) {
+//			option (google.api.http) = { post: "/v1/users" body: "user" };
+//		}
+//	}
+//
+// Methods are described by their protobuf descriptors and messages are built dynamically,
+// so the gateway needs the generated descriptor of the service but none of its stubs:
+//
+//	conn, _ := grpc.NewClient("users:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	gateway := grpcgateway.New(conn)
+//	if err := gateway.Register(app.ControllerCollection, userspb.File_users_proto.Services().ByName("Users")); err != nil {
+//		log.Fatal(err)
+//	}
+package grpcgateway
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/interactiv/micro"
+)
+
+/**********************************/
+/*          GRPC GATEWAY          */
+/**********************************/
+
+// DefaultForwardedHeaders are the request headers sent to the upstream service as gRPC metadata
+var DefaultForwardedHeaders = []string{"Authorization", "X-Request-Id"}
+
+// DefaultMaxBodySize is the maximum size of the request bodies of the gateways created by New
+var DefaultMaxBodySize int64 = 1 << 20
+
+// pathVariable matches the variables of path templates, such as {id} or {user.id}
+var pathVariable = regexp.MustCompile(`\{([\w.]+)\}`)
+
+// Gateway transcodes HTTP/JSON requests to calls of a gRPC service
+type Gateway struct {
+	conn grpc.ClientConnInterface
+	// ForwardedHeaders are the request headers sent as gRPC metadata
+	ForwardedHeaders []string
+	// MarshalOptions encode the responses
+	MarshalOptions protojson.MarshalOptions
+	// UnmarshalOptions decode the request bodies, unknown fields are discarded by default
+	UnmarshalOptions protojson.UnmarshalOptions
+	// MaxBodySize is the maximum size of request bodies, larger bodies are answered with 413 Request Entity Too Large
+	MaxBodySize int64
+}
+
+// New creates a gateway calling the services of conn
+func New(conn grpc.ClientConnInterface) *Gateway {
+	return &Gateway{
+		conn:             conn,
+		ForwardedHeaders: DefaultForwardedHeaders,
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		MaxBodySize:      DefaultMaxBodySize,
+	}
+}
+
+// Register creates the routes of the methods of service annotated with google.api.http,
+// including their additional bindings. Methods without annotation are skipped.
+// It returns an error if a path template is not supported.
+func (gateway *Gateway) Register(rc *micro.ControllerCollection, service protoreflect.ServiceDescriptor) error {
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		rule, _ := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if rule == nil {
+			continue
+		}
+		for _, binding := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+			httpMethod, path := httpPattern(binding)
+			if httpMethod == "" {
+				return fmt.Errorf("%s : no HTTP pattern", method.FullName())
+			}
+			if _, err := gateway.Handle(rc, httpMethod, path, method, binding.GetBody()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// httpPattern returns the method and the path template of rule
+func httpPattern(rule *annotations.HttpRule) (string, string) {
+	switch {
+	case rule.GetGet() != "":
+		return http.MethodGet, rule.GetGet()
+	case rule.GetPost() != "":
+		return http.MethodPost, rule.GetPost()
+	case rule.GetPut() != "":
+		return http.MethodPut, rule.GetPut()
+	case rule.GetPatch() != "":
+		return http.MethodPatch, rule.GetPatch()
+	case rule.GetDelete() != "":
+		return http.MethodDelete, rule.GetDelete()
+	case rule.GetCustom() != nil:
+		return strings.ToUpper(rule.GetCustom().GetKind()), rule.GetCustom().GetPath()
+	}
+	return "", ""
+}
+
+// Handle creates a route calling method for the requests matching httpMethod and the path template path,
+// whose variables such as {id} or {user.id} set the fields of the request message.
+// body is the field the request body is decoded in, * for the whole message, or empty if the request has no body.
+// The query parameters set the fields which are not set by the path or the body.
+// Request bodies larger than MaxBodySize are answered with 413 Request Entity Too Large.
+//
+// It returns an error if path uses templates other than field variables, such as {name=shelves/*},
+// if method is a streaming method or if body is not a message field of its request.
+func (gateway *Gateway) Handle(rc *micro.ControllerCollection, httpMethod string, path string, method protoreflect.MethodDescriptor, body string) (*micro.Route, error) {
+	if strings.Contains(pathVariable.ReplaceAllString(path, ""), "{") || strings.Contains(path, "*") {
+		return nil, fmt.Errorf("%s : unsupported path template %s", method.FullName(), path)
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return nil, fmt.Errorf("%s : streaming methods are not supported", method.FullName())
+	}
+	if body != "" && body != "*" {
+		field := method.Input().Fields().ByName(protoreflect.Name(body))
+		if field == nil || field.Message() == nil || field.IsList() || field.IsMap() {
+			return nil, fmt.Errorf("%s : body %s is not a message field of %s", method.FullName(), body, method.Input().FullName())
+		}
+	}
+	// fields are the field paths of the route params
+	fields := map[string]string{}
+	pattern := pathVariable.ReplaceAllStringFunc(path, func(variable string) string {
+		field := variable[1 : len(variable)-1]
+		param := strings.ReplaceAll(field, ".", "__")
+		fields[param] = field
+		return ":" + param
+	})
+	fullMethod := fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+	route := rc.All(pattern, func(ctx *micro.Context) error {
+		request := dynamicpb.NewMessage(method.Input())
+		if err := gateway.decode(ctx, request, body); err != nil {
+			return err
+		}
+		for param, field := range fields {
+			if err := setField(request, field, []string{ctx.RequestVars[param]}); err != nil {
+				return micro.BadRequest(err.Error())
+			}
+		}
+		if body != "*" {
+			for key, values := range ctx.Request.URL.Query() {
+				if hasField(request, key) {
+					continue
+				}
+				if err := setField(request, key, values); err != nil && !errors.Is(err, errUnknownField) {
+					return micro.BadRequest(err.Error())
+				}
+			}
+		}
+		response := dynamicpb.NewMessage(method.Output())
+		if err := gateway.conn.Invoke(gateway.outgoingContext(ctx), fullMethod, request, response); err != nil {
+			return httpError(err)
+		}
+		encoded, err := gateway.MarshalOptions.Marshal(response)
+		if err != nil {
+			return err
+		}
+		ctx.Response.Header().Set("Content-Type", micro.MediaTypes["json"])
+		_, err = ctx.Response.Write(encoded)
+		return err
+	})
+	route.SetMethods([]string{httpMethod})
+	return route, nil
+}
+
+// decode decodes the body of the request of ctx in the field body of message
+func (gateway *Gateway) decode(ctx *micro.Context, message *dynamicpb.Message, body string) error {
+	if body == "" {
+		return nil
+	}
+	encoded, err := io.ReadAll(http.MaxBytesReader(ctx.Response, ctx.Request.Body, gateway.MaxBodySize))
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return micro.NewHTTPError(http.StatusRequestEntityTooLarge, "")
+	} else if err != nil {
+		return err
+	}
+	if len(encoded) == 0 {
+		return nil
+	}
+	target := proto.Message(message)
+	if body != "*" {
+		field := message.Descriptor().Fields().ByName(protoreflect.Name(body))
+		target = message.Mutable(field).Message().Interface()
+	}
+	if err := gateway.UnmarshalOptions.Unmarshal(encoded, target); err != nil {
+		return micro.BadRequest(err.Error()).WithInternal(err)
+	}
+	return nil
+}
+
+// outgoingContext returns the context of the call, with the forwarded headers of the request as metadata
+func (gateway *Gateway) outgoingContext(ctx *micro.Context) context.Context {
+	pairs := []string{}
+	for _, header := range gateway.ForwardedHeaders {
+		for _, value := range ctx.Request.Header.Values(header) {
+			pairs = append(pairs, strings.ToLower(header), value)
+		}
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+// errUnknownField is returned by setField for fields the message does not have
+var errUnknownField = errors.New("unknown field")
+
+// setField sets the field at the dotted path of message to values, parsed according to the type of the field
+func setField(message protoreflect.Message, path string, values []string) error {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		field := message.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if field == nil || field.Message() == nil || field.IsList() || field.IsMap() {
+			return errUnknownField
+		}
+		message = message.Mutable(field).Message()
+	}
+	field := message.Descriptor().Fields().ByName(protoreflect.Name(names[len(names)-1]))
+	if field == nil {
+		field = message.Descriptor().Fields().ByJSONName(names[len(names)-1])
+	}
+	if field == nil || field.IsMap() || field.Message() != nil {
+		return errUnknownField
+	}
+	if !field.IsList() {
+		values = values[len(values)-1:]
+	}
+	for _, value := range values {
+		parsed, err := parseValue(field, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q : %w", path, value, err)
+		}
+		if field.IsList() {
+			message.Mutable(field).List().Append(parsed)
+		} else {
+			message.Set(field, parsed)
+		}
+	}
+	return nil
+}
+
+// hasField returns true if the field at the dotted path of message is set
+func hasField(message protoreflect.Message, path string) bool {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		field := message.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if field == nil || field.Message() == nil || field.IsList() || field.IsMap() || !message.Has(field) {
+			return false
+		}
+		message = message.Get(field).Message()
+	}
+	field := message.Descriptor().Fields().ByName(protoreflect.Name(names[len(names)-1]))
+	if field == nil {
+		field = message.Descriptor().Fields().ByJSONName(names[len(names)-1])
+	}
+	return field != nil && message.Has(field)
+}
+
+// parseValue parses value according to the kind of field
+func parseValue(field protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BoolKind:
+		parsed, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(parsed), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(parsed)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(parsed), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(parsed)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(parsed), err
+	case protoreflect.FloatKind:
+		parsed, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(parsed)), err
+	case protoreflect.DoubleKind:
+		parsed, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(parsed), err
+	case protoreflect.BytesKind:
+		parsed, err := base64.URLEncoding.DecodeString(value)
+		if err != nil {
+			parsed, err = base64.StdEncoding.DecodeString(value)
+		}
+		return protoreflect.ValueOfBytes(parsed), err
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByName(protoreflect.Name(value)); enumValue != nil {
+			return protoreflect.ValueOfEnum(enumValue.Number()), nil
+		}
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(parsed)), err
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", field.Kind())
+}
+
+// httpStatus maps the codes of gRPC statuses to HTTP status codes
+var httpStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// httpError converts the error of a call to an HTTPError with the HTTP status of its gRPC status.
+// The messages of server errors are not sent to the client.
+func httpError(err error) *micro.HTTPError {
+	grpcStatus, _ := status.FromError(err)
+	code, ok := httpStatus[grpcStatus.Code()]
+	if !ok {
+		code = http.StatusInternalServerError
+	}
+	httpError := micro.NewHTTPError(code, "").WithInternal(err)
+	if code < http.StatusInternalServerError {
+		httpError.Message = grpcStatus.Message()
+	}
+	return httpError
+}
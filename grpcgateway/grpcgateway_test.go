@@ -0,0 +1,149 @@
+//go:build adapters
+
+package grpcgateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/interactiv/expect"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/interactiv/micro"
+)
+
+func TestHTTPPattern(t *testing.T) {
+	e := expect.New(t)
+	method, path := httpPattern(&annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/users/{id}"}})
+	e.Expect(method).ToBe(http.MethodGet)
+	e.Expect(path).ToBe("/v1/users/{id}")
+	method, path = httpPattern(&annotations.HttpRule{Pattern: &annotations.HttpRule_Custom{
+		Custom: &annotations.CustomHttpPattern{Kind: "head", Path: "/v1/users"},
+	}})
+	e.Expect(method).ToBe(http.MethodHead)
+	e.Expect(path).ToBe("/v1/users")
+	method, _ = httpPattern(&annotations.HttpRule{})
+	e.Expect(method).ToBe("")
+}
+
+func TestHTTPError(t *testing.T) {
+	e := expect.New(t)
+	notFound := httpError(status.Error(codes.NotFound, "user 42 not found"))
+	e.Expect(notFound.Code).ToBe(http.StatusNotFound)
+	e.Expect(notFound.Message).ToBe("user 42 not found")
+	internal := httpError(status.Error(codes.Internal, "connection string leaked"))
+	e.Expect(internal.Code).ToBe(http.StatusInternalServerError)
+	e.Expect(internal.Message).Not().ToContain("leaked")
+	e.Expect(httpError(status.Error(codes.Unavailable, "")).Code).ToBe(http.StatusServiceUnavailable)
+}
+
+// usersService returns the descriptor of a Users service with an UpdateUser method
+func usersService(t *testing.T) protoreflect.ServiceDescriptor {
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		descriptor := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   kind.Enum(),
+		}
+		if typeName != "" {
+			descriptor.TypeName = proto.String(typeName)
+		}
+		return descriptor
+	}
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("users.proto"),
+		Package: proto.String("users"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("name", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			},
+		}, {
+			Name: proto.String("UpdateUserRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("user", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".users.User"),
+				field("notify", 3, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Users"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("UpdateUser"),
+				InputType:  proto.String(".users.UpdateUserRequest"),
+				OutputType: proto.String(".users.User"),
+			}},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Services().ByName("Users")
+}
+
+// usersConn records the calls of the gateway and answers with the user of the request
+type usersConn struct {
+	method  string
+	request *dynamicpb.Message
+}
+
+func (conn *usersConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	conn.method, conn.request = method, args.(*dynamicpb.Message)
+	user := conn.request.Get(conn.request.Descriptor().Fields().ByName("user")).Message()
+	proto.Merge(reply.(proto.Message), user.Interface())
+	return nil
+}
+
+func (conn *usersConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, errors.New("streams are not supported")
+}
+
+func TestHandle(t *testing.T) {
+	e := expect.New(t)
+	method := usersService(t).Methods().ByName("UpdateUser")
+	conn := &usersConn{}
+	gateway := New(conn)
+	gateway.MaxBodySize = 64
+	app := micro.New()
+	_, err := gateway.Handle(app.ControllerCollection, http.MethodPatch, "/v1/users/{id}", method, "user")
+	e.Expect(err).ToBeNil()
+
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPatch, "/v1/users/42?id=7&notify=true&user.name=query&user.id=query", strings.NewReader(`{"name":"body"}`))
+	app.ServeHTTP(response, request)
+	e.Expect(response.Code).ToBe(http.StatusOK)
+	e.Expect(conn.method).ToBe("/users.Users/UpdateUser")
+	fields := conn.request.Descriptor().Fields()
+	e.Expect(conn.request.Get(fields.ByName("id")).String()).ToBe("42")
+	e.Expect(conn.request.Get(fields.ByName("notify")).Bool()).ToBeTrue()
+	user := map[string]string{}
+	e.Expect(json.Unmarshal(response.Body.Bytes(), &user)).ToBeNil()
+	e.Expect(user["name"]).ToBe("body")
+	e.Expect(user["id"]).ToBe("query")
+
+	response = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodPatch, "/v1/users/42", strings.NewReader(`{"name":"`+strings.Repeat("a", 64)+`"}`))
+	app.ServeHTTP(response, request)
+	e.Expect(response.Code).ToBe(http.StatusRequestEntityTooLarge)
+
+	_, err = gateway.Handle(app.ControllerCollection, http.MethodGet, "/v1/{name=users/*}", method, "")
+	e.Expect(err).Not().ToBeNil()
+	_, err = gateway.Handle(app.ControllerCollection, http.MethodPost, "/v1/users", method, "notify")
+	e.Expect(err).Not().ToBeNil()
+}
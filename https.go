@@ -0,0 +1,205 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/**********************************/
+/*             HTTPS              */
+/**********************************/
+
+// DefaultHSTSMaxAge is the duration browsers remember to use HTTPS when HTTPSOptions has no max age
+const DefaultHSTSMaxAge = 365 * 24 * time.Hour
+
+// HTTPSOptions configures the redirection of HTTP requests to HTTPS and the Strict-Transport-Security header
+type HTTPSOptions struct {
+	// HSTSMaxAge is how long browsers only use HTTPS for the host, DefaultHSTSMaxAge if zero.
+	// A negative max age disables the Strict-Transport-Security header.
+	HSTSMaxAge time.Duration
+	// IncludeSubdomains applies the policy to the subdomains of the host
+	IncludeSubdomains bool
+	// Preload allows the host to be included in the HSTS preload lists of browsers,
+	// it requires a max age of at least a year and IncludeSubdomains
+	Preload bool
+	// Port is the HTTPS port requests are redirected to, 443 if zero
+	Port int
+	// TrustForwardedProto considers the requests with an X-Forwarded-Proto: https header secure,
+	// for applications behind proxies terminating TLS
+	TrustForwardedProto bool
+	// HTTPAddr is the address RunTLSRedirect redirects requests from, ":http" if empty
+	HTTPAddr string
+}
+
+// hsts returns the value of the Strict-Transport-Security header, empty if it is disabled.
+//
+// Can Panic! if Preload is set without IncludeSubdomains or with a max age under a year
+func (options HTTPSOptions) hsts() string {
+	maxAge := options.HSTSMaxAge
+	if maxAge == 0 {
+		maxAge = DefaultHSTSMaxAge
+	}
+	if maxAge < 0 {
+		return ""
+	}
+	if options.Preload && (!options.IncludeSubdomains || maxAge < DefaultHSTSMaxAge) {
+		panic("HSTS preload requires IncludeSubdomains and a max age of at least a year")
+	}
+	value := fmt.Sprintf("max-age=%d", int64(maxAge/time.Second))
+	if options.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if options.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// secure returns true if request was received over HTTPS
+func (options HTTPSOptions) secure(request *http.Request) bool {
+	return request.TLS != nil || options.TrustForwardedProto && strings.EqualFold(request.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// redirect redirects request to HTTPS, permanently. Methods other than GET and HEAD are redirected
+// with 308 Permanent Redirect so clients repeat them with their body.
+func (options HTTPSOptions) redirect(rw http.ResponseWriter, request *http.Request) {
+	host := request.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if options.Port != 0 && options.Port != 443 {
+		host = fmt.Sprintf("%s:%d", host, options.Port)
+	}
+	code := http.StatusMovedPermanently
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		code = http.StatusPermanentRedirect
+	}
+	http.Redirect(rw, request, "https://"+host+request.URL.RequestURI(), code)
+}
+
+// RedirectHTTPS returns a middleware redirecting the requests received over HTTP to HTTPS,
+// and setting the Strict-Transport-Security header of the responses sent over HTTPS:
+//
+//	app.Use("/", micro.RedirectHTTPS(micro.HTTPSOptions{IncludeSubdomains: true, Preload: true}))
+//
+// Can Panic! if Preload is set without IncludeSubdomains or with a max age under a year
+func RedirectHTTPS(options HTTPSOptions) HandlerFunction {
+	hsts := options.hsts()
+	return func(ctx *Context, next Next) {
+		if !options.secure(ctx.Request) {
+			options.redirect(ctx.Response, ctx.Request)
+			return
+		}
+		if hsts != "" {
+			ctx.Response.Header().Set("Strict-Transport-Security", hsts)
+		}
+		next()
+	}
+}
+
+// HSTS sets the Strict-Transport-Security header of the responses of an HTTPS server:
+//
+//	app.RunTLS(":443", certFile, keyFile, micro.HSTS(micro.HTTPSOptions{IncludeSubdomains: true}))
+//
+// Can Panic! if Preload is set without IncludeSubdomains or with a max age under a year
+func HSTS(options HTTPSOptions) ServerOption {
+	hsts := options.hsts()
+	return func(server *http.Server) {
+		handler := server.Handler
+		server.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if hsts != "" {
+				rw.Header().Set("Strict-Transport-Security", hsts)
+			}
+			handler.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// RunHTTPSRedirect listens on the TCP network address addr, ":http" if empty,
+// and redirects all requests to HTTPS. The server is shut down with the application.
+// It always returns a non-nil error.
+func (e *Micro) RunHTTPSRedirect(addr string, options HTTPSOptions) error {
+	server, listener, err := e.listenHTTPSRedirect(addr, options)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// listenHTTPSRedirect listens on the TCP network address addr, ":http" if empty,
+// and returns the server redirecting requests to HTTPS, shut down with the application
+func (e *Micro) listenHTTPSRedirect(addr string, options HTTPSOptions) (*http.Server, net.Listener, error) {
+	if addr == "" {
+		addr = ":http"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	server := &http.Server{Addr: addr, Handler: http.HandlerFunc(options.redirect), ReadHeaderTimeout: 10 * time.Second}
+	e.serverMutex.Lock()
+	e.servers = append(e.servers, server)
+	e.listeners = append(e.listeners, listener)
+	e.serverMutex.Unlock()
+	return server, listener, nil
+}
+
+// RunTLSRedirect serves the application over HTTPS like RunTLS, with the Strict-Transport-Security
+// header of options, and redirects the requests received on options.HTTPAddr to HTTPS,
+// so TLS only deployments are a single call:
+//
+//	app.RunTLSRedirect(":443", certFile, keyFile, micro.HTTPSOptions{IncludeSubdomains: true})
+//
+// It always returns a non-nil error, the error of the first server to stop.
+// When a server fails, the other server is shut down so it does not outlive it,
+// the application itself is not shut down.
+//
+// Can Panic! if Preload is set without IncludeSubdomains or with a max age under a year
+func (e *Micro) RunTLSRedirect(addr string, certFile string, keyFile string, options HTTPSOptions, serverOptions ...ServerOption) error {
+	if options.Port == 0 && addr != "" {
+		if _, port, err := net.SplitHostPort(addr); err == nil {
+			fmt.Sscan(port, &options.Port)
+		}
+	}
+	if addr == "" {
+		addr = ":https"
+	}
+	hsts := HSTS(options)
+	redirectServer, redirectListener, err := e.listenHTTPSRedirect(options.HTTPAddr, options)
+	if err != nil {
+		return err
+	}
+	listener, err := e.listen(addr)
+	if err != nil {
+		redirectServer.Close()
+		return err
+	}
+	server := e.newServer(addr, append(serverOptions, hsts)...)
+	redirectErrs, errs := make(chan error, 1), make(chan error, 1)
+	go func() { redirectErrs <- redirectServer.Serve(redirectListener) }()
+	go func() { errs <- e.serve(server, listener, certFile, keyFile) }()
+	// when a server stops, the other one is shut down unless both are shut down with the application
+	other, otherErrs := redirectServer, redirectErrs
+	select {
+	case err = <-errs:
+	case err = <-redirectErrs:
+		other, otherErrs = server, errs
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		ctx, cancel := context.WithTimeout(context.Background(), e.ShutdownTimeout())
+		defer cancel()
+		if shutdownErr := other.Shutdown(ctx); shutdownErr != nil {
+			e.Logger().Error("cannot shut the server down", "error", shutdownErr)
+		}
+	}
+	<-otherErrs
+	return err
+}
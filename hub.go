@@ -0,0 +1,359 @@
+package micro
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+/**********************************/
+/*              HUB               */
+/**********************************/
+
+// BackpressurePolicy decides what happens when a message is broadcast to a client whose buffer is full
+type BackpressurePolicy int
+
+const (
+	// DropMessage discards the message for the slow client
+	DropMessage BackpressurePolicy = iota
+	// DropOldest discards the oldest buffered message of the slow client to make room for the message
+	DropOldest
+	// DisconnectClient closes the slow client
+	DisconnectClient
+)
+
+// DefaultHubBufferSize is the number of messages buffered per client by hubs created with a zero buffer size
+var DefaultHubBufferSize = 64
+
+// HubMessage is a message broadcast to a topic
+type HubMessage struct {
+	Topic string
+	Data  []byte
+	// Origin identifies the hub the message was broadcast from
+	Origin string
+}
+
+// Backplane relays the messages broadcast by the hubs of several instances of an application,
+// so clients receive them whatever the instance they are connected to.
+// Implementations wrap a pub/sub system such as Redis or NATS:
+//
+//	type RedisBackplane struct{ client *redis.Client }
+//
+//	func (backplane RedisBackplane) Publish(message micro.HubMessage) error {
+//		payload, _ := json.Marshal(message)
+//		return backplane.client.Publish(context.Background(), "hub", payload).Err()
+//	}
+//
+//	func (backplane RedisBackplane) Subscribe(handler func(micro.HubMessage)) (func(), error) {
+//		subscription := backplane.client.Subscribe(context.Background(), "hub")
+//		go func() {
+//			for received := range subscription.Channel() {
+//				message := micro.HubMessage{}
+//				if json.Unmarshal([]byte(received.Payload), &message) == nil {
+//					handler(message)
+//				}
+//			}
+//		}()
+//		return func() { subscription.Close() }, nil
+//	}
+type Backplane interface {
+	// Publish sends message to the hubs subscribed to the backplane
+	Publish(message HubMessage) error
+	// Subscribe calls handler with the messages published on the backplane, including the messages
+	// of the hub subscribing, until the returned function is called
+	Subscribe(handler func(message HubMessage)) (unsubscribe func(), err error)
+}
+
+// Hub broadcasts messages to the clients which joined topics, from any handler or worker.
+// It is usually registered in the application injector and served over server-sent events or websockets:
+//
+//	hub := micro.NewHub(0, micro.DropOldest)
+//	app.Injector().Register(hub)
+//
+//	app.Get("/rooms/:room", func(ctx *micro.Context, hub *micro.Hub) {
+//		stream, err := ctx.SSE()
+//		if err != nil {
+//			return
+//		}
+//		defer stream.Close()
+//		client := hub.Connect()
+//		defer client.Close()
+//		client.Join(ctx.RequestVars["room"])
+//		client.ServeSSE(stream)
+//	})
+//
+//	app.Post("/rooms/:room", func(ctx *micro.Context, hub *micro.Hub) {
+//		message, _ := io.ReadAll(ctx.Request.Body)
+//		hub.Broadcast(ctx.RequestVars["room"], message)
+//	})
+type Hub struct {
+	mutex      sync.RWMutex
+	topics     map[string]map[*HubClient]struct{}
+	bufferSize int
+	policy     BackpressurePolicy
+	// id is the origin of the messages broadcast by the hub
+	id             string
+	backplaneMutex sync.RWMutex
+	backplane      Backplane
+	unsubscribe    func()
+	logger         Logger
+}
+
+// NewHub creates a hub buffering bufferSize messages per client, or DefaultHubBufferSize if bufferSize is zero,
+// and applying policy to the clients whose buffer is full
+func NewHub(bufferSize int, policy BackpressurePolicy) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultHubBufferSize
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &Hub{
+		topics:     map[string]map[*HubClient]struct{}{},
+		bufferSize: bufferSize,
+		policy:     policy,
+		id:         hex.EncodeToString(id),
+		logger:     DefaultLogger,
+	}
+}
+
+// SetBackplane relays the broadcasts of the hub through backplane, a nil backplane stops relaying
+func (hub *Hub) SetBackplane(backplane Backplane) error {
+	hub.backplaneMutex.Lock()
+	defer hub.backplaneMutex.Unlock()
+	if hub.unsubscribe != nil {
+		hub.unsubscribe()
+	}
+	hub.backplane, hub.unsubscribe = nil, nil
+	if backplane == nil {
+		return nil
+	}
+	unsubscribe, err := backplane.Subscribe(func(message HubMessage) {
+		if message.Origin != hub.id {
+			hub.deliver(message)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	hub.backplane, hub.unsubscribe = backplane, unsubscribe
+	return nil
+}
+
+// SetLogger sets the logger of the failures to publish on the backplane, DefaultLogger by default
+func (hub *Hub) SetLogger(logger Logger) {
+	hub.logger = logger
+}
+
+// Connect creates a client of the hub, which must be closed once disconnected
+func (hub *Hub) Connect() *HubClient {
+	return &HubClient{
+		hub:      hub,
+		messages: make(chan HubMessage, hub.bufferSize),
+		done:     make(chan struct{}),
+		topics:   map[string]struct{}{},
+	}
+}
+
+// Broadcast sends data to the clients which joined topic and returns the number of local clients
+// it was delivered to. With a backplane, data is also sent to the clients of the other hubs.
+func (hub *Hub) Broadcast(topic string, data []byte) int {
+	message := HubMessage{Topic: topic, Data: data, Origin: hub.id}
+	delivered := hub.deliver(message)
+	hub.backplaneMutex.RLock()
+	backplane := hub.backplane
+	hub.backplaneMutex.RUnlock()
+	if backplane != nil {
+		if err := backplane.Publish(message); err != nil {
+			hub.logger.Error("backplane publish failed", "topic", topic, "error", err)
+		}
+	}
+	return delivered
+}
+
+// deliver sends message to the local clients which joined its topic
+func (hub *Hub) deliver(message HubMessage) int {
+	delivered, slow := 0, []*HubClient{}
+	hub.mutex.RLock()
+	for client := range hub.topics[message.Topic] {
+		if client.deliver(message, hub.policy) {
+			delivered++
+		} else if hub.policy == DisconnectClient {
+			slow = append(slow, client)
+		}
+	}
+	hub.mutex.RUnlock()
+	for _, client := range slow {
+		client.Close()
+	}
+	return delivered
+}
+
+// Topics returns the topics which have clients
+func (hub *Hub) Topics() []string {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+	topics := make([]string, 0, len(hub.topics))
+	for topic := range hub.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// Clients returns the number of clients which joined topic
+func (hub *Hub) Clients(topic string) int {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+	return len(hub.topics[topic])
+}
+
+// HubClient is a client of a Hub receiving the messages of the topics it joined
+type HubClient struct {
+	hub       *Hub
+	messages  chan HubMessage
+	done      chan struct{}
+	closeOnce sync.Once
+	// topics are the topics the client joined, guarded by the mutex of the hub
+	topics map[string]struct{}
+}
+
+// Join subscribes the client to topic, it does nothing if the client is closed
+func (client *HubClient) Join(topic string) {
+	client.hub.mutex.Lock()
+	defer client.hub.mutex.Unlock()
+	select {
+	case <-client.done:
+		return
+	default:
+	}
+	if client.hub.topics[topic] == nil {
+		client.hub.topics[topic] = map[*HubClient]struct{}{}
+	}
+	client.hub.topics[topic][client] = struct{}{}
+	client.topics[topic] = struct{}{}
+}
+
+// Leave unsubscribes the client from topic
+func (client *HubClient) Leave(topic string) {
+	client.hub.mutex.Lock()
+	defer client.hub.mutex.Unlock()
+	client.leave(topic)
+}
+
+// leave unsubscribes the client from topic, the mutex of the hub must be locked
+func (client *HubClient) leave(topic string) {
+	delete(client.topics, topic)
+	delete(client.hub.topics[topic], client)
+	if len(client.hub.topics[topic]) == 0 {
+		delete(client.hub.topics, topic)
+	}
+}
+
+// Messages returns the channel of the messages broadcast to the topics of the client
+func (client *HubClient) Messages() <-chan HubMessage {
+	return client.messages
+}
+
+// Done returns a channel closed when the client is closed
+func (client *HubClient) Done() <-chan struct{} {
+	return client.done
+}
+
+// Close leaves all the topics of the client, subsequent calls do nothing
+func (client *HubClient) Close() {
+	client.closeOnce.Do(func() {
+		client.hub.mutex.Lock()
+		defer client.hub.mutex.Unlock()
+		for topic := range client.topics {
+			client.leave(topic)
+		}
+		close(client.done)
+	})
+}
+
+// deliver buffers message according to policy, it returns false if the message was not buffered
+func (client *HubClient) deliver(message HubMessage, policy BackpressurePolicy) bool {
+	for {
+		select {
+		case client.messages <- message:
+			return true
+		default:
+		}
+		if policy != DropOldest {
+			return false
+		}
+		select {
+		case <-client.messages:
+		default:
+		}
+	}
+}
+
+// ServeSSE sends the messages of the client as events named after their topic
+// until the client or the stream is closed
+func (client *HubClient) ServeSSE(stream *EventStream) error {
+	for {
+		select {
+		case message := <-client.messages:
+			if err := stream.Send(message.Topic, "", string(message.Data)); err != nil {
+				return err
+			}
+		case <-stream.Done():
+			return nil
+		case <-client.done:
+			return nil
+		}
+	}
+}
+
+// ServeWebSocket sends the messages of the client as text messages until the client or the connection is closed.
+// The connection must be read from another goroutine for pings and close frames to be handled.
+func (client *HubClient) ServeWebSocket(conn *WSConn) error {
+	for {
+		select {
+		case message := <-client.messages:
+			if err := conn.WriteMessage(TextMessage, message.Data); err != nil {
+				return err
+			}
+		case <-conn.Done():
+			return nil
+		case <-client.done:
+			return nil
+		}
+	}
+}
+
+// MemoryBackplane is a Backplane relaying messages between the hubs of a single process
+type MemoryBackplane struct {
+	mutex    sync.RWMutex
+	handlers map[int]func(message HubMessage)
+	next     int
+}
+
+// NewMemoryBackplane creates a MemoryBackplane
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{handlers: map[int]func(message HubMessage){}}
+}
+
+// Publish calls the handlers subscribed to the backplane with message
+func (backplane *MemoryBackplane) Publish(message HubMessage) error {
+	backplane.mutex.RLock()
+	defer backplane.mutex.RUnlock()
+	for _, handler := range backplane.handlers {
+		handler(message)
+	}
+	return nil
+}
+
+// Subscribe calls handler with the messages published until unsubscribe is called
+func (backplane *MemoryBackplane) Subscribe(handler func(message HubMessage)) (unsubscribe func(), err error) {
+	backplane.mutex.Lock()
+	defer backplane.mutex.Unlock()
+	id := backplane.next
+	backplane.handlers[id] = handler
+	backplane.next++
+	return func() {
+		backplane.mutex.Lock()
+		defer backplane.mutex.Unlock()
+		delete(backplane.handlers, id)
+	}, nil
+}
@@ -0,0 +1,476 @@
+package micro
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**********************************/
+/*      INTERNATIONALIZATION      */
+/**********************************/
+
+// LocalizerVar is the Context.Vars key under which the locale middleware of a Translator stores the *Localizer of the request
+const LocalizerVar = "localizer"
+
+// PluralRule returns the plural category of the count n: zero, one, two, few, many or other
+type PluralRule func(n float64) string
+
+// PluralRules are the plural rules of languages, by primary language subtag.
+// Languages without a rule use the rule of English.
+var PluralRules = map[string]PluralRule{
+	"en": oneOtherRule, "de": oneOtherRule, "nl": oneOtherRule, "sv": oneOtherRule, "da": oneOtherRule,
+	"no": oneOtherRule, "it": oneOtherRule, "es": oneOtherRule, "pt": oneOtherRule, "el": oneOtherRule,
+	"fr": func(n float64) string {
+		if n >= 0 && n < 2 {
+			return "one"
+		}
+		return "other"
+	},
+	"ru": slavicRule, "uk": slavicRule,
+	"pl": func(n float64) string {
+		i := int64(n)
+		switch {
+		case float64(i) != n:
+			return "other"
+		case i == 1:
+			return "one"
+		case i%10 >= 2 && i%10 <= 4 && (i%100 < 12 || i%100 > 14):
+			return "few"
+		}
+		return "many"
+	},
+	"ja": otherRule, "zh": otherRule, "ko": otherRule, "tr": otherRule, "vi": otherRule,
+}
+
+// oneOtherRule is the rule of languages with a singular for one only, like English
+func oneOtherRule(n float64) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+// slavicRule is the rule of Russian and Ukrainian
+func slavicRule(n float64) string {
+	i := int64(n)
+	switch {
+	case float64(i) != n:
+		return "other"
+	case i%10 == 1 && i%100 != 11:
+		return "one"
+	case i%10 >= 2 && i%10 <= 4 && (i%100 < 12 || i%100 > 14):
+		return "few"
+	}
+	return "many"
+}
+
+// otherRule is the rule of languages without plural forms
+func otherRule(n float64) string {
+	return "other"
+}
+
+// pluralCategories are the keys of the plural forms of a message
+var pluralCategories = map[string]bool{"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true}
+
+// CatalogDecoders decode message catalogs by file extension, into nested maps of messages
+var CatalogDecoders = map[string]func(data []byte) (map[string]interface{}, error){
+	".json": func(data []byte) (map[string]interface{}, error) {
+		messages := map[string]interface{}{}
+		return messages, json.Unmarshal(data, &messages)
+	},
+	".toml": decodeTOML,
+}
+
+// message is a translated message, with plural forms by category if it has some
+type message struct {
+	text   string
+	plural map[string]string
+}
+
+// Translator translates messages from catalogs of locales. Catalogs are nested objects of messages,
+// whose keys are joined with dots, and messages have {name} placeholders and plural forms:
+//
+//	{
+//		"cart": {
+//			"title": "Cart of {name}",
+//			"items": {"one": "{count} item", "other": "{count} items"}
+//		}
+//	}
+//
+// Messages are translated with Context.T, or with .T in templates:
+//
+//	translator := micro.NewTranslator("en")
+//	if err := translator.Load(locales, "*.json"); err != nil {
+//		log.Fatal(err)
+//	}
+//	app.Use("/", translator.Middleware(micro.LocaleOptions{}))
+//	app.Get("/cart", func(ctx *micro.Context) {
+//		ctx.WriteString(ctx.T("cart.items", "count", 3))
+//	})
+type Translator struct {
+	fallback string
+	mutex    sync.RWMutex
+	// catalogs are the messages by lower case locale and key
+	catalogs map[string]map[string]message
+	// locales are the locales of the catalogs, the fallback locale first
+	locales []string
+}
+
+// NewTranslator creates a translator translating messages missing in a locale in the fallback locale
+func NewTranslator(fallback string) *Translator {
+	return &Translator{fallback: fallback, catalogs: map[string]map[string]message{}, locales: []string{fallback}}
+}
+
+// Load loads the catalogs of fsys matching pattern, decoded according to their extension with CatalogDecoders.
+// The locale of a catalog is its base name without extension, such as pt-BR for locales/pt-BR.json.
+func (t *Translator) Load(fsys fs.FS, pattern string) error {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		decode := CatalogDecoders[path.Ext(name)]
+		if decode == nil {
+			return fmt.Errorf("catalog %s : unsupported format", name)
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		messages, err := decode(data)
+		if err != nil {
+			return fmt.Errorf("catalog %s : %w", name, err)
+		}
+		if err := t.AddMessages(strings.TrimSuffix(path.Base(name), path.Ext(name)), messages); err != nil {
+			return fmt.Errorf("catalog %s : %w", name, err)
+		}
+	}
+	return nil
+}
+
+// AddMessages adds the nested messages of a catalog to the messages of locale
+func (t *Translator) AddMessages(locale string, messages map[string]interface{}) error {
+	flattened := map[string]message{}
+	if err := flattenMessages("", messages, flattened); err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	catalog := t.catalogs[strings.ToLower(locale)]
+	if catalog == nil {
+		catalog = map[string]message{}
+		t.catalogs[strings.ToLower(locale)] = catalog
+		if !strings.EqualFold(locale, t.fallback) {
+			t.locales = append(t.locales, locale)
+		}
+	}
+	for key, message := range flattened {
+		catalog[key] = message
+	}
+	return nil
+}
+
+// flattenMessages adds the messages of nested to flattened, with their keys joined with dots
+func flattenMessages(prefix string, nested map[string]interface{}, flattened map[string]message) error {
+	for key, value := range nested {
+		key = prefix + key
+		switch value := value.(type) {
+		case string:
+			flattened[key] = message{text: value}
+		case map[string]interface{}:
+			if forms, ok := pluralForms(value); ok {
+				flattened[key] = message{text: forms["other"], plural: forms}
+			} else if err := flattenMessages(key+".", value, flattened); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("message %s is not a string", key)
+		}
+	}
+	return nil
+}
+
+// pluralForms returns the plural forms of value if it only has plural categories, including other
+func pluralForms(value map[string]interface{}) (map[string]string, bool) {
+	forms := map[string]string{}
+	for category, form := range value {
+		text, ok := form.(string)
+		if !ok || !pluralCategories[category] {
+			return nil, false
+		}
+		forms[category] = text
+	}
+	_, ok := forms["other"]
+	return forms, ok
+}
+
+// Locales returns the locales of the catalogs, the fallback locale first
+func (t *Translator) Locales() []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return append([]string{}, t.locales...)
+}
+
+// supports returns the locale of the catalogs matching locale, or sharing its primary language
+func (t *Translator) supports(locale string) (string, bool) {
+	if locale == "" {
+		return "", false
+	}
+	primary, _, _ := strings.Cut(locale, "-")
+	for _, candidate := range t.Locales() {
+		if strings.EqualFold(candidate, locale) {
+			return candidate, true
+		}
+	}
+	for _, candidate := range t.Locales() {
+		if strings.EqualFold(candidate, primary) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// Translate returns the message key in locale, or in the fallback locale if locale does not have it,
+// with its placeholders replaced by args, key value pairs like "name", "Jane".
+// The plural form of messages with plural forms is chosen by the count arg.
+// The key is returned if no locale has the message.
+func (t *Translator) Translate(locale string, key string, args ...interface{}) string {
+	primary, _, _ := strings.Cut(locale, "-")
+	fallbackPrimary, _, _ := strings.Cut(t.fallback, "-")
+	t.mutex.RLock()
+	var found *message
+	for _, candidate := range []string{locale, primary, t.fallback, fallbackPrimary} {
+		if message, ok := t.catalogs[strings.ToLower(candidate)][key]; ok {
+			found, locale = &message, candidate
+			break
+		}
+	}
+	t.mutex.RUnlock()
+	if found == nil {
+		return key
+	}
+	text := found.text
+	replacements := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		name := fmt.Sprint(args[i])
+		if name == "count" && found.plural != nil {
+			text = found.pluralForm(locale, args[i+1])
+		}
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(args[i+1]))
+	}
+	return strings.NewReplacer(replacements...).Replace(text)
+}
+
+// pluralForm returns the plural form of the message for count in locale
+func (m *message) pluralForm(locale string, count interface{}) string {
+	n, err := strconv.ParseFloat(fmt.Sprint(count), 64)
+	if err != nil {
+		return m.text
+	}
+	primary, _, _ := strings.Cut(strings.ToLower(locale), "-")
+	rule := PluralRules[primary]
+	if rule == nil {
+		rule = oneOtherRule
+	}
+	if n == 0 {
+		if form, ok := m.plural["zero"]; ok {
+			return form
+		}
+	}
+	if form, ok := m.plural[rule(n)]; ok {
+		return form
+	}
+	return m.text
+}
+
+// LocaleOptions configures the locale middleware of a Translator
+type LocaleOptions struct {
+	// QueryParam is the query parameter selecting the locale, lang if empty.
+	// The selected locale is remembered in the cookie.
+	QueryParam string
+	// CookieName is the name of the cookie of the locale, lang if empty
+	CookieName string
+	// CookieMaxAge is how long the locale is remembered, a year if zero
+	CookieMaxAge time.Duration
+}
+
+// Localizer translates the messages of a request in its locale
+type Localizer struct {
+	// Locale is the locale of the request
+	Locale     string
+	translator *Translator
+}
+
+// T translates the message key in the locale of the localizer, see Translator.Translate
+func (localizer *Localizer) T(key string, args ...interface{}) string {
+	return localizer.translator.Translate(localizer.Locale, key, args...)
+}
+
+// Middleware returns a middleware resolving the locale of the requests among the locales of the catalogs,
+// from the query parameter, the cookie, then the Accept-Language header, the fallback locale otherwise.
+// The *Localizer of the request is stored under LocalizerVar and registered in the request injector.
+func (t *Translator) Middleware(options LocaleOptions) HandlerFunction {
+	if options.QueryParam == "" {
+		options.QueryParam = "lang"
+	}
+	if options.CookieName == "" {
+		options.CookieName = "lang"
+	}
+	if options.CookieMaxAge == 0 {
+		options.CookieMaxAge = 365 * 24 * time.Hour
+	}
+	return func(ctx *Context, injector *Injector, next Next) {
+		locale, ok := t.supports(ctx.Request.URL.Query().Get(options.QueryParam))
+		if ok {
+			http.SetCookie(ctx.Response, &http.Cookie{
+				Name: options.CookieName, Value: locale, Path: "/", MaxAge: int(options.CookieMaxAge / time.Second),
+				SameSite: http.SameSiteLaxMode,
+			})
+		} else if cookie, err := ctx.Request.Cookie(options.CookieName); err == nil {
+			locale, ok = t.supports(cookie.Value)
+		}
+		if !ok {
+			locale = ctx.NegotiateLanguage(t.Locales()...)
+		}
+		localizer := &Localizer{Locale: locale, translator: t}
+		SetVar(ctx, LocalizerVar, localizer)
+		injector.Register(localizer)
+		ctx.Response.Header().Set("Content-Language", locale)
+		next()
+	}
+}
+
+// T translates the message key in the locale of the request, see Translator.Translate.
+// The key is returned if the request has no localizer.
+func (ctx *Context) T(key string, args ...interface{}) string {
+	localizer, ok := GetVar[*Localizer](ctx, LocalizerVar)
+	if !ok {
+		return key
+	}
+	return localizer.T(key, args...)
+}
+
+// Locale returns the locale of the request, empty if the request has no localizer
+func (ctx *Context) Locale() string {
+	if localizer, ok := GetVar[*Localizer](ctx, LocalizerVar); ok {
+		return localizer.Locale
+	}
+	return ""
+}
+
+// decodeTOML decodes the subset of TOML of catalogs: tables, bare, quoted or dotted keys and string values
+func decodeTOML(data []byte) (map[string]interface{}, error) {
+	root := map[string]interface{}{}
+	table := root
+	for number, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var err error
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 || strings.TrimSpace(stripTOMLComment(line[end+1:])) != "" {
+				return nil, fmt.Errorf("line %d : invalid table", number+1)
+			}
+			table, err = tomlTable(root, tomlKeys(line[1:end]))
+		} else {
+			err = setTOMLValue(table, line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d : %w", number+1, err)
+		}
+	}
+	return root, nil
+}
+
+// setTOMLValue sets the key value pair of line in table
+func setTOMLValue(table map[string]interface{}, line string) error {
+	key, value, found := strings.Cut(line, "=")
+	if !found {
+		return fmt.Errorf("expected key = value")
+	}
+	value = strings.TrimSpace(value)
+	var text, rest string
+	switch {
+	case strings.HasPrefix(value, `"`):
+		quoted, err := strconv.QuotedPrefix(value)
+		if err != nil {
+			return fmt.Errorf("invalid string %s", value)
+		}
+		text, _ = strconv.Unquote(quoted)
+		rest = value[len(quoted):]
+	case strings.HasPrefix(value, "'"):
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return fmt.Errorf("invalid string %s", value)
+		}
+		text, rest = value[1:end+1], value[end+2:]
+	default:
+		return fmt.Errorf("unsupported value %s, catalogs only have strings", value)
+	}
+	if strings.TrimSpace(stripTOMLComment(rest)) != "" {
+		return fmt.Errorf("unexpected %s", rest)
+	}
+	keys := tomlKeys(key)
+	parent, err := tomlTable(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	if _, exists := parent[keys[len(keys)-1]]; exists {
+		return fmt.Errorf("duplicate key %s", strings.TrimSpace(key))
+	}
+	parent[keys[len(keys)-1]] = text
+	return nil
+}
+
+// tomlTable returns the table at keys in root, created if it does not exist
+func tomlTable(root map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	table := root
+	for _, key := range keys {
+		value, exists := table[key]
+		if !exists {
+			value = map[string]interface{}{}
+			table[key] = value
+		}
+		child, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("key %s is not a table", key)
+		}
+		table = child
+	}
+	return table, nil
+}
+
+// tomlKeys splits a dotted key, whose parts can be quoted
+func tomlKeys(key string) []string {
+	keys := strings.Split(key, ".")
+	for i := range keys {
+		keys[i] = strings.Trim(strings.TrimSpace(keys[i]), `"'`)
+	}
+	return keys
+}
+
+// stripTOMLComment removes the comment following a value
+func stripTOMLComment(rest string) string {
+	if index := strings.IndexByte(rest, '#'); index >= 0 {
+		return rest[:index]
+	}
+	return rest
+}
+
+// T translates the message key in the locale of the request being rendered, as in {{.T "cart.items" "count" 3}}.
+// The key is returned when rendering outside of a request.
+func (data TemplateData) T(key string, args ...interface{}) string {
+	if data.Context == nil {
+		return key
+	}
+	return data.Context.T(key, args...)
+}
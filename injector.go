@@ -1,107 +1,654 @@
-package micro
-
-import	(
-	"reflect" 
-	"fmt"
-	"runtime/debug"
-)
-
-/**********************************/
-/*            INJECTOR            */
-/**********************************/
-
-// Injector is a dependency injection container
-// Based on types.
-type Injector struct {
-	services map[reflect.Type]interface{}
-	parent   *Injector
-}
-
-// NewInjector returns an new Injector
-func NewInjector(services ...interface{}) *Injector {
-	injector := &Injector{services: map[reflect.Type]interface{}{}}
-	for _, service := range services {
-		injector.Register(service)
-	}
-	return injector
-}
-
-// Register registers a new service to the injector
-func (i *Injector) Register(service interface{}) {
-	i.services[reflect.ValueOf(service).Type()] = service
-}
-
-// RegisterWithType registers a new service to the injector with a given type
-func (i *Injector) RegisterWithType(service interface{}, Type interface{}) {
-	if !reflect.TypeOf(service).ConvertibleTo(reflect.TypeOf(Type)) {
-		panic(fmt.Sprint(service, " is not convertible to ", Type))
-	}
-	i.services[reflect.TypeOf(Type)] = service
-}
-
-// Resolve fetch the value according to a registered type
-func (i *Injector) Resolve(someType reflect.Type) (interface{}, error) {
-	var (
-		err     error
-		service interface{}
-	)
-	for typeService, service := range i.services {
-		if typeService == someType {
-			return service, nil
-		} else if someType.Kind() == reflect.Interface && typeService.Implements(someType) {
-			return service, nil
-		} else if someType.Kind() == reflect.Ptr && someType.Elem().Kind() == reflect.Interface && typeService.Implements(someType.Elem()) {
-			return service, nil
-		}
-	}
-	if service == nil && i.parent != nil && i.parent != i {
-		service, err = i.parent.Resolve(someType)
-	}
-	if service == nil {
-		err = fmt.Errorf("service with type %v cannot be injected : not found", someType)
-	}
-	return service, err
-}
-
-// Apply applies resolved values to the given function
-func (i *Injector) Apply(function interface{}) ([]interface{}, error) {
-	var err error
-	if !IsCallable(function) {
-		return nil, fmt.Errorf("%v is not a function or a method\r\n%s", function, debug.Stack())
-	}
-	arguments := []reflect.Value{}
-	callableValue := reflect.ValueOf(function)
-	for j := 0; j < callableValue.Type().NumIn(); j++ {
-		argument, err := i.Resolve(callableValue.Type().In(j))
-		if err != nil {
-			return nil, err
-		}
-		arguments = append(arguments, reflect.ValueOf(argument))
-	}
-	results := callableValue.Call(arguments)
-
-	out := []interface{}{}
-	for _, result := range results {
-		out = append(out, result.Interface())
-	}
-	return out, err
-}
-
-// MustApply is the "can panic" version of MustApply
-func (i *Injector) MustApply(function interface{}) (results []interface{}) {
-	results, err := i.Apply(function)
-	if err != nil {
-		panic(err)
-	}
-	return
-}
-
-// SetParent sets the injector's parent
-func (i *Injector) SetParent(parent *Injector) {
-	i.parent = parent
-}
-
-// Parent gets the injector's parent
-func (i Injector) Parent() *Injector {
-	return i.parent
-}
\ No newline at end of file
+package micro
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+/**********************************/
+/*            INJECTOR            */
+/**********************************/
+
+// Injector is a dependency injection container
+// Based on types.
+type Injector struct {
+	services  map[reflect.Type]interface{}
+	named     map[string]interface{}
+	providers map[reflect.Type]*provider
+	parent    *Injector
+	mutex     sync.Mutex
+	cleanups  []func()
+	// singleton is true for the injectors singletons are built with
+	singleton bool
+}
+
+// Lifetime is the lifetime of a service built by a provider
+type Lifetime int
+
+const (
+	// Singleton services are built once and shared by the injector owning the provider and its children
+	Singleton Lifetime = iota
+	// Scoped services are built once per injector resolving them, that is once per request
+	// when registered on the application injector. They cannot be injected in singletons.
+	Scoped
+	// Transient services are built on each resolution
+	Transient
+)
+
+func (lifetime Lifetime) String() string {
+	switch lifetime {
+	case Singleton:
+		return "singleton"
+	case Scoped:
+		return "scoped"
+	case Transient:
+		return "transient"
+	}
+	return fmt.Sprintf("Lifetime(%d)", int(lifetime))
+}
+
+// provider builds a service on demand
+type provider struct {
+	factory  reflect.Value
+	lifetime Lifetime
+	mutex    sync.Mutex
+	built    bool
+	service  interface{}
+}
+
+var (
+	// errorType is the type of error
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	// cleanupType is the type of the cleanup functions returned by factories
+	cleanupType = reflect.TypeOf(func() {})
+)
+
+// ResolutionError is returned when the arguments of a function cannot be resolved
+type ResolutionError struct {
+	// Function is the name and source location of the function
+	Function string
+	// Chain is the dependency chain, from the argument of the function
+	// through the services built by providers to the service that could not be resolved
+	Chain []reflect.Type
+	// Cycle is true if providers depend on each other
+	Cycle bool
+	// Err is the underlying error
+	Err error
+}
+
+func (err *ResolutionError) Error() string {
+	chain := make([]string, len(err.Chain))
+	for j, someType := range err.Chain {
+		chain[j] = fmt.Sprint(someType)
+	}
+	message := fmt.Sprintf("%s : %v", strings.Join(chain, " -> "), err.Err)
+	if err.Cycle {
+		message = "circular dependency " + strings.Join(chain, " -> ")
+	}
+	if err.Function != "" {
+		return fmt.Sprintf("cannot call %s : %s", err.Function, message)
+	}
+	return message
+}
+
+// Unwrap returns the underlying error
+func (err *ResolutionError) Unwrap() error {
+	return err.Err
+}
+
+// functionLocation returns the name and source location of a function
+func functionLocation(function reflect.Value) string {
+	runtimeFunction := runtime.FuncForPC(function.Pointer())
+	if runtimeFunction == nil {
+		return function.Type().String()
+	}
+	file, line := runtimeFunction.FileLine(runtimeFunction.Entry())
+	return fmt.Sprintf("%s (%s:%d)", runtimeFunction.Name(), file, line)
+}
+
+// In is embedded in structs whose fields are injected,
+// so a function can depend on several services of the same type registered with RegisterNamed.
+// Fields with an inject tag are resolved by name, fields with a param tag are bound
+// to route parameters (see Params), other exported fields are resolved by type:
+//
+//	type Databases struct {
+//	    micro.In
+//	    Read  *sql.DB `inject:"readDB"`
+//	    Write *sql.DB `inject:"writeDB"`
+//	}
+//
+//	app.Get("/", func(ctx *micro.Context, databases Databases) {})
+type In struct{}
+
+var (
+	// inType is the type of In
+	inType = reflect.TypeOf(In{})
+	// argumentTypesCache caches the argument types of functions by function type,
+	// so handlers called on each request are analysed once
+	argumentTypesCache sync.Map
+	// inStructCache caches isInStruct by type
+	inStructCache sync.Map
+)
+
+// NewInjector returns an new Injector
+func NewInjector(services ...interface{}) *Injector {
+	injector := &Injector{
+		services:  map[reflect.Type]interface{}{},
+		named:     map[string]interface{}{},
+		providers: map[reflect.Type]*provider{},
+	}
+	for _, service := range services {
+		injector.Register(service)
+	}
+	return injector
+}
+
+// Register registers a new service to the injector
+func (i *Injector) Register(service interface{}) {
+	i.registerAs(service, reflect.ValueOf(service).Type())
+}
+
+// RegisterWithType registers a new service to the injector with a given type
+func (i *Injector) RegisterWithType(service interface{}, Type interface{}) {
+	if !reflect.TypeOf(service).ConvertibleTo(reflect.TypeOf(Type)) {
+		panic(fmt.Sprint(service, " is not convertible to ", Type))
+	}
+	i.registerAs(service, reflect.TypeOf(Type))
+}
+
+// RegisterAs registers a service under an interface type, given as a nil pointer to the interface,
+// so functions can depend on the interface while the implementation is chosen at boot:
+//
+//	injector.RegisterAs(NewRedisStorage(), (*Storage)(nil))
+//
+// Can Panic!
+func (i *Injector) RegisterAs(service interface{}, someInterface interface{}) {
+	interfaceType := reflect.TypeOf(someInterface)
+	if interfaceType == nil || interfaceType.Kind() != reflect.Ptr || interfaceType.Elem().Kind() != reflect.Interface {
+		panic(fmt.Sprint(someInterface, " is not a pointer to an interface"))
+	}
+	interfaceType = interfaceType.Elem()
+	if service == nil || !reflect.TypeOf(service).Implements(interfaceType) {
+		panic(fmt.Sprint(service, " does not implement ", interfaceType))
+	}
+	i.registerAs(service, interfaceType)
+}
+
+// Provide registers a factory building a service the first time it is resolved.
+// The factory returns the service and optionally an error, its arguments are injected:
+//
+//	injector.Provide(func(config *Config) (*sql.DB, error) {
+//	    return sql.Open("postgres", config.DSN)
+//	})
+//
+// The service is then shared by all resolutions.
+//
+// Can Panic!
+func (i *Injector) Provide(factory interface{}) {
+	i.ProvideWithLifetime(factory, Singleton)
+}
+
+// ProvideScoped registers a factory called once per injector resolving the service.
+// Registered on the application injector, it builds a service per request
+// with dependencies resolved from the request injector.
+//
+// Factories can also return a cleanup function, called by Injector.Cleanup
+// in the reverse order services were built. Request injectors are cleaned up
+// once the response is complete:
+//
+//	injector.ProvideScoped(func(db *sql.DB) (*sql.Tx, func(), error) {
+//	    tx, err := db.Begin()
+//	    if err != nil {
+//	        return nil, nil, err
+//	    }
+//	    return tx, func() { tx.Rollback() }, nil
+//	})
+//
+// Can Panic!
+func (i *Injector) ProvideScoped(factory interface{}) {
+	i.ProvideWithLifetime(factory, Scoped)
+}
+
+// ProvideTransient registers a factory called each time the service is resolved.
+// Cleanup functions are registered on the injector resolving the service.
+//
+// Can Panic!
+func (i *Injector) ProvideTransient(factory interface{}) {
+	i.ProvideWithLifetime(factory, Transient)
+}
+
+// ProvideWithLifetime registers a factory building services with the given lifetime
+//
+// Can Panic!
+func (i *Injector) ProvideWithLifetime(factory interface{}, lifetime Lifetime) {
+	if !isFactory(reflect.TypeOf(factory)) {
+		panic(fmt.Sprint(factory, " is not a factory, a factory returns a service, optionally a cleanup function and an error"))
+	}
+	factoryType := reflect.TypeOf(factory)
+	i.providers[factoryType.Out(0)] = &provider{factory: reflect.ValueOf(factory), lifetime: lifetime}
+}
+
+// isFactory returns true if factoryType is a function returning a service,
+// optionally followed by a cleanup function, an error or both
+func isFactory(factoryType reflect.Type) bool {
+	if factoryType == nil || factoryType.Kind() != reflect.Func {
+		return false
+	}
+	switch factoryType.NumOut() {
+	case 1:
+		return true
+	case 2:
+		return factoryType.Out(1) == errorType || factoryType.Out(1) == cleanupType
+	case 3:
+		return factoryType.Out(1) == cleanupType && factoryType.Out(2) == errorType
+	}
+	return false
+}
+
+// get returns the service of the provider owned by owner, resolved by origin.
+// path is the chain of services being built.
+func (p *provider) get(owner *Injector, origin *Injector, path []reflect.Type) (interface{}, error) {
+	providedType := p.factory.Type().Out(0)
+	for _, someType := range path {
+		if someType == providedType {
+			return nil, &ResolutionError{Chain: append(append([]reflect.Type{}, path...), providedType), Cycle: true}
+		}
+	}
+	path = append(append([]reflect.Type{}, path...), providedType)
+	switch p.lifetime {
+	case Transient:
+		return origin.build(p.factory, path)
+	case Scoped:
+		if origin.singleton {
+			return nil, fmt.Errorf("scoped service with type %v cannot be injected in a singleton", p.factory.Type().Out(0))
+		}
+		service, err := origin.build(p.factory, path)
+		if err != nil {
+			return nil, err
+		}
+		origin.mutex.Lock()
+		defer origin.mutex.Unlock()
+		// the service built by a concurrent resolution first is kept
+		if built, ok := origin.services[providedType]; ok {
+			return built, nil
+		}
+		origin.services[providedType] = service
+		return service, nil
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.built {
+		// singletons are built in their own scope so they cannot capture scoped services
+		// of the injector resolving them, and their cleanups belong to the owner
+		scope := NewInjector()
+		scope.SetParent(owner)
+		scope.singleton = true
+		service, err := scope.build(p.factory, path)
+		owner.mutex.Lock()
+		owner.cleanups = append(owner.cleanups, scope.cleanups...)
+		owner.mutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		p.service, p.built = service, true
+	}
+	return p.service, nil
+}
+
+// build calls a factory, its cleanup function is registered on the injector
+func (i *Injector) build(factory reflect.Value, path []reflect.Type) (interface{}, error) {
+	results, err := i.call(factory, path)
+	if err != nil {
+		return nil, err
+	}
+	if last := results[len(results)-1]; len(results) > 1 && last.Type() == errorType && !last.IsNil() {
+		return nil, fmt.Errorf("provider of %v failed : %w", factory.Type().Out(0), last.Interface().(error))
+	}
+	if len(results) > 1 && results[1].Type() == cleanupType {
+		if cleanup := results[1].Interface().(func()); cleanup != nil {
+			i.mutex.Lock()
+			i.cleanups = append(i.cleanups, cleanup)
+			i.mutex.Unlock()
+		}
+	}
+	return results[0].Interface(), nil
+}
+
+// onCleanup registers a cleanup function called by Cleanup
+func (i *Injector) onCleanup(cleanup func()) {
+	i.mutex.Lock()
+	i.cleanups = append(i.cleanups, cleanup)
+	i.mutex.Unlock()
+}
+
+// Cleanup calls the cleanup functions of the services built by the injector,
+// in the reverse order the services were built
+func (i *Injector) Cleanup() {
+	i.mutex.Lock()
+	cleanups := i.cleanups
+	i.cleanups = nil
+	i.mutex.Unlock()
+	for j := len(cleanups) - 1; j >= 0; j-- {
+		cleanups[j]()
+	}
+}
+
+// RegisterNamed registers a service under a name, so services of the same type can coexist
+func (i *Injector) RegisterNamed(name string, service interface{}) {
+	i.named[name] = service
+}
+
+// ResolveNamed fetches the service registered under name, which must be assignable to someType.
+// someType can be nil.
+func (i *Injector) ResolveNamed(name string, someType reflect.Type) (interface{}, error) {
+	if service, ok := i.named[name]; ok {
+		if someType != nil && (service == nil || !reflect.TypeOf(service).AssignableTo(someType)) {
+			return nil, fmt.Errorf("service named %s with type %T cannot be injected as %v", name, service, someType)
+		}
+		return service, nil
+	}
+	if i.parent != nil && i.parent != i {
+		return i.parent.ResolveNamed(name, someType)
+	}
+	return nil, fmt.Errorf("service named %s cannot be injected : not found", name)
+}
+
+// reset removes all services and the parent of a pooled injector
+func (i *Injector) reset() {
+	clear(i.services)
+	clear(i.named)
+	clear(i.providers)
+	i.cleanups = nil
+	i.parent = nil
+}
+
+// registerAs registers a service under someType, which is usually an interface type
+func (i *Injector) registerAs(service interface{}, someType reflect.Type) {
+	i.mutex.Lock()
+	i.services[someType] = service
+	i.mutex.Unlock()
+}
+
+// Resolve fetch the value according to a registered type
+func (i *Injector) Resolve(someType reflect.Type) (interface{}, error) {
+	return i.resolve(someType, i, nil)
+}
+
+// resolve fetches a service for origin, the injector the resolution started from.
+// path is the chain of services being built by providers.
+func (i *Injector) resolve(someType reflect.Type, origin *Injector, path []reflect.Type) (interface{}, error) {
+	var (
+		err     error
+		service interface{}
+	)
+	if service, ok := i.service(someType, false); ok {
+		return service, nil
+	}
+	if isInStruct(someType) {
+		return i.resolveStruct(someType, path)
+	}
+	if provider, ok := i.providers[someType]; ok {
+		return provider.get(i, origin, path)
+	}
+	if service, ok := i.service(someType, true); ok {
+		return service, nil
+	}
+	if someType.Kind() == reflect.Interface {
+		for providedType, provider := range i.providers {
+			if providedType.Implements(someType) {
+				return provider.get(i, origin, path)
+			}
+		}
+	}
+	if service == nil && i.parent != nil && i.parent != i {
+		service, err = i.parent.resolve(someType, origin, path)
+	}
+	if service == nil && err == nil {
+		err = fmt.Errorf("service with type %v cannot be injected : not found", someType)
+	}
+	return service, err
+}
+
+// service returns the service registered with someType, or if implementing is true
+// a service implementing someType or the interface someType points to
+func (i *Injector) service(someType reflect.Type, implementing bool) (interface{}, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if service, ok := i.services[someType]; ok || !implementing {
+		return service, ok
+	}
+	for typeService, service := range i.services {
+		if someType.Kind() == reflect.Interface && typeService.Implements(someType) {
+			return service, true
+		} else if someType.Kind() == reflect.Ptr && someType.Elem().Kind() == reflect.Interface && typeService.Implements(someType.Elem()) {
+			return service, true
+		}
+	}
+	return nil, false
+}
+
+// argumentTypes returns the argument types of a function type
+func argumentTypes(functionType reflect.Type) []reflect.Type {
+	if cached, ok := argumentTypesCache.Load(functionType); ok {
+		return cached.([]reflect.Type)
+	}
+	types := make([]reflect.Type, functionType.NumIn())
+	for j := range types {
+		types[j] = functionType.In(j)
+	}
+	argumentTypesCache.Store(functionType, types)
+	return types
+}
+
+// Resolve returns the service of type T, T can be an interface:
+//
+//	storage, err := micro.Resolve[Storage](app.Injector())
+func Resolve[T any](injector *Injector) (T, error) {
+	var zero T
+	service, err := injector.Resolve(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil || service == nil {
+		return zero, err
+	}
+	typed, ok := service.(T)
+	if !ok {
+		return zero, fmt.Errorf("service with type %T cannot be injected as %v", service, reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return typed, nil
+}
+
+// MustResolve is the "can panic" version of Resolve
+//
+// Can Panic!
+func MustResolve[T any](injector *Injector) T {
+	service, err := Resolve[T](injector)
+	if err != nil {
+		panic(err)
+	}
+	return service
+}
+
+// isInStruct returns true if someType is a struct, or a pointer to a struct, that embeds In
+func isInStruct(someType reflect.Type) bool {
+	if cached, ok := inStructCache.Load(someType); ok {
+		return cached.(bool)
+	}
+	inStruct := embedsIn(someType)
+	inStructCache.Store(someType, inStruct)
+	return inStruct
+}
+
+// embedsIn returns true if someType is a struct, or a pointer to a struct, that embeds In
+func embedsIn(someType reflect.Type) bool {
+	if someType.Kind() == reflect.Ptr {
+		someType = someType.Elem()
+	}
+	if someType.Kind() != reflect.Struct {
+		return false
+	}
+	for j := 0; j < someType.NumField(); j++ {
+		if field := someType.Field(j); field.Anonymous && field.Type == inType {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveStruct returns a struct embedding In with its fields injected
+func (i *Injector) resolveStruct(someType reflect.Type, path []reflect.Type) (interface{}, error) {
+	structType := someType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	value := reflect.New(structType).Elem()
+	for j := 0; j < structType.NumField(); j++ {
+		field := structType.Field(j)
+		if field.Type == inType || !field.IsExported() {
+			continue
+		}
+		var (
+			service interface{}
+			err     error
+		)
+		if name := field.Tag.Get("param"); name != "" {
+			if err = i.bindParam(value.Field(j), name, path); err != nil {
+				return nil, err
+			}
+			continue
+		} else if name := field.Tag.Get("inject"); name != "" {
+			service, err = i.ResolveNamed(name, field.Type)
+		} else {
+			service, err = i.resolve(field.Type, i, path)
+		}
+		if _, ok := err.(*ResolutionError); ok {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("field %s of %v : %w", field.Name, structType, err)
+		}
+		value.Field(j).Set(reflect.ValueOf(service))
+	}
+	if someType.Kind() == reflect.Ptr {
+		return value.Addr().Interface(), nil
+	}
+	return value.Interface(), nil
+}
+
+// bindParam sets field to the route parameter name converted to the type of the field,
+// field is left to its zero value if the parameter is missing
+func (i *Injector) bindParam(field reflect.Value, name string, path []reflect.Type) error {
+	params, err := i.resolve(paramsType, i, path)
+	if err != nil {
+		return err
+	}
+	value, ok := params.(Params)[name]
+	if !ok {
+		return nil
+	}
+	converted, err := convertString(value, field.Type())
+	if err != nil {
+		return &ParamError{Name: name, Value: value, Type: field.Type(), Err: err}
+	}
+	field.Set(converted)
+	return nil
+}
+
+// Apply applies resolved values to the given function
+func (i *Injector) Apply(function interface{}) ([]interface{}, error) {
+	results, err := i.Call(function)
+	if err != nil {
+		return nil, err
+	}
+	out := []interface{}{}
+	for _, result := range results {
+		out = append(out, result.Interface())
+	}
+	return out, nil
+}
+
+// Call calls function, or a pointer to a function, with resolved arguments and returns its results.
+// If an argument cannot be resolved, the function is not called
+// and a *ResolutionError describing the missing dependency is returned.
+//
+//	results, err := injector.Call(func(db *sql.DB) (int, error) { ... })
+func (i *Injector) Call(function interface{}) ([]reflect.Value, error) {
+	if !IsCallable(function) {
+		return nil, fmt.Errorf("%v is not a function or a method\r\n%s", function, debug.Stack())
+	}
+	callableValue := reflect.ValueOf(function)
+	if callableValue.Kind() == reflect.Ptr {
+		callableValue = callableValue.Elem()
+	}
+	results, err := i.call(callableValue, nil)
+	var resolutionError *ResolutionError
+	if errors.As(err, &resolutionError) && resolutionError.Function == "" {
+		resolutionError.Function = functionLocation(callableValue)
+	}
+	return results, err
+}
+
+// call calls function with resolved arguments, path is the chain of services being built
+func (i *Injector) call(function reflect.Value, path []reflect.Type) ([]reflect.Value, error) {
+	types := argumentTypes(function.Type())
+	arguments := make([]reflect.Value, len(types))
+	for j, argumentType := range types {
+		argument, err := i.resolve(argumentType, i, path)
+		if _, ok := err.(*ResolutionError); ok {
+			return nil, err
+		} else if err != nil {
+			return nil, &ResolutionError{Chain: append(append([]reflect.Type{}, path...), argumentType), Err: err}
+		}
+		if argument == nil {
+			arguments[j] = reflect.Zero(argumentType)
+		} else {
+			arguments[j] = reflect.ValueOf(argument)
+		}
+	}
+	return function.Call(arguments), nil
+}
+
+// MustApply is the "can panic" version of MustApply
+func (i *Injector) MustApply(function interface{}) (results []interface{}) {
+	results, err := i.Apply(function)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// Child returns a new injector whose parent is the injector,
+// services registered on the child shadow the services of the parent
+func (i *Injector) Child() *Injector {
+	child := NewInjector()
+	child.SetParent(i)
+	return child
+}
+
+// Override returns a child of the injector with services registered,
+// so tests can replace services without modifying the injector:
+//
+//	defer app.SetInjector(app.Injector())
+//	app.SetInjector(app.Injector().Override(&FakeMailer{}))
+//
+// Services also replace the services of interface types they implement.
+// Singletons already built by the injector keep their dependencies.
+func (i *Injector) Override(services ...interface{}) *Injector {
+	child := i.Child()
+	for _, service := range services {
+		child.Register(service)
+	}
+	return child
+}
+
+// SetParent sets the injector's parent
+func (i *Injector) SetParent(parent *Injector) {
+	i.parent = parent
+}
+
+// Parent gets the injector's parent
+func (i *Injector) Parent() *Injector {
+	return i.parent
+}
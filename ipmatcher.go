@@ -0,0 +1,133 @@
+package micro
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+/**********************************/
+/*           IP MATCHER           */
+/**********************************/
+
+// IPMatcher matches the requests by the IP address of their client, against lists of allowed
+// and denied CIDR ranges. Behind reverse proxies, the client address is read from the
+// X-Forwarded-For header added by the trusted proxies.
+// It is a route matcher, and a middleware answering requests not matching with 403 Forbidden:
+//
+//	office := micro.NewIPMatcher("203.0.113.0/24", "10.8.0.0/16").TrustProxies("10.0.0.0/8")
+//	app.Get("/metrics", metrics).AddMatcher(office)
+//	admin.Use("/", office.Middleware())
+//
+// Matchers are configured before the application serves requests.
+type IPMatcher struct {
+	allowed        []netip.Prefix
+	denied         []netip.Prefix
+	trustedProxies []netip.Prefix
+}
+
+// NewIPMatcher creates a matcher allowing the clients in the ranges allowed, CIDR ranges or IP addresses.
+// Without ranges all clients are allowed, except the denied ones.
+//
+// Can Panic! if a range is not valid
+func NewIPMatcher(allowed ...string) *IPMatcher {
+	return &IPMatcher{allowed: mustParsePrefixes(allowed)}
+}
+
+// Deny denies the clients in ranges, even if they are allowed.
+//
+// Can Panic! if a range is not valid
+func (matcher *IPMatcher) Deny(ranges ...string) *IPMatcher {
+	matcher.denied = append(matcher.denied, mustParsePrefixes(ranges)...)
+	return matcher
+}
+
+// TrustProxies trusts the X-Forwarded-For header of the requests sent by the proxies in ranges.
+//
+// Can Panic! if a range is not valid
+func (matcher *IPMatcher) TrustProxies(ranges ...string) *IPMatcher {
+	matcher.trustedProxies = append(matcher.trustedProxies, mustParsePrefixes(ranges)...)
+	return matcher
+}
+
+// ClientIP returns the IP address of the client of request. It is the remote address of the request,
+// or if it is a trusted proxy, the last address of the X-Forwarded-For header which is not a trusted proxy.
+// It returns an invalid address if the address cannot be parsed.
+func (matcher *IPMatcher) ClientIP(request *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	client, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	client = client.Unmap()
+	// addresses are appended by each proxy, they are read from the closest proxy
+	forwarded := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0 && prefixesContain(matcher.trustedProxies, client); i-- {
+		address := strings.TrimSpace(forwarded[i])
+		if address == "" {
+			continue
+		}
+		if client, err = netip.ParseAddr(address); err != nil {
+			return netip.Addr{}
+		}
+		client = client.Unmap()
+	}
+	return client
+}
+
+// Match returns true if the client of request is allowed and not denied
+func (matcher *IPMatcher) Match(request *http.Request) bool {
+	client := matcher.ClientIP(request)
+	if !client.IsValid() || prefixesContain(matcher.denied, client) {
+		return false
+	}
+	return len(matcher.allowed) == 0 || prefixesContain(matcher.allowed, client)
+}
+
+// Middleware returns a middleware answering the requests whose client is not allowed with 403 Forbidden
+func (matcher *IPMatcher) Middleware() HandlerFunction {
+	return func(request *http.Request, next Next) error {
+		if !matcher.Match(request) {
+			return Forbidden("")
+		}
+		next()
+		return nil
+	}
+}
+
+// prefixesContain returns true if address is in one of prefixes
+func prefixesContain(prefixes []netip.Prefix, address netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// mustParsePrefixes parses CIDR ranges and IP addresses, the ranges of a single address
+func mustParsePrefixes(ranges []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(ranges))
+	for _, value := range ranges {
+		if !strings.Contains(value, "/") {
+			address, err := netip.ParseAddr(value)
+			if err != nil {
+				panic(fmt.Sprintf("invalid IP range %q : %v", value, err))
+			}
+			address = address.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(address, address.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			panic(fmt.Sprintf("invalid IP range %q : %v", value, err))
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
@@ -0,0 +1,251 @@
+package micro
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/**********************************/
+/*              JSON              */
+/**********************************/
+
+// JSONEncoder encodes values to JSON, *json.Encoder implements it
+// as do the encoders of most drop-in replacements of encoding/json
+type JSONEncoder interface {
+	Encode(v interface{}) error
+	SetIndent(prefix, indent string)
+	SetEscapeHTML(on bool)
+}
+
+// JSONConfig configures how Context.WriteJSON and Context.WriteJSONP encode responses
+type JSONConfig struct {
+	// Indent is the indentation of responses in debug mode, responses are compact otherwise
+	Indent string
+	// EscapeHTML escapes <, > and & in strings
+	EscapeHTML bool
+	// NewEncoder returns the encoder writing to w, encoding/json is used if nil
+	NewEncoder func(w io.Writer) JSONEncoder
+	// Prefix is written before JSON responses to prevent JSON hijacking,
+	// clients strip it before parsing, e.g. JSONHijackingPrefix
+	Prefix string
+}
+
+// JSONHijackingPrefix is a JSONConfig.Prefix that makes JSON responses unexecutable as scripts
+const JSONHijackingPrefix = ")]}',\n"
+
+// ErrInvalidJSONPCallback is returned by Context.WriteJSONP when the callback is not a safe javascript identifier
+var ErrInvalidJSONPCallback = errors.New("invalid JSONP callback name")
+
+// jsonpCallback matches safe JSONP callback names: identifiers, optionally dotted
+var jsonpCallback = regexp.MustCompile(`^[a-zA-Z_$][0-9a-zA-Z_$]*(\.[a-zA-Z_$][0-9a-zA-Z_$]*)*$`)
+
+// DefaultJSONConfig is the JSON configuration of new applications
+var DefaultJSONConfig = JSONConfig{Indent: "  ", EscapeHTML: true}
+
+// SetJSONConfig sets how JSON responses are encoded,
+// config should be derived from DefaultJSONConfig:
+//
+//	config := micro.DefaultJSONConfig
+//	config.EscapeHTML = false
+//	app.SetJSONConfig(config)
+func (e *Micro) SetJSONConfig(config JSONConfig) {
+	e.jsonConfig = config
+}
+
+// JSONConfig returns the JSON configuration of the application
+func (e *Micro) JSONConfig() JSONConfig {
+	return e.jsonConfig
+}
+
+// jsonConfig returns the JSON configuration of the application of ctx
+func (ctx *Context) jsonConfig() JSONConfig {
+	if ctx.app != nil {
+		return ctx.app.jsonConfig
+	}
+	return DefaultJSONConfig
+}
+
+// newJSONEncoder returns an encoder writing to w configured by the application
+func (ctx *Context) newJSONEncoder(w io.Writer) JSONEncoder {
+	config, debug := ctx.jsonConfig(), ctx.app != nil && ctx.app.debug
+	var encoder JSONEncoder
+	if config.NewEncoder != nil {
+		encoder = config.NewEncoder(w)
+	} else {
+		encoder = json.NewEncoder(w)
+	}
+	encoder.SetEscapeHTML(config.EscapeHTML)
+	if debug && config.Indent != "" {
+		encoder.SetIndent("", config.Indent)
+	}
+	return encoder
+}
+
+// JSONDecodeOptions configures how Context.ReadJSON decodes request bodies
+type JSONDecodeOptions struct {
+	// DisallowUnknownFields makes decoding fail when the body has keys
+	// that do not match any field of the destination struct
+	DisallowUnknownFields bool
+	// MaxDepth is the maximum nesting depth of objects and arrays, 0 means no limit
+	MaxDepth int
+	// MaxBodySize is the maximum size of the body, JSONMaxBodySize if 0
+	MaxBodySize int64
+}
+
+// JSONMaxBodySize is the maximum size of the bodies read by Context.ReadJSON without MaxBodySize option,
+// larger bodies are answered with 413 Request Entity Too Large
+var JSONMaxBodySize int64 = 10 << 20
+
+// JSONDecodeOption is an option of Context.ReadJSON
+type JSONDecodeOption func(options *JSONDecodeOptions)
+
+// DisallowUnknownFields makes ReadJSON fail on unknown fields
+func DisallowUnknownFields() JSONDecodeOption {
+	return func(options *JSONDecodeOptions) { options.DisallowUnknownFields = true }
+}
+
+// MaxDepth makes ReadJSON fail on bodies nested deeper than depth
+func MaxDepth(depth int) JSONDecodeOption {
+	return func(options *JSONDecodeOptions) { options.MaxDepth = depth }
+}
+
+// MaxBodySize makes ReadJSON fail with 413 Request Entity Too Large on bodies larger than size
+func MaxBodySize(size int64) JSONDecodeOption {
+	return func(options *JSONDecodeOptions) { options.MaxBodySize = size }
+}
+
+// JSONDecodeError is returned by Context.ReadJSON when the request body cannot be decoded.
+// It is serialized as a structured error:
+//
+//	{"message":"...","field":"address.city","offset":42}
+type JSONDecodeError struct {
+	Message string `json:"message"`
+	// Field is the path of the field that could not be decoded, if any
+	Field string `json:"field,omitempty"`
+	// Offset is the position in the body where the error occurred
+	Offset int64 `json:"offset"`
+	// Err is the underlying error
+	Err error `json:"-"`
+}
+
+func (err *JSONDecodeError) Error() string {
+	if err.Field != "" {
+		return fmt.Sprintf("invalid JSON at offset %d, field %s: %s", err.Offset, err.Field, err.Message)
+	}
+	return fmt.Sprintf("invalid JSON at offset %d: %s", err.Offset, err.Message)
+}
+
+// Unwrap returns the underlying error
+func (err *JSONDecodeError) Unwrap() error {
+	return err.Err
+}
+
+// StatusCode returns the status of the response a decode error should produce
+func (err *JSONDecodeError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// readJSON decodes r into v according to options
+func readJSON(r io.Reader, v interface{}, options ...JSONDecodeOption) error {
+	config := JSONDecodeOptions{}
+	for _, option := range options {
+		option(&config)
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = JSONMaxBodySize
+	}
+	r = http.MaxBytesReader(nil, io.NopCloser(r), config.MaxBodySize)
+	if config.MaxDepth > 0 {
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return newJSONDecodeError(err, 0)
+		}
+		if offset, exceeded := exceedsDepth(body, config.MaxDepth); exceeded {
+			return &JSONDecodeError{
+				Message: fmt.Sprintf("maximum nesting depth of %d exceeded", config.MaxDepth),
+				Offset:  offset,
+			}
+		}
+		r = bytes.NewReader(body)
+	}
+	decoder := json.NewDecoder(r)
+	if config.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return newJSONDecodeError(err, decoder.InputOffset())
+	}
+	return nil
+}
+
+// newJSONDecodeError converts an encoding/json error to a JSONDecodeError
+func newJSONDecodeError(err error, offset int64) error {
+	var (
+		syntaxError   *json.SyntaxError
+		typeError     *json.UnmarshalTypeError
+		maxBytesError *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &maxBytesError):
+		return NewHTTPError(http.StatusRequestEntityTooLarge, "").WithInternal(err)
+	case errors.As(err, &syntaxError):
+		return &JSONDecodeError{Message: syntaxError.Error(), Offset: syntaxError.Offset, Err: err}
+	case errors.As(err, &typeError):
+		return &JSONDecodeError{
+			Message: fmt.Sprintf("cannot use %s as %v", typeError.Value, typeError.Type),
+			Field:   typeError.Field,
+			Offset:  typeError.Offset,
+			Err:     err,
+		}
+	case errors.Is(err, io.EOF):
+		return &JSONDecodeError{Message: "request body is empty", Err: err}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &JSONDecodeError{Message: "unexpected end of request body", Offset: offset, Err: err}
+	}
+	if field, ok := unknownField(err); ok {
+		return &JSONDecodeError{Message: "unknown field", Field: field, Offset: offset, Err: err}
+	}
+	return err
+}
+
+// unknownField returns the key of the unknown field error of a decoder with DisallowUnknownFields,
+// encoding/json reports it with an untyped error whose message quotes the key
+func unknownField(err error) (string, bool) {
+	quoted, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !ok {
+		return "", false
+	}
+	field, unquoteErr := strconv.Unquote(quoted)
+	return field, unquoteErr == nil
+}
+
+// exceedsDepth returns true and the offset where it happens
+// if objects or arrays of data are nested deeper than maxDepth
+func exceedsDepth(data []byte, maxDepth int) (int64, bool) {
+	depth, inString, escaped := 0, false, false
+	for i, c := range data {
+		switch {
+		case inString && escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			if depth++; depth > maxDepth {
+				return int64(i), true
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,220 @@
+package micro
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/**********************************/
+/*             LINKS              */
+/**********************************/
+
+// routeVariables matches the variables of route paths
+var routeVariables = regexp.MustCompile(Pattern)
+
+// URL returns the path of the route name with its variables replaced by params, such as /users/42
+// for a route /users/:id and the params {"id": "42"}. The variables of regexp groups are named by their position,
+// "0" for the first variable of the path. Optional variables missing from params are left empty.
+// Routes are found once the application is booted, or by boot hooks once routes are frozen.
+func (e *Micro) URL(name string, params Params) (string, error) {
+	if !e.ControllerCollection.IsFrozen() {
+		return "", fmt.Errorf("route %s : the application is not booted", name)
+	}
+	for _, route := range e.routes() {
+		if route.name == name && !route.passthrough {
+			return route.url(params)
+		}
+	}
+	return "", fmt.Errorf("route %s not found", name)
+}
+
+// url returns the path of the route with its variables replaced by params
+func (r *Route) url(params Params) (string, error) {
+	var err error
+	position := 0
+	path := routeVariables.ReplaceAllStringFunc(r.path, func(match string) string {
+		name := r.params[position]
+		position++
+		value, ok := params[name]
+		if !ok && !strings.HasSuffix(match, "?") && err == nil {
+			err = fmt.Errorf("route %s : missing parameter %s", r.name, name)
+		}
+		// the values of catch-all groups are paths, their segments are escaped
+		segments := strings.Split(value, "/")
+		for i := range segments {
+			segments[i] = url.PathEscape(segments[i])
+		}
+		return strings.Join(segments, "/")
+	})
+	if err != nil {
+		return "", err
+	}
+	// the optional slashes of prefixes ending with a slash are dropped
+	path = strings.ReplaceAll(path, "/?", "/")
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+	if !r.pattern.MatchString(path) {
+		return "", fmt.Errorf("route %s : parameters %v do not match %s", r.name, params, r.path)
+	}
+	return path, nil
+}
+
+// SetBaseURL sets the URL the absolute links of the application are resolved against, such as https://api.example.com/v1,
+// instead of the scheme and host of the requests.
+//
+// Can Panic! if base is not an absolute URL
+func (e *Micro) SetBaseURL(base string) {
+	baseURL, err := url.Parse(base)
+	if err != nil || !baseURL.IsAbs() {
+		panic(fmt.Sprintf("invalid base URL %q", base))
+	}
+	baseURL.Path = strings.TrimSuffix(baseURL.Path, "/")
+	e.baseURL = baseURL
+}
+
+// TrustForwardedHeaders resolves the absolute links of the application against the X-Forwarded-Proto,
+// X-Forwarded-Host and X-Forwarded-Prefix headers of the requests, or their Forwarded header.
+// It must only be enabled behind a reverse proxy setting these headers, clients could forge them otherwise.
+func (e *Micro) TrustForwardedHeaders(trust bool) {
+	e.trustForwardedHeaders = trust
+}
+
+// BaseURL returns the URL the absolute links of the request are resolved against: the base URL of the application
+// if it is set, the scheme and host the client sent the request to otherwise.
+func (ctx *Context) BaseURL() *url.URL {
+	if ctx.app != nil && ctx.app.baseURL != nil {
+		base := *ctx.app.baseURL
+		return &base
+	}
+	base := &url.URL{Scheme: "http", Host: ctx.Request.Host}
+	if ctx.Request.TLS != nil {
+		base.Scheme = "https"
+	}
+	if ctx.app == nil || !ctx.app.trustForwardedHeaders {
+		return base
+	}
+	forwarded := parseForwarded(ctx.Request.Header)
+	if proto := firstForwarded(ctx.Request.Header.Get("X-Forwarded-Proto"), forwarded["proto"]); proto == "http" || proto == "https" {
+		base.Scheme = proto
+	}
+	if host := firstForwarded(ctx.Request.Header.Get("X-Forwarded-Host"), forwarded["host"]); host != "" {
+		base.Host = host
+	}
+	if prefix := strings.Trim(ctx.Request.Header.Get("X-Forwarded-Prefix"), "/"); prefix != "" {
+		base.Path = "/" + prefix
+	}
+	return base
+}
+
+// parseForwarded returns the parameters of the first element of the Forwarded header, added by the closest client
+func parseForwarded(header http.Header) map[string]string {
+	parameters := map[string]string{}
+	element, _, _ := strings.Cut(header.Get("Forwarded"), ",")
+	for _, pair := range strings.Split(element, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		parameters[strings.ToLower(name)] = value
+	}
+	return parameters
+}
+
+// firstForwarded returns the first value of a comma separated X-Forwarded-* header, or fallback
+func firstForwarded(value string, fallback string) string {
+	first, _, _ := strings.Cut(value, ",")
+	if first = strings.TrimSpace(first); first != "" {
+		return strings.ToLower(first)
+	}
+	return strings.ToLower(fallback)
+}
+
+// AbsoluteURL returns the absolute URL of path, resolved against the base URL of the request
+func (ctx *Context) AbsoluteURL(path string) string {
+	base := ctx.BaseURL()
+	target, err := url.Parse(path)
+	if err != nil {
+		return base.String() + path
+	}
+	base.Path += target.Path
+	base.RawQuery = target.RawQuery
+	base.Fragment = target.Fragment
+	return base.String()
+}
+
+// URLFor returns the absolute URL of the route name with params, see Micro.URL and Context.BaseURL
+func (ctx *Context) URLFor(name string, params Params) (string, error) {
+	path, err := ctx.app.URL(name, params)
+	if err != nil {
+		return "", err
+	}
+	return ctx.AbsoluteURL(path), nil
+}
+
+// Link is a hypermedia link of a json response
+type Link struct {
+	Href string `json:"href"`
+	// Method is the method of the requests to the link, GET if empty
+	Method string `json:"method,omitempty"`
+}
+
+// Links are the links of a resource by relation, embedded in json responses as a _links section
+type Links map[string]Link
+
+// LinkBuilder builds the links of a resource from named routes, see Context.Links
+type LinkBuilder struct {
+	ctx   *Context
+	links Links
+	err   error
+}
+
+// Links returns a builder of the links of a resource, with absolute hrefs generated from named routes:
+//
+//	app.Get("/users/:id", showUser).SetName("user")
+//	app.Delete("/users/:id", deleteUser).SetName("delete_user")
+//	app.Get("/users/:id/posts", listPosts).SetName("user_posts")
+//
+//	links, err := ctx.Links().
+//		Add("self", "user", micro.Params{"id": id}).
+//		Add("posts", "user_posts", micro.Params{"id": id}).
+//		AddMethod("delete", http.MethodDelete, "delete_user", micro.Params{"id": id}).
+//		Build()
+//	if err != nil {
+//		return err
+//	}
+//	return ctx.WriteJSON(UserResource{User: user, Links: links}) // Links `json:"_links"`
+func (ctx *Context) Links() *LinkBuilder {
+	return &LinkBuilder{ctx: ctx, links: Links{}}
+}
+
+// Add adds the link rel to the route name with params
+func (builder *LinkBuilder) Add(rel string, name string, params Params) *LinkBuilder {
+	return builder.AddMethod(rel, "", name, params)
+}
+
+// AddMethod adds the link rel to the route name with params, requested with method
+func (builder *LinkBuilder) AddMethod(rel string, method string, name string, params Params) *LinkBuilder {
+	if builder.err != nil {
+		return builder
+	}
+	href, err := builder.ctx.URLFor(name, params)
+	if err != nil {
+		builder.err = fmt.Errorf("link %s : %w", rel, err)
+		return builder
+	}
+	builder.links[rel] = Link{Href: href, Method: method}
+	return builder
+}
+
+// Build returns the links, or the error of the first link whose route cannot be found or whose params are invalid
+func (builder *LinkBuilder) Build() (Links, error) {
+	return builder.links, builder.err
+}
@@ -0,0 +1,54 @@
+package micro
+
+import (
+	"log/slog"
+)
+
+/**********************************/
+/*             LOGGER             */
+/**********************************/
+
+// Logger logs the errors and panics of the framework, *slog.Logger implements it
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// DefaultLogger is the logger of applications without a logger,
+// it logs with the slog default logger at the time of the call
+var DefaultLogger Logger = slogDefaultLogger{}
+
+// slogDefaultLogger logs with slog.Default
+type slogDefaultLogger struct{}
+
+func (slogDefaultLogger) Debug(msg string, args ...interface{}) { slog.Default().Debug(msg, args...) }
+func (slogDefaultLogger) Info(msg string, args ...interface{})  { slog.Default().Info(msg, args...) }
+func (slogDefaultLogger) Warn(msg string, args ...interface{})  { slog.Default().Warn(msg, args...) }
+func (slogDefaultLogger) Error(msg string, args ...interface{}) { slog.Default().Error(msg, args...) }
+
+// SetLogger sets the logger of the application and its event emitter,
+// messages are logged with key value pairs like slog:
+//
+//	app.SetLogger(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+func (e *Micro) SetLogger(logger Logger) {
+	e.logger = logger
+	e.EventEmitter.logger = logger
+}
+
+// Logger returns the logger of the application
+func (e *Micro) Logger() Logger {
+	if e.logger == nil {
+		return DefaultLogger
+	}
+	return e.logger
+}
+
+// logger returns the logger of the application of ctx
+func (ctx *Context) logger() Logger {
+	if ctx.app != nil {
+		return ctx.app.Logger()
+	}
+	return DefaultLogger
+}
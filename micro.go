@@ -18,24 +18,45 @@
 package micro
 
 import (
-	"encoding/json"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"reflect"
 	"regexp"
 	"runtime/debug"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
+	// contextType is the type under which the request context.Context is registered in request injectors
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 	// Pattern represents a route param regexp pattern
 	Pattern = "(?:\\:)(\\w+)(\\?)?|(\\(.+\\)?)"
 	// DefaultParamPattern represents the default pattern that a route param matches
 	DefaultParamPattern = "(\\w+)"
 )
 
+// pools of per request objects, they are reset and reused between requests
+var (
+	contextPool        = sync.Pool{New: func() interface{} { return NewContext(nil, nil) }}
+	injectorPool       = sync.Pool{New: func() interface{} { return NewInjector() }}
+	responseWriterPool = sync.Pool{New: func() interface{} { return new(ResponseWriterWithCode) }}
+	bufferPool         = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+)
+
 /**********************************/
 /*               APP              */
 /**********************************/
@@ -46,9 +67,45 @@ type Micro struct {
 	*ControllerCollection
 	*EventEmitter
 	RequestMatcher *RequestMatcher
-	booted         bool
+	booted         atomic.Bool
 	injector       *Injector
 	errorHandlers  map[int]HandlerFunction
+	// errorClassHandlers are error handlers by class of status code, 4 for 4xx and 5 for 5xx
+	errorClassHandlers  map[int]HandlerFunction
+	defaultErrorHandler HandlerFunction
+	renderer            Renderer
+	secret              []byte
+	jsonConfig          JSONConfig
+	logger              Logger
+	problemDetails      bool
+	errorRenderer       ErrorRenderer
+	serverOptions       []ServerOption
+	serverMutex         sync.Mutex
+	servers             []*http.Server
+	listeners           []net.Listener
+	providers           []Provider
+	bootHooks           []func(injector *Injector) error
+	shutdownHooks       []func(ctx context.Context) error
+	devMode             bool
+	// shutdownDone is closed when the last Shutdown is complete
+	shutdownDone    chan struct{}
+	shutdownTimeout time.Duration
+	workers         workers
+	// bufferResponses is true if responses are buffered until the end of requests
+	bufferResponses bool
+	// bootOnce boots the application once, bootError is the error it failed with
+	bootOnce  sync.Once
+	bootError error
+	// reloadedMatcher is the request matcher of the routes of the last Reload
+	reloadedMatcher atomic.Pointer[RequestMatcher]
+	// tenantResolver identifies the tenant of requests before routing
+	tenantResolver *TenantResolver
+	// baseURL is the URL absolute links are resolved against, see SetBaseURL
+	baseURL *url.URL
+	// trustForwardedHeaders resolves absolute links against the X-Forwarded-* headers of requests
+	trustForwardedHeaders bool
+	// serializers are the serializers of WriteAuto, in order of preference
+	serializers []registeredSerializer
 }
 
 // New creates an micro application
@@ -58,22 +115,109 @@ func New() *Micro {
 		EventEmitter:         NewEventEmitter(),
 		injector:             NewInjector(),
 		errorHandlers:        map[int]HandlerFunction{},
+		errorClassHandlers:   map[int]HandlerFunction{},
+		jsonConfig:           DefaultJSONConfig,
+		errorRenderer:        DefaultErrorRenderer,
+		serializers:          defaultSerializers(),
 	}
 	micro.injector.Register(micro)
 	return micro
 }
 
-// Boot boots the application
-func (e *Micro) Boot() {
-	if !e.Booted() {
-		e.ControllerCollection.Flush()
-		e.booted = true
+// SetDebug enables or disables the debug mode. In debug mode JSON responses are indented
+// and panics are answered with a page showing the stack trace, the request,
+// the route and the services of the injector. It must never be enabled in production.
+func (e *Micro) SetDebug(debug bool) {
+	e.debug = debug
+}
+
+// Debug returns true if the application is in debug mode
+func (e *Micro) Debug() bool {
+	return e.debug
+}
+
+// SetBufferResponses enables or disables the buffering of all responses until the end of requests,
+// see ResponseWriterWithCode.Buffer to buffer the responses of some routes only
+func (e *Micro) SetBufferResponses(buffer bool) {
+	e.bufferResponses = buffer
+}
+
+// BufferResponses returns true if responses are buffered until the end of requests
+func (e *Micro) BufferResponses() bool {
+	return e.bufferResponses
+}
+
+// Boot boots the application: routes are frozen, boot hooks are executed in registration order
+// and workers are started.
+// It returns the error of the first failing hook, following hooks are not executed.
+// The application boots once: later calls return the error of the first one, if any.
+// Run and its variants boot the application before listening, ServeHTTP on the first request,
+// concurrent requests wait for the boot and are answered with a server error if it failed.
+// Outside of debug mode, the templates of the renderer are precompiled if it supports it, see TemplateRenderer.Precompile.
+// If the RoutesEnv environment variable is set, it writes the route table and exits once routes are frozen.
+// In debug mode, the route table is printed to DebugRoutesOutput if it is set.
+func (e *Micro) Boot() error {
+	e.bootOnce.Do(func() {
+		if e.bootError = e.boot(); e.bootError == nil {
+			e.booted.Store(true)
+		}
+	})
+	return e.bootError
+}
+
+// boot freezes the routes then executes the boot hooks and starts the workers
+func (e *Micro) boot() error {
+	if err := e.bootProviders(); err != nil {
+		return fmt.Errorf("boot failed : %w", err)
+	}
+	e.ControllerCollection.Flush()
+	if e.RequestMatcher == nil {
+		e.RequestMatcher = NewRequestMatcher(e.ControllerCollection)
 	}
+	e.exitWithRouteTable()
+	if e.debug && DebugRoutesOutput != nil {
+		e.PrintRoutes(DebugRoutesOutput)
+	}
+	for _, hook := range e.bootHooks {
+		if err := hook(e.injector); err != nil {
+			return fmt.Errorf("boot failed : %w", err)
+		}
+	}
+	// broken templates are reported before the application serves requests, they are reparsed in debug mode
+	if precompiler, ok := e.renderer.(interface{ Precompile() error }); ok && !e.debug {
+		if err := precompiler.Precompile(); err != nil {
+			return fmt.Errorf("boot failed : %w", err)
+		}
+	}
+	e.startWorkers()
+	return nil
+}
+
+// OnBoot registers a hook executed with the application injector when the application boots,
+// to open connection pools, warm caches or register to service discovery:
+//
+//	app.OnBoot(func(injector *micro.Injector) error {
+//	    db, err := sql.Open("postgres", dsn)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    injector.Register(db)
+//	    return db.Ping()
+//	})
+func (e *Micro) OnBoot(hook func(injector *Injector) error) {
+	e.bootHooks = append(e.bootHooks, hook)
+}
+
+// OnShutdown registers a hook executed by Shutdown once the servers are shut down,
+// to close connection pools or deregister from service discovery.
+// Hooks are executed in registration order, ctx bounds their duration.
+func (e *Micro) OnShutdown(hook func(ctx context.Context) error) {
+	e.shutdownHooks = append(e.shutdownHooks, hook)
 }
 
 // Booted returns true if the Boot function has been called
-func (e Micro) Booted() bool {
-	return e.booted
+func (e *Micro) Booted() bool {
+	return e.booted.Load()
 }
 
 // ServeHTTP boots micro server and handles http requests.
@@ -81,43 +225,88 @@ func (e Micro) Booted() bool {
 // Can Panic!
 func (e *Micro) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
 	var (
-		matches                []*Route
+		routeIndex             int
 		next                   Next
 		context                *Context
 		requestInjector        *Injector
 		responseWriterWithCode *ResponseWriterWithCode
 	)
+	// wrap responseWriter so we can access the status code
+	responseWriterWithCode = responseWriterPool.Get().(*ResponseWriterWithCode)
+	responseWriterWithCode.reset(responseWriter)
+	// sets context and injector
+	context = contextPool.Get().(*Context)
+	context.reset(responseWriterWithCode, request)
+	requestInjector = injectorPool.Get().(*Injector)
+	defer func() {
+		// buffered responses are sent once the handlers are done
+		if err := responseWriterWithCode.flushBuffer(); err != nil {
+			e.Logger().Error("cannot write response", "error", err)
+		}
+		e.Emit(RequestFinished.Name, context)
+		// scoped services are released once the response is complete
+		requestInjector.Cleanup()
+		context.reset(nil, nil)
+		contextPool.Put(context)
+		requestInjector.reset()
+		injectorPool.Put(requestInjector)
+		responseWriterWithCode.reset(nil)
+		responseWriterPool.Put(responseWriterWithCode)
+	}()
 	defer func() {
 		if err := recover(); err != nil {
-			responseWriter.WriteHeader(http.StatusInternalServerError)
-			log.Println(err)
-			debug.PrintStack()
-			requestInjector.MustApply(e.errorHandlers[500])
+			panicError, ok := err.(error)
+			if !ok {
+				panicError = fmt.Errorf("panic: %v", err)
+			}
+			caught := newCaughtError(InternalServerError("").WithInternal(panicError), panicError)
+			caught.Recovered, caught.Stack = err, debug.Stack()
+			// a partially written buffered response is discarded
+			responseWriterWithCode.ResetBuffer()
+			e.Logger().Error("panic recovered", "error", err, "reference", caught.Reference, "stack", string(caught.Stack))
+			// in debug mode panics are answered with the stack trace, never in production
+			if e.debug && responseWriterWithCode.Length() == 0 {
+				e.writeDebugPage(context, responseWriterWithCode, err, caught.Stack)
+			} else {
+				e.handleError(context.route, responseWriterWithCode, requestInjector, caught)
+			}
+			e.Emit(RequestPanic.Name, context, err)
+			e.emitError(context, http.StatusInternalServerError, panicError)
 		}
 	}()
-	// wrap responseWriter so we can access the status code
-	responseWriterWithCode = &ResponseWriterWithCode{
-		ResponseWriter: responseWriter,
-	}
-	// sets context and injector
-	context = NewContext(responseWriterWithCode, request)
-	requestInjector = NewInjector(request, responseWriterWithCode, context, e.EventEmitter)
+	context.app = e
+	requestInjector.Register(request)
+	requestInjector.Register(responseWriterWithCode)
+	requestInjector.Register(context)
+	requestInjector.Register(Params(context.RequestVars))
+	requestInjector.Register(e.EventEmitter)
 	requestInjector.Register(requestInjector)
 	requestInjector.SetParent(e.Injector())
-	if e.errorHandlers[500] == nil {
-		e.Error(500, InternalServerErrorHandler)
+	context.injector = requestInjector
+	context.syncInjector()
+	responseWriterWithCode.onWriteHeader = func() {
+		e.Emit(ResponseWritten.Name, context)
 	}
-	if e.errorHandlers[404] == nil {
-		e.Error(404, NotFoundErrorHandler)
+	if e.bufferResponses {
+		responseWriterWithCode.Buffer()
 	}
-	if e.RequestMatcher == nil {
-		e.RequestMatcher = NewRequestMatcher(e.ControllerCollection)
+	if err := e.Boot(); err != nil {
+		context.handlerError(err)
+		return
 	}
-	if !e.Booted() {
-		e.Boot()
+	e.Emit(RequestReceived.Name, context)
+	if e.tenantResolver != nil {
+		if !e.resolveTenant(context) {
+			return
+		}
+		// routes are matched with the path of the tenant request
+		request = context.Request
+	}
+	// routes are matched lazily, in order, each time next is called
+	requestMatcher := e.RequestMatcher
+	if reloaded := e.reloadedMatcher.Load(); reloaded != nil {
+		requestMatcher = reloaded
 	}
-	// find all routes matching the request in the route collection
-	matches = e.RequestMatcher.MatchAll(request)
 
 	// For the first matched route, call all its handlers
 	// if an handler in a route calls micro.Next next() , execute the next handler
@@ -125,28 +314,100 @@ func (e *Micro) ServeHTTP(responseWriter http.ResponseWriter, request *http.Requ
 	// if there are still some matched routes and the last handler of the previous route calls next
 	// then repeat the process for the next matched route
 	next = func() {
-		if e.hasErrorCode(responseWriterWithCode, requestInjector) {
+		if context.aborted {
+			return
+		}
+		if e.hasErrorCode(context, responseWriterWithCode, requestInjector) {
 			return
 		}
-		if len(matches) == 0 {
-			requestInjector.MustApply(e.errorHandlers[404])
+		match, submatches, index := requestMatcher.Match(request, routeIndex)
+		if match == nil {
+			e.handleError(context.route, responseWriterWithCode, requestInjector, newCaughtError(NotFound(""), nil))
+			e.emitError(context, http.StatusNotFound, nil)
 			return
 		}
-		match := matches[0]
-		matches = matches[1:]
+		routeIndex = index
 		// If there are some request variables, populate the context with them
-		for i, matchedParam := range match.pattern.FindStringSubmatch(request.URL.Path)[1:] {
+		for i, matchedParam := range submatches[1:] {
 			context.RequestVars[match.params[i]] = matchedParam
 		}
 
-		requestInjector.Register(next)
 		context.next = next
-		requestInjector.MustApply(match.Handler())
+		context.route = match
+		context.syncInjector()
+		e.Emit(RouteMatched.Name, context, match)
+		if !match.consumesRequest(request) {
+			unsupported := UnsupportedMediaType(match.consumes, requestMediaType(request))
+			context.sendError(unsupported.Code, unsupported.Message, unsupported)
+			return
+		}
+		// the services of the collections of the route are only visible while its handler is called
+		previousParent := requestInjector.Parent()
+		requestInjector.SetParent(match.injectorLayer(e.Injector()))
+		results, err := callHandler(requestInjector, match)
+		requestInjector.SetParent(previousParent)
+		if err != nil {
+			var paramError *ParamError
+			if errors.As(err, &paramError) {
+				context.handlerError(paramError)
+				return
+			}
+			panic(err)
+		}
+		e.handleResults(context, results)
 	}
+	requestInjector.Register(next)
 	next()
 
 }
 
+// handleResults writes the results of handlers returning error, (interface{}, error)
+// or (int, interface{}, error), results of other handlers are ignored.
+// The value is written with Context.Respond, errors are sent to the error handlers.
+// The error result can be of any type implementing error, such as *HTTPError.
+func (e *Micro) handleResults(ctx *Context, results []reflect.Value) {
+	code, value := http.StatusOK, reflect.Value{}
+	switch {
+	case len(results) == 1:
+		if err, _ := resultError(results[0]); err != nil {
+			ctx.handlerError(err)
+		}
+		return
+	case len(results) == 2:
+		value = results[0]
+	case len(results) == 3 && results[0].Kind() == reflect.Int:
+		code, value = int(results[0].Int()), results[1]
+	default:
+		return
+	}
+	err, ok := resultError(results[len(results)-1])
+	if !ok {
+		return
+	}
+	if err != nil {
+		ctx.handlerError(err)
+		return
+	}
+	if err := ctx.Respond(code, value.Interface()); err != nil {
+		ctx.logger().Error("cannot write response", "error", err)
+	}
+}
+
+// resultError returns the error of a handler result, ok is false if the type of the result does not implement error.
+// A nil pointer implementing error, such as a nil *HTTPError, is no error.
+func resultError(result reflect.Value) (err error, ok bool) {
+	if !result.Type().Implements(errorType) {
+		return nil, false
+	}
+	switch result.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		if result.IsNil() {
+			return nil, true
+		}
+	}
+	return result.Interface().(error), true
+}
+
 // Error sets an error handler given an error code.
 // Arguments of that handler function are resolved by micro's injector.
 //
@@ -161,24 +422,98 @@ func (e *Micro) Error(errorCode int, handlerFunc HandlerFunction) {
 	e.errorHandlers[errorCode] = handlerFunc
 }
 
+// ErrorClass sets an error handler for a class of error codes,
+// 4 for all 4xx codes and 5 for all 5xx codes:
+//
+//	app.ErrorClass(5, func(ctx *micro.Context, err *micro.HTTPError) {
+//	    ctx.Respond(err.Code, err)
+//	})
+//
+// Handlers registered with Error for a specific code take precedence.
+//
+// Can Panic! if the class is not 4 or 5.
+func (e *Micro) ErrorClass(class int, handlerFunc HandlerFunction) {
+	if e.Booted() {
+		return
+	}
+	if class != 4 && class != 5 {
+		panic(fmt.Sprintf("class should be 4 or 5, got %d", class))
+	}
+	e.errorClassHandlers[class] = handlerFunc
+}
+
+// ErrorDefault sets the error handler of the error codes
+// that have neither a handler nor a class handler.
+func (e *Micro) ErrorDefault(handlerFunc HandlerFunction) {
+	if e.Booted() {
+		return
+	}
+	e.defaultErrorHandler = handlerFunc
+}
+
+// errorHandler returns the handler of code, looking for a handler of the code registered on the collection
+// of route, then on the application, then of its class, then the default handler, then calls the error renderer.
+// It returns nil if there is none.
+func (e *Micro) errorHandler(route *Route, code int) HandlerFunction {
+	if route != nil && route.errorHandlers[code] != nil {
+		return route.errorHandlers[code]
+	}
+	if handler := e.errorHandlers[code]; handler != nil {
+		return handler
+	}
+	if handler := e.errorClassHandlers[code/100]; handler != nil {
+		return handler
+	}
+	if e.defaultErrorHandler != nil {
+		return e.defaultErrorHandler
+	}
+	if e.errorRenderer != nil {
+		return errorRendererHandler(e.errorRenderer)
+	}
+	return nil
+}
+
 // hasErrorCode Return true if a http status greater than 399 has been set
-func (e *Micro) hasErrorCode(rw *ResponseWriterWithCode, injector *Injector) bool {
+func (e *Micro) hasErrorCode(ctx *Context, rw *ResponseWriterWithCode, injector *Injector) bool {
 	if code := rw.Code(); code > 399 {
-		if e.errorHandlers[code] != nil && rw.Length() == 0 {
-			injector.MustApply(e.errorHandlers[code])
-		} else {
-			http.Error(rw, http.StatusText(code), code)
-		}
+		e.handleError(ctx.route, rw, injector, newCaughtError(NewHTTPError(code, ""), nil))
+		e.emitError(ctx, code, nil)
 		return true
 	}
 	return false
 }
 
+// handleError executes the error handler registered for the code of the caught error,
+// which can be injected in the handler with its *HTTPError, or writes its message if there is none
+// or the response body has already been written. route is the last route matched by the request, nil if none.
+// The status code is written when the handler first writes, so it can still set headers.
+func (e *Micro) handleError(route *Route, rw *ResponseWriterWithCode, injector *Injector, caught *CaughtError) {
+	httpError := caught.HTTPError
+	injector.Register(caught)
+	injector.Register(httpError)
+	// both implement error, handlers depending on error are given the caught error
+	injector.registerAs(caught, errorType)
+	if handler := e.errorHandler(route, httpError.Code); handler != nil && rw.Length() == 0 {
+		rw.errorCode = httpError.Code
+		injector.MustApply(handler)
+		rw.WriteHeader(httpError.Code)
+		rw.errorCode = 0
+	} else {
+		http.Error(rw, httpError.Message, httpError.Code)
+	}
+}
+
 // Injector return the injector
 func (e *Micro) Injector() *Injector {
 	return e.injector
 }
 
+// SetInjector replaces the application injector, usually with a child of the current one
+// overriding services in tests. It must not be called while the application serves requests.
+func (e *Micro) SetInjector(injector *Injector) {
+	e.injector = injector
+}
+
 /**********************************/
 /*     DEFAULT ERROR HANDLERS     */
 /**********************************/
@@ -197,15 +532,28 @@ func NotFoundErrorHandler(rw http.ResponseWriter, r *http.Request) {
 /*            CONTEXT             */
 /**********************************/
 
-// Context represents a request context in an micro application
+// Context represents a request context in an micro application.
+//
+// Contexts are reused between requests, a Context must not be retained
+// once the request it was created for has been handled.
 type Context struct {
 	Request  *http.Request
 	Response http.ResponseWriter
 	// RequestVars are variables extracted from the request
 	RequestVars          map[string]string
-	//  Vars is a map to store any data during the request response cycle
-	Vars map[string]interface{}
-	next Next
+	//  Vars is a map to store any data during the request response cycle.
+	// Use GetVar and SetVar to access it from several goroutines.
+	Vars      map[string]interface{}
+	varsMutex sync.RWMutex
+	next      Next
+	app       *Micro
+	injector  *Injector
+	aborted   bool
+	route     *Route
+	// flash messages of the previous request and of the current request
+	incomingFlashes map[string][]string
+	outgoingFlashes map[string][]string
+	flashesRead     bool
 }
 
 // NewContext returns a new Context
@@ -219,47 +567,318 @@ func NewContext(response http.ResponseWriter, request *http.Request) *Context {
 	return ctx
 }
 
+// Context implements context.Context by delegating to the context of its request,
+// so it can be given to database drivers or http clients and is cancelled when the client goes away.
+var _ context.Context = (*Context)(nil)
+
+// requestContext returns the context of the request, or an empty context if there is no request
+func (ctx *Context) requestContext() context.Context {
+	if ctx.Request == nil {
+		return context.Background()
+	}
+	return ctx.Request.Context()
+}
+
+// Deadline returns the deadline of the request context
+func (ctx *Context) Deadline() (deadline time.Time, ok bool) {
+	return ctx.requestContext().Deadline()
+}
+
+// Done returns a channel closed when the request context is cancelled
+func (ctx *Context) Done() <-chan struct{} {
+	return ctx.requestContext().Done()
+}
+
+// Err returns why the request context was cancelled
+func (ctx *Context) Err() error {
+	return ctx.requestContext().Err()
+}
+
+// Value returns the value associated with key in the request context
+func (ctx *Context) Value(key interface{}) interface{} {
+	return ctx.requestContext().Value(key)
+}
+
+// SetContext replaces the context of the request, middlewares use it to add deadlines or values
+// to the request context. Handlers declaring a context.Context argument receive the new context.
+//
+//	ctx.SetContext(context.WithValue(ctx.Request.Context(), key, value))
+func (ctx *Context) SetContext(c context.Context) {
+	ctx.Request = ctx.Request.WithContext(c)
+	ctx.syncInjector()
+}
+
+// syncInjector registers the current request and its context in the request injector,
+// so that handlers are injected with the request as modified by previous middlewares.
+func (ctx *Context) syncInjector() {
+	if ctx.injector == nil || ctx.Request == nil {
+		return
+	}
+	ctx.injector.Register(ctx.Request)
+	ctx.injector.registerAs(ctx.Request.Context(), contextType)
+}
+
+// GetVar returns the value stored in ctx.Vars under key
+// and true if there is one and it has type T.
+// It is safe for concurrent use with SetVar.
+func GetVar[T any](ctx *Context, key string) (T, bool) {
+	ctx.varsMutex.RLock()
+	defer ctx.varsMutex.RUnlock()
+	value, ok := ctx.Vars[key].(T)
+	return value, ok
+}
+
+// SetVar stores value in ctx.Vars under key.
+// It is safe for concurrent use with GetVar.
+func SetVar[T any](ctx *Context, key string, value T) {
+	ctx.varsMutex.Lock()
+	defer ctx.varsMutex.Unlock()
+	ctx.Vars[key] = value
+}
+
+// reset prepares a pooled context for a new request
+func (ctx *Context) reset(response http.ResponseWriter, request *http.Request) {
+	clear(ctx.RequestVars)
+	clear(ctx.Vars)
+	ctx.Request = request
+	ctx.Response = response
+	ctx.next = nil
+	ctx.app = nil
+	ctx.injector = nil
+	ctx.aborted = false
+	ctx.route = nil
+	ctx.incomingFlashes = nil
+	ctx.outgoingFlashes = nil
+	ctx.flashesRead = false
+}
+
+// ErrDetachedContext is returned when writing to the response of a copied Context
+var ErrDetachedContext = errors.New("the context is detached from its request, the response cannot be written")
+
+// Copy returns a snapshot of ctx that can be used by goroutines that outlive the request,
+// since the Context itself is reused once the request is handled.
+// The copy has the request headers, RequestVars and Vars of ctx, and a request context
+// that is not cancelled when the request ends. Its request has no body,
+// and its response cannot be written: writes return ErrDetachedContext.
+// Values of Vars are not copied and must be safe for concurrent use.
+//
+//	copy := ctx.Copy()
+//	go func() {
+//	    sendWelcomeEmail(copy, copy.RequestVars["user"])
+//	}()
+func (ctx *Context) Copy() *Context {
+	copy := NewContext(detachedResponseWriter{header: http.Header{}}, nil)
+	copy.app = ctx.app
+	copy.route = ctx.route
+	copy.next = func() {}
+	if ctx.Request != nil {
+		copy.Request = ctx.Request.Clone(context.WithoutCancel(ctx.Request.Context()))
+		copy.Request.Body = http.NoBody
+		copy.Request.GetBody = nil
+	}
+	for key, value := range ctx.RequestVars {
+		copy.RequestVars[key] = value
+	}
+	ctx.varsMutex.RLock()
+	for key, value := range ctx.Vars {
+		copy.Vars[key] = value
+	}
+	ctx.varsMutex.RUnlock()
+	if ctx.flashesRead {
+		copy.flashesRead = true
+		copy.incomingFlashes = map[string][]string{}
+		for key, messages := range ctx.incomingFlashes {
+			copy.incomingFlashes[key] = append([]string{}, messages...)
+		}
+	}
+	return copy
+}
+
+// detachedResponseWriter is the response of a copied Context
+type detachedResponseWriter struct {
+	header http.Header
+}
+
+func (rw detachedResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw detachedResponseWriter) Write([]byte) (int, error) {
+	return 0, ErrDetachedContext
+}
+
+func (rw detachedResponseWriter) WriteHeader(int) {}
+
 // Next calls the next middleware in the middleware chain
 func (ctx *Context) Next() {
 	ctx.next()
 }
 
+// Route returns the route whose handler is being called, nil before routes are matched
+func (ctx *Context) Route() *Route {
+	return ctx.route
+}
+
+// Abort stops the middleware chain, next handlers won't be called
+func (ctx *Context) Abort() {
+	ctx.aborted = true
+}
+
+// IsAborted returns true if the middleware chain has been stopped
+func (ctx *Context) IsAborted() bool {
+	return ctx.aborted
+}
+
+// Error sets the status code of the response, stops the middleware chain
+// and executes the error handler registered for code, which can have the *HTTPError injected.
+// message is written as the response body if no error handler is registered for code.
+func (ctx *Context) Error(code int, message string) {
+	ctx.sendError(code, message, nil)
+}
+
+// sendError sends an error caused by err to the error handlers
+func (ctx *Context) sendError(code int, message string, err error) {
+	ctx.sendCaughtError(newCaughtErrorFrom(code, message, err))
+}
+
+// sendCaughtError sends a caught error to the error handlers
+func (ctx *Context) sendCaughtError(caught *CaughtError) {
+	ctx.Abort()
+	rw, ok := ctx.Response.(*ResponseWriterWithCode)
+	if !ok || ctx.app == nil {
+		http.Error(ctx.Response, caught.HTTPError.Message, caught.HTTPError.Code)
+		return
+	}
+	ctx.app.handleError(ctx.route, rw, ctx.injector, caught)
+	ctx.app.emitError(ctx, caught.HTTPError.Code, caught.Err)
+}
+
+// handlerError sends an error returned by a handler to the error handlers.
+// The status code is given by the StatusCode method of the error if any, 500 otherwise.
+// Messages of server errors are not sent to the client, they are logged,
+// HTTPError messages are always sent and their internal errors logged.
+func (ctx *Context) handlerError(err error) {
+	code := http.StatusInternalServerError
+	var coder interface{ StatusCode() int }
+	if errors.As(err, &coder) {
+		code = coder.StatusCode()
+	}
+	message, logged := err.Error(), false
+	var httpError *HTTPError
+	if errors.As(err, &httpError) {
+		message, logged = httpError.Message, httpError.Internal != nil
+	} else if code >= http.StatusInternalServerError {
+		message, logged = http.StatusText(code), true
+	}
+	caught := newCaughtErrorFrom(code, message, err)
+	if logged {
+		ctx.logger().Error("handler error", "error", err, "reference", caught.Reference)
+	}
+	ctx.sendCaughtError(caught)
+}
+
 // Redirect redirects request
 func (ctx *Context) Redirect(path string, code int) {
 	http.Redirect(ctx.Response, ctx.Request, path, code)
 }
 
-// WriteJSON writes json to response
+// WriteJSON writes json to response, encoded according to the application JSONConfig
 func (ctx *Context) WriteJSON(v interface{}) error {
-	ctx.Response.Header().Add("Content-Type", "application/json")
-	return json.NewEncoder(ctx.Response).Encode(v)
+	ctx.Response.Header().Add("Content-Type", MediaTypes["json"])
+	return ctx.encodeJSON(v)
+}
+
+// encodeJSON writes v as json to response
+func (ctx *Context) encodeJSON(v interface{}) error {
+	if prefix := ctx.jsonConfig().Prefix; prefix != "" {
+		if _, err := ctx.WriteString(prefix); err != nil {
+			return err
+		}
+	}
+	return ctx.newJSONEncoder(ctx.Response).Encode(v)
 }
 
 // WriteXML writes xml to response
 func (ctx *Context) WriteXML(v interface{}) error {
-	ctx.Response.Header().Add("Content-Type", "text/xml")
+	ctx.Response.Header().Add("Content-Type", MediaTypes["xml"])
 	return xml.NewEncoder(ctx.Response).Encode(v)
 }
 
+// WriteMsgPack writes msgpack to response
+func (ctx *Context) WriteMsgPack(v interface{}) error {
+	ctx.Response.Header().Add("Content-Type", MediaTypes["msgpack"])
+	return NewMsgPackEncoder(ctx.Response).Encode(v)
+}
+
 // WriteString writes a string to response
 func (ctx *Context) WriteString(v ...interface{}) (int, error) {
 	return fmt.Fprint(ctx.Response, v...)
 }
 
-// WriteJSONP writes a jsonp response
+// WriteCSV streams csv to response.
+// headers, if not empty, are written as the first record, then rows is called
+// to write the records. The csv writer is flushed to the client when rows returns,
+// rows can call w.Flush to send records earlier.
+func (ctx *Context) WriteCSV(headers []string, rows func(w *csv.Writer) error) error {
+	ctx.Response.Header().Add("Content-Type", MediaTypes["csv"])
+	writer := csv.NewWriter(ctx.Response)
+	if len(headers) > 0 {
+		if err := writer.Write(headers); err != nil {
+			return err
+		}
+	}
+	if err := rows(writer); err != nil {
+		return err
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	if flusher, ok := ctx.Response.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// SetContentDisposition sets the Content-Disposition header of the response.
+// disposition is either "attachment" or "inline", filename is optional.
+//
+// Example:
+//
+//	ctx.SetContentDisposition("attachment", "report.csv")
+func (ctx *Context) SetContentDisposition(disposition string, filename string) {
+	params := map[string]string{}
+	if filename != "" {
+		params["filename"] = filename
+	}
+	ctx.Response.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, params))
+}
+
+// WriteJSONP writes a jsonp response.
+// callbackName must be a javascript identifier, optionally dotted, ErrInvalidJSONPCallback is returned otherwise.
+// The response starts with an empty comment and is sent with X-Content-Type-Options: nosniff
+// to protect against content sniffing attacks.
 func (ctx *Context) WriteJSONP(v interface{}, callbackName string) (n int, err error) {
-	ctx.Response.Header().Add("Content-Type", "application/x-javascript")
-	bytes, err := json.Marshal(v)
-	if err != nil {
+	if !jsonpCallback.MatchString(callbackName) {
+		return 0, ErrInvalidJSONPCallback
+	}
+	buffer := new(bytes.Buffer)
+	if err = ctx.newJSONEncoder(buffer).Encode(v); err != nil {
 		return 0, err
 	}
-	n, err = ctx.WriteString(callbackName+"(", bytes, ")")
-	return
+	ctx.Response.Header().Add("Content-Type", MediaTypes["jsonp"])
+	ctx.Response.Header().Set("X-Content-Type-Options", "nosniff")
+	return ctx.WriteString("/**/", callbackName, "(", strings.TrimSuffix(buffer.String(), "\n"), ");")
 }
 
-// ReadJSON reads json from request's Body
-func (ctx *Context) ReadJSON(v interface{}) error {
-	return json.NewDecoder(ctx.Request.Body).Decode(v)
+// ReadJSON reads json from request's Body.
+// Decoding errors are returned as *JSONDecodeError, with the path of the invalid field
+// and the offset of the error in the body. Bodies larger than JSONMaxBodySize, or the MaxBodySize option,
+// return an *HTTPError with the status 413 Request Entity Too Large.
+//
+//	err := ctx.ReadJSON(&user, micro.DisallowUnknownFields(), micro.MaxDepth(10))
+func (ctx *Context) ReadJSON(v interface{}, options ...JSONDecodeOption) error {
+	return readJSON(ctx.Request.Body, v, options...)
 }
 
 // ReadXML reads xml from request's body
@@ -267,6 +886,11 @@ func (ctx *Context) ReadXML(v interface{}) error {
 	return xml.NewDecoder(ctx.Request.Body).Decode(v)
 }
 
+// ReadMsgPack reads msgpack from request's body
+func (ctx *Context) ReadMsgPack(v interface{}) error {
+	return NewMsgPackDecoder(ctx.Request.Body).Decode(v)
+}
+
 /**********************************/
 /*             ROUTE              */
 /**********************************/
@@ -289,6 +913,14 @@ type Route struct {
 	// wether the route is intended to be a middlware or not
 	passthrough bool
 	matchers    []Matcher
+	// consumes are the media types of the request bodies the route accepts
+	consumes []string
+	// errorHandlers are the error handlers of the collection of the route, by error code
+	errorHandlers map[int]HandlerFunction
+	// services are the services of the route and of its collections, injected in its handler only
+	services map[reflect.Type]interface{}
+	// plan is how the arguments of the handler are filled, computed when the route is frozen
+	plan *handlerPlan
 }
 
 // NewRoute creates a new route with a path that handles all methods
@@ -409,15 +1041,45 @@ func (r *Route) freeze() *Route {
 	if r.name == "" {
 		r.name = regexp.MustCompile("\\W+").ReplaceAllString(r.path+"_"+fmt.Sprint(r.methods), "_")
 	}
-	r.matchers = []Matcher{
-		NewPatternMatcher(r.pattern),
+	// the method is checked first, it is cheaper than the pattern, then the matchers added with AddMatcher
+	r.matchers = append([]Matcher{
 		NewMethodMatcher(r.Methods()...),
-	}
+		NewPatternMatcher(r.pattern),
+	}, r.matchers...)
+	r.plan = newHandlerPlan(r.handlerFunc)
 	r.frozen = true
 
 	return r
 }
 
+// match returns the submatches of the pattern of the route in the request path
+// if all the matchers of the route match the request, nil otherwise.
+// The pattern is evaluated once, its submatches are the route parameters.
+func (r *Route) match(request *http.Request) (submatches []string) {
+	for _, matcher := range r.matchers {
+		if patternMatcher, ok := matcher.(*PatternMatcher); ok {
+			if submatches = patternMatcher.Submatch(request); submatches == nil {
+				return nil
+			}
+		} else if !matcher.Match(request) {
+			return nil
+		}
+	}
+	if submatches == nil {
+		submatches = r.pattern.FindStringSubmatch(request.URL.Path)
+	}
+	return submatches
+}
+
+// injectorLayer returns the injector resolving the services of the route, then the services of parent,
+// or parent if the route has no services
+func (r *Route) injectorLayer(parent *Injector) *Injector {
+	if len(r.services) == 0 {
+		return parent
+	}
+	return &Injector{services: r.services, parent: parent}
+}
+
 // IsFrozen return the frozen state of a route.
 // A Frozen route cannot be modified.
 func (r *Route) IsFrozen() bool {
@@ -456,6 +1118,62 @@ func (r *Route) Assert(parameterName string, pattern string) *Route {
 	return r
 }
 
+// With registers services only injected in the handler of the route, so a handler shared by several routes
+// is given the services of each route instead of branching on the request, here a listHandler
+// depending on a Repository interface:
+//
+//	app.Get("/users", listHandler).With(&UserRepository{db: db}, &ReadPolicy{Resource: "users"})
+//	app.Get("/posts", listHandler).With(&PostRepository{db: db}, &ReadPolicy{Resource: "posts"})
+//
+// They shadow the services registered on the collections of the route, see ControllerCollection.Register.
+func (r *Route) With(services ...interface{}) *Route {
+	if r.IsFrozen() {
+		return r
+	}
+	if r.services == nil {
+		r.services = map[reflect.Type]interface{}{}
+	}
+	for _, service := range services {
+		r.services[reflect.ValueOf(service).Type()] = service
+	}
+	return r
+}
+
+// AddMatcher adds a matcher the requests handled by the route must match,
+// such as an IPMatcher. Requests not matching are handled by the next matching route.
+func (r *Route) AddMatcher(matcher Matcher) *Route {
+	if r.IsFrozen() {
+		return r
+	}
+	r.matchers = append(r.matchers, matcher)
+	return r
+}
+
+// Consumes restricts the media types of the request bodies the route accepts,
+// ranges like "text/*" are allowed. Requests with a body of another media type
+// are answered with a 415 Unsupported Media Type error.
+func (r *Route) Consumes(mediaTypes ...string) *Route {
+	if r.IsFrozen() {
+		return r
+	}
+	r.consumes = mediaTypes
+	return r
+}
+
+// consumesRequest returns true if the route accepts the body of request
+func (r *Route) consumesRequest(request *http.Request) bool {
+	if len(r.consumes) == 0 || request.ContentLength == 0 && request.Header.Get("Content-Type") == "" {
+		return true
+	}
+	mediaType := requestMediaType(request)
+	for _, consumed := range r.consumes {
+		if mediaTypeMatches(consumed, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
 // SetAttribute sets a route attribute
 func (r *Route) SetAttribute(attr string, value interface{}) *Route {
 	r.attributes[attr] = value
@@ -478,6 +1196,12 @@ type ControllerCollection struct {
 	frozen    bool
 	Children  []*ControllerCollection
 	hasParent bool
+	// matchers are added to the routes of the collection and of its children
+	matchers []Matcher
+	// errorHandlers are the error handlers of the routes of the collection and of its children, by error code
+	errorHandlers map[int]HandlerFunction
+	// services are the services of the routes of the collection and of its children, see Register
+	services map[reflect.Type]interface{}
 }
 
 // NewControllerCollection creates a new ControllerCollection
@@ -521,12 +1245,23 @@ func (rc *ControllerCollection) Flush() {
 
 	for _, route := range rc.Routes {
 		route.path = rc.prefix + route.path
+		route.matchers = append(route.matchers, rc.matchers...)
+		route.errorHandlers = rc.errorHandlers
+		route.services = mergeServices(rc.services, route.services)
 		route.freeze()
 	}
 
 	if len(rc.Children) > 0 {
 
 		for _, routeCollection := range rc.Children {
+			routeCollection.matchers = append(append([]Matcher{}, rc.matchers...), routeCollection.matchers...)
+			routeCollection.services = mergeServices(rc.services, routeCollection.services)
+			// the handlers of the child take precedence over the handlers of its parent
+			for code, handler := range rc.errorHandlers {
+				if routeCollection.errorHandlers[code] == nil {
+					routeCollection.Error(code, handler)
+				}
+			}
 			routeCollection.setPrefix(rc.prefix + routeCollection.prefix).Flush()
 			for _, route := range routeCollection.Routes {
 				rc.Routes = append(rc.Routes, route)
@@ -542,6 +1277,83 @@ func (rc ControllerCollection) IsFrozen() bool {
 	return rc.frozen
 }
 
+// AddMatcher adds a matcher to the routes of the collection, including the routes of the collections
+// mounted on it, so they only match the requests matched by matcher:
+//
+//	enterprise := micro.NewControllerCollection()
+//	enterprise.AddMatcher(micro.ForPlans("enterprise"))
+//	app.Mount("/reports", enterprise)
+func (rc *ControllerCollection) AddMatcher(matcher Matcher) *ControllerCollection {
+	rc.mustNotBeFrozen()
+	rc.matchers = append(rc.matchers, matcher)
+	return rc
+}
+
+// Error sets the error handler of an error code for the routes of the collection, including the routes
+// of the collections mounted on it, so a mounted API renders json errors while the site renders error pages:
+//
+//	api := micro.NewControllerCollection()
+//	api.Error(404, func(ctx *micro.Context, err *micro.HTTPError) error {
+//	    return ctx.WriteJSON(err)
+//	})
+//	app.Mount("/api", api)
+//
+// They take precedence over the handlers of the application. An error is handled by the handlers of the
+// collection of the last route the request matched: requests no route matches are handled by the handlers
+// of the collection of the last middleware they matched, if any.
+//
+// Can Panic! if the error code is lower than 400 or if the collection is frozen.
+func (rc *ControllerCollection) Error(errorCode int, handlerFunc HandlerFunction) *ControllerCollection {
+	rc.mustNotBeFrozen()
+	if errorCode < 400 {
+		panic(fmt.Sprintf("errorCode should be greater or equal to 400, got %d", errorCode))
+	}
+	MustBeCallable(handlerFunc)
+	if rc.errorHandlers == nil {
+		rc.errorHandlers = map[int]HandlerFunction{}
+	}
+	rc.errorHandlers[errorCode] = handlerFunc
+	return rc
+}
+
+// Register registers a service only injected in the handlers of the routes of the collection, including
+// the routes of the collections mounted on it, so the services of a module do not pollute the application injector:
+//
+//	billing := micro.NewControllerCollection()
+//	billing.Register(&InvoiceRepository{db: db})
+//	billing.Get("/invoices", func(ctx *micro.Context, invoices *InvoiceRepository) error {
+//	    return ctx.WriteJSON(invoices.All())
+//	})
+//	app.Mount("/billing", billing)
+//
+// The services of the collection are resolved between the request injector and the application injector,
+// they shadow the services of the application and of the collections it is mounted on.
+//
+// Can Panic! if the collection is frozen.
+func (rc *ControllerCollection) Register(service interface{}) *ControllerCollection {
+	rc.mustNotBeFrozen()
+	if rc.services == nil {
+		rc.services = map[reflect.Type]interface{}{}
+	}
+	rc.services[reflect.ValueOf(service).Type()] = service
+	return rc
+}
+
+// mergeServices returns the services of parent and child, the services of child taking precedence
+func mergeServices(parent map[reflect.Type]interface{}, child map[reflect.Type]interface{}) map[reflect.Type]interface{} {
+	if len(parent) == 0 {
+		return child
+	}
+	merged := make(map[reflect.Type]interface{}, len(parent)+len(child))
+	for serviceType, service := range parent {
+		merged[serviceType] = service
+	}
+	for serviceType, service := range child {
+		merged[serviceType] = service
+	}
+	return merged
+}
+
 // Use creates a passthrough route usefull for middlewares
 func (rc *ControllerCollection) Use(path string, handlerFunction HandlerFunction) *Route {
 	route := rc.All(path, handlerFunction)
@@ -561,6 +1373,25 @@ func (rc *ControllerCollection) Mount(path string, routeCollection *ControllerCo
 	return rc
 }
 
+// MountApp dispatches the requests whose path starts with path to app, with path stripped
+// from the request URL. app keeps its own injector, error handlers, event emitter and configuration:
+//
+//	admin := micro.New()
+//	admin.Get("/users", listUsers)
+//	app.MountApp("/admin", admin) // GET /admin/users is handled by admin as GET /users
+func (rc *ControllerCollection) MountApp(path string, app *Micro) *Route {
+	path = strings.TrimSuffix(path, "/")
+	return rc.All(path+"(|/.*)", func(ctx *Context) {
+		params := ctx.Route().Params()
+		request := ctx.Request.Clone(ctx.Request.Context())
+		request.URL.Path, request.URL.RawPath = ctx.RequestVars[params[len(params)-1]], ""
+		if request.URL.Path == "" {
+			request.URL.Path = "/"
+		}
+		app.ServeHTTP(ctx.Response, request)
+	})
+}
+
 // Get creates a GET route
 func (rc *ControllerCollection) Get(path string, handlerFunction HandlerFunction) *Route {
 	route := rc.All(path, handlerFunction)
@@ -619,23 +1450,25 @@ func NewRequestMatcher(routeCollection *ControllerCollection) *RequestMatcher {
 
 // MatchAll matches all routes matching the request in the route collection
 func (rm *RequestMatcher) MatchAll(request *http.Request) (matches []*Route) {
-	if len(rm.routeCollection.Routes) > 0 {
-		for _, route := range rm.routeCollection.Routes {
-			match := true
-			for _, matcher := range route.matchers {
-				if !matcher.Match(request) {
-					match = false
-					break
-				}
-			}
-			if match == true {
-				matches = append(matches, route)
-			}
-		}
+	for route, _, index := rm.Match(request, 0); route != nil; route, _, index = rm.Match(request, index) {
+		matches = append(matches, route)
 	}
 	return
 }
 
+// Match returns the first route matching the request in the route collection, starting at the position from,
+// the submatches of its pattern in the request path and the position to resume matching from.
+// It returns a nil route if no route matches.
+func (rm *RequestMatcher) Match(request *http.Request, from int) (route *Route, submatches []string, next int) {
+	routes := rm.routeCollection.Routes
+	for next = from; next < len(routes); next++ {
+		if submatches = routes[next].match(request); submatches != nil {
+			return routes[next], submatches, next + 1
+		}
+	}
+	return nil, nil, next
+}
+
 
 
 /**********************************/
@@ -645,76 +1478,253 @@ func (rm *RequestMatcher) MatchAll(request *http.Request) (matches []*Route) {
 // Listener is an event handler function
 type Listener *func(string, ...interface{}) bool
 
-// EventEmitter listens for and emits events
+// ListenerFunc is an event handler function, it returns false to stop the propagation of the event
+type ListenerFunc func(event string, arguments ...interface{}) bool
+
+// Subscription is a listener registered on an EventEmitter
+type Subscription struct {
+	emitter  *EventEmitter
+	event    string
+	listener Listener
+}
+
+// Event returns the event listened to
+func (subscription *Subscription) Event() string {
+	return subscription.event
+}
+
+// Listener returns the registered listener
+func (subscription *Subscription) Listener() Listener {
+	return subscription.listener
+}
+
+// Unsubscribe removes the listener, it returns false if it was already removed
+func (subscription *Subscription) Unsubscribe() bool {
+	return subscription.emitter.RemoveListener(subscription.event, subscription.listener)
+}
+
+// EventEmitter listens for and emits events.
+// Listeners can be added and removed while events are emitted from other goroutines.
 type EventEmitter struct {
-	handlers map[string][]Listener
+	mutex        sync.RWMutex
+	handlers     map[string][]registeredListener
+	interceptors []EventInterceptor
+	// logger logs the panics of listeners when ListenerPanic has no listener
+	logger Logger
+}
+
+// EventInterceptor is called for every event emitted, before listeners.
+// It calls next to go on with the emission, possibly with other arguments,
+// or does not call it to filter the event out.
+type EventInterceptor func(event string, arguments []interface{}, next func(arguments []interface{}))
+
+// registeredListener is a listener and its priority
+type registeredListener struct {
+	listener Listener
+	priority int
 }
 
 // NewEventEmitter returns a new event emitter
 func NewEventEmitter() *EventEmitter {
 	return &EventEmitter{
-		handlers: map[string][]Listener{},
+		handlers: map[string][]registeredListener{},
 	}
 }
 
+// listeners returns the listeners of event. Listener slices are never modified
+// once stored, so they can be iterated over without holding the lock.
+func (em *EventEmitter) listeners(event string) []registeredListener {
+	em.mutex.RLock()
+	defer em.mutex.RUnlock()
+	return em.handlers[event]
+}
+
+// Intercept adds an interceptor called for all events, interceptors are called in the order they were added:
+//
+//	app.Intercept(func(event string, arguments []interface{}, next func([]interface{})) {
+//	    log.Println("event", event)
+//	    next(arguments)
+//	})
+func (em *EventEmitter) Intercept(interceptor EventInterceptor) {
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+	// copy the interceptors so that an emission iterating over them is not affected
+	em.interceptors = append(append([]EventInterceptor{}, em.interceptors...), interceptor)
+}
+
+// intercept calls the interceptors then dispatch with the arguments they pass on
+func (em *EventEmitter) intercept(event string, arguments []interface{}, dispatch func(arguments []interface{})) {
+	em.mutex.RLock()
+	interceptors := em.interceptors
+	em.mutex.RUnlock()
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], dispatch
+		dispatch = func(arguments []interface{}) {
+			interceptor(event, arguments, next)
+		}
+	}
+	dispatch(arguments)
+}
+
 // Emit emits an event
 func (em *EventEmitter) Emit(event string, arguments ...interface{}) {
-	if len(em.handlers) > 0 && em.handlers[event] != nil {
-		for _, handler := range em.handlers[event] {
-			Continue := (*handler)(event, arguments...)
+	em.intercept(event, arguments, func(arguments []interface{}) {
+		for _, handler := range em.listeners(event) {
+			Continue := em.callListener(event, handler.listener, arguments)
 			if !Continue {
 				break
 			}
 		}
+	})
+}
+
+// callListener calls a listener, a panicking listener does not stop the emission:
+// the panic is recovered and ListenerPanic is emitted, or logged if it has no listener.
+func (em *EventEmitter) callListener(event string, listener Listener, arguments []interface{}) (Continue bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			Continue = true
+			payload := &ListenerPanicEvent{Event: event, Recovered: recovered, Stack: debug.Stack()}
+			if event == ListenerPanic.Name || !em.HasListener(ListenerPanic.Name) {
+				logger := em.logger
+				if logger == nil {
+					logger = DefaultLogger
+				}
+				logger.Error("listener panicked", "event", event, "error", recovered, "stack", string(payload.Stack))
+				return
+			}
+			Publish(em, ListenerPanic, payload)
+		}
+	}()
+	return (*listener)(event, arguments...)
+}
+
+// EmitContext emits an event, listeners receive ctx as their first argument.
+// Emission stops when ctx is cancelled: the remaining listeners are not called
+// and EmitContext returns without waiting for the running listener, which should
+// itself stop on ctx cancellation. It returns the error of ctx if emission was stopped.
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//	defer cancel()
+//	app.EmitContext(ctx, "shutdown")
+func (em *EventEmitter) EmitContext(ctx context.Context, event string, arguments ...interface{}) (err error) {
+	em.intercept(event, append([]interface{}{ctx}, arguments...), func(arguments []interface{}) {
+		err = em.emitContext(ctx, event, arguments)
+	})
+	return err
+}
+
+// emitContext calls the listeners of event until ctx is cancelled
+func (em *EventEmitter) emitContext(ctx context.Context, event string, arguments []interface{}) error {
+	for _, handler := range em.listeners(event) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		result := make(chan bool, 1)
+		go func(listener Listener) {
+			result <- em.callListener(event, listener, arguments)
+		}(handler.listener)
+		select {
+		case Continue := <-result:
+			if !Continue {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// AddListener adds a new listener function pointer.
+// Listeners with a higher priority are called first, listeners with the same priority
+// are called in the order they were added. The default priority is 0.
+//
+//	em.AddListener("request", &authenticate, 100)
+//	em.AddListener("request", &audit)
+func (em *EventEmitter) AddListener(event string, listener Listener, priority ...int) *Subscription {
+	handler := registeredListener{listener: listener}
+	if len(priority) > 0 {
+		handler.priority = priority[0]
+	}
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+	handlers := em.handlers[event]
+	position := len(handlers)
+	for position > 0 && handlers[position-1].priority < handler.priority {
+		position--
 	}
+	// copy the listeners so that an Emit iterating over them is not affected
+	listeners := make([]registeredListener, 0, len(handlers)+1)
+	listeners = append(listeners, handlers[:position]...)
+	listeners = append(listeners, handler)
+	em.handlers[event] = append(listeners, handlers[position:]...)
+	return &Subscription{emitter: em, event: event, listener: listener}
 }
 
-// AddListener adds a new listener function pointer
-func (em *EventEmitter) AddListener(event string, listener Listener) {
-	if em.handlers[event] != nil {
-		em.handlers[event] = []Listener{}
+// On adds a listener function and returns its subscription:
+//
+//	subscription := app.On("user.created", func(event string, arguments ...interface{}) bool {
+//	    return true
+//	})
+//	defer subscription.Unsubscribe()
+func (em *EventEmitter) On(event string, listener ListenerFunc, priority ...int) *Subscription {
+	function := (func(string, ...interface{}) bool)(listener)
+	return em.AddListener(event, &function, priority...)
+}
+
+// Once adds a listener that is removed after its first call.
+// The returned subscription removes it before the event is emitted.
+func (em *EventEmitter) Once(event string, listener Listener, priority ...int) *Subscription {
+	var (
+		wrapper func(string, ...interface{}) bool
+		called  atomic.Bool
+	)
+	// the subscription is created before the listener is added, which can be called right away
+	subscription := &Subscription{emitter: em, event: event, listener: &wrapper}
+	wrapper = func(event string, arguments ...interface{}) bool {
+		// the event can be emitted concurrently before the listener is removed
+		if called.Swap(true) {
+			return true
+		}
+		subscription.Unsubscribe()
+		return (*listener)(event, arguments...)
 	}
-	em.handlers[event] = append(em.handlers[event], listener)
+	em.AddListener(event, &wrapper, priority...)
+	return subscription
 }
 
 // RemoveListener removes a listener function pointer
 func (em *EventEmitter) RemoveListener(event string, listener Listener) bool {
-	var found bool
-	if em.handlers[event] != nil {
-		for i, handler := range em.handlers[event] {
-			if handler == listener {
-
-				head := em.handlers[event][0:i]
-				if length := len(em.handlers); i == length-1 {
-					em.handlers[event] = head
-				} else {
-					tail := em.handlers[event][i+1 : length-1]
-					em.handlers[event] = append(head, tail...)
-				}
-
-				found = true
-				break
-			}
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+	for i, handler := range em.handlers[event] {
+		if handler.listener == listener {
+			// copy the listeners so that an Emit iterating over them is not affected
+			listeners := make([]registeredListener, 0, len(em.handlers[event])-1)
+			listeners = append(listeners, em.handlers[event][:i]...)
+			em.handlers[event] = append(listeners, em.handlers[event][i+1:]...)
+			return true
 		}
 	}
-	return found
+	return false
 }
 
 // RemoveAllListeners remove all listeners given an event and returns the listener slice
 func (em *EventEmitter) RemoveAllListeners(event string) []Listener {
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
 	listeners := []Listener{}
-	if em.handlers[event] != nil {
-		listeners, em.handlers[event] = em.handlers[event], listeners
+	for _, handler := range em.handlers[event] {
+		listeners = append(listeners, handler.listener)
 	}
+	delete(em.handlers, event)
 	return listeners
 }
 
 // HasListener returns true if an event has listeners
 func (em *EventEmitter) HasListener(event string) bool {
-	if em.handlers[event] != nil && len(em.handlers[event]) > 0 {
-		return true
-	}
-	return false
+	return len(em.listeners(event)) > 0
 }
 
 /**********************************/
@@ -763,21 +1773,223 @@ type ResponseWriterWithCode struct {
 	http.ResponseWriter
 	code          int
 	writtenLength int
+	wroteHeader   bool
+	// errorCode, if set, is the status code of the response while an error handler runs
+	errorCode int
+	// onWriteHeader is called when the header is written
+	onWriteHeader func()
+	// buffer holds the body of a buffered response, nil if the response is not buffered
+	buffer *bytes.Buffer
+}
+
+// reset prepares a pooled ResponseWriterWithCode to wrap responseWriter
+func (r *ResponseWriterWithCode) reset(responseWriter http.ResponseWriter) {
+	if r.buffer != nil {
+		r.buffer.Reset()
+		bufferPool.Put(r.buffer)
+	}
+	*r = ResponseWriterWithCode{ResponseWriter: responseWriter}
 }
 
 // WriteHeader sends an HTTP response header with status code.
+// Only the first call is sent, subsequent calls are ignored.
+// The header of a buffered response is only recorded, it is sent when the buffer is flushed.
 func (r *ResponseWriterWithCode) WriteHeader(code int) {
+	if r.wroteHeader {
+		return
+	}
+	if r.errorCode != 0 {
+		code = r.errorCode
+	}
+	r.wroteHeader = true
 	r.code = code
+	if r.buffer != nil {
+		return
+	}
+	if r.onWriteHeader != nil {
+		r.onWriteHeader()
+	}
 	r.ResponseWriter.WriteHeader(code)
 }
 
-// Write writes to the response
+// Write writes to the response, or to the buffer of a buffered response
 func (r *ResponseWriterWithCode) Write(b []byte) (int, error) {
+	r.writeImplicitHeader()
+	if r.buffer != nil {
+		r.writtenLength = r.writtenLength + len(b)
+		return r.buffer.Write(b)
+	}
 	i, err := r.ResponseWriter.Write(b)
 	r.writtenLength = r.writtenLength + len(b)
 	return i, err
 }
 
+// writeImplicitHeader records the status of a response written without calling WriteHeader
+func (r *ResponseWriterWithCode) writeImplicitHeader() {
+	if !r.wroteHeader && r.errorCode != 0 {
+		r.WriteHeader(r.errorCode)
+	}
+	if !r.wroteHeader {
+		r.wroteHeader = true
+		r.code = http.StatusOK
+		if r.onWriteHeader != nil && r.buffer == nil {
+			r.onWriteHeader()
+		}
+	}
+}
+
+// Buffer buffers the response until the end of the request, so middlewares can still change
+// its status, headers and body after the handlers have written it, to add an ETag, minify HTML
+// or substitute error pages:
+//
+//	app.Use("/", func(rw *micro.ResponseWriterWithCode, next micro.Next) {
+//		rw.Buffer()
+//		next()
+//		if rw.Code() >= 500 {
+//			rw.ResetBuffer()
+//			rw.WriteHeader(http.StatusInternalServerError)
+//			rw.Write(errorPage)
+//		}
+//	})
+//
+// It returns false if the response cannot be buffered because its header is already sent.
+func (r *ResponseWriterWithCode) Buffer() bool {
+	if r.buffer != nil {
+		return true
+	}
+	if r.wroteHeader {
+		return false
+	}
+	r.buffer = bufferPool.Get().(*bytes.Buffer)
+	return true
+}
+
+// Buffered returns true if the response is buffered
+func (r *ResponseWriterWithCode) Buffered() bool {
+	return r.buffer != nil
+}
+
+// BufferedBody returns the body of a buffered response, nil if the response is not buffered.
+// It is valid until the response is modified.
+func (r *ResponseWriterWithCode) BufferedBody() []byte {
+	if r.buffer == nil {
+		return nil
+	}
+	return r.buffer.Bytes()
+}
+
+// SetBufferedBody replaces the body of a buffered response, it does nothing if the response is not buffered
+func (r *ResponseWriterWithCode) SetBufferedBody(body []byte) {
+	if r.buffer == nil {
+		return
+	}
+	r.buffer.Reset()
+	r.buffer.Write(body)
+	r.writtenLength = len(body)
+}
+
+// ResetBuffer discards the status and the body of a buffered response, so another response can be written.
+// Headers are kept. It does nothing if the response is not buffered.
+func (r *ResponseWriterWithCode) ResetBuffer() {
+	if r.buffer == nil {
+		return
+	}
+	r.buffer.Reset()
+	r.wroteHeader, r.code, r.writtenLength = false, 0, 0
+}
+
+// flushBuffer sends the status, headers and body of a buffered response, the response is no longer buffered
+func (r *ResponseWriterWithCode) flushBuffer() error {
+	if r.buffer == nil {
+		return nil
+	}
+	buffer := r.buffer
+	r.buffer = nil
+	defer func() {
+		buffer.Reset()
+		bufferPool.Put(buffer)
+	}()
+	if !r.wroteHeader {
+		return nil
+	}
+	if r.onWriteHeader != nil {
+		r.onWriteHeader()
+	}
+	r.ResponseWriter.WriteHeader(r.code)
+	_, err := r.ResponseWriter.Write(buffer.Bytes())
+	return err
+}
+
+// ReadFrom writes the content of reader to the response,
+// using the wrapped ResponseWriter if it is an io.ReaderFrom, which allows sendfile to be used for files
+func (r *ResponseWriterWithCode) ReadFrom(reader io.Reader) (n int64, err error) {
+	r.writeImplicitHeader()
+	if r.buffer != nil {
+		n, err = r.buffer.ReadFrom(reader)
+		r.writtenLength = r.writtenLength + int(n)
+		return n, err
+	}
+	if readerFrom, ok := r.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = readerFrom.ReadFrom(reader)
+	} else {
+		// hide the methods of the wrapped ResponseWriter from io.Copy
+		n, err = io.Copy(struct{ io.Writer }{r.ResponseWriter}, reader)
+	}
+	r.writtenLength = r.writtenLength + int(n)
+	return n, err
+}
+
+// Flush sends any buffered data to the client if the wrapped ResponseWriter is a http.Flusher.
+// A buffered response is sent and stops being buffered, so streaming works.
+func (r *ResponseWriterWithCode) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		r.writeImplicitHeader()
+		r.flushBuffer()
+		flusher.Flush()
+	}
+}
+
+// Push initiates an HTTP/2 server push if the wrapped ResponseWriter is a http.Pusher,
+// it returns http.ErrNotSupported otherwise
+func (r *ResponseWriterWithCode) Push(target string, options *http.PushOptions) error {
+	if pusher, ok := r.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, options)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped ResponseWriter, http.ResponseController uses it
+// to reach the optional interfaces the wrapper does not implement
+func (r *ResponseWriterWithCode) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Supports returns true if the wrapped ResponseWriter implements the optional interface of v,
+// a pointer to an interface such as (*http.Flusher)(nil), (*http.Hijacker)(nil), (*http.Pusher)(nil)
+// or (*io.ReaderFrom)(nil). The wrapper implements them all, falling back when the wrapped ResponseWriter does not.
+func (r *ResponseWriterWithCode) Supports(v interface{}) bool {
+	return reflect.TypeOf(r.ResponseWriter).Implements(reflect.TypeOf(v).Elem())
+}
+
+// Hijack lets the caller take over the connection if the wrapped ResponseWriter is a http.Hijacker,
+// the response is then considered written with a 101 Switching Protocols status
+func (r *ResponseWriterWithCode) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker : %w", r.ResponseWriter, http.ErrNotSupported)
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err == nil {
+		if r.buffer != nil {
+			r.buffer.Reset()
+			bufferPool.Put(r.buffer)
+			r.buffer = nil
+		}
+		r.wroteHeader, r.code = true, http.StatusSwitchingProtocols
+	}
+	return conn, buffer, err
+}
+
 // Code returns the response status code
 func (r *ResponseWriterWithCode) Code() int {
 	return r.code
@@ -837,3 +2049,8 @@ func (patternMatcher PatternMatcher) Pattern() *regexp.Regexp {
 func (patternMatcher PatternMatcher) Match(request *http.Request) bool {
 	return patternMatcher.pattern.MatchString(request.URL.Path)
 }
+
+// Submatch returns the submatches of the pattern in the request url path, nil if it does not match
+func (patternMatcher PatternMatcher) Submatch(request *http.Request) []string {
+	return patternMatcher.pattern.FindStringSubmatch(request.URL.Path)
+}
@@ -18,15 +18,39 @@
 package micro_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"io/ioutil"
+	"log/slog"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/interactiv/expect"
 	"github.com/interactiv/micro"
@@ -316,6 +340,52 @@ func TestmicroError401(t *testing.T) {
 	e.Expect(body).ToEqual(notAuthorizedMessage)
 }
 
+func TestContextErrorAndAbort(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Use("/admin", func(ctx *micro.Context) {
+		if ctx.Request.URL.Query().Get("password") != "secret" {
+			ctx.Error(http.StatusForbidden, "Forbidden area")
+			ctx.Next()
+			return
+		}
+		ctx.Next()
+	})
+	app.Use("/maintenance", func(ctx *micro.Context) {
+		ctx.WriteString("under maintenance")
+		ctx.Abort()
+		ctx.Next()
+	})
+	app.All("/.*", func(ctx *micro.Context) {
+		ctx.WriteString("welcome")
+	})
+	app.Error(http.StatusForbidden, func(ctx *micro.Context) {
+		ctx.WriteString("custom forbidden")
+	})
+	for path, expected := range map[string]struct {
+		code int
+		body string
+	}{
+		"/admin":                 {http.StatusForbidden, "custom forbidden"},
+		"/admin?password=secret": {http.StatusOK, "welcome"},
+		"/maintenance":           {http.StatusOK, "under maintenance"},
+	} {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, micro.MustWithResult(http.NewRequest("GET", "http://example.com"+path, nil)).(*http.Request))
+		e.Expect(response.Code).ToBe(expected.code)
+		e.Expect(response.Body.String()).ToBe(expected.body)
+	}
+	app = micro.New()
+	app.Get("/", func(ctx *micro.Context) {
+		ctx.Error(http.StatusTeapot, "no coffee")
+		e.Expect(ctx.IsAborted()).ToBeTrue()
+	})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, micro.MustWithResult(http.NewRequest("GET", "http://example.com/", nil)).(*http.Request))
+	e.Expect(response.Code).ToBe(http.StatusTeapot)
+	e.Expect(response.Body.String()).ToBe("no coffee\n")
+}
+
 // TestMicroRouteMatchers test the new route matcher api
 func TestMicroRouteMatchers(t *testing.T) {
 	e := expect.New(t)
@@ -382,6 +452,262 @@ func TestEventEmitter(t *testing.T) {
 	e.Expect(em.HasListener("event")).ToBeTrue()
 }
 
+func TestTypedEvents(t *testing.T) {
+	e := expect.New(t)
+	type User struct {
+		Name string
+	}
+	userCreated := micro.NewEvent[*User]("user.created")
+	names := []string{}
+	em := micro.NewEventEmitter()
+	subscription := micro.Subscribe(em, userCreated, func(user *User) bool {
+		names = append(names, user.Name)
+		return true
+	})
+	micro.Publish(em, userCreated, &User{Name: "john"})
+	em.Emit("user.created", "not a person")
+	e.Expect(names).ToEqual([]string{"john"})
+	e.Expect(subscription.Unsubscribe()).ToBeTrue()
+	micro.Publish(em, userCreated, &User{Name: "jane"})
+	e.Expect(len(names)).ToBe(1)
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	e := expect.New(t)
+	events := []string{}
+	app := micro.New()
+	for _, event := range []micro.Event[*micro.Context]{
+		micro.RequestReceived, micro.RouteMatched, micro.ResponseWritten, micro.RequestFinished, micro.RequestPanic,
+	} {
+		event := event
+		micro.Subscribe(app.EventEmitter, event, func(ctx *micro.Context) bool {
+			name := event.Name
+			if ctx.Route() != nil {
+				name += " " + ctx.Route().Name()
+			}
+			events = append(events, name)
+			return true
+		})
+	}
+	micro.Subscribe(app.EventEmitter, micro.ResponseWritten, func(ctx *micro.Context) bool {
+		ctx.Response.Header().Set("X-Served-By", "micro")
+		return true
+	})
+	app.Use("/", func(ctx *micro.Context) { ctx.Next() }).SetName("middleware")
+	app.Get("/", func(ctx *micro.Context) { ctx.WriteString("home") }).SetName("home")
+	app.Get("/panic", func() { panic("boom") }).SetName("panic")
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	e.Expect(response.Header().Get("X-Served-By")).ToBe("micro")
+	e.Expect(events).ToEqual([]string{
+		"request.received",
+		"route.matched middleware",
+		"route.matched home",
+		"response.written home",
+		"request.finished home",
+	})
+	events = events[:0]
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	e.Expect(events[len(events)-2:]).ToEqual([]string{"request.panic panic", "request.finished panic"})
+}
+
+func TestErrorEvents(t *testing.T) {
+	e := expect.New(t)
+	errorEvents := []*micro.ErrorEvent{}
+	app := micro.New()
+	listener := func(event *micro.ErrorEvent) bool {
+		errorEvents = append(errorEvents, event)
+		return true
+	}
+	micro.Subscribe(app.EventEmitter, micro.ErrorClient, listener)
+	micro.Subscribe(app.EventEmitter, micro.ErrorServer, listener)
+	app.Get("/users/:id", func() error {
+		return micro.NewHTTPError(http.StatusNotFound, "")
+	}).SetName("user")
+	app.Get("/forbidden", func(rw http.ResponseWriter, next micro.Next) {
+		rw.WriteHeader(http.StatusForbidden)
+		next()
+	}).SetName("forbidden")
+	app.Get("/panic", func() { panic(io.ErrUnexpectedEOF) }).SetName("panic")
+	for _, path := range []string{"/users/1", "/forbidden", "/panic", "/missing"} {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	e.Expect(len(errorEvents)).ToBe(4)
+	e.Expect(errorEvents[0].Code).ToBe(http.StatusNotFound)
+	e.Expect(errorEvents[0].Route).ToBe("user")
+	e.Expect(errorEvents[0].Err.Error()).ToBe("404 Not Found")
+	e.Expect(errorEvents[1].Code).ToBe(http.StatusForbidden)
+	e.Expect(errorEvents[1].Route).ToBe("forbidden")
+	e.Expect(errorEvents[1].Err).ToBeNil()
+	e.Expect(errorEvents[2].Code).ToBe(http.StatusInternalServerError)
+	e.Expect(errorEvents[2].Err).ToBe(io.ErrUnexpectedEOF)
+	e.Expect(errorEvents[3].Code).ToBe(http.StatusNotFound)
+	e.Expect(errorEvents[3].Route).ToBe("")
+}
+
+func TestEventEmitterEmitContext(t *testing.T) {
+	e := expect.New(t)
+	em := micro.NewEventEmitter()
+	calls := make(chan string, 3)
+	fast := func(event string, arguments ...interface{}) bool {
+		calls <- fmt.Sprint("fast ", arguments[1])
+		return true
+	}
+	slow := func(event string, arguments ...interface{}) bool {
+		<-arguments[0].(context.Context).Done()
+		calls <- "slow"
+		return true
+	}
+	em.AddListener("shutdown", &fast)
+	em.AddListener("shutdown", &slow)
+	em.AddListener("shutdown", &fast)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	e.Expect(em.EmitContext(ctx, "shutdown", "now")).ToBe(context.DeadlineExceeded)
+	e.Expect(<-calls).ToBe("fast now")
+	e.Expect(<-calls).ToBe("slow")
+	e.Expect(len(calls)).ToBe(0)
+	e.Expect(em.EmitContext(context.Background(), "missing")).ToBeNil()
+}
+
+func TestEventEmitterOnceAndPriorities(t *testing.T) {
+	e := expect.New(t)
+	calls := []string{}
+	em := micro.NewEventEmitter()
+	first := func(event string, arguments ...interface{}) bool {
+		calls = append(calls, "first")
+		return true
+	}
+	second := func(event string, arguments ...interface{}) bool {
+		calls = append(calls, fmt.Sprint("second ", arguments[0]))
+		return true
+	}
+	last := func(event string, arguments ...interface{}) bool {
+		calls = append(calls, "last")
+		return true
+	}
+	em.AddListener("boot", &first)
+	em.Once("boot", &second)
+	em.AddListener("boot", &last)
+	em.Emit("boot", 1)
+	em.Emit("boot", 2)
+	e.Expect(calls).ToEqual([]string{"first", "second 1", "last", "first", "last"})
+	calls = calls[:0]
+	em.AddListener("request", &last, -10)
+	em.AddListener("request", &first, 100)
+	em.Once("request", &second, 100)
+	em.Emit("request", 3)
+	e.Expect(calls).ToEqual([]string{"first", "second 3", "last"})
+	once := em.Once("warmup", &first)
+	e.Expect(once.Unsubscribe()).ToBeTrue()
+	e.Expect(em.HasListener("warmup")).ToBeFalse()
+}
+
+func TestEventEmitterConcurrency(t *testing.T) {
+	e := expect.New(t)
+	em := micro.NewEventEmitter()
+	var onceCalls int32
+	once := func(event string, arguments ...interface{}) bool {
+		atomic.AddInt32(&onceCalls, 1)
+		return true
+	}
+	em.Once("event", &once)
+	wait := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wait.Add(2)
+		go func() {
+			defer wait.Done()
+			em.Emit("event")
+		}()
+		go func() {
+			defer wait.Done()
+			subscription := em.On("event", func(event string, arguments ...interface{}) bool { return true }, i)
+			em.HasListener("event")
+			subscription.Unsubscribe()
+		}()
+	}
+	wait.Wait()
+	e.Expect(atomic.LoadInt32(&onceCalls)).ToBe(int32(1))
+
+	// once listeners can be called while Once returns
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for atomic.LoadInt32(&onceCalls) < 21 {
+			em.Emit("emitted")
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		em.Once("emitted", &once)
+	}
+	<-done
+	e.Expect(em.HasListener("emitted")).ToBeFalse()
+}
+
+func TestEventEmitterIntercept(t *testing.T) {
+	e := expect.New(t)
+	calls := []string{}
+	em := micro.NewEventEmitter()
+	em.On("user.created", func(event string, arguments ...interface{}) bool {
+		calls = append(calls, fmt.Sprint(event, " ", arguments))
+		return true
+	})
+	em.Intercept(func(event string, arguments []interface{}, next func([]interface{})) {
+		calls = append(calls, "log "+event)
+		next(arguments)
+	})
+	em.Intercept(func(event string, arguments []interface{}, next func([]interface{})) {
+		if strings.HasPrefix(event, "internal.") {
+			return
+		}
+		next(append(arguments, "enriched"))
+	})
+	em.Emit("user.created", "john")
+	em.Emit("internal.tick")
+	e.Expect(calls).ToEqual([]string{"log user.created", "user.created [john enriched]", "log internal.tick"})
+}
+
+func TestEventEmitterListenerPanic(t *testing.T) {
+	e := expect.New(t)
+	calls := []string{}
+	em := micro.NewEventEmitter()
+	em.On("event", func(event string, arguments ...interface{}) bool {
+		panic("buggy listener")
+	})
+	em.On("event", func(event string, arguments ...interface{}) bool {
+		calls = append(calls, "next listener")
+		return true
+	})
+	micro.Subscribe(em, micro.ListenerPanic, func(payload *micro.ListenerPanicEvent) bool {
+		calls = append(calls, fmt.Sprint(payload.Event, " ", payload.Recovered))
+		panic("buggy panic listener")
+	})
+	em.Emit("event")
+	e.Expect(calls).ToEqual([]string{"event buggy listener", "next listener"})
+	e.Expect(em.EmitContext(context.Background(), "event")).ToBeNil()
+	e.Expect(len(calls)).ToBe(4)
+}
+
+func TestEventEmitterSubscriptions(t *testing.T) {
+	e := expect.New(t)
+	called := 0
+	em := micro.NewEventEmitter()
+	subscription := em.On("event", func(event string, arguments ...interface{}) bool {
+		called++
+		return true
+	})
+	e.Expect(subscription.Event()).ToBe("event")
+	em.Emit("event")
+	e.Expect(subscription.Unsubscribe()).ToBeTrue()
+	e.Expect(subscription.Unsubscribe()).ToBeFalse()
+	em.Emit("event")
+	e.Expect(called).ToBe(1)
+	listener := func(event string, arguments ...interface{}) bool { return true }
+	subscription = em.AddListener("event", &listener)
+	e.Expect(subscription.Listener()).ToBe(micro.Listener(&listener))
+	e.Expect(em.RemoveListener("event", &listener)).ToBeTrue()
+}
+
 /**********************************/
 /*     ROUTE COLLECTION TESTS     */
 /**********************************/
@@ -394,6 +720,26 @@ func TestAddRoute(t *testing.T) {
 	e.Expect(len(rc.Routes)).ToBe(1)
 }
 
+func TestRequestMatcherMatch(t *testing.T) {
+	e := expect.New(t)
+	collection := micro.NewControllerCollection()
+	collection.Post("/users/:id", func() {})
+	collection.Get("/users/:id", func() {})
+	collection.Use("/", func() {})
+	collection.Flush()
+	matcher := micro.NewRequestMatcher(collection)
+	request := httptest.NewRequest("GET", "/users/42", nil)
+	route, submatches, next := matcher.Match(request, 0)
+	e.Expect(route).ToBe(collection.Routes[1])
+	e.Expect(submatches[1]).ToBe("42")
+	e.Expect(next).ToBe(2)
+	route, _, next = matcher.Match(request, next)
+	e.Expect(route).ToBe(collection.Routes[2])
+	route, _, _ = matcher.Match(request, next)
+	e.Expect(route).ToBeNil()
+	e.Expect(len(matcher.MatchAll(request))).ToBe(2)
+}
+
 func TestRouteCollectionMount(t *testing.T) {
 	e := expect.New(t)
 	app := micro.New()
@@ -452,55 +798,3356 @@ func TestContextReadJson(t *testing.T) {
 	e.Expect(response.Body.String()).ToEqual("foobar")
 }
 
-/**********************************/
-/*           UTILS TESTS          */
-/**********************************/
+func TestContextMsgPack(t *testing.T) {
+	e := expect.New(t)
+	type Account struct {
+		Owner   string
+		Balance float64
+		Tags    []string `msgpack:"tags"`
+		Secret  string   `msgpack:"-"`
+		Number  int64
+	}
+	response := httptest.NewRecorder()
+	context := micro.NewContext(response, nil)
+	err := context.WriteMsgPack(&Account{Owner: "john", Balance: 1000.5, Tags: []string{"a", "b"}, Secret: "secret", Number: -70000})
+	e.Expect(err).ToBeNil()
+	e.Expect(response.Header().Get("Content-Type")).ToBe("application/msgpack")
+	req, _ := http.NewRequest("POST", "example.com", bytes.NewReader(response.Body.Bytes()))
+	context = micro.NewContext(nil, req)
+	account := new(Account)
+	e.Expect(context.ReadMsgPack(account)).ToBeNil()
+	e.Expect(*account).ToEqual(Account{Owner: "john", Balance: 1000.5, Tags: []string{"a", "b"}, Number: -70000})
+	var generic map[string]interface{}
+	e.Expect(micro.NewMsgPackDecoder(bytes.NewReader(response.Body.Bytes())).Decode(&generic)).ToBeNil()
+	e.Expect(generic["tags"]).ToEqual([]interface{}{"a", "b"})
+	e.Expect(generic["Number"]).ToEqual(int64(-70000))
+}
 
-func TestMustWithResult(t *testing.T) {
-	b := func() (*Foo, error) {
-		return new(Foo), nil
+func TestMsgPackDecoderLimits(t *testing.T) {
+	e := expect.New(t)
+	decode := func(data []byte, v interface{}) error {
+		return micro.NewMsgPackDecoder(bytes.NewReader(data)).Decode(v)
 	}
-	_ = micro.MustWithResult(b()).(*Foo)
+	var generic interface{}
+	var names []string
+	var data []byte
+	// lengths announced on the wire are not allocated
+	e.Expect(decode([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, &generic)).Not().ToBeNil()
+	e.Expect(decode([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, &names)).Not().ToBeNil()
+	e.Expect(decode([]byte{0xc6, 0xff, 0xff, 0xff, 0xff}, &data)).Not().ToBeNil()
+	e.Expect(decode([]byte{0xdd, 0x00, 0x01, 0x00, 0x00, 0xc0}, &generic)).Not().ToBeNil()
+	e.Expect(decode([]byte{0xc6, 0x00, 0x01, 0x00, 0x00, 'a'}, &data)).Not().ToBeNil()
+	// nesting is limited
+	e.Expect(decode(bytes.Repeat([]byte{0x91}, 100000), &generic)).Not().ToBeNil()
+	nested := append(bytes.Repeat([]byte{0x91}, micro.MsgPackMaxDepth-1), 0x01)
+	e.Expect(decode(nested, &generic)).ToBeNil()
+	// keys which are not comparable are rejected
+	e.Expect(decode([]byte{0x81, 0x90, 0x01}, &generic)).Not().ToBeNil()
+	var keyed map[interface{}]interface{}
+	e.Expect(decode([]byte{0x81, 0x90, 0x01}, &keyed)).Not().ToBeNil()
+
+	app := micro.New()
+	app.Post("/", func(ctx *micro.Context) error {
+		var body interface{}
+		if err := ctx.ReadMsgPack(&body); err != nil {
+			return micro.BadRequest(err.Error())
+		}
+		return nil
+	})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("POST", "/", bytes.NewReader([]byte{0x81, 0x90, 0x01})))
+	e.Expect(response.Code).ToBe(http.StatusBadRequest)
 }
 
-/********************************/
-/*            FIXTURES          */
-/********************************/
+func TestMsgPackDecoderFormats(t *testing.T) {
+	e := expect.New(t)
+	decode := func(data []byte, v interface{}) error {
+		return micro.NewMsgPackDecoder(bytes.NewReader(data)).Decode(v)
+	}
+	str := func(header []byte, n int) []byte {
+		return append(header, bytes.Repeat([]byte{'a'}, n)...)
+	}
+	for _, test := range []struct {
+		name     string
+		input    []byte
+		expected interface{}
+	}{
+		{"positive fixint", []byte{0x7f}, int64(127)},
+		{"negative fixint", []byte{0xe0}, int64(-32)},
+		{"fixstr", str([]byte{0xa3}, 3), "aaa"},
+		{"str8", str([]byte{0xd9, 0x20}, 32), strings.Repeat("a", 32)},
+		{"str16", str([]byte{0xda, 0x01, 0x00}, 256), strings.Repeat("a", 256)},
+		{"str32", str([]byte{0xdb, 0x00, 0x01, 0x00, 0x00}, 65536), strings.Repeat("a", 65536)},
+		{"bin8", []byte{0xc4, 0x02, 0x01, 0x02}, []byte{0x01, 0x02}},
+		{"bin16", []byte{0xc5, 0x00, 0x02, 0x01, 0x02}, []byte{0x01, 0x02}},
+		{"bin32", []byte{0xc6, 0x00, 0x00, 0x00, 0x02, 0x01, 0x02}, []byte{0x01, 0x02}},
+		{"map16", []byte{0xde, 0x00, 0x01, 0xa1, 'a', 0x01}, map[string]interface{}{"a": int64(1)}},
+		{"map32", []byte{0xdf, 0x00, 0x00, 0x00, 0x01, 0xa1, 'a', 0x01}, map[string]interface{}{"a": int64(1)}},
+		{"nil", []byte{0xc0}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var generic interface{}
+			expect.New(t).Expect(decode(test.input, &generic)).ToBeNil()
+			expect.New(t).Expect(generic).ToEqual(test.expected)
+		})
+	}
 
-type Foo struct {
-	Bar string
+	var integer int8
+	e.Expect(decode([]byte{0xe0}, &integer)).ToBeNil()
+	e.Expect(integer).ToBe(int8(-32))
+	var text string
+	e.Expect(decode(str([]byte{0xda, 0x01, 0x00}, 256), &text)).ToBeNil()
+	e.Expect(len(text)).ToBe(256)
+	var data []byte
+	e.Expect(decode([]byte{0xc5, 0x00, 0x02, 0x01, 0x02}, &data)).ToBeNil()
+	e.Expect(data).ToEqual([]byte{0x01, 0x02})
+	var counts map[string]int
+	e.Expect(decode([]byte{0xdf, 0x00, 0x00, 0x00, 0x02, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}, &counts)).ToBeNil()
+	e.Expect(counts).ToEqual(map[string]int{"a": 1, "b": 2})
+	// nil sets pointers to nil
+	pointer := new(int)
+	e.Expect(decode([]byte{0xc0}, &pointer)).ToBeNil()
+	e.Expect(pointer == nil).ToBeTrue()
+	// elements of arrays past the decoded length are zeroed
+	array := [3]int{7, 8, 9}
+	e.Expect(decode([]byte{0x91, 0x01}, &array)).ToBeNil()
+	e.Expect(array).ToEqual([3]int{1, 0, 0})
+	e.Expect(decode([]byte{0x94, 0x01, 0x02, 0x03, 0x04}, &array)).Not().ToBeNil()
+	// extension types are not supported
+	for _, input := range [][]byte{
+		{0xd4, 0x01, 0x00},
+		{0xd8, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		{0xc7, 0x01, 0x01, 0x00},
+	} {
+		var generic interface{}
+		e.Expect(decode(input, &generic)).Not().ToBeNil()
+	}
+	// truncated input is an error
+	for _, input := range [][]byte{
+		{},
+		{0xcd, 0x01},
+		{0xd9},
+		{0xda, 0x01, 0x00, 'a'},
+		{0xc4, 0x02, 0x01},
+		{0xde, 0x00, 0x01, 0xa1, 'a'},
+		{0x92, 0x01},
+	} {
+		var generic interface{}
+		e.Expect(decode(input, &generic)).Not().ToBeNil()
+	}
 }
 
-func (f Foo) Call() string {
-	return "called"
+func TestContextWriteCSV(t *testing.T) {
+	e := expect.New(t)
+	response := httptest.NewRecorder()
+	context := micro.NewContext(response, nil)
+	context.SetContentDisposition("attachment", "export.csv")
+	err := context.WriteCSV([]string{"id", "name"}, func(w *csv.Writer) error {
+		for i, name := range []string{"john", "jane, doe"} {
+			if err := w.Write([]string{fmt.Sprint(i), name}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	e.Expect(err).ToBeNil()
+	e.Expect(response.Header().Get("Content-Type")).ToBe("text/csv")
+	e.Expect(response.Header().Get("Content-Disposition")).ToBe(`attachment; filename=export.csv`)
+	e.Expect(response.Body.String()).ToBe("id,name\n0,john\n1,\"jane, doe\"\n")
+	e.Expect(response.Flushed).ToBeTrue()
 }
 
-type Caller interface {
-	Call() string
+func TestContextSSE(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/events", func(ctx *micro.Context) {
+		stream, err := ctx.SSE()
+		e.Expect(err).ToBeNil()
+		defer stream.Close()
+		e.Expect(stream.Send("greeting", "1", "hello\nworld")).ToBeNil()
+		e.Expect(stream.Send("", "", "bye")).ToBeNil()
+	})
+	server := httptest.NewServer(app)
+	defer server.Close()
+	res, err := http.Get(server.URL + "/events")
+	e.Expect(err).ToBeNil()
+	defer res.Body.Close()
+	e.Expect(res.Header.Get("Content-Type")).ToBe("text/event-stream")
+	body, err := ioutil.ReadAll(res.Body)
+	e.Expect(err).ToBeNil()
+	e.Expect(string(body)).ToBe("event: greeting\nid: 1\ndata: hello\ndata: world\n\ndata: bye\n\n")
 }
 
-type Person struct {
-	id   int
-	name string
+func TestContextSSEClosedWhenHandled(t *testing.T) {
+	e := expect.New(t)
+	streams := make(chan *micro.EventStream, 1)
+	app := micro.New()
+	app.Get("/events", func(ctx *micro.Context) {
+		stream, err := ctx.SSE()
+		e.Expect(err).ToBeNil()
+		e.Expect(stream.Send("", "", "hello")).ToBeNil()
+		streams <- stream
+	})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/events", nil))
+	stream := <-streams
+	select {
+	case <-stream.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the event stream is not closed once the request is handled")
+	}
+	e.Expect(stream.Send("", "", "late")).ToBe(micro.ErrStreamClosed)
+	e.Expect(response.Body.String()).ToBe("data: hello\n\n")
 }
 
-func (p Person) Find(id int) *Person {
-	var (
-		person           *Person
-		personRepository = []*Person{
-			&Person{id: 0, name: "James"},
-			&Person{id: 1, name: "Frank"},
-		}
-	)
-	for _, p := range personRepository {
-		if p.id == id {
-			person = p
-			break
-		}
+func TestContextAttachment(t *testing.T) {
+	e := expect.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report")
+	e.Expect(os.WriteFile(path, []byte("%PDF-1.4 report"), 0644)).ToBeNil()
+	req, _ := http.NewRequest("GET", "http://example.com/report", nil)
+	response := httptest.NewRecorder()
+	context := micro.NewContext(response, req)
+	e.Expect(context.Attachment(path, "report.pdf")).ToBeNil()
+	e.Expect(response.Header().Get("Content-Type")).ToBe("application/pdf")
+	e.Expect(response.Header().Get("Content-Disposition")).ToBe("attachment; filename=report.pdf")
+	e.Expect(response.Body.String()).ToBe("%PDF-1.4 report")
+	response = httptest.NewRecorder()
+	context = micro.NewContext(response, req)
+	e.Expect(context.Inline(path)).ToBeNil()
+	e.Expect(response.Header().Get("Content-Type")).ToBe("application/pdf")
+	e.Expect(response.Header().Get("Content-Disposition")).ToBe("inline; filename=report")
+	e.Expect(context.Inline(filepath.Join(dir, "missing"))).Not().ToBeNil()
+}
+
+func TestContextSendFile(t *testing.T) {
+	e := expect.New(t)
+	fsys := fstest.MapFS{"videos/clip.mp4": &fstest.MapFile{Data: []byte("0123456789"), ModTime: time.Now()}}
+	app := micro.New()
+	app.Get("/videos/:name", func(ctx *micro.Context) {
+		e.Expect(ctx.SendFile(fsys, "videos/"+ctx.RequestVars["name"])).ToBeNil()
+	}).Assert("name", `[\w.]+`)
+	req, _ := http.NewRequest("GET", "http://example.com/videos/clip.mp4", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, req)
+	e.Expect(response.Code).ToBe(http.StatusPartialContent)
+	e.Expect(response.Body.String()).ToBe("2345")
+	e.Expect(response.Header().Get("Content-Range")).ToBe("bytes 2-5/10")
+	etag := response.Header().Get("ETag")
+	e.Expect(etag).Not().ToBe("")
+	req, _ = http.NewRequest("GET", "http://example.com/videos/clip.mp4", nil)
+	req.Header.Set("If-None-Match", etag)
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, req)
+	e.Expect(response.Code).ToBe(http.StatusNotModified)
+
+	// files without modification time, such as embedded files, are tagged from their content
+	fsys["videos/a.mp4"] = &fstest.MapFile{Data: []byte("aaaa")}
+	fsys["videos/b.mp4"] = &fstest.MapFile{Data: []byte("bbbb")}
+	etags := []string{}
+	for _, name := range []string{"a.mp4", "b.mp4"} {
+		response = httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "http://example.com/videos/"+name, nil))
+		e.Expect(response.Body.String()).ToBe(strings.Repeat(name[:1], 4))
+		etags = append(etags, response.Header().Get("ETag"))
 	}
-	return person
+	e.Expect(etags[0]).Not().ToBe(etags[1])
 }
 
-var (
-	PersonRepository Person
-)
+func TestContextRender(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/render", func(ctx *micro.Context) {
+		e.Expect(ctx.Render(http.StatusCreated, "greet", "john")).ToBe(micro.ErrNoRenderer)
+	})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, micro.MustWithResult(http.NewRequest("GET", "http://example.com/render", nil)).(*http.Request))
+	app = micro.New()
+	app.SetRenderer(FakeRenderer{template.Must(template.New("greet").Parse("Hello {{.}}"))})
+	app.Get("/render", func(ctx *micro.Context) {
+		e.Expect(ctx.Render(http.StatusCreated, "greet", "john")).ToBeNil()
+	})
+	app.Get("/broken", func(ctx *micro.Context) {
+		e.Expect(ctx.Render(http.StatusOK, "missing", nil)).Not().ToBeNil()
+		e.Expect(ctx.Response.(*micro.ResponseWriterWithCode).Length()).ToBe(0)
+	})
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, micro.MustWithResult(http.NewRequest("GET", "http://example.com/broken", nil)).(*http.Request))
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, micro.MustWithResult(http.NewRequest("GET", "http://example.com/render", nil)).(*http.Request))
+	e.Expect(response.Code).ToBe(http.StatusCreated)
+	e.Expect(response.Header().Get("Content-Type")).ToBe("text/html; charset=utf-8")
+	e.Expect(response.Body.String()).ToBe("Hello john")
+}
+
+func TestTemplateRenderer(t *testing.T) {
+	e := expect.New(t)
+	fsys := fstest.MapFS{
+		"layouts/base.html":    &fstest.MapFile{Data: []byte(`<title>{{block "title" .}}Site{{end}}</title>{{block "content" .}}{{end}}`)},
+		"layouts/admin.html":   &fstest.MapFile{Data: []byte(`{{/* extends "layouts/base" */}}{{define "content"}}[admin]{{block "body" .}}{{end}}{{end}}`)},
+		"partials/footer.html": &fstest.MapFile{Data: []byte(`<footer>{{.Globals.Year}}</footer>`)},
+		"users/show.html":      &fstest.MapFile{Data: []byte(`{{define "title"}}{{upper .Data}}{{end}}{{define "content"}}{{.Data}}{{template "partials/footer.html" .}}{{end}}`)},
+		"users/edit.html":      &fstest.MapFile{Data: []byte(`{{/* extends "layouts/admin.html" */}}{{define "body"}}<input value="{{.CSRFToken}}">{{end}}`)},
+		"raw.html":             &fstest.MapFile{Data: []byte(`{{/* extends "" */}}raw {{.Data}}`)},
+	}
+	renderer := micro.NewTemplateRenderer(fsys, micro.TemplateOptions{
+		Layout:   "layouts/base",
+		Partials: []string{"partials/*.html"},
+		Funcs:    template.FuncMap{"upper": strings.ToUpper},
+		Data: func(ctx *micro.Context) map[string]interface{} {
+			return map[string]interface{}{"Year": 2015}
+		},
+		Cache: true,
+	})
+	app := micro.New()
+	app.SetRenderer(renderer)
+	app.Get("/users/:page", func(ctx *micro.Context) {
+		ctx.Vars[micro.CSRFTokenVar] = "token"
+		e.Expect(ctx.Render(http.StatusOK, "users/"+ctx.RequestVars["page"], "john")).ToBeNil()
+	})
+	for path, body := range map[string]string{
+		"/users/show": `<title>JOHN</title>john<footer>2015</footer>`,
+		"/users/edit": `<title>Site</title>[admin]<input value="token">`,
+	} {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, micro.MustWithResult(http.NewRequest("GET", "http://example.com"+path, nil)).(*http.Request))
+		e.Expect(response.Body.String()).ToBe(body)
+	}
+	buffer := new(bytes.Buffer)
+	e.Expect(renderer.Render(buffer, "raw", "<b>")).ToBeNil()
+	e.Expect(buffer.String()).ToBe("raw &lt;b&gt;")
+	e.Expect(renderer.Render(buffer, "missing", nil)).Not().ToBeNil()
+}
+
+func TestContextVars(t *testing.T) {
+	e := expect.New(t)
+	type User struct{ Name string }
+	context := micro.NewContext(nil, nil)
+	_, ok := micro.GetVar[*User](context, "user")
+	e.Expect(ok).ToBeFalse()
+	micro.SetVar(context, "user", &User{Name: "john"})
+	user, ok := micro.GetVar[*User](context, "user")
+	e.Expect(ok).ToBeTrue()
+	e.Expect(user.Name).ToBe("john")
+	_, ok = micro.GetVar[string](context, "user")
+	e.Expect(ok).ToBeFalse()
+	done := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			micro.SetVar(context, fmt.Sprint("key", i), i)
+			micro.GetVar[int](context, "key0")
+			done <- true
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+	count, _ := micro.GetVar[int](context, "key9")
+	e.Expect(count).ToBe(9)
+}
+
+func TestContextIsAContext(t *testing.T) {
+	e := expect.New(t)
+	type key string
+	parent, cancel := context.WithCancel(context.WithValue(context.Background(), key("user"), "john"))
+	req, _ := http.NewRequestWithContext(parent, "GET", "http://example.com", nil)
+	var ctx context.Context = micro.NewContext(nil, req)
+	e.Expect(ctx.Value(key("user"))).ToBe("john")
+	e.Expect(ctx.Err()).ToBeNil()
+	cancel()
+	<-ctx.Done()
+	e.Expect(ctx.Err()).ToBe(context.Canceled)
+	_, ok := micro.NewContext(nil, nil).Deadline()
+	e.Expect(ok).ToBeFalse()
+}
+
+func TestContextInjection(t *testing.T) {
+	e := expect.New(t)
+	type key string
+	app := micro.New()
+	app.Use("/", func(ctx *micro.Context, next micro.Next) {
+		ctx.SetContext(context.WithValue(ctx.Request.Context(), key("user"), "john"))
+		next()
+	})
+	app.Use("/", func(ctx *micro.Context, next micro.Next) {
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), key("role"), "admin"))
+		next()
+	})
+	app.Get("/", func(c context.Context, r *http.Request, rw http.ResponseWriter) {
+		e.Expect(c.Value(key("user"))).ToBe("john")
+		e.Expect(c.Value(key("role"))).ToBe("admin")
+		e.Expect(r.Context()).ToBe(c)
+		rw.Write([]byte("ok"))
+	})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, micro.MustWithResult(http.NewRequest("GET", "http://example.com/", nil)).(*http.Request))
+	e.Expect(response.Body.String()).ToBe("ok")
+}
+
+func TestInjectorCall(t *testing.T) {
+	e := expect.New(t)
+	injector := micro.NewInjector(&Foo{})
+	handler := func(foo *Foo) (int, error) {
+		return 10, fmt.Errorf("failed")
+	}
+	for _, function := range []interface{}{handler, &handler} {
+		results, err := injector.Call(function)
+		e.Expect(err).ToBeNil()
+		e.Expect(len(results)).ToBe(2)
+		e.Expect(results[0].Int()).ToBe(int64(10))
+		e.Expect(results[1].Interface().(error).Error()).ToBe("failed")
+	}
+	called := false
+	_, err := injector.Call(func(foo *Foo, person *Person) { called = true })
+	e.Expect(err).Not().ToBeNil()
+	e.Expect(called).ToBeFalse()
+	_, err = injector.Call("not a function")
+	e.Expect(err).Not().ToBeNil()
+}
+
+func TestInjectorResolutionError(t *testing.T) {
+	type Repository struct{}
+	type Service struct{}
+	type Chicken struct{}
+	type Egg struct{}
+	e := expect.New(t)
+	injector := micro.NewInjector()
+	injector.Provide(func(person *Person) *Repository { return &Repository{} })
+	injector.ProvideTransient(func(repository *Repository) *Service { return &Service{} })
+	_, err := injector.Call(func(service *Service) {})
+	resolutionError, ok := err.(*micro.ResolutionError)
+	e.Expect(ok).ToBeTrue()
+	e.Expect(resolutionError.Cycle).ToBeFalse()
+	e.Expect(resolutionError.Chain).ToEqual([]reflect.Type{
+		reflect.TypeOf(&Service{}), reflect.TypeOf(&Repository{}), reflect.TypeOf(&Person{}),
+	})
+	e.Expect(resolutionError.Function).ToContain("micro_test.go")
+	e.Expect(err.Error()).ToContain("*micro_test.Person cannot be injected : not found")
+	injector.Provide(func(egg *Egg) *Chicken { return &Chicken{} })
+	injector.ProvideScoped(func(chicken *Chicken) *Egg { return &Egg{} })
+	_, err = injector.Call(func(egg *Egg) {})
+	resolutionError = err.(*micro.ResolutionError)
+	e.Expect(resolutionError.Cycle).ToBeTrue()
+	e.Expect(err.Error()).ToContain("circular dependency *micro_test.Egg -> *micro_test.Chicken -> *micro_test.Egg")
+}
+
+func BenchmarkInjectorCall(b *testing.B) {
+	app := micro.New()
+	injector := micro.NewInjector(&Foo{}, &Person{})
+	injector.SetParent(app.Injector())
+	handler := func(foo *Foo, person *Person, app *micro.Micro) {}
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		injector.Call(handler)
+	}
+}
+
+func TestHandlerArguments(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Injector().Register(&MemoryStorage{name: "main"})
+	app.Use("/", func(injector *micro.Injector, next micro.Next) {
+		injector.Register(&Foo{})
+		next()
+	})
+	app.Get("/context/:id", func(ctx *micro.Context) error {
+		_, err := ctx.WriteString(ctx.RequestVars["id"])
+		return err
+	})
+	app.Get("/http", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(r.URL.Path))
+	})
+	app.Get("/mixed/:id", func(ctx *micro.Context, params micro.Params, storage *MemoryStorage, foo *Foo,
+		requestContext context.Context, rw *micro.ResponseWriterWithCode, emitter *micro.EventEmitter) {
+		e.Expect(foo).Not().ToBeNil()
+		e.Expect(requestContext).ToBe(ctx.Request.Context())
+		e.Expect(emitter).ToBe(app.EventEmitter)
+		rw.Write([]byte(storage.name + " " + params["id"]))
+	})
+	app.Get("/missing", func(person *Person) {})
+	for path, body := range map[string]string{"/context/1": "1", "/http": "/http", "/mixed/2": "main 2"} {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		e.Expect(response.Body.String()).ToBe(body)
+	}
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/missing", nil))
+	e.Expect(response.Code).ToBe(http.StatusInternalServerError)
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	app := micro.New()
+	app.Injector().Register(&MemoryStorage{name: "main"})
+	app.Get("/users/:id", func(ctx *micro.Context, params micro.Params, storage *MemoryStorage) {})
+	request := httptest.NewRequest("GET", "/users/1", nil)
+	response := httptest.NewRecorder()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		app.ServeHTTP(response, request)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	e := expect.New(t)
+	injector := micro.NewInjector(&Foo{})
+	injector.RegisterAs(&MemoryStorage{name: "main"}, (*Storage)(nil))
+	storage, err := micro.Resolve[Storage](injector)
+	e.Expect(err).ToBeNil()
+	e.Expect(storage.Name()).ToBe("main")
+	e.Expect(micro.MustResolve[*Foo](injector)).Not().ToBeNil()
+	person, err := micro.Resolve[*Person](injector)
+	e.Expect(person).ToBeNil()
+	e.Expect(err).Not().ToBeNil()
+	e.Expect(func() { micro.MustResolve[*Person](injector) }).ToPanic()
+}
+
+func TestInjectorOverride(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Injector().RegisterAs(&MemoryStorage{name: "main"}, (*Storage)(nil))
+	app.Get("/", func(ctx *micro.Context, storage Storage) {
+		ctx.WriteString(storage.Name())
+	})
+	get := func() string {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+		return response.Body.String()
+	}
+	func() {
+		defer app.SetInjector(app.Injector())
+		app.SetInjector(app.Injector().Override(&MemoryStorage{name: "fake"}))
+		e.Expect(get()).ToBe("fake")
+	}()
+	e.Expect(get()).ToBe("main")
+	child := app.Injector().Child()
+	e.Expect(child.Parent()).ToBe(app.Injector())
+	e.Expect(micro.MustResolve[*micro.Micro](child)).ToBe(app)
+}
+
+func TestParams(t *testing.T) {
+	type UserParams struct {
+		micro.In
+		ID      int     `param:"id"`
+		Slug    *string `param:"slug"`
+		Missing bool    `param:"missing"`
+		App     *micro.Micro
+	}
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/users/:id/:slug", func(ctx *micro.Context, params micro.Params, user UserParams) {
+		id, err := params.Int("id")
+		e.Expect(err).ToBeNil()
+		e.Expect(user.App).ToBe(app)
+		e.Expect(user.Missing).ToBeFalse()
+		ctx.WriteString(params["slug"], " ", id+user.ID, " ", *user.Slug)
+	})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/users/21/john", nil))
+	e.Expect(response.Body.String()).ToBe("john 42 john")
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/users/john/john", nil))
+	e.Expect(response.Code).ToBe(http.StatusBadRequest)
+	_, err := micro.Params{"id": "a"}.Int("id")
+	e.Expect(err.(*micro.ParamError).Name).ToBe("id")
+}
+
+func TestHandlerResults(t *testing.T) {
+	type User struct {
+		Name string `json:"name" xml:"name"`
+	}
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/users/:name", func(params micro.Params) (interface{}, error) {
+		return User{Name: params["name"]}, nil
+	})
+	app.Post("/users", func() (int, *User, error) {
+		return http.StatusCreated, &User{Name: "john"}, nil
+	})
+	app.Delete("/users/:name", func() (int, interface{}, error) {
+		return http.StatusNoContent, nil, nil
+	})
+	app.Get("/invalid/:id", func() (interface{}, error) {
+		return nil, &micro.ParamError{Name: "id", Type: reflect.TypeOf(0)}
+	})
+	app.Get("/failing", func() (interface{}, error) {
+		return nil, fmt.Errorf("database password is wrong")
+	})
+	app.Get("/typed/:name", func(params micro.Params) (*User, *micro.HTTPError) {
+		if params["name"] == "missing" {
+			return nil, micro.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		return &User{Name: params["name"]}, nil
+	})
+	app.Put("/typed/:name", func(params micro.Params) (int, *User, *micro.ParamError) {
+		return http.StatusAccepted, &User{Name: params["name"]}, nil
+	})
+	app.Error(http.StatusBadRequest, func(ctx *micro.Context) {
+		ctx.WriteString("bad request")
+	})
+	serve := func(method, path, accept string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		request := httptest.NewRequest(method, path, nil)
+		request.Header.Set("Accept", accept)
+		app.ServeHTTP(response, request)
+		return response
+	}
+	response := serve("GET", "/users/jane", "")
+	e.Expect(response.Body.String()).ToBe(`{"name":"jane"}` + "\n")
+	response = serve("GET", "/users/jane", "text/xml")
+	e.Expect(response.Body.String()).ToBe("<User><name>jane</name></User>")
+	response = serve("GET", "/users/jane", "text/html")
+	e.Expect(response.Code).ToBe(http.StatusNotAcceptable)
+	response = serve("POST", "/users", "application/json")
+	e.Expect(response.Code).ToBe(http.StatusCreated)
+	e.Expect(response.Header().Get("Content-Type")).ToBe("application/json")
+	response = serve("DELETE", "/users/john", "")
+	e.Expect(response.Code).ToBe(http.StatusNoContent)
+	e.Expect(response.Body.Len()).ToBe(0)
+	response = serve("GET", "/invalid/1", "")
+	e.Expect(response.Code).ToBe(http.StatusBadRequest)
+	e.Expect(response.Body.String()).ToBe("bad request")
+	response = serve("GET", "/failing", "")
+	e.Expect(response.Code).ToBe(http.StatusInternalServerError)
+	e.Expect(strings.Contains(response.Body.String(), "password")).ToBeFalse()
+	response = serve("GET", "/typed/jane", "")
+	e.Expect(response.Code).ToBe(http.StatusOK)
+	e.Expect(response.Body.String()).ToBe(`{"name":"jane"}` + "\n")
+	response = serve("GET", "/typed/missing", "")
+	e.Expect(response.Code).ToBe(http.StatusNotFound)
+	e.Expect(response.Body.String()).ToContain("user not found")
+	response = serve("PUT", "/typed/jane", "")
+	e.Expect(response.Code).ToBe(http.StatusAccepted)
+	e.Expect(response.Body.String()).ToBe(`{"name":"jane"}` + "\n")
+}
+
+func TestErrorReturningHandlers(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/users/:id", func(params micro.Params) error {
+		return micro.NewHTTPError(http.StatusNotFound, "user "+params["id"]+" not found")
+	})
+	app.Get("/forbidden", func() error {
+		return micro.NewHTTPError(http.StatusForbidden, "").WithInternal(fmt.Errorf("token expired"))
+	})
+	app.Get("/failing", func() error {
+		return fmt.Errorf("connection refused")
+	})
+	app.Get("/ok", func(ctx *micro.Context) error {
+		ctx.WriteString("ok")
+		return nil
+	})
+	app.Get("/typed/:id", func(ctx *micro.Context, params micro.Params) *micro.HTTPError {
+		if params["id"] != "1" {
+			return micro.NotFound("user not found")
+		}
+		ctx.WriteString("user 1")
+		return nil
+	})
+	app.Error(http.StatusNotFound, func(ctx *micro.Context) {
+		ctx.WriteString("custom not found")
+	})
+	serve := func(path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		return response
+	}
+	response := serve("/users/10")
+	e.Expect(response.Code).ToBe(http.StatusNotFound)
+	e.Expect(response.Body.String()).ToBe("custom not found")
+	response = serve("/forbidden")
+	e.Expect(response.Code).ToBe(http.StatusForbidden)
+	e.Expect(response.Body.String()).ToBe("Forbidden\n")
+	response = serve("/failing")
+	e.Expect(response.Code).ToBe(http.StatusInternalServerError)
+	e.Expect(serve("/ok").Body.String()).ToBe("ok")
+	e.Expect(serve("/typed/1").Body.String()).ToBe("user 1")
+	e.Expect(serve("/typed/2").Code).ToBe(http.StatusNotFound)
+	err := micro.NewHTTPError(http.StatusBadGateway, "upstream").WithInternal(io.EOF)
+	e.Expect(err.Error()).ToBe("502 upstream : EOF")
+	e.Expect(err.Unwrap()).ToBe(io.EOF)
+}
+
+func TestHTTPErrorInjection(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Post("/users", func() error {
+		return micro.UnprocessableEntity("invalid user").WithDetails(map[string]string{"email": "required"})
+	})
+	app.Get("/panic", func() { panic(io.EOF) })
+	for _, code := range []int{http.StatusUnprocessableEntity, http.StatusNotFound} {
+		app.Error(code, func(ctx *micro.Context, err *micro.HTTPError) {
+			ctx.Respond(err.Code, err)
+		})
+	}
+	app.Error(http.StatusInternalServerError, func(ctx *micro.Context, err *micro.HTTPError) {
+		ctx.WriteString(err.Internal)
+	})
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest(method, path, nil))
+		return response
+	}
+	response := serve("POST", "/users")
+	e.Expect(response.Code).ToBe(http.StatusUnprocessableEntity)
+	e.Expect(response.Body.String()).ToBe(`{"code":422,"message":"invalid user","details":{"email":"required"}}` + "\n")
+	response = serve("GET", "/missing")
+	e.Expect(response.Body.String()).ToBe(`{"code":404,"message":"Not Found"}` + "\n")
+	response = serve("GET", "/panic")
+	e.Expect(response.Body.String()).ToBe("EOF")
+	e.Expect(micro.NotFound("").Error()).ToBe("404 Not Found")
+}
+
+func TestErrorClassAndDefault(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/teapot", func() error { return micro.NewHTTPError(http.StatusTeapot, "") })
+	app.Get("/unavailable", func() error { return micro.ServiceUnavailable("") })
+	app.Get("/forbidden", func() error { return micro.Forbidden("") })
+	app.Get("/panic", func() { panic("panic") })
+	app.Error(http.StatusForbidden, func(ctx *micro.Context) {
+		ctx.WriteString("forbidden")
+	})
+	app.ErrorClass(4, func(ctx *micro.Context, err *micro.HTTPError) {
+		ctx.WriteString("client error ", err.Code)
+	})
+	app.ErrorDefault(func(ctx *micro.Context, err *micro.HTTPError) {
+		ctx.WriteString("error ", err.Code)
+	})
+	e.Expect(func() { app.ErrorClass(3, func() {}) }).ToPanic()
+	for path, body := range map[string]string{
+		"/teapot":      "client error 418",
+		"/missing":     "client error 404",
+		"/forbidden":   "forbidden",
+		"/unavailable": "error 503",
+		"/panic":       "error 500",
+	} {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		e.Expect(response.Body.String()).ToBe(body)
+	}
+}
+
+func TestProblemDetails(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.SetProblemDetails(true)
+	app.Get("/users/:id", func() error {
+		return micro.UnprocessableEntity("invalid user").WithDetails(map[string]interface{}{"errors": []string{"name"}})
+	})
+	app.Get("/panic", func() { panic("panic") })
+	app.Error(http.StatusUnauthorized, func(ctx *micro.Context) {
+		ctx.WriteString("unauthorized")
+	})
+	app.Get("/login", func(ctx *micro.Context) { ctx.Error(http.StatusUnauthorized, "") })
+	serve := func(path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		return response
+	}
+	response := serve("/users/1")
+	e.Expect(response.Code).ToBe(http.StatusUnprocessableEntity)
+	e.Expect(response.Header().Get("Content-Type")).ToBe(micro.ProblemMediaType)
+	e.Expect(response.Body.String()).ToBe(`{"detail":"invalid user","errors":["name"],"instance":"/users/1","status":422,"title":"Unprocessable Entity","type":"about:blank"}` + "\n")
+	response = serve("/missing")
+	e.Expect(response.Code).ToBe(http.StatusNotFound)
+	e.Expect(response.Body.String()).ToBe(`{"type":"about:blank","title":"Not Found","status":404,"instance":"/missing"}` + "\n")
+	response = serve("/panic")
+	e.Expect(response.Code).ToBe(http.StatusInternalServerError)
+	e.Expect(response.Header().Get("Content-Type")).ToBe(micro.ProblemMediaType)
+	e.Expect(strings.Contains(response.Body.String(), "detail")).ToBeFalse()
+	response = serve("/login")
+	e.Expect(response.Body.String()).ToBe("unauthorized")
+	e.Expect(micro.New().ProblemDetails()).ToBeFalse()
+}
+
+func TestErrorRenderer(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/users/:id", func() error { return micro.NotFound("<user> not found") })
+	serve := func(accept string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/users/1", nil)
+		request.Header.Set("Accept", accept)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+	response := serve("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	e.Expect(response.Code).ToBe(http.StatusNotFound)
+	e.Expect(response.Header().Get("Content-Type")).ToBe("text/html; charset=utf-8")
+	e.Expect(strings.Contains(response.Body.String(), "<p>&lt;user&gt; not found</p>")).ToBeTrue()
+	response = serve("application/json")
+	e.Expect(response.Header().Get("Content-Type")).ToBe("application/json")
+	e.Expect(response.Body.String()).ToBe(`{"code":404,"message":"\u003cuser\u003e not found"}` + "\n")
+	response = serve("*/*")
+	e.Expect(response.Header().Get("Content-Type")).ToBe("text/plain; charset=utf-8")
+	e.Expect(response.Body.String()).ToBe("<user> not found\n")
+	app = micro.New()
+	app.SetErrorRenderer(micro.ErrorRendererFunc(func(ctx *micro.Context, err *micro.HTTPError) error {
+		_, writeErr := ctx.WriteString("custom ", err.Code)
+		return writeErr
+	}))
+	response = serve("application/json")
+	e.Expect(response.Body.String()).ToBe("custom 404")
+}
+
+func TestDebugErrorPage(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Injector().Register(&MemoryStorage{})
+	app.Get("/users/:id", func() { panic("<boom>") }).SetName("user")
+	serve := func() *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/users/42", nil))
+		return response
+	}
+	response := serve()
+	e.Expect(response.Code).ToBe(http.StatusInternalServerError)
+	e.Expect(strings.Contains(response.Body.String(), "boom")).ToBeFalse()
+	app.SetDebug(true)
+	response = serve()
+	body := response.Body.String()
+	e.Expect(response.Code).ToBe(http.StatusInternalServerError)
+	e.Expect(response.Header().Get("Content-Type")).ToBe("text/html; charset=utf-8")
+	for _, expected := range []string{"&lt;boom&gt;", "TestDebugErrorPage", "/users/42", "user", "42", "*micro_test.MemoryStorage"} {
+		e.Expect(strings.Contains(body, expected)).ToBeTrue()
+	}
+}
+
+func TestLogger(t *testing.T) {
+	e := expect.New(t)
+	buffer := &bytes.Buffer{}
+	app := micro.New()
+	app.SetLogger(slog.New(slog.NewTextHandler(buffer, nil)))
+	app.Get("/error", func() error { return errors.New("database is down") })
+	app.Get("/panic", func() { panic("boom") })
+	app.On("event", func(string, ...interface{}) bool { panic("listener") })
+	for _, path := range []string{"/error", "/panic"} {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	app.Emit("event")
+	logs := buffer.String()
+	e.Expect(strings.Contains(logs, `level=ERROR msg="handler error" error="database is down" reference=`)).ToBeTrue()
+	e.Expect(strings.Contains(logs, `msg="panic recovered" error=boom reference=`)).ToBeTrue()
+	e.Expect(strings.Contains(logs, `msg="listener panicked" event=event error=listener`)).ToBeTrue()
+	e.Expect(micro.New().Logger()).ToBe(micro.DefaultLogger)
+}
+
+func TestNotAcceptableAndUnsupportedMediaType(t *testing.T) {
+	type User struct {
+		Name string `json:"name" xml:"name"`
+	}
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/users", func() (*User, error) { return &User{Name: "john"}, nil })
+	app.Post("/users", func(ctx *micro.Context) (int, *User, error) {
+		user := &User{}
+		if err := ctx.Bind(user); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusCreated, user, nil
+	})
+	app.Put("/users", func(ctx *micro.Context) {
+		ctx.WriteString("updated")
+	}).Consumes("application/json", "text/*")
+	for _, code := range []int{http.StatusNotAcceptable, http.StatusUnsupportedMediaType} {
+		app.Error(code, func(ctx *micro.Context, err *micro.HTTPError) {
+			details := err.Details.(micro.MediaTypeDetails)
+			ctx.WriteString(err.Code, " ", strings.Join(details.Offered, ","), " ", details.Requested)
+		})
+	}
+	serve := func(method, contentType, accept, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/users", strings.NewReader(body))
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		request.Header.Set("Accept", accept)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+	response := serve("GET", "", "text/html", "")
+	e.Expect(response.Code).ToBe(http.StatusNotAcceptable)
+	e.Expect(response.Body.String()).ToBe("406 application/json,text/xml,application/msgpack text/html")
+	response = serve("POST", "application/json; charset=utf-8", "application/json", `{"name":"jane"}`)
+	e.Expect(response.Code).ToBe(http.StatusCreated)
+	e.Expect(response.Body.String()).ToBe(`{"name":"jane"}` + "\n")
+	response = serve("POST", "application/xml", "application/json", `<User><name>jane</name></User>`)
+	e.Expect(response.Code).ToBe(http.StatusCreated)
+	response = serve("POST", "text/csv", "application/json", "name\njane")
+	e.Expect(response.Code).ToBe(http.StatusUnsupportedMediaType)
+	e.Expect(response.Body.String()).ToBe("415 application/json,text/xml,application/msgpack text/csv")
+	response = serve("PUT", "text/plain", "", "jane")
+	e.Expect(response.Body.String()).ToBe("updated")
+	response = serve("PUT", "application/xml", "", "<name>jane</name>")
+	e.Expect(response.Code).ToBe(http.StatusUnsupportedMediaType)
+	e.Expect(response.Body.String()).ToBe("415 application/json,text/* application/xml")
+}
+
+func TestCaughtError(t *testing.T) {
+	e := expect.New(t)
+	buffer := &bytes.Buffer{}
+	app := micro.New()
+	app.SetLogger(slog.New(slog.NewTextHandler(buffer, nil)))
+	app.Get("/panic", func() { panic("boom") })
+	app.Get("/error", func() error { return io.ErrUnexpectedEOF })
+	var caught *micro.CaughtError
+	app.Error(http.StatusInternalServerError, func(ctx *micro.Context, err *micro.CaughtError) {
+		caught = err
+		ctx.WriteString("reference ", err.Reference)
+	})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/panic", nil))
+	e.Expect(caught.Recovered).ToBe("boom")
+	e.Expect(len(caught.Stack) > 0).ToBeTrue()
+	e.Expect(len(caught.Reference)).ToBe(16)
+	e.Expect(response.Body.String()).ToBe("reference " + caught.Reference)
+	e.Expect(strings.Contains(buffer.String(), "reference="+caught.Reference)).ToBeTrue()
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/error", nil))
+	e.Expect(caught.Err).ToBe(io.ErrUnexpectedEOF)
+	e.Expect(caught.Recovered).ToBeNil()
+	e.Expect(caught.HTTPError.Code).ToBe(http.StatusInternalServerError)
+	e.Expect(strings.Contains(buffer.String(), "reference="+caught.Reference)).ToBeTrue()
+}
+
+func TestRun(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	e.Expect(app.Run("invalid address") != nil).ToBeTrue()
+	e.Expect(app.RunTLS("127.0.0.1:0", "missing.crt", "missing.key") != nil).ToBeTrue()
+}
+
+// runApp serves app on a free local port and returns the address it listens on
+func runApp(t *testing.T, app *micro.Micro) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Serve(listener)
+	return listener.Addr().String()
+}
+
+func TestRunUnix(t *testing.T) {
+	e := expect.New(t)
+	path := filepath.Join(t.TempDir(), "micro.sock")
+	e.Expect(os.WriteFile(path, nil, 0600)).ToBeNil()
+	app := micro.New()
+	app.Get("/", func(ctx *micro.Context) { ctx.WriteString("unix") })
+	go app.RunUnix(path, 0660)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	var (
+		response *http.Response
+		err      error
+	)
+	for i := 0; i < 50; i++ {
+		if response, err = client.Get("http://unix/"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	e.Expect(err).ToBeNil()
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	e.Expect(string(body)).ToBe("unix")
+	info, err := os.Stat(path)
+	e.Expect(err).ToBeNil()
+	e.Expect(info.Mode().Perm()).ToBe(os.FileMode(0660))
+}
+
+func TestInheritedListener(t *testing.T) {
+	if os.Getenv(micro.ListenFDEnv) != "" {
+		// the test is run as the child process inheriting the listener
+		app := micro.New()
+		app.Get("/", func(ctx *micro.Context) { ctx.WriteString("child ", os.Getpid()) })
+		app.Run(":0")
+		return
+	}
+	e := expect.New(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	e.Expect(err).ToBeNil()
+	defer listener.Close()
+	file, err := listener.(*net.TCPListener).File()
+	e.Expect(err).ToBeNil()
+	ready, readyWriter, err := os.Pipe()
+	e.Expect(err).ToBeNil()
+	child := exec.Command(os.Args[0], "-test.run=^TestInheritedListener$")
+	child.ExtraFiles = []*os.File{file, readyWriter}
+	child.Env = append(os.Environ(), micro.ListenFDEnv+"=3", micro.ReadyFDEnv+"=4")
+	e.Expect(child.Start()).ToBeNil()
+	defer child.Process.Kill()
+	file.Close()
+	readyWriter.Close()
+	_, err = io.ReadFull(ready, make([]byte, 1))
+	e.Expect(err).ToBeNil()
+	response, err := http.Get("http://" + listener.Addr().String() + "/")
+	e.Expect(err).ToBeNil()
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	e.Expect(string(body)).ToBe(fmt.Sprint("child ", child.Process.Pid))
+	e.Expect(errors.Is(micro.New().Upgrade(), micro.ErrUpgrade)).ToBeTrue()
+}
+
+func TestBootAndShutdownHooks(t *testing.T) {
+	e := expect.New(t)
+	calls := []string{}
+	app := micro.New()
+	app.OnBoot(func(injector *micro.Injector) error {
+		calls = append(calls, "boot 1")
+		injector.Register(&MemoryStorage{name: "booted"})
+		return nil
+	})
+	app.OnBoot(func(*micro.Injector) error {
+		calls = append(calls, "boot 2")
+		return nil
+	})
+	app.OnShutdown(func(context.Context) error {
+		calls = append(calls, "shutdown 1")
+		return nil
+	})
+	app.OnShutdown(func(context.Context) error {
+		calls = append(calls, "shutdown 2")
+		return io.ErrClosedPipe
+	})
+	app.Get("/", func(ctx *micro.Context, storage *MemoryStorage) { ctx.WriteString(storage.name) })
+	addr := runApp(t, app)
+	response, err := http.Get("http://" + addr + "/")
+	e.Expect(err).ToBeNil()
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	e.Expect(string(body)).ToBe("booted")
+	e.Expect(errors.Is(app.Shutdown(context.Background()), io.ErrClosedPipe)).ToBeTrue()
+	e.Expect(strings.Join(calls, ", ")).ToBe("boot 1, boot 2, shutdown 1, shutdown 2")
+	_, err = http.Get("http://" + addr + "/")
+	e.Expect(err).Not().ToBeNil()
+
+	app = micro.New()
+	app.OnBoot(func(*micro.Injector) error { return io.ErrUnexpectedEOF })
+	e.Expect(errors.Is(app.Run("127.0.0.1:0"), io.ErrUnexpectedEOF)).ToBeTrue()
+}
+
+func TestBootOnce(t *testing.T) {
+	e := expect.New(t)
+	boots := int32(0)
+	release := make(chan struct{})
+	app := micro.New()
+	app.OnBoot(func(*micro.Injector) error {
+		atomic.AddInt32(&boots, 1)
+		<-release
+		return nil
+	})
+	app.Get("/", func(ctx *micro.Context) { ctx.WriteString("booted") })
+	bodies := make(chan string, 8)
+	for i := 0; i < cap(bodies); i++ {
+		go func() {
+			response := httptest.NewRecorder()
+			app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+			bodies <- response.Body.String()
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	e.Expect(app.Booted()).ToBeFalse()
+	close(release)
+	for i := 0; i < cap(bodies); i++ {
+		e.Expect(<-bodies).ToBe("booted")
+	}
+	e.Expect(atomic.LoadInt32(&boots)).ToBe(int32(1))
+	e.Expect(app.Booted()).ToBeTrue()
+
+	app = micro.New()
+	app.OnBoot(func(*micro.Injector) error {
+		atomic.AddInt32(&boots, 1)
+		return io.ErrUnexpectedEOF
+	})
+	app.Get("/", func(ctx *micro.Context) { ctx.WriteString("booted") })
+	for i := 0; i < 2; i++ {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+		e.Expect(response.Code).ToBe(http.StatusInternalServerError)
+		e.Expect(response.Body.String()).Not().ToContain("booted")
+	}
+	e.Expect(errors.Is(app.Boot(), io.ErrUnexpectedEOF)).ToBeTrue()
+	e.Expect(app.Booted()).ToBeFalse()
+	e.Expect(atomic.LoadInt32(&boots)).ToBe(int32(2))
+}
+
+type StorageProvider struct {
+	calls *[]string
+}
+
+func (provider StorageProvider) Register(injector *micro.Injector) {
+	*provider.calls = append(*provider.calls, "register")
+	injector.Register(&MemoryStorage{name: "provided"})
+}
+
+func (provider StorageProvider) Boot(app *micro.Micro) {
+	*provider.calls = append(*provider.calls, "boot provider")
+	app.Get("/storage", func(ctx *micro.Context, storage *MemoryStorage) { ctx.WriteString(storage.name) })
+	app.OnBoot(func(*micro.Injector) error {
+		*provider.calls = append(*provider.calls, "boot hook")
+		return nil
+	})
+}
+
+func TestRegisterProvider(t *testing.T) {
+	e := expect.New(t)
+	calls := []string{}
+	app := micro.New()
+	app.RegisterProvider(StorageProvider{calls: &calls})
+	e.Expect(strings.Join(calls, ", ")).ToBe("register")
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/storage", nil))
+	e.Expect(response.Body.String()).ToBe("provided")
+	e.Expect(strings.Join(calls, ", ")).ToBe("register, boot provider, boot hook")
+	defer func() {
+		e.Expect(recover()).Not().ToBeNil()
+	}()
+	app.RegisterProvider(StorageProvider{calls: &calls})
+}
+
+type TestPlugin struct {
+	micro.PluginMetadata
+	booted *[]string
+}
+
+func (plugin TestPlugin) Register(*micro.Injector) {}
+
+func (plugin TestPlugin) Boot(*micro.Micro) { *plugin.booted = append(*plugin.booted, plugin.Name) }
+
+func (plugin TestPlugin) Metadata() micro.PluginMetadata { return plugin.PluginMetadata }
+
+func TestPlugins(t *testing.T) {
+	e := expect.New(t)
+	booted := []string{}
+	plugin := func(name string, dependencies ...string) TestPlugin {
+		return TestPlugin{micro.PluginMetadata{Name: name, Version: "1.0.0", Dependencies: dependencies}, &booted}
+	}
+	app := micro.New()
+	app.RegisterProvider(plugin("admin", "auth", "billing"))
+	app.RegisterProvider(plugin("billing", "auth"))
+	app.RegisterProvider(plugin("auth"))
+	e.Expect(app.Boot()).ToBeNil()
+	e.Expect(strings.Join(booted, ", ")).ToBe("auth, billing, admin")
+	e.Expect(len(app.Plugins())).ToBe(3)
+	e.Expect(app.Plugins()[0].Name).ToBe("auth")
+
+	app = micro.New()
+	app.RegisterProvider(plugin("admin", "auth"))
+	e.Expect(errors.Is(app.Boot(), micro.ErrMissingDependency)).ToBeTrue()
+
+	app = micro.New()
+	app.RegisterProvider(plugin("auth", "admin"))
+	app.RegisterProvider(plugin("admin", "auth"))
+	err := app.Boot()
+	e.Expect(errors.Is(err, micro.ErrDependencyCycle)).ToBeTrue()
+	e.Expect(strings.Contains(err.Error(), "auth -> admin -> auth")).ToBeTrue()
+
+	app = micro.New()
+	app.RegisterProvider(plugin("auth"))
+	app.RegisterProvider(plugin("auth"))
+	e.Expect(errors.Is(app.Boot(), micro.ErrPluginConflict)).ToBeTrue()
+
+	conflicting := plugin("oauth")
+	conflicting.Conflicts = []string{"auth"}
+	app = micro.New()
+	app.RegisterProvider(plugin("auth"))
+	app.RegisterProvider(conflicting)
+	e.Expect(errors.Is(app.Boot(), micro.ErrPluginConflict)).ToBeTrue()
+}
+
+// writeClientFrame writes a masked websocket frame
+func writeClientFrame(conn net.Conn, opcode byte, payload []byte) error {
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := conn.Write(frame)
+	return err
+}
+
+// readServerFrame reads an unmasked websocket frame
+func readServerFrame(reader *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, header[1]&0x7f)
+	_, err := io.ReadFull(reader, payload)
+	return header[0] & 0x0f, payload, err
+}
+
+func TestWebSocket(t *testing.T) {
+	e := expect.New(t)
+	closed := make(chan error, 1)
+	app := micro.New()
+	app.WebSocket("/echo", func(conn *micro.WSConn, ctx *micro.Context) {
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				closed <- err
+				return
+			}
+			conn.WriteMessage(messageType, append([]byte("echo "), message...))
+		}
+	})
+	addr := runApp(t, app)
+
+	response, err := http.Get("http://" + addr + "/echo")
+	e.Expect(err).ToBeNil()
+	response.Body.Close()
+	e.Expect(response.StatusCode).ToBe(http.StatusBadRequest)
+
+	conn, err := net.Dial("tcp", addr)
+	e.Expect(err).ToBeNil()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET /echo HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", addr)
+	reader := bufio.NewReader(conn)
+	handshake, err := http.ReadResponse(reader, nil)
+	e.Expect(err).ToBeNil()
+	e.Expect(handshake.StatusCode).ToBe(http.StatusSwitchingProtocols)
+	e.Expect(handshake.Header.Get("Sec-WebSocket-Accept")).ToBe("s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+
+	e.Expect(writeClientFrame(conn, 1, []byte("hello"))).ToBeNil()
+	opcode, payload, err := readServerFrame(reader)
+	e.Expect(err).ToBeNil()
+	e.Expect(opcode).ToBe(byte(1))
+	e.Expect(string(payload)).ToBe("echo hello")
+
+	e.Expect(writeClientFrame(conn, 9, []byte("ping"))).ToBeNil()
+	opcode, payload, _ = readServerFrame(reader)
+	e.Expect(opcode).ToBe(byte(10))
+	e.Expect(string(payload)).ToBe("ping")
+
+	e.Expect(writeClientFrame(conn, 8, []byte{0x03, 0xe8})).ToBeNil()
+	opcode, _, _ = readServerFrame(reader)
+	e.Expect(opcode).ToBe(byte(8))
+	var closeError *micro.CloseError
+	e.Expect(errors.As(<-closed, &closeError)).ToBeTrue()
+	e.Expect(closeError.Code).ToBe(micro.CloseNormalClosure)
+
+	// a frame announcing a length the client does not send is truncated
+	conn, err = net.Dial("tcp", addr)
+	e.Expect(err).ToBeNil()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET /echo HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", addr)
+	handshake, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	e.Expect(err).ToBeNil()
+	e.Expect(handshake.StatusCode).ToBe(http.StatusSwitchingProtocols)
+	conn.Write([]byte{0x82, 0x80 | 127, 0, 0, 0, 0, 0x01, 0, 0, 0, 1, 2, 3, 4, 'a', 'b', 'c'})
+	conn.(*net.TCPConn).CloseWrite()
+	e.Expect(<-closed).ToBe(io.ErrUnexpectedEOF)
+}
+
+func TestHub(t *testing.T) {
+	e := expect.New(t)
+	hub := micro.NewHub(2, micro.DropMessage)
+	alice, bob := hub.Connect(), hub.Connect()
+	alice.Join("general")
+	bob.Join("general")
+	bob.Join("random")
+	e.Expect(hub.Clients("general")).ToBe(2)
+	e.Expect(hub.Broadcast("general", []byte("hello"))).ToBe(2)
+	e.Expect(hub.Broadcast("random", []byte("psst"))).ToBe(1)
+	e.Expect(string((<-alice.Messages()).Data)).ToBe("hello")
+	e.Expect(string((<-bob.Messages()).Data)).ToBe("hello")
+	message := <-bob.Messages()
+	e.Expect(message.Topic).ToBe("random")
+	e.Expect(string(message.Data)).ToBe("psst")
+	alice.Leave("general")
+	e.Expect(hub.Broadcast("general", []byte("bye"))).ToBe(1)
+	bob.Close()
+	e.Expect(hub.Broadcast("general", []byte("anyone?"))).ToBe(0)
+	e.Expect(len(hub.Topics())).ToBe(0)
+
+	for policy, expected := range map[micro.BackpressurePolicy]string{micro.DropMessage: "1 2", micro.DropOldest: "2 3"} {
+		hub = micro.NewHub(2, policy)
+		client := hub.Connect()
+		client.Join("numbers")
+		for _, number := range []string{"1", "2", "3"} {
+			hub.Broadcast("numbers", []byte(number))
+		}
+		e.Expect(string((<-client.Messages()).Data) + " " + string((<-client.Messages()).Data)).ToBe(expected)
+	}
+	hub = micro.NewHub(1, micro.DisconnectClient)
+	client := hub.Connect()
+	client.Join("numbers")
+	hub.Broadcast("numbers", []byte("1"))
+	e.Expect(hub.Broadcast("numbers", []byte("2"))).ToBe(0)
+	<-client.Done()
+	e.Expect(hub.Clients("numbers")).ToBe(0)
+
+	hub = micro.NewHub(0, micro.DropOldest)
+	app := micro.New()
+	app.Injector().Register(hub)
+	app.Get("/events", func(ctx *micro.Context, hub *micro.Hub) {
+		stream, _ := ctx.SSE()
+		defer stream.Close()
+		client := hub.Connect()
+		defer client.Close()
+		client.Join("news")
+		client.Join("sync")
+		client.ServeSSE(stream)
+	})
+	addr := runApp(t, app)
+	response, err := http.Get("http://" + addr + "/events")
+	e.Expect(err).ToBeNil()
+	defer response.Body.Close()
+	for hub.Clients("sync") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	hub.Broadcast("news", []byte("extra"))
+	reader := bufio.NewReader(response.Body)
+	line, _ := reader.ReadString('\n')
+	e.Expect(line).ToBe("event: news\n")
+	line, _ = reader.ReadString('\n')
+	e.Expect(line).ToBe("data: extra\n")
+}
+
+func TestHubBackplane(t *testing.T) {
+	e := expect.New(t)
+	backplane := micro.NewMemoryBackplane()
+	first, second := micro.NewHub(0, micro.DropMessage), micro.NewHub(0, micro.DropMessage)
+	e.Expect(first.SetBackplane(backplane)).ToBeNil()
+	e.Expect(second.SetBackplane(backplane)).ToBeNil()
+	local, remote := first.Connect(), second.Connect()
+	local.Join("news")
+	remote.Join("news")
+	e.Expect(first.Broadcast("news", []byte("extra"))).ToBe(1)
+	e.Expect(string((<-local.Messages()).Data)).ToBe("extra")
+	e.Expect(string((<-remote.Messages()).Data)).ToBe("extra")
+	e.Expect(len(local.Messages())).ToBe(0)
+	e.Expect(second.SetBackplane(nil)).ToBeNil()
+	first.Broadcast("news", []byte("again"))
+	e.Expect(len(remote.Messages())).ToBe(0)
+}
+
+type writerOnly struct {
+	http.ResponseWriter
+}
+
+func TestResponseWriterWithCodeInterfaces(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/file", func(ctx *micro.Context, rw *micro.ResponseWriterWithCode) {
+		e.Expect(rw.Supports((*io.ReaderFrom)(nil))).ToBeTrue()
+		e.Expect(rw.Supports((*http.Hijacker)(nil))).ToBeTrue()
+		e.Expect(rw.Supports((*http.Pusher)(nil))).ToBeFalse()
+		e.Expect(errors.Is(rw.Push("/style.css", nil), http.ErrNotSupported)).ToBeTrue()
+		n, err := io.Copy(ctx.Response, strings.NewReader("content"))
+		e.Expect(err).ToBeNil()
+		e.Expect(n).ToBe(int64(7))
+		e.Expect(rw.Length()).ToBe(7)
+		e.Expect(rw.Code()).ToBe(http.StatusOK)
+	})
+	app.Get("/stream", func(ctx *micro.Context) {
+		_, err := ctx.SSE()
+		e.Expect(err).Not().ToBeNil()
+		ctx.WriteString("not flushable")
+	})
+	addr := runApp(t, app)
+	response, err := http.Get("http://" + addr + "/file")
+	e.Expect(err).ToBeNil()
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	e.Expect(string(body)).ToBe("content")
+
+	response2 := httptest.NewRecorder()
+	app.ServeHTTP(writerOnly{response2}, httptest.NewRequest("GET", "/stream", nil))
+	e.Expect(response2.Body.String()).ToBe("not flushable")
+}
+
+func TestBufferedResponse(t *testing.T) {
+	e := expect.New(t)
+	written := 0
+	app := micro.New()
+	app.On(micro.ResponseWritten.Name, func(string, ...interface{}) bool { written++; return true })
+	app.Use("/", func(ctx *micro.Context, rw *micro.ResponseWriterWithCode, next micro.Next) {
+		e.Expect(rw.Buffer()).ToBeTrue()
+		next()
+		switch {
+		case rw.Code() >= 500:
+			rw.ResetBuffer()
+			rw.Header().Set("Content-Type", "text/plain")
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			rw.Write([]byte("try again later"))
+		case rw.Code() == http.StatusOK:
+			etag := fmt.Sprintf(`"%x"`, len(rw.BufferedBody()))
+			rw.Header().Set("ETag", etag)
+			if ctx.Request.Header.Get("If-None-Match") == etag {
+				rw.ResetBuffer()
+				rw.WriteHeader(http.StatusNotModified)
+				return
+			}
+			rw.SetBufferedBody(bytes.ToUpper(rw.BufferedBody()))
+		}
+	})
+	app.Get("/page", func(ctx *micro.Context) { ctx.WriteString("hello") })
+	app.Get("/broken", func(ctx *micro.Context) {
+		ctx.WriteString("half a page")
+		ctx.Response.WriteHeader(http.StatusOK)
+		panic("broken")
+	})
+	app.Get("/failing", func(ctx *micro.Context) {
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.WriteString("stack trace")
+	})
+
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/page", nil))
+	e.Expect(response.Body.String()).ToBe("HELLO")
+	e.Expect(response.Header().Get("ETag")).ToBe(`"5"`)
+	e.Expect(written).ToBe(1)
+
+	request := httptest.NewRequest("GET", "/page", nil)
+	request.Header.Set("If-None-Match", `"5"`)
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	e.Expect(response.Code).ToBe(http.StatusNotModified)
+	e.Expect(response.Body.Len()).ToBe(0)
+
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/failing", nil))
+	e.Expect(response.Code).ToBe(http.StatusServiceUnavailable)
+	e.Expect(response.Body.String()).ToBe("try again later")
+
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/broken", nil))
+	e.Expect(response.Code).ToBe(http.StatusInternalServerError)
+	e.Expect(response.Body.String()).Not().ToContain("half a page")
+
+	app = micro.New()
+	app.SetBufferResponses(true)
+	app.Get("/", func(rw *micro.ResponseWriterWithCode) {
+		e.Expect(rw.Buffered()).ToBeTrue()
+		rw.Write([]byte("buffered"))
+	})
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	e.Expect(response.Body.String()).ToBe("buffered")
+}
+
+func TestAccessLog(t *testing.T) {
+	e := expect.New(t)
+	output := &bytes.Buffer{}
+	newApp := func(config micro.AccessLogConfig) *micro.Micro {
+		config.Output = output
+		app := micro.New()
+		app.Use("/", micro.AccessLog(config))
+		app.Use("/", func(injector *micro.Injector, next micro.Next) {
+			injector.Register(&MemoryStorage{name: "john"})
+			next()
+		})
+		app.Get("/users/:id", func(ctx *micro.Context) { ctx.WriteString("user") }).SetName("user")
+		app.Get("/health", func(ctx *micro.Context) {}).SetName("health")
+		app.Get("/panic", func() { panic("boom") })
+		return app
+	}
+	serve := func(app *micro.Micro, path string) string {
+		output.Reset()
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set("User-Agent", "test")
+		request.Header.Set("X-Request-ID", "42")
+		app.ServeHTTP(httptest.NewRecorder(), request)
+		return output.String()
+	}
+
+	app := newApp(micro.AccessLogConfig{})
+	line := serve(app, "/users/1")
+	e.Expect(line).ToContain(`192.0.2.1 - - [`)
+	e.Expect(line).ToContain(`] "GET /users/1 HTTP/1.1" 200 4 "-" "test"` + "\n")
+	e.Expect(serve(app, "/panic")).ToContain(`"GET /panic HTTP/1.1" 500 `)
+	output.Reset()
+	request := httptest.NewRequest("GET", "/users/%22", nil)
+	request.RequestURI = "/users/\" HTTP/1.1\" 200 4 \"-\" \"forged\"\n"
+	request.Header.Set("Referer", "http://example.com/\"\x01")
+	request.Header.Set("User-Agent", "agent\\\t\xe9")
+	app.ServeHTTP(httptest.NewRecorder(), request)
+	e.Expect(output.String()).ToContain(`"GET /users/\" HTTP/1.1\" 200 4 \"-\" \"forged\"\n HTTP/1.1" 404 `)
+	e.Expect(output.String()).ToContain(` "http://example.com/\"\x01" "agent\\\t\xe9"` + "\n")
+	e.Expect(strings.Count(output.String(), "\n")).ToBe(1)
+
+	app = newApp(micro.AccessLogConfig{
+		Format: micro.AccessLogJSON,
+		Fields: []string{"method", "status", "route", "request_id", "user_id"},
+		UserID: func(injector *micro.Injector) string { return micro.MustResolve[*MemoryStorage](injector).name },
+	})
+	e.Expect(serve(app, "/users/1")).ToBe(`{"method":"GET","request_id":"42","route":"user","status":200,"user_id":"john"}` + "\n")
+
+	app = newApp(micro.AccessLogConfig{Format: "{{.Method}} {{.URI}} {{.Status}}", SampleRates: map[string]float64{"health": 0}})
+	e.Expect(serve(app, "/missing")).ToBe("GET /missing 404\n")
+	e.Expect(serve(app, "/health")).ToBe("")
+	e.Expect(func() { micro.AccessLog(micro.AccessLogConfig{Format: "{{"}) }).ToPanic()
+}
+
+func TestServerOptions(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.SetServerOptions(micro.MaxHeaderBytes(1024))
+	app.Get("/", func(ctx *micro.Context) {})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	e.Expect(err).ToBeNil()
+	go app.Serve(listener, micro.ReadHeaderTimeout(100*time.Millisecond), micro.KeepAlives(false))
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	e.Expect(err).ToBeNil()
+	defer conn.Close()
+	// the header timeout closes connections of clients not sending their headers
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	e.Expect(err).ToBe(io.EOF)
+	request := httptest.NewRequest("GET", "http://"+listener.Addr().String()+"/", nil)
+	request.RequestURI = ""
+	request.Header.Set("X-Large", strings.Repeat("a", 8192))
+	response, err := http.DefaultClient.Do(request)
+	e.Expect(err).ToBeNil()
+	response.Body.Close()
+	e.Expect(response.StatusCode).ToBe(http.StatusRequestHeaderFieldsTooLarge)
+	response, err = http.Get("http://" + listener.Addr().String() + "/")
+	e.Expect(err).ToBeNil()
+	response.Body.Close()
+	e.Expect(response.Close).ToBeTrue()
+}
+
+func TestShutdownOn(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	app.SetShutdownTimeout(time.Second)
+	e.Expect(app.ShutdownTimeout()).ToBe(time.Second)
+	hooked := make(chan bool, 1)
+	app.OnShutdown(func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		hooked <- true
+		return nil
+	})
+	app.ShutdownOn(os.Interrupt)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	e.Expect(err).ToBeNil()
+	served := make(chan error, 1)
+	go func() { served <- app.Serve(listener) }()
+	process, err := os.FindProcess(os.Getpid())
+	e.Expect(err).ToBeNil()
+	// the server is running once it answers
+	response, err := http.Get("http://" + listener.Addr().String() + "/")
+	e.Expect(err).ToBeNil()
+	response.Body.Close()
+	e.Expect(process.Signal(os.Interrupt)).ToBeNil()
+	select {
+	case err := <-served:
+		e.Expect(err).ToBe(http.ErrServerClosed)
+		// Serve returns once the shutdown hooks are executed
+		e.Expect(len(hooked)).ToBe(1)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the application was not shut down")
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	app.Injector().Register(&MemoryStorage{name: "queue"})
+	started, stopped := make(chan string, 2), make(chan bool, 1)
+	failures := make(chan *micro.WorkerError, 2)
+	micro.Subscribe(app.EventEmitter, micro.WorkerFailed, func(err *micro.WorkerError) bool {
+		failures <- err
+		return true
+	})
+	app.Go("consumer", func(ctx context.Context, storage *MemoryStorage) {
+		started <- storage.name
+		<-ctx.Done()
+		stopped <- true
+	})
+	app.Go("failing", func() error { return io.ErrUnexpectedEOF })
+	e.Expect(func() { app.Go("invalid", "worker") }).ToPanic()
+	e.Expect(app.Boot()).ToBeNil()
+	e.Expect(<-started).ToBe("queue")
+	failure := <-failures
+	e.Expect(failure.Worker).ToBe("failing")
+	e.Expect(failure.Err).ToBe(io.ErrUnexpectedEOF)
+	app.Go("panicking", func() { panic("boom") })
+	failure = <-failures
+	e.Expect(failure.Worker).ToBe("panicking")
+	e.Expect(len(failure.Stack) > 0).ToBeTrue()
+	e.Expect(app.Shutdown(context.Background())).ToBeNil()
+	e.Expect(len(stopped)).ToBe(1)
+}
+
+func TestSchedule(t *testing.T) {
+	e := expect.New(t)
+	start := time.Date(2024, time.January, 31, 10, 7, 30, 0, time.UTC)
+	for spec, expected := range map[string]string{
+		"*/5 * * * *":    "2024-01-31 10:10",
+		"0 9-17 * * 1-5": "2024-01-31 11:00",
+		"30 2 * * 0":     "2024-02-04 02:30",
+		"0 0 1,15 * *":   "2024-02-01 00:00",
+		"0 0 13 * 5":     "2024-02-02 00:00",
+		"@monthly":       "2024-02-01 00:00",
+		"0 12 29 2 *":    "2024-02-29 12:00",
+		"15 10 * * 7":    "2024-02-04 10:15",
+	} {
+		schedule, err := micro.ParseSchedule(spec)
+		e.Expect(err).ToBeNil()
+		e.Expect(schedule.Next(start).Format("2006-01-02 15:04")).ToBe(expected)
+	}
+	for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := micro.ParseSchedule(spec)
+		e.Expect(err).Not().ToBeNil()
+	}
+	schedule, _ := micro.ParseSchedule("0 0 30 2 *")
+	e.Expect(schedule.Next(start).IsZero()).ToBeTrue()
+	app := micro.New()
+	e.Expect(func() { app.Schedule("invalid", func() {}) }).ToPanic()
+	e.Expect(func() { app.Schedule("* * * * *", nil) }).ToPanic()
+}
+
+func TestH2C(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.SetServerOptions(micro.H2C())
+	app.Get("/", func(ctx *micro.Context) { ctx.WriteString(ctx.Request.Proto) })
+	addr := runApp(t, app)
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	response, err := client.Get("http://" + addr + "/")
+	e.Expect(err).ToBeNil()
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	e.Expect(string(body)).ToBe("HTTP/2.0")
+}
+
+func TestAltSvc(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.SetServerOptions(micro.AltSvc(`h3=":443"; ma=86400`))
+	e.Expect(len(app.ServerOptions())).ToBe(1)
+	app.Get("/", func(ctx *micro.Context) {})
+	response, err := http.Get("http://" + runApp(t, app) + "/")
+	e.Expect(err).ToBeNil()
+	response.Body.Close()
+	e.Expect(response.Header.Get("Alt-Svc")).ToBe(`h3=":443"; ma=86400`)
+}
+
+func TestReload(t *testing.T) {
+	e := expect.New(t)
+	fsys := fstest.MapFS{"home.html": {Data: []byte("version 1")}}
+	app := micro.New()
+	app.SetRenderer(micro.NewTemplateRenderer(fsys, micro.TemplateOptions{Cache: true}))
+	routes := func(version string) func(*micro.ControllerCollection) {
+		return func(routes *micro.ControllerCollection) {
+			routes.Get("/"+version, func(ctx *micro.Context) { ctx.Render(http.StatusOK, "home", nil) }).SetName("home")
+		}
+	}
+	routes("v1")(app.ControllerCollection)
+	serve := func(path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		return response
+	}
+	e.Expect(serve("/v1").Body.String()).ToBe("version 1")
+	e.Expect(app.Reload(routes("v2"))).ToBe(micro.ErrNotDevMode)
+	app.SetDevMode(true)
+	fsys["home.html"] = &fstest.MapFile{Data: []byte("version 2")}
+	e.Expect(app.Reload(routes("v2"))).ToBeNil()
+	e.Expect(serve("/v1").Code).ToBe(http.StatusNotFound)
+	e.Expect(serve("/v2").Body.String()).ToBe("version 2")
+	url, err := app.URL("home", nil)
+	e.Expect(err).ToBeNil()
+	e.Expect(url).ToBe("/v2")
+	e.Expect(len(app.RouteTable())).ToBe(1)
+	e.Expect(app.RouteTable()[0].Path).ToBe("/v2")
+	err = app.Reload(func(routes *micro.ControllerCollection) {
+		routes.Get("/v3", func() {}).Assert("id", "(")
+	})
+	e.Expect(err).Not().ToBeNil()
+	e.Expect(serve("/v2").Code).ToBe(http.StatusOK)
+}
+
+func TestMountApp(t *testing.T) {
+	e := expect.New(t)
+	admin := micro.New()
+	admin.Injector().Register(&MemoryStorage{name: "admin"})
+	admin.Get("/", func(ctx *micro.Context) { ctx.WriteString("dashboard") })
+	admin.Get("/users/:id", func(ctx *micro.Context, storage *MemoryStorage) {
+		ctx.WriteString(storage.name, " user ", ctx.RequestVars["id"])
+	})
+	admin.Error(http.StatusNotFound, func(ctx *micro.Context) { ctx.WriteString("admin not found") })
+	app := micro.New()
+	app.Get("/", func(ctx *micro.Context) { ctx.WriteString("home") })
+	app.MountApp("/admin/", admin)
+	for path, body := range map[string]string{
+		"/":              "home",
+		"/admin":         "dashboard",
+		"/admin/":        "dashboard",
+		"/admin/users/1": "admin user 1",
+		"/admin/missing": "admin not found",
+	} {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		e.Expect(response.Body.String()).ToBe(body)
+	}
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/administrator", nil))
+	e.Expect(response.Code).ToBe(http.StatusNotFound)
+}
+
+func TestInjectorRegisterAs(t *testing.T) {
+	e := expect.New(t)
+	injector := micro.NewInjector(&MemoryStorage{name: "memory"}, &MemoryStorage{name: "other"})
+	injector.RegisterAs(&MemoryStorage{name: "main"}, (*Storage)(nil))
+	injector.MustApply(func(storage Storage) {
+		e.Expect(storage.Name()).ToBe("main")
+	})
+	e.Expect(func() { injector.RegisterAs(&Foo{}, (*Storage)(nil)) }).ToPanic()
+	e.Expect(func() { injector.RegisterAs(&MemoryStorage{}, &MemoryStorage{}) }).ToPanic()
+	child := micro.NewInjector()
+	child.SetParent(injector)
+	child.MustApply(func(storage Storage) {
+		e.Expect(storage.Name()).ToBe("main")
+	})
+}
+
+func TestInjectorNamed(t *testing.T) {
+	e := expect.New(t)
+	type Storages struct {
+		micro.In
+		Read    Storage        `inject:"read"`
+		Write   *MemoryStorage `inject:"write"`
+		Default Storage
+	}
+	injector := micro.NewInjector()
+	injector.RegisterNamed("read", &MemoryStorage{name: "read"})
+	injector.RegisterAs(&MemoryStorage{name: "default"}, (*Storage)(nil))
+	child := micro.NewInjector()
+	child.SetParent(injector)
+	child.RegisterNamed("write", &MemoryStorage{name: "write"})
+	child.MustApply(func(storages Storages, pointer *Storages) {
+		e.Expect(storages.Read.Name()).ToBe("read")
+		e.Expect(storages.Write.Name()).ToBe("write")
+		e.Expect(storages.Default.Name()).ToBe("default")
+		e.Expect(pointer.Write.Name()).ToBe("write")
+	})
+	service, err := child.ResolveNamed("read", reflect.TypeOf(&Foo{}))
+	e.Expect(service).ToBeNil()
+	e.Expect(err).Not().ToBeNil()
+	_, err = injector.ResolveNamed("write", nil)
+	e.Expect(err).Not().ToBeNil()
+}
+
+func TestInjectorProvide(t *testing.T) {
+	e := expect.New(t)
+	built := 0
+	injector := micro.NewInjector(&Foo{})
+	injector.Provide(func(foo *Foo) *MemoryStorage {
+		built++
+		return &MemoryStorage{name: "memory"}
+	})
+	e.Expect(built).ToBe(0)
+	injector.MustApply(func(storage Storage, memoryStorage *MemoryStorage) {
+		e.Expect(storage).ToBe(memoryStorage)
+	})
+	injector.MustApply(func(storage *MemoryStorage) {})
+	e.Expect(built).ToBe(1)
+	injector.Provide(func() (*Person, error) {
+		return nil, fmt.Errorf("no database")
+	})
+	_, err := injector.Apply(func(person *Person) {})
+	e.Expect(err.Error()).ToContain("no database")
+	e.Expect(func() { injector.Provide(func() (*Person, int) { return nil, 0 }) }).ToPanic()
+}
+
+func TestInjectorProvideScoped(t *testing.T) {
+	type Visitor struct {
+		Name  string
+		Pages int
+	}
+	e := expect.New(t)
+	app := micro.New()
+	app.Injector().ProvideScoped(func(request *http.Request) *Visitor {
+		return &Visitor{Name: request.URL.Query().Get("name")}
+	})
+	app.Use("/", func(ctx *micro.Context, visitor *Visitor) {
+		visitor.Pages++
+		ctx.Next()
+	})
+	app.Get("/", func(ctx *micro.Context, visitor *Visitor) {
+		ctx.WriteString(visitor.Name, visitor.Pages)
+	})
+	for _, name := range []string{"john", "jane"} {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/?name="+name, nil))
+		e.Expect(response.Body.String()).ToBe(name + "1")
+	}
+
+	// scoped services can be resolved concurrently, by the goroutines of a handler
+	injector := micro.NewInjector()
+	injector.ProvideScoped(func() *Visitor { return &Visitor{} })
+	visitors := make(chan interface{}, 10)
+	for i := 0; i < cap(visitors); i++ {
+		go func() {
+			visitor, _ := injector.Resolve(reflect.TypeOf(&Visitor{}))
+			injector.Register(&MemoryStorage{})
+			visitors <- visitor
+		}()
+	}
+	first := <-visitors
+	for i := 1; i < cap(visitors); i++ {
+		e.Expect(<-visitors).ToBe(first)
+	}
+}
+
+func TestInjectorCleanup(t *testing.T) {
+	type Transaction struct {
+		Committed bool
+	}
+	e := expect.New(t)
+	calls := []string{}
+	app := micro.New()
+	app.Injector().ProvideScoped(func() (*Transaction, func(), error) {
+		transaction := &Transaction{}
+		return transaction, func() {
+			calls = append(calls, fmt.Sprint("transaction ", transaction.Committed))
+		}, nil
+	})
+	app.Injector().ProvideScoped(func(transaction *Transaction) (*MemoryStorage, func()) {
+		return &MemoryStorage{name: "storage"}, func() { calls = append(calls, "storage") }
+	})
+	app.Get("/", func(ctx *micro.Context, storage *MemoryStorage, transaction *Transaction) {
+		e.Expect(len(calls)).ToBe(0)
+		transaction.Committed = true
+	})
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	e.Expect(calls).ToEqual([]string{"storage", "transaction true"})
+	e.Expect(func() { app.Injector().Provide(func() (*Foo, error, func()) { return nil, nil, nil }) }).ToPanic()
+}
+
+func TestInjectorLifetimes(t *testing.T) {
+	type Clock struct{ ID int }
+	type Session struct{ ID int }
+	type Cache struct{ Session *Session }
+	e := expect.New(t)
+	ids := 0
+	app := micro.New()
+	app.Injector().ProvideTransient(func() *Clock { ids++; return &Clock{ID: ids} })
+	app.Injector().ProvideWithLifetime(func(clock *Clock) *Session { return &Session{ID: clock.ID} }, micro.Scoped)
+	app.Injector().Provide(func(session *Session) *Cache { return &Cache{Session: session} })
+	app.Get("/", func(first *Clock, second *Clock, session *Session, sameSession *Session) {
+		e.Expect(first.ID).Not().ToBe(second.ID)
+		e.Expect(session).ToBe(sameSession)
+	})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	e.Expect(response.Code).ToBe(http.StatusOK)
+	_, err := app.Injector().Apply(func(cache *Cache) {})
+	e.Expect(err.Error()).ToContain("cannot be injected in a singleton")
+	e.Expect(micro.Transient.String()).ToBe("transient")
+}
+
+func TestContextCopy(t *testing.T) {
+	e := expect.New(t)
+	copies := make(chan *micro.Context, 2)
+	app := micro.New()
+	app.Get("/users/:id", func(ctx *micro.Context) {
+		ctx.Vars["role"] = "admin"
+		copies <- ctx.Copy()
+	})
+	request, _ := http.NewRequest("GET", "/users/10", strings.NewReader("body"))
+	request.Header.Set("Authorization", "Bearer token")
+	requestContext, cancel := context.WithCancel(context.Background())
+	app.ServeHTTP(httptest.NewRecorder(), request.WithContext(requestContext))
+	cancel()
+	// the pooled context is reused by the next request
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/20", nil))
+	copy := <-copies
+	e.Expect(copy.RequestVars["id"]).ToBe("10")
+	e.Expect(copy.Vars["role"]).ToBe("admin")
+	e.Expect(copy.Request.Header.Get("Authorization")).ToBe("Bearer token")
+	e.Expect(copy.Err()).ToBeNil()
+	body, _ := io.ReadAll(copy.Request.Body)
+	e.Expect(len(body)).ToBe(0)
+	_, err := copy.WriteString("hello")
+	e.Expect(err).ToBe(micro.ErrDetachedContext)
+}
+
+func TestContextIsResetBetweenRequests(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/:name", func(ctx *micro.Context, injector *micro.Injector) {
+		_, found := ctx.Vars["previous"]
+		e.Expect(found).ToBeFalse()
+		e.Expect(len(ctx.RequestVars)).ToBe(1)
+		_, err := injector.Resolve(reflect.TypeOf(&Foo{}))
+		e.Expect(err).Not().ToBeNil()
+		ctx.Vars["previous"] = ctx.RequestVars["name"]
+		injector.Register(&Foo{})
+		ctx.WriteString(ctx.RequestVars["name"])
+	})
+	for _, name := range []string{"first", "second", "third"} {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, micro.MustWithResult(http.NewRequest("GET", "http://example.com/"+name, nil)).(*http.Request))
+		e.Expect(response.Body.String()).ToBe(name)
+	}
+}
+
+func TestContextFlash(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Post("/users", func(ctx *micro.Context) {
+		e.Expect(ctx.Flash("success", "user created")).ToBeNil()
+		e.Expect(ctx.Flash("success", "welcome")).ToBeNil()
+		ctx.Redirect("/users", http.StatusSeeOther)
+	})
+	app.Get("/users", func(ctx *micro.Context) {
+		ctx.WriteString(strings.Join(ctx.Flashes()["success"], ","))
+	})
+	e.Expect(micro.NewContext(httptest.NewRecorder(), nil).Flash("success", "welcome")).ToBe(micro.ErrNoSecret)
+	app.SetSecret([]byte("secret"))
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, micro.MustWithResult(http.NewRequest("POST", "http://example.com/users", nil)).(*http.Request))
+	e.Expect(response.Code).ToBe(http.StatusSeeOther)
+	cookies := response.Result().Cookies()
+	e.Expect(len(cookies)).ToBe(1)
+	request := micro.MustWithResult(http.NewRequest("GET", "http://example.com/users", nil)).(*http.Request)
+	request.AddCookie(cookies[0])
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	e.Expect(response.Body.String()).ToBe("user created,welcome")
+	e.Expect(response.Result().Cookies()[0].MaxAge).ToBe(-1)
+	request = micro.MustWithResult(http.NewRequest("GET", "http://example.com/users", nil)).(*http.Request)
+	request.AddCookie(&http.Cookie{Name: micro.FlashCookieName, Value: strings.Replace(cookies[0].Value, "w", "x", 1)})
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	e.Expect(response.Body.String()).ToBe("")
+}
+
+func TestContextNegotiateLanguage(t *testing.T) {
+	e := expect.New(t)
+	req, _ := http.NewRequest("GET", "example.com", nil)
+	context := micro.NewContext(nil, req)
+	e.Expect(context.NegotiateLanguage("en", "fr")).ToBe("en")
+	req.Header.Set("Accept-Language", "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5, it;q=0")
+	e.Expect(context.AcceptedLanguages()).ToEqual([]string{"fr-CH", "fr", "en", "de"})
+	e.Expect(context.NegotiateLanguage("en", "fr")).ToBe("fr")
+	e.Expect(context.NegotiateLanguage("de", "fr-ch")).ToBe("fr-ch")
+	e.Expect(context.NegotiateLanguage("it", "de")).ToBe("de")
+	e.Expect(context.NegotiateLanguage("es", "it")).ToBe("es")
+	req.Header.Set("Accept-Language", "en")
+	e.Expect(context.NegotiateLanguage("fr", "en-GB")).ToBe("en-GB")
+}
+
+func TestJSONConfig(t *testing.T) {
+	e := expect.New(t)
+	encoders := 0
+	app := micro.New()
+	app.Get("/", func(ctx *micro.Context) {
+		ctx.WriteJSON(map[string]string{"html": "<b>"})
+	})
+	app.Get("/jsonp", func(ctx *micro.Context) {
+		ctx.WriteJSONP([]int{1, 2}, "callback")
+	})
+	get := func(path string) string {
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", path, nil)
+		app.ServeHTTP(response, request)
+		return response.Body.String()
+	}
+	e.Expect(get("/")).ToBe("{\"html\":\"\\u003cb\\u003e\"}\n")
+	e.Expect(get("/jsonp")).ToBe("/**/callback([1,2]);")
+	app.SetDebug(true)
+	config := micro.DefaultJSONConfig
+	config.EscapeHTML = false
+	config.NewEncoder = func(w io.Writer) micro.JSONEncoder {
+		encoders++
+		return json.NewEncoder(w)
+	}
+	app.SetJSONConfig(config)
+	e.Expect(get("/")).ToBe("{\n  \"html\": \"<b>\"\n}\n")
+	e.Expect(encoders).ToBe(1)
+	app.SetDebug(false)
+	config.Prefix = micro.JSONHijackingPrefix
+	app.SetJSONConfig(config)
+	e.Expect(get("/")).ToBe(")]}',\n{\"html\":\"<b>\"}\n")
+}
+
+func TestContextWriteJSONP(t *testing.T) {
+	e := expect.New(t)
+	for callback, valid := range map[string]bool{
+		"callback":         true,
+		"jQuery_12.$done1": true,
+		"alert(1)//":       false,
+		"1callback":        false,
+		"a..b":             false,
+		"":                 false,
+	} {
+		response := httptest.NewRecorder()
+		_, err := micro.NewContext(response, nil).WriteJSONP(1, callback)
+		if valid {
+			e.Expect(err).ToBeNil()
+			e.Expect(response.Body.String()).ToBe("/**/" + callback + "(1);")
+			e.Expect(response.Header().Get("X-Content-Type-Options")).ToBe("nosniff")
+		} else {
+			e.Expect(err).ToBe(micro.ErrInvalidJSONPCallback)
+			e.Expect(response.Body.Len()).ToBe(0)
+		}
+	}
+}
+
+func TestContextReadJSONOptions(t *testing.T) {
+	e := expect.New(t)
+	type Address struct {
+		City string
+	}
+	type User struct {
+		Name    string
+		Address Address `json:"address"`
+	}
+	read := func(body string, options ...micro.JSONDecodeOption) *micro.JSONDecodeError {
+		req, _ := http.NewRequest("POST", "example.com", strings.NewReader(body))
+		err := micro.NewContext(nil, req).ReadJSON(new(User), options...)
+		if err == nil {
+			return nil
+		}
+		return err.(*micro.JSONDecodeError)
+	}
+	e.Expect(read(`{"Name":"john","age":20}`)).ToBeNil()
+	err := read(`{"Name":"john","age":20}`, micro.DisallowUnknownFields())
+	e.Expect(err.Field).ToBe("age")
+	e.Expect(err.StatusCode()).ToBe(http.StatusBadRequest)
+	err = read(`{"Name":"john","address":{"City":10}}`)
+	e.Expect(err.Field).ToBe("address.City")
+	e.Expect(err.Offset).ToBe(int64(35))
+	err = read(`{"Name":"john",}`)
+	e.Expect(err.Offset).ToBe(int64(16))
+	e.Expect(read(``).Message).ToBe("request body is empty")
+	e.Expect(read(`{"Name":"[[[[","address":{"City":"paris"}}`, micro.MaxDepth(2))).ToBeNil()
+	err = read(`{"Name":"john","address":{"City":{"a":[1]}}}`, micro.MaxDepth(2))
+	e.Expect(err.Offset).ToBe(int64(33))
+	body, _ := json.Marshal(err)
+	e.Expect(string(body)).ToBe(`{"message":"maximum nesting depth of 2 exceeded","offset":33}`)
+	e.Expect(read(`{"Name":"john","a\"b":1}`, micro.DisallowUnknownFields()).Field).ToBe(`a"b`)
+
+	for _, options := range [][]micro.JSONDecodeOption{{micro.MaxBodySize(16)}, {micro.MaxBodySize(16), micro.MaxDepth(2)}} {
+		req, _ := http.NewRequest("POST", "example.com", strings.NewReader(`{"Name":"john","address":{}}`))
+		var httpError *micro.HTTPError
+		e.Expect(errors.As(micro.NewContext(nil, req).ReadJSON(new(User), options...), &httpError)).ToBeTrue()
+		e.Expect(httpError.Code).ToBe(http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestContextNegotiate(t *testing.T) {
+	e := expect.New(t)
+	req, _ := http.NewRequest("GET", "example.com", nil)
+	context := micro.NewContext(nil, req)
+	e.Expect(context.Negotiate()).ToBe("json")
+	req.Header.Set("Accept", "application/msgpack, application/json;q=0.8")
+	e.Expect(context.Negotiate()).ToBe("msgpack")
+	req.Header.Set("Accept", "text/*;q=0.9, */*;q=0.1")
+	e.Expect(context.Negotiate("json", "xml")).ToBe("xml")
+	req.Header.Set("Accept", "text/html")
+	e.Expect(context.Negotiate("json", "msgpack")).ToBe("")
+}
+
+func TestRespondInErrorHandler(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.ErrorClass(4, func(ctx *micro.Context, err *micro.HTTPError) error {
+		return ctx.Respond(err.Code, err)
+	})
+	app.Get("/users", func(ctx *micro.Context) error {
+		return ctx.Respond(http.StatusOK, []string{"john"})
+	})
+	for path, code := range map[string]int{"/users": http.StatusNotAcceptable, "/missing": http.StatusNotFound} {
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set("Accept", "image/png")
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		e.Expect(response.Code).ToBe(code)
+		e.Expect(response.Header().Get("Content-Type")).ToBe("application/json")
+		e.Expect(response.Body.String()).ToContain(fmt.Sprintf(`"code":%d`, code))
+	}
+}
+
+/**********************************/
+/*           UTILS TESTS          */
+/**********************************/
+
+func TestMustWithResult(t *testing.T) {
+	b := func() (*Foo, error) {
+		return new(Foo), nil
+	}
+	_ = micro.MustWithResult(b()).(*Foo)
+}
+
+/********************************/
+/*            FIXTURES          */
+/********************************/
+
+type Foo struct {
+	Bar string
+}
+
+func (f Foo) Call() string {
+	return "called"
+}
+
+type FakeRenderer struct {
+	*template.Template
+}
+
+func (renderer FakeRenderer) Render(w io.Writer, name string, data interface{}) error {
+	return renderer.ExecuteTemplate(w, name, data)
+}
+
+type Caller interface {
+	Call() string
+}
+
+type Person struct {
+	id   int
+	name string
+}
+
+func (p Person) Find(id int) *Person {
+	var (
+		person           *Person
+		personRepository = []*Person{
+			&Person{id: 0, name: "James"},
+			&Person{id: 1, name: "Frank"},
+		}
+	)
+	for _, p := range personRepository {
+		if p.id == id {
+			person = p
+			break
+		}
+	}
+	return person
+}
+
+var (
+	PersonRepository Person
+)
+
+type Storage interface {
+	Name() string
+}
+
+type MemoryStorage struct {
+	name string
+}
+
+func (storage *MemoryStorage) Name() string {
+	return storage.name
+}
+
+func TestRouteTable(t *testing.T) {
+	newApp := func() *micro.Micro {
+		app := micro.New()
+		app.Use("/", func(next micro.Next) { next() })
+		app.Get("/users/:id", func(ctx *micro.Context) {}).SetName("users.show")
+		admin := micro.NewControllerCollection()
+		admin.Post("/users", func(ctx *micro.Context) {})
+		app.Mount("/admin", admin)
+		app.OnBoot(func(*micro.Injector) error { return errors.New("boot hooks must not be executed") })
+		return app
+	}
+	if os.Getenv(micro.RoutesEnv) != "" {
+		// the test is run as the child process writing its route table
+		newApp().Boot()
+		return
+	}
+	e := expect.New(t)
+	app := newApp()
+	e.Expect(app.RouteTable()).ToBeNil()
+	app.Boot()
+	table := app.RouteTable()
+	e.Expect(len(table)).ToBe(3)
+	e.Expect(table[0].Passthrough).ToBeTrue()
+	e.Expect(reflect.DeepEqual(table[1], micro.RouteInfo{Name: "users.show", Methods: []string{"GET", "HEAD"}, Path: "/users/:id", Handler: table[1].Handler, Middlewares: 1})).ToBeTrue()
+	e.Expect(table[1].Handler).ToContain("TestRouteTable")
+	e.Expect(table[2].Path).ToBe("/admin/users")
+
+	served := micro.New()
+	served.Get("/debug/routes", served.ServeRouteTable)
+	response := httptest.NewRecorder()
+	served.ServeHTTP(response, httptest.NewRequest("GET", "/debug/routes", nil))
+	e.Expect(response.Body.String()).ToContain(`"path":"/debug/routes"`)
+
+	child := exec.Command(os.Args[0], "-test.run=^TestRouteTable$")
+	child.Env = append(os.Environ(), micro.RoutesEnv+"=1")
+	output, err := child.Output()
+	e.Expect(err).ToBeNil()
+	written := []micro.RouteInfo{}
+	e.Expect(json.Unmarshal(output, &written)).ToBeNil()
+	e.Expect(reflect.DeepEqual(written, table)).ToBeTrue()
+}
+
+func TestPrintRoutes(t *testing.T) {
+	e := expect.New(t)
+	defer func(output io.Writer) { micro.DebugRoutesOutput = output }(micro.DebugRoutesOutput)
+	output := &bytes.Buffer{}
+	micro.DebugRoutesOutput = output
+	app := micro.New()
+	app.SetDebug(true)
+	app.Use("/", func(next micro.Next) { next() })
+	app.Use("/admin", func(next micro.Next) { next() })
+	app.Get("/admin/users", func(ctx *micro.Context) {}).SetName("admin.users")
+	app.Post("/posts", func(ctx *micro.Context) {}).SetName("posts.create")
+	app.Boot()
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	e.Expect(len(lines)).ToBe(5)
+	e.Expect(strings.Join(strings.Fields(lines[0]), " ")).ToBe("METHODS PATH NAME HANDLER MIDDLEWARES")
+	admin := strings.Fields(lines[3])
+	e.Expect(admin[0] + " " + admin[1] + " " + admin[2] + " " + admin[4]).ToBe("GET,HEAD /admin/users admin.users 2")
+	e.Expect(admin[3]).ToContain("TestPrintRoutes")
+	posts := strings.Fields(lines[4])
+	e.Expect(posts[0] + " " + posts[4]).ToBe("POST 1")
+	// columns are aligned
+	e.Expect(strings.Index(lines[0], "PATH")).ToBe(strings.Index(lines[4], "/posts"))
+
+	printed := &bytes.Buffer{}
+	e.Expect(app.PrintRoutes(printed)).ToBeNil()
+	e.Expect(printed.String()).ToBe(output.String())
+	output.Reset()
+	micro.New().Boot()
+	e.Expect(output.Len()).ToBe(0)
+}
+
+func TestSessions(t *testing.T) {
+	e := expect.New(t)
+	key, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16)
+	newApp := func(store *micro.CookieStore) *micro.Micro {
+		app := micro.New()
+		app.Use("/", micro.Sessions(micro.SessionConfig{Store: store}))
+		app.Post("/login", func(session *micro.Session) {
+			session.RenewID()
+			session.Set("user", "42")
+		})
+		app.Get("/me", func(ctx *micro.Context, session *micro.Session) {
+			e.Expect(ctx.Session()).ToBe(session)
+			ctx.WriteString(session.Get("user"))
+		})
+		app.Post("/logout", func(session *micro.Session) { session.Destroy() })
+		app.Post("/large", func(session *micro.Session) { session.Set("data", strings.Repeat("x", 4096)) })
+		return app
+	}
+	do := func(app *micro.Micro, method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+	app := newApp(micro.NewCookieStore(key))
+	response := do(app, "GET", "/me", nil)
+	e.Expect(response.Header().Get("Set-Cookie")).ToBe("")
+	response = do(app, "POST", "/login", nil)
+	cookies := response.Result().Cookies()
+	e.Expect(len(cookies)).ToBe(1)
+	cookie := cookies[0]
+	e.Expect(cookie.Name).ToBe(micro.DefaultSessionCookieName)
+	e.Expect(cookie.HttpOnly).ToBeTrue()
+	e.Expect(cookie.MaxAge).ToBe(int(micro.DefaultSessionMaxAge / time.Second))
+	e.Expect(do(app, "GET", "/me", cookie).Body.String()).ToBe("42")
+	// tampered cookies start a new session
+	tampered := *cookie
+	if tampered.Value[0] == 'A' {
+		tampered.Value = "B" + cookie.Value[1:]
+	} else {
+		tampered.Value = "A" + cookie.Value[1:]
+	}
+	e.Expect(do(app, "GET", "/me", &tampered).Body.String()).ToBe("")
+	// keys are rotated
+	e.Expect(do(newApp(micro.NewCookieStore(newKey, key)), "GET", "/me", cookie).Body.String()).ToBe("42")
+	e.Expect(do(newApp(micro.NewCookieStore(newKey)), "GET", "/me", cookie).Body.String()).ToBe("")
+	// sessions exceeding the cookie size are not saved
+	e.Expect(do(app, "POST", "/large", cookie).Header().Get("Set-Cookie")).ToBe("")
+	response = do(app, "POST", "/logout", cookie)
+	e.Expect(response.Result().Cookies()[0].MaxAge).ToBe(-1)
+
+	store := micro.NewCookieStore(key)
+	session := micro.NewSession()
+	session.ExpiresAt = time.Now().Add(-time.Minute)
+	value, err := store.Save(context.Background(), session)
+	e.Expect(err).ToBeNil()
+	_, err = store.Load(context.Background(), value)
+	e.Expect(err).ToBe(micro.ErrSessionNotFound)
+	_, err = store.Load(context.Background(), "invalid")
+	e.Expect(err).ToBe(micro.ErrSessionTampered)
+	e.Expect(func() { micro.NewCookieStore([]byte("short")) }).ToPanic()
+	e.Expect(func() { micro.Sessions(micro.SessionConfig{}) }).ToPanic()
+}
+
+// TouchStore is a cookie store counting the sessions it touches
+type TouchStore struct {
+	*micro.CookieStore
+	touched []string
+}
+
+func (store *TouchStore) Touch(ctx context.Context, session *micro.Session) error {
+	store.touched = append(store.touched, session.UserID)
+	return nil
+}
+
+func TestSlidingSessions(t *testing.T) {
+	e := expect.New(t)
+	do := func(app *micro.Micro, path string, cookie *http.Cookie) *http.Response {
+		request := httptest.NewRequest("GET", path, nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response.Result()
+	}
+	newApp := func(store micro.SessionStore) *micro.Micro {
+		app := micro.New()
+		app.Use("/", micro.Sessions(micro.SessionConfig{Store: store, Sliding: true, MaxAge: time.Hour}))
+		app.Get("/login", func(session *micro.Session) { session.SetUserID("42") })
+		app.Get("/", func(ctx *micro.Context, session *micro.Session) { ctx.WriteString(session.UserID) })
+		return app
+	}
+	// stores without Touch save the session again
+	app := newApp(micro.NewCookieStore(bytes.Repeat([]byte{1}, 16)))
+	e.Expect(len(do(app, "/", nil).Cookies())).ToBe(0)
+	cookie := do(app, "/login", nil).Cookies()[0]
+	response := do(app, "/", cookie)
+	body, _ := io.ReadAll(response.Body)
+	e.Expect(string(body)).ToBe("42")
+	e.Expect(response.Cookies()[0].MaxAge).ToBe(3600)
+	e.Expect(response.Cookies()[0].Value).Not().ToBe(cookie.Value)
+	// stores implementing SessionToucher are touched and the cookie is kept
+	store := &TouchStore{CookieStore: micro.NewCookieStore(bytes.Repeat([]byte{1}, 16))}
+	app = newApp(store)
+	response = do(app, "/", cookie)
+	e.Expect(response.Cookies()[0].Value).ToBe(cookie.Value)
+	e.Expect(strings.Join(store.touched, ",")).ToBe("42")
+}
+
+func TestIPMatcher(t *testing.T) {
+	e := expect.New(t)
+	matcher := micro.NewIPMatcher("203.0.113.0/24", "2001:db8::/32", "198.51.100.7").
+		Deny("203.0.113.13").
+		TrustProxies("10.0.0.0/8")
+	request := func(remoteAddr string, forwardedFor ...string) *http.Request {
+		request := httptest.NewRequest("GET", "/admin", nil)
+		request.RemoteAddr = remoteAddr
+		for _, forwarded := range forwardedFor {
+			request.Header.Add("X-Forwarded-For", forwarded)
+		}
+		return request
+	}
+	for _, test := range []struct {
+		request *http.Request
+		client  string
+		match   bool
+	}{
+		{request("203.0.113.5:1234"), "203.0.113.5", true},
+		{request("[::ffff:203.0.113.5]:1234"), "203.0.113.5", true},
+		{request("[2001:db8::1]:1234"), "2001:db8::1", true},
+		{request("198.51.100.7:1234"), "198.51.100.7", true},
+		{request("198.51.100.8:1234"), "198.51.100.8", false},
+		{request("203.0.113.13:1234"), "203.0.113.13", false},
+		// the header of untrusted clients is ignored
+		{request("198.51.100.8:1234", "203.0.113.5"), "198.51.100.8", false},
+		// trusted proxies are skipped
+		{request("10.0.0.1:1234", "198.51.100.8, 203.0.113.5", "10.0.0.2"), "203.0.113.5", true},
+		{request("10.0.0.1:1234", "203.0.113.5, 198.51.100.8"), "198.51.100.8", false},
+		{request("10.0.0.1:1234", "invalid"), "invalid IP", false},
+	} {
+		e.Expect(matcher.ClientIP(test.request).String()).ToBe(test.client)
+		e.Expect(matcher.Match(test.request)).ToBe(test.match)
+	}
+	e.Expect(micro.NewIPMatcher().Deny("198.51.100.0/24").Match(request("192.0.2.1:1234"))).ToBeTrue()
+	e.Expect(func() { micro.NewIPMatcher("203.0.113.0/33") }).ToPanic()
+
+	app := micro.New()
+	app.Get("/metrics", func(ctx *micro.Context) { ctx.WriteString("metrics") }).AddMatcher(matcher)
+	admin := micro.NewControllerCollection()
+	admin.Use("/", matcher.Middleware())
+	admin.Get("/", func(ctx *micro.Context) { ctx.WriteString("admin") })
+	app.Mount("/admin", admin)
+	for _, test := range []struct {
+		path, remoteAddr string
+		code             int
+	}{
+		{"/metrics", "203.0.113.5:1234", http.StatusOK},
+		{"/metrics", "198.51.100.8:1234", http.StatusNotFound},
+		{"/admin", "203.0.113.5:1234", http.StatusOK},
+		{"/admin", "198.51.100.8:1234", http.StatusForbidden},
+	} {
+		request := httptest.NewRequest("GET", test.path, nil)
+		request.RemoteAddr = test.remoteAddr
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		e.Expect(response.Code).ToBe(test.code)
+	}
+}
+
+func TestCSP(t *testing.T) {
+	e := expect.New(t)
+	policy := micro.NewCSP().
+		DefaultSrc(micro.CSPSelf).
+		ScriptSrc(micro.CSPSelf, "https://cdn.example.com").ScriptNonce().
+		ImgSrc(micro.CSPSelf, "data:").
+		ObjectSrc(micro.CSPNone).
+		UpgradeInsecureRequests().
+		ReportURI("/csp-reports").
+		ReportTo("csp", "https://example.com/csp-reports")
+	e.Expect(policy.Policy("abc")).ToBe("default-src 'self'; script-src 'self' https://cdn.example.com 'nonce-abc'; " +
+		"img-src 'self' data:; object-src 'none'; upgrade-insecure-requests; report-uri /csp-reports; report-to csp")
+	app := micro.New()
+	app.SetRenderer(micro.NewTemplateRenderer(fstest.MapFS{
+		"page.html": {Data: []byte(`<script nonce="{{.CSPNonce}}"></script>`)},
+	}, micro.TemplateOptions{}))
+	app.Use("/", policy.Middleware())
+	app.Get("/", func(ctx *micro.Context) error { return ctx.Render(http.StatusOK, "page", nil) })
+	nonces := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+		header := response.Header().Get("Content-Security-Policy")
+		nonce := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(header)
+		e.Expect(len(nonce)).ToBe(2)
+		e.Expect(response.Body.String()).ToBe(`<script nonce="` + nonce[1] + `"></script>`)
+		e.Expect(response.Header().Get("Reporting-Endpoints")).ToBe(`csp="https://example.com/csp-reports"`)
+		nonces[nonce[1]] = true
+	}
+	e.Expect(len(nonces)).ToBe(2)
+
+	app = micro.New()
+	app.Use("/", micro.NewCSP().DefaultSrc(micro.CSPSelf).ReportOnly().Middleware())
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	e.Expect(response.Header().Get("Content-Security-Policy-Report-Only")).ToBe("default-src 'self'")
+	e.Expect(func() { micro.NewCSP().ScriptSrc("self") }).ToPanic()
+	e.Expect(func() { micro.NewCSP().ScriptSrc("https://a.com; script-src *") }).ToPanic()
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Use("/", micro.RedirectHTTPS(micro.HTTPSOptions{IncludeSubdomains: true, Preload: true, TrustForwardedProto: true}))
+	app.Get("/", func(ctx *micro.Context) { ctx.WriteString("secure") })
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "http://example.com:8080/?a=b", nil))
+	e.Expect(response.Code).ToBe(http.StatusMovedPermanently)
+	e.Expect(response.Header().Get("Location")).ToBe("https://example.com/?a=b")
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("POST", "http://example.com/", nil))
+	e.Expect(response.Code).ToBe(http.StatusPermanentRedirect)
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "https://example.com/", nil))
+	e.Expect(response.Body.String()).ToBe("secure")
+	e.Expect(response.Header().Get("Strict-Transport-Security")).ToBe("max-age=31536000; includeSubDomains; preload")
+	response = httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "http://example.com/", nil)
+	request.Header.Set("X-Forwarded-Proto", "https")
+	app.ServeHTTP(response, request)
+	e.Expect(response.Code).ToBe(http.StatusOK)
+	e.Expect(func() { micro.RedirectHTTPS(micro.HTTPSOptions{Preload: true}) }).ToPanic()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	done := make(chan error, 1)
+	go func() { done <- app.RunHTTPSRedirect(addr, micro.HTTPSOptions{Port: 8443}) }()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	var redirect *http.Response
+	for i := 0; i < 50; i++ {
+		if redirect, err = client.Get("http://" + addr + "/path"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirect.Body.Close()
+	e.Expect(redirect.Header.Get("Location")).ToBe("https://127.0.0.1:8443/path")
+	e.Expect(app.Shutdown(context.Background())).ToBeNil()
+	e.Expect(<-done).ToBe(http.ErrServerClosed)
+
+	// the redirect server is shut down when the HTTPS server fails, the application is not
+	app = micro.New()
+	shutdown := false
+	app.OnShutdown(func(context.Context) error { shutdown = true; return nil })
+	err = app.RunTLSRedirect("127.0.0.1:0", "missing.crt", "missing.key", micro.HTTPSOptions{HTTPAddr: addr})
+	e.Expect(err).Not().ToBeNil()
+	e.Expect(errors.Is(err, http.ErrServerClosed)).ToBeFalse()
+	e.Expect(shutdown).ToBeFalse()
+	_, err = client.Get("http://" + addr + "/path")
+	e.Expect(err).Not().ToBeNil()
+
+	// the HTTPS server is not started when the redirect server cannot listen
+	listener, err = net.Listen("tcp", "127.0.0.1:0")
+	e.Expect(err).ToBeNil()
+	defer listener.Close()
+	app = micro.New()
+	err = app.RunTLSRedirect("127.0.0.1:0", "missing.crt", "missing.key", micro.HTTPSOptions{HTTPAddr: listener.Addr().String()})
+	e.Expect(err).Not().ToBeNil()
+	e.Expect(app.Booted()).ToBeFalse()
+}
+
+// GreetingSchema answers GraphQL operations with the greeting of a Greeter resolved from the request injector
+type GreetingSchema struct{}
+
+type Greeter struct{ Greeting string }
+
+func (GreetingSchema) Execute(ctx context.Context, request *micro.GraphQLRequest) (*micro.GraphQLResponse, error) {
+	switch request.Query {
+	case "{ greeting }":
+		greeter, err := micro.Resolve[*Greeter](micro.GraphQLInjector(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return &micro.GraphQLResponse{Data: map[string]interface{}{"greeting": greeter.Greeting + " " + fmt.Sprint(request.Variables["name"])}}, nil
+	case "mutation { greet }":
+		if request.ReadOnly {
+			return nil, micro.NewHTTPError(http.StatusMethodNotAllowed, "")
+		}
+		return &micro.GraphQLResponse{Errors: []*micro.GraphQLError{
+			{Message: "forbidden", Path: []interface{}{"greet"}, Err: micro.Forbidden("not allowed")},
+			{Message: "database down", Err: errors.New("database down")},
+		}}, nil
+	}
+	return &micro.GraphQLResponse{Errors: []*micro.GraphQLError{{Message: "syntax error"}}}, nil
+}
+
+func TestGraphQL(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Injector().Register(&Greeter{Greeting: "hello"})
+	app.GraphQL("/graphql", GreetingSchema{}, micro.GraphQLOptions{MaxBodySize: 100})
+	serve := func(request *http.Request) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+	post := func(body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		return serve(request)
+	}
+	response := post(`{"query": "{ greeting }", "variables": {"name": "world"}}`)
+	e.Expect(response.Code).ToBe(http.StatusOK)
+	e.Expect(strings.TrimSpace(response.Body.String())).ToBe(`{"data":{"greeting":"hello world"}}`)
+	response = serve(httptest.NewRequest("GET", "/graphql?query=%7B+greeting+%7D&variables=%7B%22name%22%3A%22get%22%7D", nil))
+	e.Expect(response.Body.String()).ToContain("hello get")
+
+	result := struct{ Errors []micro.GraphQLError }{}
+	response = post(`{"query": "mutation { greet }"}`)
+	e.Expect(json.Unmarshal(response.Body.Bytes(), &result)).ToBeNil()
+	e.Expect(len(result.Errors)).ToBe(2)
+	e.Expect(result.Errors[0].Message).ToBe("not allowed")
+	e.Expect(result.Errors[0].Extensions["code"]).ToBe(float64(http.StatusForbidden))
+	e.Expect(result.Errors[1].Message).ToBe("Internal Server Error")
+	e.Expect(result.Errors[1].Extensions["reference"]).Not().ToBeNil()
+	e.Expect(response.Body.String()).Not().ToContain("database down")
+	response = post(`{"query": "{ error"}`)
+	e.Expect(response.Body.String()).ToContain("syntax error")
+
+	e.Expect(serve(httptest.NewRequest("GET", "/graphql?query=mutation+%7B+greet+%7D", nil)).Code).ToBe(http.StatusMethodNotAllowed)
+	e.Expect(post(`{"query": ""}`).Code).ToBe(http.StatusBadRequest)
+	e.Expect(post(`{"query": "{ greeting }", "variables": {"name": "` + strings.Repeat("a", 100) + `"}}`).Code).ToBe(http.StatusRequestEntityTooLarge)
+	request := httptest.NewRequest("POST", "/graphql", strings.NewReader("{ greeting }"))
+	request.Header.Set("Content-Type", "text/plain")
+	e.Expect(serve(request).Code).ToBe(http.StatusUnsupportedMediaType)
+	request = httptest.NewRequest("POST", "/graphql", strings.NewReader("{ greeting }"))
+	request.Header.Set("Content-Type", "application/graphql")
+	e.Expect(serve(request).Body.String()).ToContain("hello")
+
+	request = httptest.NewRequest("GET", "/graphql", nil)
+	request.Header.Set("Accept", "text/html")
+	e.Expect(serve(request).Code).ToBe(http.StatusBadRequest)
+	app = micro.New()
+	app.SetDebug(true)
+	app.GraphQL("/graphql", GreetingSchema{}, micro.GraphQLOptions{})
+	response = serve(request)
+	e.Expect(response.Code).ToBe(http.StatusOK)
+	e.Expect(response.Body.String()).ToContain("GraphiQL.createFetcher")
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	e := expect.New(t)
+	sign := func(message string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(message))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	app := micro.New()
+	app.Use("/github", micro.VerifyWebhook(micro.GitHubWebhook(), micro.WebhookSecrets("old", "secret")))
+	app.Use("/stripe", micro.VerifyWebhook(micro.StripeWebhook(), micro.WebhookSecrets("secret")))
+	app.Use("/slack", micro.VerifyWebhook(micro.SlackWebhook(), micro.WebhookSecrets("secret")))
+	handler := func(ctx *micro.Context) error {
+		event := map[string]string{}
+		if err := ctx.ReadJSON(&event); err != nil {
+			return err
+		}
+		ctx.WriteString(event["type"])
+		return nil
+	}
+	app.Post("/github", handler)
+	app.Post("/stripe", handler)
+	app.Post("/slack", handler)
+	body := `{"type": "push"}`
+	post := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("POST", path, strings.NewReader(body))
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+	response := post("/github", map[string]string{"X-Hub-Signature-256": "sha256=" + sign(body)})
+	e.Expect(response.Code).ToBe(http.StatusOK)
+	e.Expect(response.Body.String()).ToBe("push")
+	e.Expect(post("/github", map[string]string{"X-Hub-Signature-256": "sha256=" + sign("other")}).Code).ToBe(http.StatusUnauthorized)
+	e.Expect(post("/github", nil).Code).ToBe(http.StatusUnauthorized)
+
+	timestamp := fmt.Sprint(time.Now().Unix())
+	stripe := map[string]string{"Stripe-Signature": "t=" + timestamp + ",v1=" + sign("x") + ",v1=" + sign(timestamp+"."+body)}
+	e.Expect(post("/stripe", stripe).Body.String()).ToBe("push")
+	response = post("/stripe", stripe)
+	e.Expect(response.Code).ToBe(http.StatusUnauthorized)
+	e.Expect(response.Body.String()).ToContain("webhook replayed")
+	replayed := map[string]string{"Stripe-Signature": "t=" + timestamp + ",v1=" + strings.ToUpper(sign(timestamp+"."+body))}
+	e.Expect(post("/stripe", replayed).Code).ToBe(http.StatusUnauthorized)
+	old := fmt.Sprint(time.Now().Add(-time.Hour).Unix())
+	response = post("/stripe", map[string]string{"Stripe-Signature": "t=" + old + ",v1=" + sign(old+"."+body)})
+	e.Expect(response.Body.String()).ToContain("outside of tolerance")
+
+	e.Expect(post("/slack", map[string]string{
+		"X-Slack-Request-Timestamp": timestamp, "X-Slack-Signature": "v0=" + sign("v0:"+timestamp+":"+body),
+	}).Body.String()).ToBe("push")
+	e.Expect(post("/slack", map[string]string{
+		"X-Slack-Request-Timestamp": old, "X-Slack-Signature": "v0=" + sign("v0:"+timestamp+":"+body),
+	}).Code).ToBe(http.StatusUnauthorized)
+}
+
+func TestProxy(t *testing.T) {
+	e := expect.New(t)
+	var mutex sync.Mutex
+	requests := []string{}
+	failures := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(body))
+		failing := failures > 0
+		if failing {
+			failures--
+		}
+		mutex.Unlock()
+		switch {
+		case r.URL.Path == "/api/slow":
+			time.Sleep(200 * time.Millisecond)
+		case failing:
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("X-Powered-By", "legacy")
+		rw.Write([]byte("upstream " + r.URL.Path))
+	}))
+	defer upstream.Close()
+	breaker := micro.NewCircuitBreaker(3, time.Hour)
+	app := micro.New()
+	app.Proxy("/legacy/", upstream.URL+"/api", micro.ProxyOptions{
+		Timeout:                50 * time.Millisecond,
+		Retry:                  micro.RetryPolicy{Attempts: 3},
+		CircuitBreaker:         breaker,
+		RewriteResponseHeaders: func(header http.Header) { header.Del("X-Powered-By") },
+	})
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return response
+	}
+	response := serve("GET", "/legacy/users", "")
+	e.Expect(response.Code).ToBe(http.StatusOK)
+	e.Expect(response.Body.String()).ToBe("upstream /api/users")
+	e.Expect(response.Header().Get("X-Powered-By")).ToBe("")
+
+	setFailures := func(n int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		failures = n
+	}
+	recorded := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string{}, requests...)
+	}
+	setFailures(2)
+	response = serve("PUT", "/legacy/users/1", "name")
+	e.Expect(response.Body.String()).ToBe("upstream /api/users/1")
+	e.Expect(strings.Join(recorded()[1:], ",")).ToBe("PUT /api/users/1 name,PUT /api/users/1 name,PUT /api/users/1 name")
+	// breaker failures are consecutive, the success reset them
+	e.Expect(breaker.Open()).ToBeFalse()
+
+	setFailures(1)
+	e.Expect(serve("POST", "/legacy/users", "").Code).ToBe(http.StatusServiceUnavailable)
+	e.Expect(len(recorded())).ToBe(5)
+
+	e.Expect(serve("GET", "/legacy/slow", "").Code).ToBe(http.StatusGatewayTimeout)
+	e.Expect(breaker.Open()).ToBeTrue()
+	response = serve("GET", "/legacy/users", "")
+	e.Expect(response.Code).ToBe(http.StatusServiceUnavailable)
+	e.Expect(len(recorded())).ToBe(7)
+	e.Expect(func() { app.Proxy("/other", "/relative", micro.ProxyOptions{}) }).ToPanic()
+}
+
+func TestProxyMaxRetryBodySize(t *testing.T) {
+	e := expect.New(t)
+	defer func(size int64) { micro.MaxRetryBodySize = size }(micro.MaxRetryBodySize)
+	micro.MaxRetryBodySize = 8
+	var mutex sync.Mutex
+	requests := []string{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		requests = append(requests, string(body))
+		mutex.Unlock()
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+	app := micro.New()
+	app.Proxy("/legacy/", upstream.URL, micro.ProxyOptions{Retry: micro.RetryPolicy{Attempts: 3}})
+	serve := func(body io.Reader) []string {
+		mutex.Lock()
+		requests = requests[:0]
+		mutex.Unlock()
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("PUT", "/legacy/users/1", body))
+		e.Expect(response.Code).ToBe(http.StatusServiceUnavailable)
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string{}, requests...)
+	}
+	e.Expect(serve(strings.NewReader("small"))).ToEqual([]string{"small", "small", "small"})
+	// larger bodies are streamed once, whether their length is known or not
+	e.Expect(serve(strings.NewReader("a large body"))).ToEqual([]string{"a large body"})
+	e.Expect(serve(io.MultiReader(strings.NewReader("a large body")))).ToEqual([]string{"a large body"})
+	e.Expect(serve(io.MultiReader(strings.NewReader("tiny")))).ToEqual([]string{"tiny", "tiny", "tiny"})
+}
+
+func TestTenancy(t *testing.T) {
+	e := expect.New(t)
+	tenants := micro.TenantStoreFunc(func(ctx context.Context, id string) (*micro.Tenant, error) {
+		switch id {
+		case "acme":
+			return &micro.Tenant{ID: "acme", Plan: "enterprise"}, nil
+		case "globex":
+			return &micro.Tenant{ID: "globex", Plan: "free"}, nil
+		case "broken":
+			return nil, errors.New("database down")
+		}
+		return nil, nil
+	})
+	get := func(app *micro.Micro, request *http.Request) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+
+	app := micro.New()
+	app.SetTenantResolver(micro.TenantBySubdomain("example.com", tenants))
+	app.Get("/", func(ctx *micro.Context, tenant *micro.Tenant) {
+		if tenant == nil {
+			ctx.WriteString("home")
+			return
+		}
+		ctx.WriteString(tenant.ID + " " + micro.TenantFrom(ctx).Plan)
+	})
+	reports := micro.NewControllerCollection()
+	reports.AddMatcher(micro.ForPlans("enterprise"))
+	reports.Get("/", func(ctx *micro.Context) { ctx.WriteString("reports") })
+	app.Mount("/reports", reports)
+	e.Expect(get(app, httptest.NewRequest("GET", "http://acme.example.com:8080/", nil)).Body.String()).ToBe("acme enterprise")
+	e.Expect(get(app, httptest.NewRequest("GET", "http://example.com/", nil)).Body.String()).ToBe("home")
+	e.Expect(get(app, httptest.NewRequest("GET", "http://initech.example.com/", nil)).Code).ToBe(http.StatusNotFound)
+	e.Expect(get(app, httptest.NewRequest("GET", "http://broken.example.com/", nil)).Code).ToBe(http.StatusInternalServerError)
+	e.Expect(get(app, httptest.NewRequest("GET", "http://acme.example.com/reports", nil)).Body.String()).ToBe("reports")
+	e.Expect(get(app, httptest.NewRequest("GET", "http://globex.example.com/reports", nil)).Code).ToBe(http.StatusNotFound)
+
+	app = micro.New()
+	app.SetTenantResolver(micro.TenantByPathPrefix(tenants))
+	app.Get("/projects", func(ctx *micro.Context, tenant *micro.Tenant) {
+		ctx.WriteString(tenant.ID + " " + ctx.Request.URL.Path)
+	}).AddMatcher(micro.ForTenants("globex"))
+	e.Expect(get(app, httptest.NewRequest("GET", "/globex/projects", nil)).Body.String()).ToBe("globex /projects")
+	e.Expect(get(app, httptest.NewRequest("GET", "/acme/projects", nil)).Code).ToBe(http.StatusNotFound)
+
+	resolver := micro.TenantByHeader("X-Tenant", tenants)
+	resolver.Required = true
+	app = micro.New()
+	app.SetTenantResolver(resolver)
+	app.Get("/", func(ctx *micro.Context, tenant *micro.Tenant) { ctx.WriteString(tenant.ID) })
+	request := httptest.NewRequest("GET", "/", nil)
+	e.Expect(get(app, request).Code).ToBe(http.StatusNotFound)
+	request.Header.Set("X-Tenant", "acme")
+	e.Expect(get(app, request).Body.String()).ToBe("acme")
+}
+
+func TestStatic(t *testing.T) {
+	e := expect.New(t)
+	assets := fstest.MapFS{
+		"app.js":          {Data: []byte("embedded js")},
+		"docs/index.html": {Data: []byte("docs")},
+		"index.html":      {Data: []byte("spa")},
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/app.js", []byte("disk js"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	app := micro.New()
+	app.Static("/assets/", app.DebugFS(assets, dir))
+	app.SPA("/", assets, "index.html")
+	get := func(path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		return response
+	}
+	e.Expect(get("/assets/app.js").Body.String()).ToBe("embedded js")
+	e.Expect(get("/assets/docs").Body.String()).ToBe("docs")
+	e.Expect(get("/assets/docs/").Body.String()).ToBe("docs")
+	e.Expect(get("/assets/missing.js").Code).ToBe(http.StatusNotFound)
+	e.Expect(get("/assets/../micro_test.go").Code).ToBe(http.StatusNotFound)
+	e.Expect(get("/").Body.String()).ToBe("spa")
+	e.Expect(get("/users/1").Body.String()).ToBe("spa")
+	e.Expect(get("/app.js").Body.String()).ToBe("embedded js")
+	e.Expect(get("/missing.css").Code).ToBe(http.StatusNotFound)
+	app.SetDebug(true)
+	e.Expect(get("/assets/app.js").Body.String()).ToBe("disk js")
+	e.Expect(get("/assets/docs").Body.String()).ToBe("docs")
+}
+
+func TestPrecompileTemplates(t *testing.T) {
+	e := expect.New(t)
+	templates := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`<main>{{block "content" .}}{{end}}</main>`)},
+		"partials/nav.html": {Data: []byte(`<nav></nav>`)},
+		"home.html":         {Data: []byte(`{{define "content"}}{{template "partials/nav.html"}}home{{end}}`)},
+		"broken.html":       {Data: []byte(`{{define "content"}}{{.Data.Name}{{end}}`)},
+		"orphan.html":       {Data: []byte(`{{/* extends "layouts/missing" */}}`)},
+		"styles.css":        {Data: []byte(`{{`)},
+	}
+	renderer := micro.NewTemplateRenderer(templates, micro.TemplateOptions{Layout: "layouts/base", Partials: []string{"partials/*.html"}, Cache: true})
+	err := renderer.Precompile()
+	templateErrors := micro.TemplateErrors{}
+	e.Expect(errors.As(err, &templateErrors)).ToBeTrue()
+	names := []string{}
+	for _, templateError := range templateErrors {
+		names = append(names, templateError.Name)
+	}
+	e.Expect(strings.Join(names, ",")).ToBe("broken.html,orphan.html")
+	e.Expect(err.Error()).ToContain("2 broken templates")
+
+	app := micro.New()
+	app.SetRenderer(renderer)
+	e.Expect(app.Boot()).Not().ToBeNil()
+	app = micro.New()
+	app.SetDebug(true)
+	app.SetRenderer(renderer)
+	e.Expect(app.Boot()).ToBeNil()
+
+	delete(templates, "broken.html")
+	delete(templates, "orphan.html")
+	app = micro.New()
+	app.SetRenderer(renderer)
+	e.Expect(app.Boot()).ToBeNil()
+	buffer := new(bytes.Buffer)
+	e.Expect(renderer.Render(buffer, "home", nil)).ToBeNil()
+	e.Expect(buffer.String()).ToBe("<main><nav></nav>home</main>")
+}
+
+func TestI18n(t *testing.T) {
+	e := expect.New(t)
+	catalogs := fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{"greeting": "Hello {name}", "cart": {"items": {"one": "{count} item", "other": "{count} items"}}, "bye": "Bye"}`)},
+		"locales/fr.toml": {Data: []byte(`# French
+greeting = "Bonjour {name}" # informal
+
+[cart.items]
+one = '{count} article'
+other = "{count} articles"
+`)},
+		"locales/ru.json": {Data: []byte(`{"cart": {"items": {"one": "{count} товар", "few": "{count} товара", "many": "{count} товаров", "other": "{count} товара"}}}`)},
+	}
+	translator := micro.NewTranslator("en")
+	e.Expect(translator.Load(catalogs, "locales/*.json")).ToBeNil()
+	e.Expect(translator.Load(catalogs, "locales/*.toml")).ToBeNil()
+	e.Expect(translator.Translate("fr-CA", "greeting", "name", "Jane")).ToBe("Bonjour Jane")
+	e.Expect(translator.Translate("fr", "cart.items", "count", 0)).ToBe("0 article")
+	e.Expect(translator.Translate("fr", "cart.items", "count", 2)).ToBe("2 articles")
+	e.Expect(translator.Translate("en", "cart.items", "count", 1)).ToBe("1 item")
+	e.Expect(translator.Translate("en", "cart.items", "count", 0)).ToBe("0 items")
+	e.Expect(translator.Translate("ru", "cart.items", "count", 3)).ToBe("3 товара")
+	e.Expect(translator.Translate("ru", "cart.items", "count", 11)).ToBe("11 товаров")
+	e.Expect(translator.Translate("fr", "bye")).ToBe("Bye")
+	e.Expect(translator.Translate("fr", "missing")).ToBe("missing")
+	e.Expect(micro.NewTranslator("en").Load(fstest.MapFS{"fr.toml": {Data: []byte("count = 3")}}, "*.toml")).Not().ToBeNil()
+
+	app := micro.New()
+	app.SetRenderer(micro.NewTemplateRenderer(fstest.MapFS{
+		"cart.html": {Data: []byte(`{{.T "cart.items" "count" .Data}}`)},
+	}, micro.TemplateOptions{}))
+	app.Use("/", translator.Middleware(micro.LocaleOptions{}))
+	app.Get("/greeting", func(ctx *micro.Context) {
+		ctx.WriteString(ctx.T("greeting", "name", "Jane"))
+	})
+	app.Get("/cart", func(ctx *micro.Context) error {
+		return ctx.Render(http.StatusOK, "cart", 2)
+	})
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		for name, values := range header {
+			request.Header[name] = values
+		}
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+	e.Expect(get("/greeting", nil).Body.String()).ToBe("Hello Jane")
+	response := get("/greeting", http.Header{"Accept-Language": {"de;q=1, fr-FR;q=0.8"}})
+	e.Expect(response.Body.String()).ToBe("Bonjour Jane")
+	e.Expect(response.Header().Get("Content-Language")).ToBe("fr")
+	response = get("/greeting?lang=ru", http.Header{"Accept-Language": {"fr"}})
+	e.Expect(response.Header().Get("Content-Language")).ToBe("ru")
+	e.Expect(response.Header().Get("Set-Cookie")).ToContain("lang=ru")
+	e.Expect(get("/greeting?lang=xx", http.Header{"Cookie": {"lang=fr"}}).Body.String()).ToBe("Bonjour Jane")
+	e.Expect(get("/cart", http.Header{"Cookie": {"lang=fr"}}).Body.String()).ToBe("2 articles")
+}
+
+type PageQuery struct {
+	Page    int `query:"page" default:"1"`
+	PerPage int `query:"per_page" default:"20"`
+}
+
+type ListQuery struct {
+	PageQuery
+	Sort    []string          `query:"sort"`
+	IDs     []int             `query:"id"`
+	Since   time.Time         `query:"since" layout:"2006-01-02"`
+	Until   *time.Time        `query:"until"`
+	Timeout time.Duration     `query:"timeout" default:"5s"`
+	Debug   bool              `query:"-"`
+	Filter  ListFilter        `query:"filter"`
+	Labels  map[string]string `query:"labels"`
+}
+
+type ListFilter struct {
+	Status string `query:"status" default:"open"`
+	Owner  string
+}
+
+func TestReadQuery(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/issues", func(ctx *micro.Context) (*ListQuery, error) {
+		query := &ListQuery{}
+		return query, ctx.ReadQuery(query)
+	})
+	get := func(query string) (*ListQuery, *httptest.ResponseRecorder) {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/issues?"+query, nil))
+		result := &ListQuery{}
+		json.Unmarshal(response.Body.Bytes(), result)
+		return result, response
+	}
+	query, _ := get("")
+	e.Expect(query.Page).ToBe(1)
+	e.Expect(query.PerPage).ToBe(20)
+	e.Expect(query.Timeout).ToBe(5 * time.Second)
+	e.Expect(query.Filter.Status).ToBe("open")
+	e.Expect(query.Until).ToBeNil()
+	query, _ = get("page=3&sort=name,-date&id[]=1&id[]=2&since=2024-03-01&until=2024-03-02T10:00:00Z" +
+		"&timeout=1m&Debug=true&filter[status]=closed&filter[Owner]=jane&labels[team]=core&labels[area]=api")
+	e.Expect(query.Page).ToBe(3)
+	e.Expect(strings.Join(query.Sort, " ")).ToBe("name -date")
+	e.Expect(fmt.Sprint(query.IDs)).ToBe("[1 2]")
+	e.Expect(query.Since.Format(time.RFC3339)).ToBe("2024-03-01T00:00:00Z")
+	e.Expect(query.Until.Hour()).ToBe(10)
+	e.Expect(query.Timeout).ToBe(time.Minute)
+	e.Expect(query.Debug).ToBeFalse()
+	e.Expect(query.Filter.Status).ToBe("closed")
+	e.Expect(query.Filter.Owner).ToBe("jane")
+	e.Expect(query.Labels["team"]).ToBe("core")
+	e.Expect(query.Labels["area"]).ToBe("api")
+	_, response := get("filter[status]=open&since=yesterday")
+	e.Expect(response.Code).ToBe(http.StatusBadRequest)
+	_, response = get("id=1&id=two")
+	e.Expect(response.Code).ToBe(http.StatusBadRequest)
+	e.Expect(func() { (&micro.Context{}).ReadQuery(ListQuery{}) }).ToPanic()
+}
+
+func TestPaginate(t *testing.T) {
+	e := expect.New(t)
+	items := make([]int, 45)
+	for i := range items {
+		items[i] = i + 1
+	}
+	app := micro.New()
+	app.Get("/items", func(ctx *micro.Context) error {
+		page, err := micro.Paginate(ctx, micro.PaginationDefaults{PerPage: 10, MaxPerPage: 20})
+		if err != nil {
+			return err
+		}
+		if page.Cursor != "" {
+			start, _ := strconv.Atoi(page.Cursor)
+			if end := start + page.PerPage; end < len(items) {
+				page.NextCursor = strconv.Itoa(end)
+				return page.WriteJSON(items[start:end])
+			}
+			return page.WriteJSON(items[start:])
+		}
+		page.SetTotal(len(items))
+		end := page.Offset() + page.PerPage
+		if end > len(items) {
+			end = len(items)
+		}
+		return page.WriteJSON(items[page.Offset():end])
+	})
+	get := func(query string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/items?"+query, nil))
+		return response
+	}
+	response := get("sort=asc")
+	e.Expect(response.Body.String()).ToContain(`"data":[1,2,3,4,5,6,7,8,9,10]`)
+	e.Expect(response.Body.String()).ToContain(`"meta":{"page":1,"per_page":10,"total":45,"total_pages":5}`)
+	e.Expect(response.Header().Get("Link")).ToBe(`</items?sort=asc>; rel="first", </items?page=2&sort=asc>; rel="next", </items?page=5&sort=asc>; rel="last"`)
+	response = get("page=3&per_page=20")
+	e.Expect(response.Body.String()).ToContain(`"data":[41,42,43,44,45]`)
+	e.Expect(response.Header().Get("Link")).ToBe(`</items?per_page=20>; rel="first", </items?page=2&per_page=20>; rel="prev", </items?page=3&per_page=20>; rel="last"`)
+	response = get("cursor=10")
+	e.Expect(response.Body.String()).ToContain(`"meta":{"per_page":10,"next_cursor":"20"}`)
+	e.Expect(response.Header().Get("Link")).ToBe(`</items>; rel="first", </items?cursor=20>; rel="next"`)
+	response = get("cursor=40")
+	e.Expect(response.Header().Get("Link")).ToBe(`</items>; rel="first"`)
+	e.Expect(get("page=0").Code).ToBe(http.StatusBadRequest)
+	e.Expect(get("page=two").Code).ToBe(http.StatusBadRequest)
+	e.Expect(get("per_page=21").Code).ToBe(http.StatusBadRequest)
+	// pages whose offset overflows are rejected, the offset would be negative
+	e.Expect(get("page=" + strconv.Itoa(math.MaxInt)).Code).ToBe(http.StatusBadRequest)
+	e.Expect(get("page=" + strconv.Itoa(math.MaxInt/10+2)).Code).ToBe(http.StatusBadRequest)
+}
+
+func TestLinks(t *testing.T) {
+	e := expect.New(t)
+	type UserResource struct {
+		ID    string      `json:"id"`
+		Links micro.Links `json:"_links"`
+	}
+	app := micro.New()
+	api := micro.NewControllerCollection()
+	api.Get("/users/:id", func(ctx *micro.Context) error {
+		id := ctx.RequestVars["id"]
+		links, err := ctx.Links().
+			Add("self", "user", micro.Params{"id": id}).
+			Add("files", "user_files", micro.Params{"id": id, "1": "/avatars/me.png"}).
+			AddMethod("delete", http.MethodDelete, "delete_user", micro.Params{"id": id}).
+			Build()
+		if err != nil {
+			return err
+		}
+		return ctx.WriteJSON(UserResource{ID: id, Links: links})
+	}).SetName("user").Assert("id", `\d+`)
+	api.Delete("/users/:id", func() {}).SetName("delete_user")
+	api.Get("/users/:id/files(|/.*)", func() {}).SetName("user_files")
+	api.Get("/broken/:id", func(ctx *micro.Context) error {
+		_, err := ctx.Links().Add("self", "user", micro.Params{"id": "jane"}).Add("other", "missing", nil).Build()
+		return err
+	})
+	app.Mount("/api/", api)
+	e.Expect(app.Boot()).ToBeNil()
+
+	path, err := app.URL("user", micro.Params{"id": "42"})
+	e.Expect(err).ToBeNil()
+	e.Expect(path).ToBe("/api/users/42")
+	_, err = app.URL("user", micro.Params{})
+	e.Expect(err).Not().ToBeNil()
+	_, err = app.URL("missing", nil)
+	e.Expect(err).Not().ToBeNil()
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header = header
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+	forwarded := http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"api.example.com"}, "X-Forwarded-Prefix": {"/v1/"}}
+	e.Expect(get("/api/users/42", forwarded).Body.String()).ToBe(`{"id":"42","_links":{"delete":{"href":"http://example.com/api/users/42","method":"DELETE"},` +
+		`"files":{"href":"http://example.com/api/users/42/files/avatars/me.png"},"self":{"href":"http://example.com/api/users/42"}}}` + "\n")
+	e.Expect(get("/api/broken/1", http.Header{}).Code).ToBe(http.StatusInternalServerError)
+	app.TrustForwardedHeaders(true)
+	e.Expect(get("/api/users/42", forwarded).Body.String()).ToContain(`"self":{"href":"https://api.example.com/v1/api/users/42"}`)
+	e.Expect(get("/api/users/42", http.Header{"Forwarded": {`for=192.0.2.1;proto=https;host="shop.example.com", for=10.0.0.1`}}).Body.String()).
+		ToContain(`"self":{"href":"https://shop.example.com/api/users/42"}`)
+	app.SetBaseURL("https://public.example.com/base/")
+	e.Expect(get("/api/users/42", forwarded).Body.String()).ToContain(`"self":{"href":"https://public.example.com/base/api/users/42"}`)
+	e.Expect(func() { app.SetBaseURL("/relative") }).ToPanic()
+}
+
+func TestServeRange(t *testing.T) {
+	e := expect.New(t)
+	data := "0123456789abcdefghij"
+	modified := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	app := micro.New()
+	app.Get("/export", func(ctx *micro.Context) error {
+		return ctx.ServeRange(micro.RangeContent{
+			Size:         int64(len(data)),
+			ETag:         `"v1"`,
+			LastModified: modified,
+			ContentType:  "text/plain",
+			WriteRange: func(w io.Writer, offset, length int64) error {
+				_, err := io.WriteString(w, data[offset:offset+length])
+				return err
+			},
+		})
+	})
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/export", nil)
+		request.Header = header
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+	response := get(http.Header{})
+	e.Expect(response.Code).ToBe(http.StatusOK)
+	e.Expect(response.Body.String()).ToBe(data)
+	e.Expect(response.Header().Get("Accept-Ranges")).ToBe("bytes")
+	response = get(http.Header{"Range": {"bytes=5-9"}})
+	e.Expect(response.Code).ToBe(http.StatusPartialContent)
+	e.Expect(response.Body.String()).ToBe("56789")
+	e.Expect(response.Header().Get("Content-Range")).ToBe("bytes 5-9/20")
+	e.Expect(response.Header().Get("Content-Length")).ToBe("5")
+	e.Expect(get(http.Header{"Range": {"bytes=-3"}}).Body.String()).ToBe("hij")
+	e.Expect(get(http.Header{"Range": {"bytes=15-"}}).Body.String()).ToBe("fghij")
+	e.Expect(get(http.Header{"Range": {"bytes=18-100"}}).Header().Get("Content-Range")).ToBe("bytes 18-19/20")
+	response = get(http.Header{"Range": {"bytes=0-1,10-11"}})
+	e.Expect(response.Code).ToBe(http.StatusPartialContent)
+	_, params, _ := mime.ParseMediaType(response.Header().Get("Content-Type"))
+	reader := multipart.NewReader(response.Body, params["boundary"])
+	for _, expected := range []string{"bytes 0-1/20:01", "bytes 10-11/20:ab"} {
+		part, err := reader.NextPart()
+		e.Expect(err).ToBeNil()
+		body, _ := io.ReadAll(part)
+		e.Expect(part.Header.Get("Content-Range") + ":" + string(body)).ToBe(expected)
+	}
+	response = get(http.Header{"Range": {"bytes=20-30"}})
+	e.Expect(response.Code).ToBe(http.StatusRequestedRangeNotSatisfiable)
+	e.Expect(response.Header().Get("Content-Range")).ToBe("bytes */20")
+	e.Expect(get(http.Header{"Range": {"bytes=5-9"}, "If-Range": {`"v1"`}}).Code).ToBe(http.StatusPartialContent)
+	e.Expect(get(http.Header{"Range": {"bytes=5-9"}, "If-Range": {`"v0"`}}).Body.String()).ToBe(data)
+	e.Expect(get(http.Header{"Range": {"bytes=5-9"}, "If-Range": {modified.Format(http.TimeFormat)}}).Code).ToBe(http.StatusPartialContent)
+	e.Expect(get(http.Header{"Range": {"bytes=5-9"}, "If-Range": {modified.Add(-time.Hour).Format(http.TimeFormat)}}).Code).ToBe(http.StatusOK)
+	e.Expect(get(http.Header{"Range": {"lines=1-2"}}).Code).ToBe(http.StatusOK)
+}
+
+func TestWriteAuto(t *testing.T) {
+	e := expect.New(t)
+	type Greeting struct {
+		Message string `json:"message" xml:"message"`
+	}
+	app := micro.New()
+	app.RegisterSerializer("application/hal+json", micro.JSONSerializer)
+	app.RegisterSerializer("text/plain", micro.SerializerFunc(func(ctx *micro.Context, w io.Writer, v interface{}) error {
+		_, err := fmt.Fprint(w, v.(*Greeting).Message)
+		return err
+	}))
+	app.Get("/greeting", func(ctx *micro.Context) error {
+		return ctx.WriteAuto(http.StatusCreated, &Greeting{Message: "hello"})
+	})
+	app.Get("/empty", func(ctx *micro.Context) error {
+		return ctx.WriteAuto(http.StatusNoContent, nil)
+	})
+	app.ErrorClass(4, func(ctx *micro.Context, err *micro.HTTPError) error {
+		return ctx.WriteAuto(err.Code, err)
+	})
+	get := func(path string, accept string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		return response
+	}
+	response := get("/greeting", "")
+	e.Expect(response.Code).ToBe(http.StatusCreated)
+	e.Expect(response.Header().Get("Content-Type")).ToBe("application/json")
+	e.Expect(response.Body.String()).ToBe(`{"message":"hello"}` + "\n")
+	response = get("/greeting", "application/hal+json, application/json;q=0.5")
+	e.Expect(response.Header().Get("Content-Type")).ToBe("application/hal+json")
+	e.Expect(response.Header().Get("Vary")).ToBe("Accept")
+	e.Expect(get("/greeting", "text/*").Body.String()).ToContain("<message>hello</message>")
+	e.Expect(get("/greeting", "text/plain").Body.String()).ToBe("hello")
+	// the error handler writes the 406 error with the first serializer
+	response = get("/greeting", "application/cbor")
+	e.Expect(response.Code).ToBe(http.StatusNotAcceptable)
+	e.Expect(response.Header().Get("Content-Type")).ToBe("application/json")
+	e.Expect(response.Body.String()).ToContain(`"code":406`)
+	e.Expect(get("/empty", "").Code).ToBe(http.StatusNoContent)
+}
+
+func TestCollectionErrorHandlers(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Error(http.StatusNotFound, func(ctx *micro.Context) {
+		ctx.WriteString("<h1>page not found</h1>")
+	})
+	app.Error(http.StatusInternalServerError, func(ctx *micro.Context) {
+		ctx.WriteString("<h1>server error</h1>")
+	})
+	api := micro.NewControllerCollection()
+	api.Error(http.StatusNotFound, func(ctx *micro.Context, err *micro.HTTPError) error {
+		return ctx.WriteJSON(map[string]interface{}{"error": err.Code})
+	})
+	api.Use("/", func(next micro.Next) { next() })
+	api.Get("/users/:id", func(ctx *micro.Context) error {
+		return micro.NotFound("no such user")
+	})
+	admin := micro.NewControllerCollection()
+	admin.Error(http.StatusInternalServerError, func(ctx *micro.Context) error {
+		return ctx.WriteJSON(map[string]string{"error": "admin failure"})
+	})
+	admin.Get("/crash", func() error { return errors.New("crash") })
+	admin.Get("/reports/:id", func() error { return micro.NotFound("") })
+	api.Mount("/admin", admin)
+	app.Mount("/api", api)
+	app.Get("/pages/:id", func() error { return micro.NotFound("") })
+	get := func(path string) string {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		return fmt.Sprint(response.Code, " ", strings.TrimSpace(response.Body.String()))
+	}
+	e.Expect(get("/api/users/1")).ToBe(`404 {"error":404}`)
+	e.Expect(get("/api/admin/reports/1")).ToBe(`404 {"error":404}`)
+	e.Expect(get("/api/admin/crash")).ToBe(`500 {"error":"admin failure"}`)
+	e.Expect(get("/api/missing")).ToBe(`404 {"error":404}`)
+	e.Expect(get("/pages/1")).ToBe("404 <h1>page not found</h1>")
+	e.Expect(get("/missing")).ToBe("404 <h1>page not found</h1>")
+	e.Expect(func() { micro.NewControllerCollection().Error(302, func() {}) }).ToPanic()
+}
+
+type ModuleRepository struct{ Name string }
+
+type ModuleAuditor interface{ Audit() string }
+
+type moduleAuditor struct{ module string }
+
+func (auditor moduleAuditor) Audit() string { return "audited by " + auditor.module }
+
+func TestCollectionServices(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Injector().Register(&ModuleRepository{Name: "global"})
+	billing := micro.NewControllerCollection()
+	billing.Register(&ModuleRepository{Name: "invoices"})
+	billing.Register(moduleAuditor{module: "billing"})
+	billing.Use("/", func(ctx *micro.Context, repository *ModuleRepository, next micro.Next) {
+		ctx.Response.Header().Set("X-Repository", repository.Name)
+		next()
+	})
+	billing.Get("/invoices", func(ctx *micro.Context, repository *ModuleRepository, auditor ModuleAuditor) {
+		ctx.WriteString(repository.Name, " ", auditor.Audit())
+	})
+	refunds := micro.NewControllerCollection()
+	refunds.Register(&ModuleRepository{Name: "refunds"})
+	refunds.Get("/", func(ctx *micro.Context, repository *ModuleRepository, auditor ModuleAuditor) {
+		ctx.WriteString(repository.Name, " ", auditor.Audit())
+	})
+	billing.Mount("/refunds", refunds)
+	app.Mount("/billing", billing)
+	// routes mounted after the module do not see its services, even when called by its middlewares
+	others := micro.NewControllerCollection()
+	others.Get("/billing/export", func(ctx *micro.Context, repository *ModuleRepository) {
+		ctx.WriteString(repository.Name)
+	})
+	app.Mount("/", others)
+	app.Get("/billing/summary", func(ctx *micro.Context, repository *ModuleRepository, injector *micro.Injector) {
+		_, err := micro.Resolve[ModuleAuditor](injector)
+		ctx.WriteString(repository.Name, " ", fmt.Sprint(err != nil))
+	})
+	app.Get("/reports", func(ctx *micro.Context, repository *ModuleRepository) {
+		ctx.WriteString(repository.Name)
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		return response
+	}
+	response := get("/billing/invoices")
+	e.Expect(response.Body.String()).ToBe("invoices audited by billing")
+	e.Expect(response.Header().Get("X-Repository")).ToBe("invoices")
+	e.Expect(get("/billing/refunds").Body.String()).ToBe("refunds audited by billing")
+	e.Expect(get("/billing/summary").Body.String()).ToBe("global true")
+	response = get("/billing/export")
+	e.Expect(response.Body.String()).ToBe("global")
+	e.Expect(response.Header().Get("X-Repository")).ToBe("invoices")
+	e.Expect(get("/reports").Body.String()).ToBe("global")
+	e.Expect(func() { billing.Register(&ModuleRepository{}) }).ToPanic()
+}
+
+func TestRouteServices(t *testing.T) {
+	e := expect.New(t)
+	type Policy struct{ Resource string }
+	list := func(ctx *micro.Context, repository *ModuleRepository, policy *Policy) {
+		ctx.WriteString(policy.Resource, " from ", repository.Name)
+	}
+	app := micro.New()
+	app.Injector().Register(&ModuleRepository{Name: "global"})
+	app.Get("/users", list).With(&ModuleRepository{Name: "users"}, &Policy{Resource: "user"})
+	app.Get("/posts", list).With(&Policy{Resource: "post"})
+	admin := micro.NewControllerCollection()
+	admin.Register(&ModuleRepository{Name: "admin"})
+	admin.Register(&Policy{Resource: "admin"})
+	admin.Get("/audits", list).With(&Policy{Resource: "audit"})
+	admin.Get("/logs", list)
+	app.Mount("/admin", admin)
+	app.Get("/reports", func(ctx *micro.Context, injector *micro.Injector) {
+		_, err := micro.Resolve[*Policy](injector)
+		ctx.WriteString(fmt.Sprint(err != nil))
+	})
+	get := func(path string) string {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		return response.Body.String()
+	}
+	e.Expect(get("/users")).ToBe("user from users")
+	e.Expect(get("/posts")).ToBe("post from global")
+	e.Expect(get("/admin/audits")).ToBe("audit from admin")
+	e.Expect(get("/admin/logs")).ToBe("admin from admin")
+	e.Expect(get("/reports")).ToBe("true")
+}
+
+func TestErrorHandlerInjectsCaughtError(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Error(http.StatusInternalServerError, func(ctx *micro.Context, err error) {
+		ctx.WriteString(fmt.Sprintf("%T %v", err, err))
+	})
+	app.Get("/", func() error { return errors.New("database down") })
+	for i := 0; i < 50; i++ {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+		e.Expect(response.Body.String()).ToBe("*micro.CaughtError database down")
+	}
+}
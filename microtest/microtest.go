@@ -0,0 +1,268 @@
+// Package microtest drives micro applications in-process from tests,
+// without hand-building requests and response recorders:
+//
+//	func TestGetUser(t *testing.T) {
+//		client := microtest.NewClient(app)
+//		user := &User{}
+//		client.GET("/users/1").WithHeader("Accept", "application/json").
+//			Expect(t).Status(http.StatusOK).JSON(user)
+//	}
+//
+// Requests are served by Micro.ServeHTTP. The client keeps the cookies set by responses,
+// so sessions and flash messages carry over between requests.
+package microtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/interactiv/micro"
+)
+
+/**********************************/
+/*             CLIENT             */
+/**********************************/
+
+// Client sends requests to an application
+type Client struct {
+	app     *micro.Micro
+	header  http.Header
+	cookies map[string]*http.Cookie
+}
+
+// NewClient returns a client sending requests to app
+func NewClient(app *micro.Micro) *Client {
+	return &Client{app: app, header: http.Header{}, cookies: map[string]*http.Cookie{}}
+}
+
+// WithHeader sets a header sent with every request of the client
+func (client *Client) WithHeader(key string, value string) *Client {
+	client.header.Set(key, value)
+	return client
+}
+
+// Cookies returns the cookies the client sends
+func (client *Client) Cookies() []*http.Cookie {
+	cookies := make([]*http.Cookie, 0, len(client.cookies))
+	for _, cookie := range client.cookies {
+		cookies = append(cookies, cookie)
+	}
+	return cookies
+}
+
+// Request returns a request with method to path, which can have a query string
+func (client *Client) Request(method string, path string) *Request {
+	return &Request{client: client, method: method, path: path, header: client.header.Clone(), query: url.Values{}}
+}
+
+// GET returns a GET request to path
+func (client *Client) GET(path string) *Request { return client.Request(http.MethodGet, path) }
+
+// HEAD returns a HEAD request to path
+func (client *Client) HEAD(path string) *Request { return client.Request(http.MethodHead, path) }
+
+// POST returns a POST request to path
+func (client *Client) POST(path string) *Request { return client.Request(http.MethodPost, path) }
+
+// PUT returns a PUT request to path
+func (client *Client) PUT(path string) *Request { return client.Request(http.MethodPut, path) }
+
+// PATCH returns a PATCH request to path
+func (client *Client) PATCH(path string) *Request { return client.Request(http.MethodPatch, path) }
+
+// DELETE returns a DELETE request to path
+func (client *Client) DELETE(path string) *Request { return client.Request(http.MethodDelete, path) }
+
+// OPTIONS returns an OPTIONS request to path
+func (client *Client) OPTIONS(path string) *Request { return client.Request(http.MethodOptions, path) }
+
+// storeCookies keeps the cookies set by response, and forgets the cookies it deletes
+func (client *Client) storeCookies(response *http.Response) {
+	for _, cookie := range response.Cookies() {
+		if cookie.MaxAge < 0 || cookie.Value == "" {
+			delete(client.cookies, cookie.Name)
+		} else {
+			client.cookies[cookie.Name] = cookie
+		}
+	}
+}
+
+// WithServices overrides services of the injector of app with fakes until the returned function is called,
+// so handlers can be tested with fake repositories, clocks or mailers.
+// Fakes also replace the services of the interface types they implement:
+//
+//	defer microtest.WithServices(app, &FakeClock{Now: time.Unix(0, 0)}, &FakeMailer{})()
+//
+// It must not be used by parallel tests sharing app.
+func WithServices(app *micro.Micro, fakes ...interface{}) (restore func()) {
+	injector := app.Injector()
+	app.SetInjector(injector.Override(fakes...))
+	return func() { app.SetInjector(injector) }
+}
+
+/**********************************/
+/*            REQUEST             */
+/**********************************/
+
+// Request is a request being built
+type Request struct {
+	client *Client
+	method string
+	path   string
+	header http.Header
+	query  url.Values
+	body   []byte
+	err    error
+}
+
+// WithHeader sets a header of the request
+func (request *Request) WithHeader(key string, value string) *Request {
+	request.header.Set(key, value)
+	return request
+}
+
+// WithQuery adds a parameter to the query string of the request
+func (request *Request) WithQuery(key string, value string) *Request {
+	request.query.Add(key, value)
+	return request
+}
+
+// WithBody sets the body of the request and its Content-Type
+func (request *Request) WithBody(contentType string, body []byte) *Request {
+	request.header.Set("Content-Type", contentType)
+	request.body = body
+	return request
+}
+
+// WithJSON sets the body of the request to v encoded in JSON
+func (request *Request) WithJSON(v interface{}) *Request {
+	body, err := json.Marshal(v)
+	if err != nil {
+		request.err = err
+	}
+	return request.WithBody(micro.MediaTypes["json"], body)
+}
+
+// WithForm sets the body of the request to the url encoded form
+func (request *Request) WithForm(form url.Values) *Request {
+	return request.WithBody("application/x-www-form-urlencoded", []byte(form.Encode()))
+}
+
+// HTTPRequest returns the *http.Request sent to the application
+func (request *Request) HTTPRequest() (*http.Request, error) {
+	if request.err != nil {
+		return nil, request.err
+	}
+	target := request.path
+	if len(request.query) > 0 {
+		separator := "?"
+		if strings.Contains(target, "?") {
+			separator = "&"
+		}
+		target += separator + request.query.Encode()
+	}
+	httpRequest := httptest.NewRequest(request.method, target, bytes.NewReader(request.body))
+	httpRequest.Header = request.header.Clone()
+	for _, cookie := range request.client.cookies {
+		httpRequest.AddCookie(cookie)
+	}
+	return httpRequest, nil
+}
+
+// Do sends the request to the application and returns the response
+func (request *Request) Do() (*http.Response, error) {
+	httpRequest, err := request.HTTPRequest()
+	if err != nil {
+		return nil, err
+	}
+	recorder := httptest.NewRecorder()
+	request.client.app.ServeHTTP(recorder, httpRequest)
+	response := recorder.Result()
+	request.client.storeCookies(response)
+	return response, nil
+}
+
+// Expect sends the request to the application and returns the response to make assertions on,
+// failing t if the request cannot be sent
+func (request *Request) Expect(t testing.TB) *Response {
+	t.Helper()
+	response, err := request.Do()
+	if err != nil {
+		t.Fatalf("%s %s : %v", request.method, request.path, err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("%s %s : %v", request.method, request.path, err)
+	}
+	return &Response{Response: response, Body: body, t: t, request: request}
+}
+
+/**********************************/
+/*            RESPONSE            */
+/**********************************/
+
+// Response is a response of the application, its assertions fail the test they were created with
+type Response struct {
+	*http.Response
+	// Body is the body of the response
+	Body    []byte
+	t       testing.TB
+	request *Request
+}
+
+// Status asserts the status code of the response
+func (response *Response) Status(code int) *Response {
+	response.t.Helper()
+	if response.StatusCode != code {
+		response.t.Errorf("%s %s : expected status %d, got %d\n%s", response.request.method, response.request.path,
+			code, response.StatusCode, response.Body)
+	}
+	return response
+}
+
+// Header asserts the value of a header of the response
+func (response *Response) Header(key string, value string) *Response {
+	response.t.Helper()
+	if actual := response.Response.Header.Get(key); actual != value {
+		response.t.Errorf("%s %s : expected header %s to be %q, got %q", response.request.method, response.request.path,
+			key, value, actual)
+	}
+	return response
+}
+
+// BodyEquals asserts the body of the response
+func (response *Response) BodyEquals(body string) *Response {
+	response.t.Helper()
+	if string(response.Body) != body {
+		response.t.Errorf("%s %s : expected body %q, got %q", response.request.method, response.request.path,
+			body, response.Body)
+	}
+	return response
+}
+
+// BodyContains asserts the body of the response contains part
+func (response *Response) BodyContains(part string) *Response {
+	response.t.Helper()
+	if !strings.Contains(string(response.Body), part) {
+		response.t.Errorf("%s %s : expected body to contain %q, got %q", response.request.method, response.request.path,
+			part, response.Body)
+	}
+	return response
+}
+
+// JSON decodes the JSON body of the response into v, failing the test if it cannot be decoded
+func (response *Response) JSON(v interface{}) *Response {
+	response.t.Helper()
+	if err := json.Unmarshal(response.Body, v); err != nil {
+		response.t.Fatalf("%s %s : cannot decode the JSON body : %v\n%s", response.request.method, response.request.path,
+			err, response.Body)
+	}
+	return response
+}
@@ -0,0 +1,99 @@
+package microtest_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/interactiv/expect"
+	"github.com/interactiv/micro"
+	"github.com/interactiv/micro/microtest"
+)
+
+type User struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// failureRecorder records the failures of assertions
+type failureRecorder struct {
+	testing.TB
+	failed bool
+}
+
+func (recorder *failureRecorder) Helper() {}
+
+func (recorder *failureRecorder) Errorf(string, ...interface{}) { recorder.failed = true }
+
+func TestClient(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	app.Get("/users/:id", func(ctx *micro.Context, params micro.Params) (*User, error) {
+		id, _ := params.Int("id")
+		return &User{ID: id, Name: ctx.Request.URL.Query().Get("name") + ctx.Request.Header.Get("X-Suffix")}, nil
+	})
+	app.Post("/users", func(ctx *micro.Context) (int, *User, error) {
+		user := &User{}
+		if err := ctx.Bind(user); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusCreated, user, nil
+	})
+	app.Post("/login", func(ctx *micro.Context) {
+		ctx.Request.ParseForm()
+		http.SetCookie(ctx.Response, &http.Cookie{Name: "user", Value: ctx.Request.PostForm.Get("user")})
+	})
+	app.Get("/me", func(ctx *micro.Context) {
+		cookie, err := ctx.Request.Cookie("user")
+		if err != nil {
+			ctx.Response.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ctx.WriteString(cookie.Value)
+	})
+
+	client := microtest.NewClient(app).WithHeader("X-Suffix", "!")
+	user := &User{}
+	client.GET("/users/1").WithQuery("name", "John").WithHeader("Accept", "application/json").
+		Expect(t).Status(http.StatusOK).Header("Content-Type", "application/json").JSON(user)
+	e.Expect(user.ID).ToBe(1)
+	e.Expect(user.Name).ToBe("John!")
+
+	created := &User{}
+	client.POST("/users").WithJSON(&User{ID: 2, Name: "Jane"}).Expect(t).Status(http.StatusCreated).JSON(created)
+	e.Expect(created.Name).ToBe("Jane")
+	client.POST("/users").WithBody("text/csv", []byte("2,Jane")).Expect(t).Status(http.StatusUnsupportedMediaType)
+
+	client.GET("/me").Expect(t).Status(http.StatusUnauthorized)
+	client.POST("/login").WithForm(url.Values{"user": {"john"}}).Expect(t).Status(http.StatusOK)
+	client.GET("/me").Expect(t).Status(http.StatusOK).BodyEquals("john").BodyContains("jo")
+	e.Expect(len(client.Cookies())).ToBe(1)
+
+	recorder := &failureRecorder{}
+	response := client.GET("/missing").Expect(recorder).Status(http.StatusOK)
+	e.Expect(recorder.failed).ToBeTrue()
+	e.Expect(response.StatusCode).ToBe(http.StatusNotFound)
+}
+
+type Clock interface {
+	Now() string
+}
+
+type SystemClock struct{}
+
+func (SystemClock) Now() string { return "now" }
+
+type FakeClock struct{}
+
+func (FakeClock) Now() string { return "midnight" }
+
+func TestWithServices(t *testing.T) {
+	app := micro.New()
+	app.Injector().RegisterAs(SystemClock{}, (*Clock)(nil))
+	app.Get("/time", func(ctx *micro.Context, clock Clock) { ctx.WriteString(clock.Now()) })
+	client := microtest.NewClient(app)
+	restore := microtest.WithServices(app, FakeClock{})
+	client.GET("/time").Expect(t).BodyEquals("midnight")
+	restore()
+	client.GET("/time").Expect(t).BodyEquals("now")
+}
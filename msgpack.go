@@ -0,0 +1,671 @@
+package micro
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+/**********************************/
+/*           MESSAGEPACK          */
+/**********************************/
+
+var (
+	// MsgPackMaxLength is the maximum length of the values read by MsgPackDecoder, in bytes for strings
+	// and binary values, in elements for arrays and maps
+	MsgPackMaxLength = 1 << 20
+	// MsgPackMaxDepth is the maximum nesting depth of the arrays and maps read by MsgPackDecoder
+	MsgPackMaxDepth = 100
+)
+
+// msgPackChunk is the capacity decoded arrays, maps and strings are allocated with, they grow as their
+// elements are read so a length announced on the wire does not allocate memory the input does not hold
+const msgPackChunk = 1024
+
+// MsgPackEncoder writes MessagePack values to an output stream.
+//
+// Structs are encoded as maps keyed by field name, the "msgpack" struct tag
+// can be used to rename ("name"), omit when empty ("name,omitempty") or skip ("-") a field.
+// Values implementing encoding.TextMarshaler (time.Time for instance) are encoded as strings.
+type MsgPackEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewMsgPackEncoder returns a new MsgPackEncoder that writes to w
+func NewMsgPackEncoder(w io.Writer) *MsgPackEncoder {
+	return &MsgPackEncoder{w: w}
+}
+
+// Encode writes the MessagePack encoding of v to the stream
+func (enc *MsgPackEncoder) Encode(v interface{}) error {
+	enc.buf = enc.buf[:0]
+	if err := enc.encode(reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := enc.w.Write(enc.buf)
+	return err
+}
+
+func (enc *MsgPackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		enc.buf = append(enc.buf, 0xc0)
+		return nil
+	}
+	if v.Kind() != reflect.Ptr || !v.IsNil() {
+		if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+			text, err := marshaler.MarshalText()
+			if err != nil {
+				return err
+			}
+			enc.writeString(string(text))
+			return nil
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			enc.buf = append(enc.buf, 0xc0)
+			return nil
+		}
+		return enc.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			enc.buf = append(enc.buf, 0xc3)
+		} else {
+			enc.buf = append(enc.buf, 0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		enc.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		enc.writeUint(v.Uint())
+	case reflect.Float32:
+		enc.buf = append(enc.buf, 0xca)
+		enc.buf = binary.BigEndian.AppendUint32(enc.buf, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		enc.buf = append(enc.buf, 0xcb)
+		enc.buf = binary.BigEndian.AppendUint64(enc.buf, math.Float64bits(v.Float()))
+	case reflect.String:
+		enc.writeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			enc.buf = append(enc.buf, 0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			enc.writeBinary(v.Bytes())
+			return nil
+		}
+		return enc.encodeArray(v)
+	case reflect.Array:
+		return enc.encodeArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			enc.buf = append(enc.buf, 0xc0)
+			return nil
+		}
+		enc.writeHeader(v.Len(), 0x80, 16, 0xde, 0xdf)
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := enc.encode(iter.Key()); err != nil {
+				return err
+			}
+			if err := enc.encode(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := msgPackFields(v.Type())
+		values := make([]reflect.Value, 0, len(fields))
+		names := make([]string, 0, len(fields))
+		for _, field := range fields {
+			value := v.Field(field.index)
+			if field.omitEmpty && value.IsZero() {
+				continue
+			}
+			names = append(names, field.name)
+			values = append(values, value)
+		}
+		enc.writeHeader(len(values), 0x80, 16, 0xde, 0xdf)
+		for i, value := range values {
+			enc.writeString(names[i])
+			if err := enc.encode(value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+func (enc *MsgPackEncoder) encodeArray(v reflect.Value) error {
+	enc.writeHeader(v.Len(), 0x90, 16, 0xdc, 0xdd)
+	for i := 0; i < v.Len(); i++ {
+		if err := enc.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHeader writes the header of a map or an array of length n
+func (enc *MsgPackEncoder) writeHeader(n int, fix byte, fixLimit int, code16 byte, code32 byte) {
+	switch {
+	case n < fixLimit:
+		enc.buf = append(enc.buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		enc.buf = append(enc.buf, code16)
+		enc.buf = binary.BigEndian.AppendUint16(enc.buf, uint16(n))
+	default:
+		enc.buf = append(enc.buf, code32)
+		enc.buf = binary.BigEndian.AppendUint32(enc.buf, uint32(n))
+	}
+}
+
+func (enc *MsgPackEncoder) writeString(s string) {
+	switch n := len(s); {
+	case n < 32:
+		enc.buf = append(enc.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		enc.buf = append(enc.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		enc.buf = append(enc.buf, 0xda)
+		enc.buf = binary.BigEndian.AppendUint16(enc.buf, uint16(n))
+	default:
+		enc.buf = append(enc.buf, 0xdb)
+		enc.buf = binary.BigEndian.AppendUint32(enc.buf, uint32(n))
+	}
+	enc.buf = append(enc.buf, s...)
+}
+
+func (enc *MsgPackEncoder) writeBinary(b []byte) {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		enc.buf = append(enc.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		enc.buf = append(enc.buf, 0xc5)
+		enc.buf = binary.BigEndian.AppendUint16(enc.buf, uint16(n))
+	default:
+		enc.buf = append(enc.buf, 0xc6)
+		enc.buf = binary.BigEndian.AppendUint32(enc.buf, uint32(n))
+	}
+	enc.buf = append(enc.buf, b...)
+}
+
+func (enc *MsgPackEncoder) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		enc.writeUint(uint64(i))
+	case i >= -32:
+		enc.buf = append(enc.buf, byte(i))
+	case i >= math.MinInt8:
+		enc.buf = append(enc.buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		enc.buf = append(enc.buf, 0xd1)
+		enc.buf = binary.BigEndian.AppendUint16(enc.buf, uint16(i))
+	case i >= math.MinInt32:
+		enc.buf = append(enc.buf, 0xd2)
+		enc.buf = binary.BigEndian.AppendUint32(enc.buf, uint32(i))
+	default:
+		enc.buf = append(enc.buf, 0xd3)
+		enc.buf = binary.BigEndian.AppendUint64(enc.buf, uint64(i))
+	}
+}
+
+func (enc *MsgPackEncoder) writeUint(u uint64) {
+	switch {
+	case u <= 127:
+		enc.buf = append(enc.buf, byte(u))
+	case u <= math.MaxUint8:
+		enc.buf = append(enc.buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		enc.buf = append(enc.buf, 0xcd)
+		enc.buf = binary.BigEndian.AppendUint16(enc.buf, uint16(u))
+	case u <= math.MaxUint32:
+		enc.buf = append(enc.buf, 0xce)
+		enc.buf = binary.BigEndian.AppendUint32(enc.buf, uint32(u))
+	default:
+		enc.buf = append(enc.buf, 0xcf)
+		enc.buf = binary.BigEndian.AppendUint64(enc.buf, u)
+	}
+}
+
+// MsgPackDecoder reads MessagePack values from an input stream.
+//
+// When decoding into an empty interface, maps with string keys become
+// map[string]interface{}, other maps map[interface{}]interface{},
+// signed integers int64, unsigned integers uint64 and arrays []interface{}.
+// Values longer than MsgPackMaxLength or nested deeper than MsgPackMaxDepth are rejected.
+type MsgPackDecoder struct {
+	r     io.ByteReader
+	depth int
+}
+
+// NewMsgPackDecoder returns a new MsgPackDecoder that reads from r
+func NewMsgPackDecoder(r io.Reader) *MsgPackDecoder {
+	byteReader, ok := r.(io.ByteReader)
+	if !ok {
+		byteReader = bufio.NewReader(r)
+	}
+	return &MsgPackDecoder{r: byteReader}
+}
+
+// Decode reads the next MessagePack value from the stream and stores it in v,
+// which must be a non nil pointer. Extension types are not supported.
+func (dec *MsgPackDecoder) Decode(v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return fmt.Errorf("msgpack: Decode expects a non nil pointer, got %T", v)
+	}
+	return dec.decode(value.Elem())
+}
+
+func (dec *MsgPackDecoder) decode(v reflect.Value) error {
+	if dec.depth >= MsgPackMaxDepth {
+		return fmt.Errorf("msgpack: values nested deeper than %d", MsgPackMaxDepth)
+	}
+	code, err := dec.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	dec.depth++
+	defer func() { dec.depth-- }()
+	return dec.decodeWithCode(code, v)
+}
+
+func (dec *MsgPackDecoder) decodeWithCode(code byte, v reflect.Value) error {
+	if code == 0xc0 {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return dec.decodeWithCode(code, v.Elem())
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		generic, err := dec.decodeGeneric(code)
+		if err != nil {
+			return err
+		}
+		if generic == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(generic))
+		}
+		return nil
+	}
+	switch {
+	case code <= 0x7f, code >= 0xe0, code >= 0xcc && code <= 0xd3, code == 0xca, code == 0xcb:
+		return dec.decodeNumber(code, v)
+	case code >= 0xa0 && code <= 0xbf, code >= 0xd9 && code <= 0xdb, code >= 0xc4 && code <= 0xc6:
+		data, err := dec.readBytes(code)
+		if err != nil {
+			return err
+		}
+		if v.CanAddr() {
+			if unmarshaler, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+				return unmarshaler.UnmarshalText(data)
+			}
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(data))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(data)
+		default:
+			return fmt.Errorf("msgpack: cannot decode string into %v", v.Type())
+		}
+	case code == 0xc2, code == 0xc3:
+		if v.Kind() != reflect.Bool {
+			return fmt.Errorf("msgpack: cannot decode bool into %v", v.Type())
+		}
+		v.SetBool(code == 0xc3)
+	case code >= 0x90 && code <= 0x9f, code == 0xdc, code == 0xdd:
+		n, err := dec.readLength(code, 0x90)
+		if err != nil {
+			return err
+		}
+		switch v.Kind() {
+		case reflect.Slice:
+			slice := reflect.MakeSlice(v.Type(), 0, min(n, msgPackChunk))
+			for i := 0; i < n; i++ {
+				element := reflect.New(v.Type().Elem()).Elem()
+				if err := dec.decode(element); err != nil {
+					return err
+				}
+				slice = reflect.Append(slice, element)
+			}
+			v.Set(slice)
+		case reflect.Array:
+			if v.Len() < n {
+				return fmt.Errorf("msgpack: array of length %d does not fit into %v", n, v.Type())
+			}
+			for i := 0; i < n; i++ {
+				if err := dec.decode(v.Index(i)); err != nil {
+					return err
+				}
+			}
+			// elements past the decoded length are zeroed, as encoding/json does
+			for i := n; i < v.Len(); i++ {
+				v.Index(i).SetZero()
+			}
+		default:
+			return fmt.Errorf("msgpack: cannot decode array into %v", v.Type())
+		}
+	case code >= 0x80 && code <= 0x8f, code == 0xde, code == 0xdf:
+		n, err := dec.readLength(code, 0x80)
+		if err != nil {
+			return err
+		}
+		return dec.decodeMap(n, v)
+	default:
+		return fmt.Errorf("msgpack: unsupported type code 0x%x", code)
+	}
+	return nil
+}
+
+func (dec *MsgPackDecoder) decodeMap(n int, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), min(n, msgPackChunk)))
+		}
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := dec.decode(key); err != nil {
+				return err
+			}
+			if key.Kind() == reflect.Interface && !key.IsNil() && !key.Elem().Type().Comparable() {
+				return fmt.Errorf("msgpack: map key of type %v is not comparable", key.Elem().Type())
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := dec.decode(value); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		fields := msgPackFields(v.Type())
+		for i := 0; i < n; i++ {
+			var key string
+			if err := dec.decode(reflect.ValueOf(&key).Elem()); err != nil {
+				return err
+			}
+			index := -1
+			for _, field := range fields {
+				if field.name == key {
+					index = field.index
+					break
+				}
+			}
+			if index == -1 {
+				var discard interface{}
+				if err := dec.decode(reflect.ValueOf(&discard).Elem()); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := dec.decode(v.Field(index)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: cannot decode map into %v", v.Type())
+	}
+	return nil
+}
+
+func (dec *MsgPackDecoder) decodeNumber(code byte, v reflect.Value) error {
+	var (
+		i       int64
+		u       uint64
+		f       float64
+		kind    = reflect.Int64
+		payload uint64
+		err     error
+	)
+	switch {
+	case code <= 0x7f:
+		i = int64(code)
+	case code >= 0xe0:
+		i = int64(int8(code))
+	case code == 0xca:
+		payload, err = dec.readUint(4)
+		f, kind = float64(math.Float32frombits(uint32(payload))), reflect.Float64
+	case code == 0xcb:
+		payload, err = dec.readUint(8)
+		f, kind = math.Float64frombits(payload), reflect.Float64
+	case code >= 0xcc && code <= 0xcf:
+		u, err = dec.readUint(1 << (code - 0xcc))
+		kind = reflect.Uint64
+	default:
+		payload, err = dec.readUint(1 << (code - 0xd0))
+		switch code {
+		case 0xd0:
+			i = int64(int8(payload))
+		case 0xd1:
+			i = int64(int16(payload))
+		case 0xd2:
+			i = int64(int32(payload))
+		default:
+			i = int64(payload)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch kind {
+		case reflect.Uint64:
+			if u > math.MaxInt64 {
+				return fmt.Errorf("msgpack: %d overflows %v", u, v.Type())
+			}
+			i = int64(u)
+		case reflect.Float64:
+			return fmt.Errorf("msgpack: cannot decode float into %v", v.Type())
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("msgpack: %d overflows %v", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch kind {
+		case reflect.Int64:
+			if i < 0 {
+				return fmt.Errorf("msgpack: %d overflows %v", i, v.Type())
+			}
+			u = uint64(i)
+		case reflect.Float64:
+			return fmt.Errorf("msgpack: cannot decode float into %v", v.Type())
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("msgpack: %d overflows %v", u, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch kind {
+		case reflect.Int64:
+			f = float64(i)
+		case reflect.Uint64:
+			f = float64(u)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("msgpack: cannot decode number into %v", v.Type())
+	}
+	return nil
+}
+
+// decodeGeneric decodes the value starting with code into its default Go representation
+func (dec *MsgPackDecoder) decodeGeneric(code byte) (interface{}, error) {
+	switch {
+	case code == 0xc0:
+		return nil, nil
+	case code == 0xc2, code == 0xc3:
+		return code == 0xc3, nil
+	case code == 0xca, code == 0xcb:
+		var f float64
+		err := dec.decodeNumber(code, reflect.ValueOf(&f).Elem())
+		return f, err
+	case code >= 0xcc && code <= 0xcf:
+		var u uint64
+		err := dec.decodeNumber(code, reflect.ValueOf(&u).Elem())
+		return u, err
+	case code <= 0x7f, code >= 0xe0, code >= 0xd0 && code <= 0xd3:
+		var i int64
+		err := dec.decodeNumber(code, reflect.ValueOf(&i).Elem())
+		return i, err
+	case code >= 0xa0 && code <= 0xbf, code >= 0xd9 && code <= 0xdb:
+		data, err := dec.readBytes(code)
+		return string(data), err
+	case code >= 0xc4 && code <= 0xc6:
+		return dec.readBytes(code)
+	case code >= 0x90 && code <= 0x9f, code == 0xdc, code == 0xdd:
+		var array []interface{}
+		err := dec.decodeWithCode(code, reflect.ValueOf(&array).Elem())
+		return array, err
+	case code >= 0x80 && code <= 0x8f, code == 0xde, code == 0xdf:
+		n, err := dec.readLength(code, 0x80)
+		if err != nil {
+			return nil, err
+		}
+		keys, values := make([]interface{}, 0, min(n, msgPackChunk)), make([]interface{}, 0, min(n, msgPackChunk))
+		stringKeys := true
+		for i := 0; i < n; i++ {
+			var key, value interface{}
+			if err := dec.decode(reflect.ValueOf(&key).Elem()); err != nil {
+				return nil, err
+			}
+			if _, ok := key.(string); !ok {
+				stringKeys = false
+				if key != nil && !reflect.TypeOf(key).Comparable() {
+					return nil, fmt.Errorf("msgpack: map key of type %T is not comparable", key)
+				}
+			}
+			if err := dec.decode(reflect.ValueOf(&value).Elem()); err != nil {
+				return nil, err
+			}
+			keys, values = append(keys, key), append(values, value)
+		}
+		if stringKeys {
+			m := make(map[string]interface{}, len(keys))
+			for i, key := range keys {
+				m[key.(string)] = values[i]
+			}
+			return m, nil
+		}
+		m := make(map[interface{}]interface{}, len(keys))
+		for i, key := range keys {
+			m[key] = values[i]
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type code 0x%x", code)
+}
+
+// readLength reads the length of a map or an array, which cannot exceed MsgPackMaxLength
+func (dec *MsgPackDecoder) readLength(code byte, fix byte) (int, error) {
+	var (
+		n   uint64
+		err error
+	)
+	switch code {
+	case 0xdc, 0xde:
+		n, err = dec.readUint(2)
+	case 0xdd, 0xdf:
+		n, err = dec.readUint(4)
+	default:
+		n = uint64(code - fix)
+	}
+	if err == nil && n > uint64(MsgPackMaxLength) {
+		err = fmt.Errorf("msgpack: length %d exceeds the maximum length %d", n, MsgPackMaxLength)
+	}
+	return int(n), err
+}
+
+// readBytes reads the payload of a string or a binary value
+func (dec *MsgPackDecoder) readBytes(code byte) ([]byte, error) {
+	var (
+		n   uint64
+		err error
+	)
+	switch {
+	case code >= 0xa0 && code <= 0xbf:
+		n = uint64(code - 0xa0)
+	case code == 0xd9, code == 0xc4:
+		n, err = dec.readUint(1)
+	case code == 0xda, code == 0xc5:
+		n, err = dec.readUint(2)
+	default:
+		n, err = dec.readUint(4)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(MsgPackMaxLength) {
+		return nil, fmt.Errorf("msgpack: length %d exceeds the maximum length %d", n, MsgPackMaxLength)
+	}
+	data := make([]byte, 0, min(int(n), msgPackChunk))
+	for i := uint64(0); i < n; i++ {
+		b, err := dec.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		data = append(data, b)
+	}
+	return data, nil
+}
+
+// readUint reads a big endian unsigned integer of size bytes
+func (dec *MsgPackDecoder) readUint(size int) (uint64, error) {
+	var u uint64
+	for i := 0; i < size; i++ {
+		b, err := dec.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		u = u<<8 | uint64(b)
+	}
+	return u, nil
+}
+
+type msgPackField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// msgPackFields returns the encodable fields of a struct type
+func msgPackFields(t reflect.Type) []msgPackField {
+	fields := []msgPackField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("msgpack"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, msgPackField{name: name, index: i, omitEmpty: options == "omitempty"})
+	}
+	return fields
+}
@@ -0,0 +1,276 @@
+package micro
+
+import (
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**********************************/
+/*      CONTENT NEGOTIATION       */
+/**********************************/
+
+// MediaTypes is the content negotiation table.
+// It maps a format name to the media type written in responses
+// and matched against the Accept header of requests.
+var MediaTypes = map[string]string{
+	"json":    "application/json",
+	"xml":     "text/xml",
+	"jsonp":   "application/x-javascript",
+	"msgpack": "application/msgpack",
+	"csv":     "text/csv",
+	"html":    "text/html",
+	"text":    "text/plain",
+	"problem": ProblemMediaType,
+}
+
+// defaultFormats are the formats negotiated when none are given to Negotiate
+var defaultFormats = []string{"json", "xml", "msgpack"}
+
+// qualityValue is an entry of a header using quality values
+// like Accept or Accept-Language
+type qualityValue struct {
+	value   string
+	quality float64
+}
+
+// parseQualityValues parses a header such as "text/html;q=0.9, */*;q=0.1"
+// and returns its values sorted by descending quality.
+func parseQualityValues(header string) []qualityValue {
+	values := []qualityValue{}
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(part, ";")
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, q, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.TrimSpace(key) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(q), 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+		values = append(values, qualityValue{value: value, quality: quality})
+	}
+	sort.SliceStable(values, func(i, j int) bool { return values[i].quality > values[j].quality })
+	return values
+}
+
+// mediaTypeQuality returns the quality the accepted values give to mediaType,
+// the most specific matching range wins. It returns -1 if mediaType is not accepted.
+func mediaTypeQuality(accepted []qualityValue, mediaType string) float64 {
+	mediaType = strings.ToLower(mediaType)
+	quality, specificity := -1.0, -1
+	for _, accept := range accepted {
+		var s int
+		value := strings.ToLower(accept.value)
+		switch {
+		case value == mediaType:
+			s = 2
+		case strings.HasSuffix(value, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(value, "*")):
+			s = 1
+		case value == "*/*" || value == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			quality, specificity = accept.quality, s
+		}
+	}
+	return quality
+}
+
+// Negotiate returns the format of the MediaTypes table the client prefers
+// among formats, according to the Accept header of the request.
+// If no format is given, json, xml and msgpack are negotiated.
+// It returns the first format when the request has no Accept header
+// and an empty string when none of the formats is acceptable.
+func (ctx *Context) Negotiate(formats ...string) string {
+	if len(formats) == 0 {
+		formats = defaultFormats
+	}
+	if i := ctx.negotiate(formatMediaTypes(formats)); i >= 0 {
+		return formats[i]
+	}
+	return ""
+}
+
+// negotiate returns the index of the media type the client prefers among mediaTypes,
+// 0 when the request has no Accept header and -1 when none of them is acceptable
+func (ctx *Context) negotiate(mediaTypes []string) int {
+	header := ""
+	if ctx.Request != nil {
+		header = ctx.Request.Header.Get("Accept")
+	}
+	if strings.TrimSpace(header) == "" {
+		return 0
+	}
+	accepted := parseQualityValues(header)
+	best, bestQuality := -1, 0.0
+	for i, mediaType := range mediaTypes {
+		if quality := mediaTypeQuality(accepted, mediaType); quality > bestQuality {
+			best, bestQuality = i, quality
+		}
+	}
+	return best
+}
+
+// Respond writes v with the status code in the format the client prefers among json, xml and msgpack,
+// see Negotiate. It sends a 406 Not Acceptable error if the client accepts none of them,
+// and only writes the status code if v is nil. Within an error handler, v is written as json
+// when the client accepts none of the formats, so the 406 error does not run the handler again.
+func (ctx *Context) Respond(code int, v interface{}) error {
+	if v == nil {
+		ctx.Response.WriteHeader(code)
+		return nil
+	}
+	format := ctx.Negotiate()
+	if format == "" && ctx.renderingError() {
+		format = defaultFormats[0]
+	} else if format == "" {
+		err := NotAcceptable(formatMediaTypes(defaultFormats), ctx.Request.Header.Get("Accept"))
+		ctx.sendError(err.Code, err.Message, err)
+		return nil
+	}
+	ctx.Response.Header().Set("Content-Type", MediaTypes[format])
+	ctx.Response.WriteHeader(code)
+	switch format {
+	case "xml":
+		return xml.NewEncoder(ctx.Response).Encode(v)
+	case "msgpack":
+		return NewMsgPackEncoder(ctx.Response).Encode(v)
+	}
+	return ctx.encodeJSON(v)
+}
+
+// renderingError returns true while an error handler writes the response
+func (ctx *Context) renderingError() bool {
+	rw, ok := ctx.Response.(*ResponseWriterWithCode)
+	return ok && rw.errorCode != 0
+}
+
+// MediaTypeDetails are the details of 406 Not Acceptable and 415 Unsupported Media Type errors
+type MediaTypeDetails struct {
+	// Offered are the media types the server can produce or consume
+	Offered []string `json:"offered" xml:"offered" msgpack:"offered"`
+	// Requested is the Accept header or the media type of the request
+	Requested string `json:"requested" xml:"requested" msgpack:"requested"`
+}
+
+// NotAcceptable returns a 406 HTTPError detailing the offered media types and the Accept header
+func NotAcceptable(offered []string, accept string) *HTTPError {
+	return NewHTTPError(http.StatusNotAcceptable, "").WithDetails(MediaTypeDetails{Offered: offered, Requested: accept})
+}
+
+// UnsupportedMediaType returns a 415 HTTPError detailing the offered media types and the media type of the request
+func UnsupportedMediaType(offered []string, mediaType string) *HTTPError {
+	return NewHTTPError(http.StatusUnsupportedMediaType, "").WithDetails(MediaTypeDetails{Offered: offered, Requested: mediaType})
+}
+
+// formatMediaTypes returns the media types of formats
+func formatMediaTypes(formats []string) []string {
+	mediaTypes := make([]string, 0, len(formats))
+	for _, format := range formats {
+		mediaTypes = append(mediaTypes, MediaTypes[format])
+	}
+	return mediaTypes
+}
+
+// requestMediaType returns the media type of the request body without parameters
+func requestMediaType(request *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// mediaTypeMatches returns true if mediaType matches pattern, which can be a range like "text/*"
+func mediaTypeMatches(pattern string, mediaType string) bool {
+	pattern, mediaType = strings.ToLower(pattern), strings.ToLower(mediaType)
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	return strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))
+}
+
+// Bind decodes the request body into v according to its Content-Type,
+// which can be the media type of json, xml or msgpack.
+// It returns a 415 Unsupported Media Type HTTPError for other media types,
+// handlers returning it have the 415 error handler called:
+//
+//	app.Post("/users", func(ctx *micro.Context) (int, *User, error) {
+//		user := &User{}
+//		if err := ctx.Bind(user); err != nil {
+//			return 0, nil, err
+//		}
+//		return http.StatusCreated, user, nil
+//	})
+func (ctx *Context) Bind(v interface{}) error {
+	switch mediaType := requestMediaType(ctx.Request); mediaType {
+	case MediaTypes["json"]:
+		return ctx.ReadJSON(v)
+	case MediaTypes["xml"], "application/xml":
+		return ctx.ReadXML(v)
+	case MediaTypes["msgpack"]:
+		return ctx.ReadMsgPack(v)
+	default:
+		return UnsupportedMediaType(formatMediaTypes(defaultFormats), mediaType)
+	}
+}
+
+// AcceptedLanguages returns the languages of the Accept-Language header of the request,
+// sorted by descending preference. Languages with a zero quality and the wildcard are omitted.
+func (ctx *Context) AcceptedLanguages() []string {
+	languages := []string{}
+	if ctx.Request == nil {
+		return languages
+	}
+	for _, language := range parseQualityValues(ctx.Request.Header.Get("Accept-Language")) {
+		if language.quality > 0 && language.value != "*" {
+			languages = append(languages, language.value)
+		}
+	}
+	return languages
+}
+
+// NegotiateLanguage returns the language the client prefers among supported.
+// An accepted language matches a supported language with the same tag,
+// or sharing the same primary language ("en-US" matches "en" and "en" matches "en-GB").
+// The first supported language is returned when none is acceptable.
+func (ctx *Context) NegotiateLanguage(supported ...string) string {
+	if len(supported) == 0 {
+		return ""
+	}
+	accepted := []qualityValue{}
+	if ctx.Request != nil {
+		accepted = parseQualityValues(ctx.Request.Header.Get("Accept-Language"))
+	}
+	for _, language := range accepted {
+		if language.quality <= 0 {
+			continue
+		}
+		if language.value == "*" {
+			return supported[0]
+		}
+		for _, candidate := range supported {
+			if strings.EqualFold(candidate, language.value) {
+				return candidate
+			}
+		}
+		primary, _, _ := strings.Cut(language.value, "-")
+		for _, candidate := range supported {
+			if candidatePrimary, _, _ := strings.Cut(candidate, "-"); strings.EqualFold(candidatePrimary, primary) {
+				return candidate
+			}
+		}
+	}
+	return supported[0]
+}
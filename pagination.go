@@ -0,0 +1,223 @@
+package micro
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/**********************************/
+/*           PAGINATION           */
+/**********************************/
+
+// PaginationDefaults configures the pagination of a list endpoint
+type PaginationDefaults struct {
+	// PerPage is the number of items of a page when the client does not choose it, 20 if zero
+	PerPage int
+	// MaxPerPage is the maximum number of items of a page, 100 if zero
+	MaxPerPage int
+	// PageParam is the query parameter of the page number, page if empty
+	PageParam string
+	// PerPageParam is the query parameter of the number of items of a page, per_page if empty
+	PerPageParam string
+	// CursorParam is the query parameter of the cursor of cursor based pagination, cursor if empty
+	CursorParam string
+}
+
+// Pagination is the page of a list a request asks for, either by page number or by cursor
+type Pagination struct {
+	// Page is the page number, starting at 1, when the request has no cursor
+	Page int
+	// PerPage is the number of items of the page
+	PerPage int
+	// Cursor is the cursor of the page, empty for page number pagination.
+	// Cursors are opaque to clients, such as the encoded key of the last item of the previous page.
+	Cursor string
+	// Total is the total number of items, negative if unknown, see SetTotal
+	Total int
+	// NextCursor is the cursor of the next page, empty on the last page
+	NextCursor string
+	// HasMore is true if there is a next page, when the total is unknown
+	HasMore bool
+
+	ctx      *Context
+	defaults PaginationDefaults
+}
+
+// PaginationMeta is the meta data of a paginated response
+type PaginationMeta struct {
+	Page       int    `json:"page,omitempty"`
+	PerPage    int    `json:"per_page"`
+	Total      *int   `json:"total,omitempty"`
+	TotalPages *int   `json:"total_pages,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// PaginatedResponse is the envelope of paginated json responses
+type PaginatedResponse struct {
+	Data interface{}    `json:"data"`
+	Meta PaginationMeta `json:"meta"`
+}
+
+// Paginate parses the pagination parameters of the request, page and per_page or cursor and per_page.
+// Invalid parameters, such as a page below 1, a page whose offset overflows or more items than MaxPerPage,
+// are returned as a 400 Bad Request HTTPError:
+//
+//	app.Get("/users", func(ctx *micro.Context, users *UserRepository) error {
+//		page, err := micro.Paginate(ctx, micro.PaginationDefaults{PerPage: 50})
+//		if err != nil {
+//			return err
+//		}
+//		list, total, err := users.List(page.Offset(), page.PerPage)
+//		if err != nil {
+//			return err
+//		}
+//		page.SetTotal(total)
+//		return page.WriteJSON(list)
+//	})
+func Paginate(ctx *Context, defaults PaginationDefaults) (*Pagination, error) {
+	if defaults.PerPage <= 0 {
+		defaults.PerPage = 20
+	}
+	if defaults.MaxPerPage <= 0 {
+		defaults.MaxPerPage = 100
+	}
+	if defaults.PageParam == "" {
+		defaults.PageParam = "page"
+	}
+	if defaults.PerPageParam == "" {
+		defaults.PerPageParam = "per_page"
+	}
+	if defaults.CursorParam == "" {
+		defaults.CursorParam = "cursor"
+	}
+	query := ctx.Request.URL.Query()
+	pagination := &Pagination{PerPage: defaults.PerPage, Total: -1, ctx: ctx, defaults: defaults}
+	if value := query.Get(defaults.PerPageParam); value != "" {
+		perPage, err := strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > defaults.MaxPerPage {
+			return nil, BadRequest(fmt.Sprintf("%s must be a number between 1 and %d", defaults.PerPageParam, defaults.MaxPerPage))
+		}
+		pagination.PerPage = perPage
+	}
+	if pagination.Cursor = query.Get(defaults.CursorParam); pagination.Cursor != "" {
+		return pagination, nil
+	}
+	pagination.Page = 1
+	if value := query.Get(defaults.PageParam); value != "" {
+		page, err := strconv.Atoi(value)
+		// the offset of the page must not overflow
+		if err != nil || page < 1 || page-1 > math.MaxInt/pagination.PerPage {
+			return nil, BadRequest(fmt.Sprintf("%s must be a number between 1 and %d", defaults.PageParam, math.MaxInt/pagination.PerPage+1))
+		}
+		pagination.Page = page
+	}
+	return pagination, nil
+}
+
+// Offset returns the number of items before the page, for page number pagination
+func (pagination *Pagination) Offset() int {
+	if pagination.Page < 1 {
+		return 0
+	}
+	return (pagination.Page - 1) * pagination.PerPage
+}
+
+// SetTotal sets the total number of items
+func (pagination *Pagination) SetTotal(total int) {
+	pagination.Total = total
+}
+
+// TotalPages returns the number of pages, -1 if the total is unknown
+func (pagination *Pagination) TotalPages() int {
+	if pagination.Total < 0 {
+		return -1
+	}
+	if pagination.Total == 0 {
+		return 1
+	}
+	return (pagination.Total + pagination.PerPage - 1) / pagination.PerPage
+}
+
+// hasNext returns true if there is a page after the page
+func (pagination *Pagination) hasNext() bool {
+	if pagination.Cursor != "" || pagination.NextCursor != "" {
+		return pagination.NextCursor != ""
+	}
+	if pagination.Total >= 0 {
+		return pagination.Page < pagination.TotalPages()
+	}
+	return pagination.HasMore
+}
+
+// Meta returns the meta data of the page
+func (pagination *Pagination) Meta() PaginationMeta {
+	meta := PaginationMeta{Page: pagination.Page, PerPage: pagination.PerPage, NextCursor: pagination.NextCursor}
+	if pagination.Total >= 0 {
+		total, totalPages := pagination.Total, pagination.TotalPages()
+		meta.Total, meta.TotalPages = &total, &totalPages
+	}
+	return meta
+}
+
+// Links returns the RFC 5988 Link header value of the first, previous, next and last pages,
+// the links the page has: the previous and last pages are only linked for page number pagination,
+// the last page when the total is known.
+func (pagination *Pagination) Links() string {
+	links := []string{pagination.link("first", pagination.pageQuery(1))}
+	if pagination.Cursor == "" && pagination.Page > 1 {
+		links = append(links, pagination.link("prev", pagination.pageQuery(pagination.Page-1)))
+	}
+	if pagination.hasNext() {
+		if pagination.NextCursor != "" {
+			links = append(links, pagination.link("next", pagination.cursorQuery(pagination.NextCursor)))
+		} else {
+			links = append(links, pagination.link("next", pagination.pageQuery(pagination.Page+1)))
+		}
+	}
+	if pagination.Cursor == "" && pagination.NextCursor == "" && pagination.Total >= 0 {
+		links = append(links, pagination.link("last", pagination.pageQuery(pagination.TotalPages())))
+	}
+	return strings.Join(links, ", ")
+}
+
+// pageQuery returns the query of the request for the page number page
+func (pagination *Pagination) pageQuery(page int) url.Values {
+	query := pagination.ctx.Request.URL.Query()
+	query.Del(pagination.defaults.CursorParam)
+	if page > 1 {
+		query.Set(pagination.defaults.PageParam, strconv.Itoa(page))
+	} else {
+		query.Del(pagination.defaults.PageParam)
+	}
+	return query
+}
+
+// cursorQuery returns the query of the request for the page of cursor
+func (pagination *Pagination) cursorQuery(cursor string) url.Values {
+	query := pagination.ctx.Request.URL.Query()
+	query.Del(pagination.defaults.PageParam)
+	query.Set(pagination.defaults.CursorParam, cursor)
+	return query
+}
+
+// link returns a link of relation rel to the request URL with query
+func (pagination *Pagination) link(rel string, query url.Values) string {
+	target := *pagination.ctx.Request.URL
+	target.RawQuery = query.Encode()
+	return fmt.Sprintf(`<%s>; rel="%s"`, target.RequestURI(), rel)
+}
+
+// SetLinkHeader sets the Link header of the response to the links of the page
+func (pagination *Pagination) SetLinkHeader() {
+	pagination.ctx.Response.Header().Set("Link", pagination.Links())
+}
+
+// WriteJSON writes data in a PaginatedResponse envelope, with the meta data of the page,
+// and sets the Link header of the response
+func (pagination *Pagination) WriteJSON(data interface{}) error {
+	pagination.SetLinkHeader()
+	return pagination.ctx.WriteJSON(PaginatedResponse{Data: data, Meta: pagination.Meta()})
+}
@@ -0,0 +1,119 @@
+package micro
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+/**********************************/
+/*             PARAMS             */
+/**********************************/
+
+// Params are the route parameters of the request, handlers can have them injected:
+//
+//	app.Get("/users/:id", func(ctx *micro.Context, params micro.Params) {
+//		ctx.WriteString(params["id"])
+//	})
+//
+// Route parameters can also be bound to the fields of a struct embedding In
+// with a param tag, they are converted to the type of the field:
+//
+//	type UserParams struct {
+//		micro.In
+//		ID int `param:"id"`
+//	}
+//
+//	app.Get("/users/:id", func(ctx *micro.Context, params UserParams) {})
+//
+// A request whose parameters cannot be converted is answered with a 400 Bad Request.
+type Params map[string]string
+
+// Int returns the parameter name converted to an int
+func (params Params) Int(name string) (int, error) {
+	value, err := convertString(params[name], reflect.TypeOf(0))
+	if err != nil {
+		return 0, &ParamError{Name: name, Value: params[name], Type: reflect.TypeOf(0), Err: err}
+	}
+	return int(value.Int()), nil
+}
+
+// ParamError is returned when a parameter cannot be converted to the type it is bound to
+type ParamError struct {
+	Name  string
+	Value string
+	Type  reflect.Type
+	Err   error
+}
+
+func (err *ParamError) Error() string {
+	return fmt.Sprintf("parameter %s : cannot convert %q to %v", err.Name, err.Value, err.Type)
+}
+
+// Unwrap returns the underlying error
+func (err *ParamError) Unwrap() error {
+	return err.Err
+}
+
+// StatusCode returns the status of the response a parameter error should produce
+func (err *ParamError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+var (
+	// paramsType is the type of Params
+	paramsType = reflect.TypeOf(Params{})
+	// textUnmarshalerType is the type of encoding.TextUnmarshaler
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// convertString converts value to someType, which can be a string, a boolean,
+// a number, a pointer to one of them, or implement encoding.TextUnmarshaler
+func convertString(value string, someType reflect.Type) (reflect.Value, error) {
+	result := reflect.New(someType).Elem()
+	if reflect.PointerTo(someType).Implements(textUnmarshalerType) {
+		err := result.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+		return result, err
+	}
+	switch someType.Kind() {
+	case reflect.String:
+		result.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return result, err
+		}
+		result.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, someType.Bits())
+		if err != nil {
+			return result, err
+		}
+		result.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(value, 10, someType.Bits())
+		if err != nil {
+			return result, err
+		}
+		result.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, someType.Bits())
+		if err != nil {
+			return result, err
+		}
+		result.SetFloat(parsed)
+	case reflect.Ptr:
+		element, err := convertString(value, someType.Elem())
+		if err != nil {
+			return result, err
+		}
+		pointer := reflect.New(someType.Elem())
+		pointer.Elem().Set(element)
+		result.Set(pointer)
+	default:
+		return result, fmt.Errorf("unsupported type %v", someType)
+	}
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package micro
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+/**********************************/
+/*        PROBLEM DETAILS         */
+/**********************************/
+
+// ProblemMediaType is the media type of problem details documents
+const ProblemMediaType = "application/problem+json"
+
+// ProblemDetails is a RFC 7807 problem details document.
+// Extensions are serialized as additional members of the document.
+type ProblemDetails struct {
+	// Type is a URI identifying the problem type, "about:blank" by default
+	Type string `json:"type"`
+	// Title is a short summary of the problem type
+	Title string `json:"title"`
+	// Status is the status code of the response
+	Status int `json:"status"`
+	// Detail is an explanation specific to this occurrence of the problem
+	Detail string `json:"detail,omitempty"`
+	// Instance is a URI identifying this occurrence of the problem
+	Instance string `json:"instance,omitempty"`
+	// Extensions are additional members of the document
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// NewProblemDetails returns the problem details document of err occurring during request.
+// The message of err is the detail when it differs from the status text.
+// Details of err are the extensions if they are a map[string]interface{},
+// they are the "details" extension otherwise. The internal error is never exposed.
+func NewProblemDetails(err *HTTPError, request *http.Request) *ProblemDetails {
+	problem := &ProblemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(err.Code),
+		Status: err.Code,
+	}
+	if err.Message != problem.Title {
+		problem.Detail = err.Message
+	}
+	if request != nil && request.URL != nil {
+		problem.Instance = request.URL.Path
+	}
+	switch details := err.Details.(type) {
+	case nil:
+	case map[string]interface{}:
+		problem.Extensions = details
+	default:
+		problem.Extensions = map[string]interface{}{"details": details}
+	}
+	return problem
+}
+
+// MarshalJSON serializes the problem with its extensions,
+// the standard members take precedence over extensions with the same name
+func (problem ProblemDetails) MarshalJSON() ([]byte, error) {
+	type document ProblemDetails
+	if len(problem.Extensions) == 0 {
+		return json.Marshal(document(problem))
+	}
+	members := map[string]interface{}{}
+	for name, value := range problem.Extensions {
+		members[name] = value
+	}
+	members["type"], members["title"], members["status"] = problem.Type, problem.Title, problem.Status
+	if problem.Detail != "" {
+		members["detail"] = problem.Detail
+	}
+	if problem.Instance != "" {
+		members["instance"] = problem.Instance
+	}
+	return json.Marshal(members)
+}
+
+// ProblemDetailsErrorHandler writes the problem details document of the error,
+// it is used by DefaultErrorRenderer when problem details are enabled
+func ProblemDetailsErrorHandler(ctx *Context, err *HTTPError) {
+	ctx.Response.Header().Set("Content-Type", ProblemMediaType)
+	ctx.Response.Header().Set("X-Content-Type-Options", "nosniff")
+	ctx.Response.WriteHeader(err.Code)
+	if encodeErr := ctx.newJSONEncoder(ctx.Response).Encode(NewProblemDetails(err, ctx.Request)); encodeErr != nil {
+		ctx.logger().Error("cannot write problem details", "error", encodeErr)
+	}
+}
+
+// SetProblemDetails makes DefaultErrorRenderer answer errors with RFC 7807 problem details documents,
+// unless the client prefers HTML or plain text:
+//
+//	app.SetProblemDetails(true)
+//	app.Get("/users/:id", func(params micro.Params) error {
+//		return micro.NotFound("user not found")
+//	})
+//	// 404 {"type":"about:blank","title":"Not Found","status":404,"detail":"user not found","instance":"/users/1"}
+func (e *Micro) SetProblemDetails(enabled bool) {
+	e.problemDetails = enabled
+}
+
+// ProblemDetails returns true if errors are answered with problem details documents
+func (e *Micro) ProblemDetails() bool {
+	return e.problemDetails
+}
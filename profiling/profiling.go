@@ -0,0 +1,53 @@
+// Package profiling mounts the net/http/pprof and expvar endpoints on micro applications,
+// so production applications can be profiled without a second HTTP server.
+//
+// Importing net/http/pprof and expvar registers /debug/pprof/ and /debug/vars on http.DefaultServeMux,
+// the package must only be imported by applications which profile, applications serving
+// http.DefaultServeMux expose these endpoints without authentication otherwise.
+package profiling
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/interactiv/micro"
+)
+
+/**********************************/
+/*           PROFILING            */
+/**********************************/
+
+// Enable mounts the pprof endpoints under prefix/pprof/ and the expvar endpoint
+// at prefix/vars of app, guarded by authMiddleware:
+//
+//	profiling.Enable(app, "/debug", func(ctx *micro.Context, next micro.Next) {
+//		if ctx.Request.Header.Get("Authorization") != "Bearer "+os.Getenv("PROFILING_TOKEN") {
+//			ctx.Response.WriteHeader(http.StatusUnauthorized)
+//			return
+//		}
+//		next()
+//	})
+//
+//	go tool pprof -http :8081 -H "Authorization: Bearer $PROFILING_TOKEN" https://example.com/debug/pprof/heap
+//
+// Can Panic! if authMiddleware is nil, profiling endpoints must never be public
+func Enable(app *micro.Micro, prefix string, authMiddleware micro.HandlerFunction) {
+	if authMiddleware == nil {
+		panic("profiling endpoints must be guarded by a middleware")
+	}
+	collection := micro.NewControllerCollection()
+	// the group requires a slash so the middleware does not run for paths only starting with the prefix
+	collection.Use("/(.*)", authMiddleware)
+	collection.Get("/pprof/", pprof.Index)
+	collection.Get("/pprof/cmdline", pprof.Cmdline)
+	collection.Get("/pprof/profile", pprof.Profile)
+	collection.All("/pprof/symbol", pprof.Symbol).SetMethods([]string{"GET", "HEAD", "POST"})
+	collection.Get("/pprof/trace", pprof.Trace)
+	collection.Get("/pprof/:profile", func(rw http.ResponseWriter, request *http.Request, params micro.Params) {
+		pprof.Handler(params["profile"]).ServeHTTP(rw, request)
+	})
+	collection.Get("/vars", expvar.Handler().ServeHTTP)
+	app.Mount(strings.TrimSuffix(prefix, "/"), collection)
+}
@@ -0,0 +1,44 @@
+package profiling_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/interactiv/expect"
+	"github.com/interactiv/micro"
+	"github.com/interactiv/micro/profiling"
+)
+
+func TestEnable(t *testing.T) {
+	e := expect.New(t)
+	app := micro.New()
+	profiling.Enable(app, "/debug/", func(ctx *micro.Context, next micro.Next) {
+		if ctx.Request.Header.Get("Authorization") != "secret" {
+			ctx.Response.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next()
+	})
+	app.Get("/debugger", func(ctx *micro.Context) { ctx.WriteString("public") })
+	for path, expected := range map[string]string{
+		"/debug/pprof/":             "goroutine",
+		"/debug/pprof/cmdline":      "profiling",
+		"/debug/pprof/heap?debug=1": "heap profile",
+		"/debug/vars":               "memstats",
+	} {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		e.Expect(response.Code).ToBe(http.StatusUnauthorized)
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set("Authorization", "secret")
+		response = httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		e.Expect(response.Code).ToBe(http.StatusOK)
+		e.Expect(response.Body.String()).ToContain(expected)
+	}
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", "/debugger", nil))
+	e.Expect(response.Body.String()).ToBe("public")
+	e.Expect(func() { profiling.Enable(micro.New(), "/debug", nil) }).ToPanic()
+}
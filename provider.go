@@ -0,0 +1,164 @@
+package micro
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/**********************************/
+/*           PROVIDERS            */
+/**********************************/
+
+// Provider bundles the services, routes, event listeners and boot hooks
+// of a reusable module, so it can be added to an application in one line:
+//
+//	type BillingProvider struct{}
+//
+//	func (BillingProvider) Register(injector *micro.Injector) {
+//		injector.Provide(NewInvoiceRepository)
+//	}
+//
+//	func (BillingProvider) Boot(app *micro.Micro) {
+//		app.Get("/invoices", listInvoices)
+//		app.OnBoot(migrateInvoices)
+//	}
+//
+//	app.RegisterProvider(BillingProvider{})
+type Provider interface {
+	// Register registers the services of the provider in the application injector,
+	// it is called by RegisterProvider
+	Register(injector *Injector)
+	// Boot adds the routes, event listeners and hooks of the provider,
+	// it is called when the application boots, before the routes are flushed
+	// and the boot hooks are executed
+	Boot(app *Micro)
+}
+
+// Plugin is a Provider describing itself, so third-party extensions can coexist safely:
+// plugins boot after their dependencies and conflicting plugins prevent the application from booting
+type Plugin interface {
+	Provider
+	Metadata() PluginMetadata
+}
+
+// PluginMetadata describes a plugin
+type PluginMetadata struct {
+	// Name identifies the plugin, two plugins with the same name conflict
+	Name string
+	// Version is the version of the plugin
+	Version string
+	// Dependencies are the names of the plugins that must be registered and booted before this one
+	Dependencies []string
+	// Conflicts are the names of the plugins that cannot be registered along this one
+	Conflicts []string
+}
+
+var (
+	// ErrPluginConflict is returned by Boot when conflicting plugins are registered
+	ErrPluginConflict = errors.New("plugin conflict")
+	// ErrMissingDependency is returned by Boot when a plugin depends on a plugin that is not registered
+	ErrMissingDependency = errors.New("missing plugin dependency")
+	// ErrDependencyCycle is returned by Boot when plugins depend on each other
+	ErrDependencyCycle = errors.New("plugin dependency cycle")
+)
+
+// RegisterProvider registers the services of provider right away and boots it with the application.
+// Providers boot in the order they are registered, except plugins which boot after their dependencies.
+//
+// Can Panic! if the application is already booted
+func (e *Micro) RegisterProvider(provider Provider) {
+	if e.Booted() {
+		panic(fmt.Sprintf("cannot register provider %T : the application is already booted", provider))
+	}
+	provider.Register(e.injector)
+	e.providers = append(e.providers, provider)
+}
+
+// Plugins returns the metadata of the registered plugins, in boot order once the application is booted
+func (e *Micro) Plugins() []PluginMetadata {
+	plugins := []PluginMetadata{}
+	for _, provider := range e.providers {
+		if plugin, ok := provider.(Plugin); ok {
+			plugins = append(plugins, plugin.Metadata())
+		}
+	}
+	return plugins
+}
+
+// bootProviders checks the plugins for conflicts, sorts the providers so plugins follow their dependencies
+// and boots them
+func (e *Micro) bootProviders() error {
+	metadatas, plugins := e.Plugins(), map[string]PluginMetadata{}
+	for _, metadata := range metadatas {
+		if other, ok := plugins[metadata.Name]; ok {
+			return fmt.Errorf("%w : %s %s and %s %s are both registered", ErrPluginConflict,
+				other.Name, other.Version, metadata.Name, metadata.Version)
+		}
+		plugins[metadata.Name] = metadata
+	}
+	for _, metadata := range metadatas {
+		for _, conflict := range metadata.Conflicts {
+			if _, ok := plugins[conflict]; ok {
+				return fmt.Errorf("%w : %s cannot be registered with %s", ErrPluginConflict, metadata.Name, conflict)
+			}
+		}
+	}
+	providers, err := sortProviders(e.providers)
+	if err != nil {
+		return err
+	}
+	e.providers = providers
+	for _, provider := range e.providers {
+		provider.Boot(e)
+	}
+	return nil
+}
+
+// sortProviders sorts providers topologically so plugins follow their dependencies,
+// keeping the registration order otherwise
+func sortProviders(providers []Provider) ([]Provider, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	names, plugins := make([]string, len(providers)), map[string]int{}
+	for i, provider := range providers {
+		names[i] = fmt.Sprintf("%T", provider)
+		if plugin, ok := provider.(Plugin); ok {
+			names[i] = plugin.Metadata().Name
+			plugins[names[i]] = i
+		}
+	}
+	sorted, states := make([]Provider, 0, len(providers)), make([]int, len(providers))
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		switch states[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w : %s", ErrDependencyCycle, strings.Join(path, " -> "))
+		}
+		states[i] = visiting
+		if plugin, ok := providers[i].(Plugin); ok {
+			for _, dependency := range plugin.Metadata().Dependencies {
+				j, ok := plugins[dependency]
+				if !ok {
+					return fmt.Errorf("%w : %s depends on %s", ErrMissingDependency, names[i], dependency)
+				}
+				if err := visit(j, append(path, dependency)); err != nil {
+					return err
+				}
+			}
+		}
+		states[i] = visited
+		sorted = append(sorted, providers[i])
+		return nil
+	}
+	for i := range providers {
+		if err := visit(i, []string{names[i]}); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
@@ -0,0 +1,295 @@
+package micro
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**********************************/
+/*             PROXY              */
+/**********************************/
+
+// ErrCircuitOpen is the error of the requests rejected by an open circuit breaker
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// MaxRetryBodySize is the maximum size of the bodies of retried requests, which are buffered to be sent again.
+// Requests with larger bodies are streamed to the upstream and not retried.
+var MaxRetryBodySize int64 = 1 << 20
+
+// ProxyOptions configures a proxy route
+type ProxyOptions struct {
+	// Timeout is the maximum duration of each attempt, until the response headers are received, no limit if zero
+	Timeout time.Duration
+	// Retry is the retry policy of the failed attempts
+	Retry RetryPolicy
+	// CircuitBreaker stops sending requests to a failing upstream, optional.
+	// A breaker can be shared by the routes of an upstream.
+	CircuitBreaker *CircuitBreaker
+	// RewriteResponseHeaders modifies the headers of the upstream responses, optional
+	RewriteResponseHeaders func(header http.Header)
+	// Transport sends the requests to the upstream, http.DefaultTransport if nil
+	Transport http.RoundTripper
+}
+
+// RetryPolicy configures the retries of proxied requests
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, requests are not retried if it is 0 or 1
+	Attempts int
+	// Backoff is the delay before the first retry, doubled after each retry
+	Backoff time.Duration
+	// Methods are the methods of the requests retried, idempotent methods if empty
+	Methods []string
+	// StatusCodes are the upstream status codes retried, 502, 503 and 504 if empty.
+	// Requests failing with a network error or a timeout are always retried.
+	StatusCodes []int
+}
+
+// retryable returns true if requests with method can be retried
+func (policy RetryPolicy) retryable(method string) bool {
+	if policy.Attempts < 2 {
+		return false
+	}
+	if len(policy.Methods) == 0 {
+		return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions ||
+			method == http.MethodPut || method == http.MethodDelete
+	}
+	for _, retried := range policy.Methods {
+		if strings.EqualFold(retried, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// retriedStatus returns true if responses with code are retried
+func (policy RetryPolicy) retriedStatus(code int) bool {
+	if len(policy.StatusCodes) == 0 {
+		return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+	}
+	for _, retried := range policy.StatusCodes {
+		if retried == code {
+			return true
+		}
+	}
+	return false
+}
+
+// CircuitBreaker opens after a number of consecutive failures of an upstream, network errors or server errors,
+// and rejects requests until a cooldown has passed. A single trial request is then let through,
+// which closes the breaker if it succeeds.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	mutex     sync.Mutex
+	failures  int
+	openedAt  time.Time
+	// trial is true while the trial request of a half-open breaker is in flight
+	trial bool
+}
+
+// NewCircuitBreaker creates a breaker opening after threshold consecutive failures for cooldown
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Open returns true if the breaker rejects requests
+func (breaker *CircuitBreaker) Open() bool {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	return breaker.failures >= breaker.threshold && (time.Since(breaker.openedAt) < breaker.cooldown || breaker.trial)
+}
+
+// allow returns true if a request can be sent
+func (breaker *CircuitBreaker) allow() bool {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	if breaker.failures < breaker.threshold {
+		return true
+	}
+	if time.Since(breaker.openedAt) < breaker.cooldown || breaker.trial {
+		return false
+	}
+	breaker.trial = true
+	return true
+}
+
+// record records the outcome of a request
+func (breaker *CircuitBreaker) record(success bool) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.trial = false
+	if success {
+		breaker.failures = 0
+		return
+	}
+	breaker.failures++
+	if breaker.failures >= breaker.threshold {
+		breaker.openedAt = time.Now()
+	}
+}
+
+// proxyErrorKey is the key of the error of a proxied request in its context
+type proxyErrorKey struct{}
+
+// Proxy forwards the requests whose path starts with path to target, with path stripped from the request URL
+// and the path of target prepended, for the requests of the routes which are not migrated yet:
+//
+//	app.Proxy("/legacy", "http://legacy.internal/", micro.ProxyOptions{
+//		Timeout:        5 * time.Second,
+//		Retry:          micro.RetryPolicy{Attempts: 3, Backoff: 100 * time.Millisecond},
+//		CircuitBreaker: micro.NewCircuitBreaker(5, 30*time.Second),
+//	})
+//
+// Requests which cannot be proxied are sent to the error handlers: 503 Service Unavailable when the
+// circuit breaker is open, 504 Gateway Timeout on timeouts and 502 Bad Gateway on other errors.
+//
+// Can Panic! if target is not an absolute URL
+func (rc *ControllerCollection) Proxy(path string, target string, options ProxyOptions) *Route {
+	targetURL, err := url.Parse(target)
+	if err != nil || !targetURL.IsAbs() {
+		panic(fmt.Sprintf("invalid proxy target %q", target))
+	}
+	if options.Transport == nil {
+		options.Transport = http.DefaultTransport
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(request *httputil.ProxyRequest) {
+			request.SetURL(targetURL)
+			request.SetXForwarded()
+		},
+		Transport: &resilientTransport{options: options},
+		ModifyResponse: func(response *http.Response) error {
+			if options.RewriteResponseHeaders != nil {
+				options.RewriteResponseHeaders(response.Header)
+			}
+			return nil
+		},
+		ErrorHandler: func(rw http.ResponseWriter, request *http.Request, err error) {
+			*request.Context().Value(proxyErrorKey{}).(*error) = err
+		},
+	}
+	path = strings.TrimSuffix(path, "/")
+	return rc.All(path+"(|/.*)", func(ctx *Context) error {
+		params := ctx.Route().Params()
+		var proxyError error
+		request := ctx.Request.Clone(context.WithValue(ctx.Request.Context(), proxyErrorKey{}, &proxyError))
+		request.URL.Path, request.URL.RawPath = ctx.RequestVars[params[len(params)-1]], ""
+		proxy.ServeHTTP(ctx.Response, request)
+		switch {
+		case proxyError == nil:
+			return nil
+		case errors.Is(proxyError, ErrCircuitOpen):
+			return ServiceUnavailable("").WithInternal(proxyError)
+		case errors.Is(proxyError, context.DeadlineExceeded):
+			return NewHTTPError(http.StatusGatewayTimeout, "").WithInternal(proxyError)
+		default:
+			return NewHTTPError(http.StatusBadGateway, "").WithInternal(proxyError)
+		}
+	})
+}
+
+// resilientTransport sends proxied requests with the timeout, retry policy and circuit breaker of options
+type resilientTransport struct {
+	options ProxyOptions
+}
+
+func (transport *resilientTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	policy, breaker := transport.options.Retry, transport.options.CircuitBreaker
+	attempts := 1
+	var body []byte
+	if policy.retryable(request.Method) {
+		attempts = policy.Attempts
+		if request.ContentLength > MaxRetryBodySize {
+			attempts = 1
+		} else if request.Body != nil && request.Body != http.NoBody {
+			var err error
+			if body, err = io.ReadAll(io.LimitReader(request.Body, MaxRetryBodySize+1)); err != nil {
+				return nil, err
+			}
+			if int64(len(body)) > MaxRetryBodySize {
+				// the body of unknown length is too large, the buffered part is sent before the rest
+				request = request.Clone(request.Context())
+				request.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(body), request.Body), request.Body}
+				attempts, body = 1, nil
+			} else {
+				request.Body.Close()
+			}
+		}
+	}
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		if breaker != nil && !breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+		current := request
+		if body != nil {
+			current = request.Clone(request.Context())
+			current.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		response, err := transport.attempt(current)
+		if breaker != nil {
+			breaker.record(err == nil && response.StatusCode < http.StatusInternalServerError)
+		}
+		// requests are not retried once the breaker opened, so the client gets the last upstream error
+		if attempt >= attempts || err == nil && !policy.retriedStatus(response.StatusCode) ||
+			request.Context().Err() != nil || breaker != nil && breaker.Open() {
+			return response, err
+		}
+		if err == nil {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+		select {
+		case <-time.After(backoff):
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+// attempt sends request once, within the timeout of the options.
+// The timeout only limits the wait for the response headers, the body is streamed until it is closed.
+func (transport *resilientTransport) attempt(request *http.Request) (*http.Response, error) {
+	timeout := transport.options.Timeout
+	if timeout <= 0 {
+		return transport.options.Transport.RoundTrip(request)
+	}
+	ctx, cancel := context.WithCancel(request.Context())
+	timer := time.AfterFunc(timeout, cancel)
+	response, err := transport.options.Transport.RoundTrip(request.WithContext(ctx))
+	expired := !timer.Stop()
+	if err != nil {
+		cancel()
+		if expired {
+			err = fmt.Errorf("upstream timeout after %s : %w", timeout, context.DeadlineExceeded)
+		}
+		return nil, err
+	}
+	response.Body = &cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// cancelOnClose cancels the context of a response when its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelOnClose) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
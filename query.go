@@ -0,0 +1,176 @@
+package micro
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/**********************************/
+/*             QUERY              */
+/**********************************/
+
+var (
+	// durationType is the type of time.Duration
+	durationType = reflect.TypeOf(time.Duration(0))
+	// timeType is the type of time.Time
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// ReadQuery decodes the query parameters of the request into the struct dst points to.
+// Fields are bound to the parameter named by their query tag, or by their name without tag,
+// fields tagged with "-" are skipped. Parameters are converted like route parameters, and:
+//
+//   - slices are bound to repeated parameters, tags=a&tags=b or tags[]=a&tags[]=b, or to comma separated values, tags=a,b
+//   - structs and maps are bound to nested parameters, filter[status]=open
+//   - times are parsed with the layout of their layout tag, RFC 3339 without tag, durations with time.ParseDuration
+//   - missing parameters are set to the value of the default tag, if any, fields are left untouched otherwise
+//
+// For instance:
+//
+//	type ListQuery struct {
+//		Page   int       `query:"page" default:"1"`
+//		Sort   []string  `query:"sort"`
+//		Since  time.Time `query:"since" layout:"2006-01-02"`
+//		Filter struct {
+//			Status string `query:"status" default:"open"`
+//		} `query:"filter"`
+//	}
+//
+// Parameters which cannot be converted are returned as *ParamError, answered with 400 Bad Request.
+//
+// Can Panic! if dst is not a pointer to a struct
+func (ctx *Context) ReadQuery(dst interface{}) error {
+	value := reflect.ValueOf(dst)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("ReadQuery expects a pointer to a struct, got %T", dst))
+	}
+	return decodeQuery(ctx.Request.URL.Query(), "", value.Elem())
+}
+
+// decodeQuery sets the fields of the struct value to the parameters of query, their names prefixed by prefix
+func decodeQuery(query url.Values, prefix string, value reflect.Value) error {
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name, tagged := field.Tag.Lookup("query")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && !tagged && field.Type.Kind() == reflect.Struct {
+			if err := decodeQuery(query, prefix, value.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if prefix != "" {
+			name = prefix + "[" + name + "]"
+		}
+		if err := decodeQueryField(query, name, field, value.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeQueryField sets the field value to the parameter name of query
+func decodeQueryField(query url.Values, name string, field reflect.StructField, value reflect.Value) error {
+	layout := field.Tag.Get("layout")
+	defaultValue, hasDefault := field.Tag.Lookup("default")
+	switch {
+	case isQueryScalar(field.Type):
+		values, ok := query[name]
+		if !ok || len(values) == 0 {
+			if !hasDefault {
+				return nil
+			}
+			values = []string{defaultValue}
+		}
+		converted, err := convertQueryValue(values[0], field.Type, layout)
+		if err != nil {
+			return &ParamError{Name: name, Value: values[0], Type: field.Type, Err: err}
+		}
+		value.Set(converted)
+	case field.Type.Kind() == reflect.Struct:
+		return decodeQuery(query, name, value)
+	case field.Type.Kind() == reflect.Slice:
+		values := append(append([]string{}, query[name]...), query[name+"[]"]...)
+		if len(values) == 0 && hasDefault {
+			values = []string{defaultValue}
+		}
+		if len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		slice := reflect.MakeSlice(field.Type, 0, len(values))
+		for _, item := range values {
+			converted, err := convertQueryValue(item, field.Type.Elem(), layout)
+			if err != nil {
+				return &ParamError{Name: name, Value: item, Type: field.Type.Elem(), Err: err}
+			}
+			slice = reflect.Append(slice, converted)
+		}
+		value.Set(slice)
+	case field.Type.Kind() == reflect.Map && field.Type.Key().Kind() == reflect.String:
+		for key, values := range query {
+			nested, found := strings.CutPrefix(key, name+"[")
+			if !found || !strings.HasSuffix(nested, "]") || len(values) == 0 {
+				continue
+			}
+			converted, err := convertQueryValue(values[0], field.Type.Elem(), layout)
+			if err != nil {
+				return &ParamError{Name: key, Value: values[0], Type: field.Type.Elem(), Err: err}
+			}
+			if value.IsNil() {
+				value.Set(reflect.MakeMap(field.Type))
+			}
+			value.SetMapIndex(reflect.ValueOf(strings.TrimSuffix(nested, "]")).Convert(field.Type.Key()), converted)
+		}
+	default:
+		return fmt.Errorf("query parameter %s : unsupported type %v", name, field.Type)
+	}
+	return nil
+}
+
+// isQueryScalar returns true if values of someType are decoded from a single parameter
+func isQueryScalar(someType reflect.Type) bool {
+	if someType.Kind() == reflect.Ptr {
+		someType = someType.Elem()
+	}
+	if someType == timeType || reflect.PointerTo(someType).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch someType.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map:
+		return false
+	}
+	return true
+}
+
+// convertQueryValue converts a parameter to someType, parsing times with layout if it is not empty
+func convertQueryValue(value string, someType reflect.Type, layout string) (reflect.Value, error) {
+	switch {
+	case someType == durationType:
+		duration, err := time.ParseDuration(value)
+		return reflect.ValueOf(duration), err
+	case someType == timeType && layout != "":
+		parsed, err := time.Parse(layout, value)
+		return reflect.ValueOf(parsed), err
+	case someType.Kind() == reflect.Ptr && (someType.Elem() == durationType || someType.Elem() == timeType):
+		element, err := convertQueryValue(value, someType.Elem(), layout)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		pointer := reflect.New(someType.Elem())
+		pointer.Elem().Set(element)
+		return pointer, nil
+	}
+	return convertString(value, someType)
+}
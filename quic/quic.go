@@ -0,0 +1,48 @@
+//go:build adapters
+
+// Package quic serves micro applications over HTTP/3 with quic-go,
+// and over HTTP/1 and HTTP/2 for the clients and networks where UDP is blocked.
+//
+//	app := micro.New()
+//	log.Fatal(quic.Run(app, ":443", tlsConfig))
+//
+// Both servers listen on the same port, UDP for HTTP/3 and TCP for the others.
+// TCP responses advertise HTTP/3 with an Alt-Svc header, so browsers switch to it for their next requests.
+package quic
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/interactiv/micro"
+	"github.com/quic-go/quic-go/http3"
+)
+
+/**********************************/
+/*             HTTP/3             */
+/**********************************/
+
+// MaxAge is the number of seconds clients remember that HTTP/3 is available
+const MaxAge = 86400
+
+// Run serves app over HTTP/3 on the UDP address addr, and over HTTP/1 and HTTP/2 on the TCP address addr
+// for clients that do not support HTTP/3 yet. TCP responses have an Alt-Svc header advertising HTTP/3.
+// config must have Certificates or GetCertificate set. It always returns a non-nil error.
+func Run(app *micro.Micro, addr string, config *tls.Config) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	server := &http3.Server{Addr: addr, Handler: app, TLSConfig: http3.ConfigureTLSConfig(config)}
+	app.SetServerOptions(append(app.ServerOptions(), micro.AltSvc(AltSvc(port)))...)
+	errs := make(chan error, 2)
+	go func() { errs <- server.ListenAndServe() }()
+	go func() { errs <- app.RunTLSConfig(addr, config) }()
+	return <-errs
+}
+
+// AltSvc returns the Alt-Svc header value advertising HTTP/3 on port
+func AltSvc(port string) string {
+	return fmt.Sprintf(`h3=":%s"; ma=%d`, port, MaxAge)
+}
@@ -0,0 +1,22 @@
+//go:build adapters
+
+package quic_test
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/interactiv/expect"
+	"github.com/interactiv/micro"
+	"github.com/interactiv/micro/quic"
+)
+
+func TestAltSvc(t *testing.T) {
+	e := expect.New(t)
+	e.Expect(quic.AltSvc("443")).ToBe(`h3=":443"; ma=86400`)
+}
+
+func TestRunInvalidAddress(t *testing.T) {
+	e := expect.New(t)
+	e.Expect(quic.Run(micro.New(), "localhost", &tls.Config{})).Not().ToBeNil()
+}
@@ -0,0 +1,191 @@
+package micro
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**********************************/
+/*             RANGES             */
+/**********************************/
+
+// MaxRanges is the maximum number of ranges of a request served by ServeRange,
+// requests with more ranges are served the whole content
+var MaxRanges = 16
+
+// RangeContent is generated content served by ranges, such as an export generated on demand
+// whose download can be resumed
+type RangeContent struct {
+	// Size is the size of the content in bytes
+	Size int64
+	// ETag is the strong entity tag of the content, such as `"v42"`, compared with the If-Range header
+	ETag string
+	// LastModified is the modification time of the content, compared with the If-Range header when it is a date
+	LastModified time.Time
+	// ContentType is the media type of the content, application/octet-stream if empty
+	ContentType string
+	// WriteRange writes the length bytes of the content starting at offset to w
+	WriteRange func(w io.Writer, offset int64, length int64) error
+}
+
+// byteRange is a range of a content
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// contentRange returns the Content-Range header of the range of a content of size bytes
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// ServeRange serves the ranges of content the Range header of the request asks for,
+// with a 206 Partial Content response, as multipart/byteranges if there are several ranges.
+// The whole content is served when the request has no Range header, when its If-Range header
+// does not match the ETag or the modification time of content, or when the Range header is invalid.
+// Requests whose ranges are all beyond the content are answered with 416 Range Not Satisfiable.
+//
+//	app.Get("/exports/:id", func(ctx *micro.Context, exports *Exports) error {
+//		export, err := exports.Find(ctx.RequestVars["id"])
+//		if err != nil {
+//			return err
+//		}
+//		return ctx.ServeRange(micro.RangeContent{
+//			Size:        export.Size,
+//			ETag:        `"` + export.Version + `"`,
+//			ContentType: "text/csv",
+//			WriteRange: func(w io.Writer, offset, length int64) error {
+//				return export.WriteRows(w, offset, length)
+//			},
+//		})
+//	})
+func (ctx *Context) ServeRange(content RangeContent) error {
+	header := ctx.Response.Header()
+	if content.ContentType == "" {
+		content.ContentType = "application/octet-stream"
+	}
+	header.Set("Accept-Ranges", "bytes")
+	if content.ETag != "" {
+		header.Set("ETag", content.ETag)
+	}
+	if !content.LastModified.IsZero() {
+		header.Set("Last-Modified", content.LastModified.UTC().Format(http.TimeFormat))
+	}
+	ranges, satisfiable := ctx.requestRanges(content)
+	if !satisfiable {
+		header.Set("Content-Range", fmt.Sprintf("bytes */%d", content.Size))
+		ctx.Response.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+	if len(ranges) == 0 {
+		header.Set("Content-Type", content.ContentType)
+		header.Set("Content-Length", strconv.FormatInt(content.Size, 10))
+		ctx.Response.WriteHeader(http.StatusOK)
+		if ctx.Request.Method == http.MethodHead {
+			return nil
+		}
+		return content.WriteRange(ctx.Response, 0, content.Size)
+	}
+	if len(ranges) == 1 {
+		header.Set("Content-Type", content.ContentType)
+		header.Set("Content-Range", ranges[0].contentRange(content.Size))
+		header.Set("Content-Length", strconv.FormatInt(ranges[0].length, 10))
+		ctx.Response.WriteHeader(http.StatusPartialContent)
+		if ctx.Request.Method == http.MethodHead {
+			return nil
+		}
+		return content.WriteRange(ctx.Response, ranges[0].start, ranges[0].length)
+	}
+	parts := multipart.NewWriter(ctx.Response)
+	header.Set("Content-Type", "multipart/byteranges; boundary="+parts.Boundary())
+	ctx.Response.WriteHeader(http.StatusPartialContent)
+	if ctx.Request.Method == http.MethodHead {
+		return nil
+	}
+	for _, r := range ranges {
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {content.ContentType},
+			"Content-Range": {r.contentRange(content.Size)},
+		})
+		if err != nil {
+			return err
+		}
+		if err := content.WriteRange(part, r.start, r.length); err != nil {
+			return err
+		}
+	}
+	return parts.Close()
+}
+
+// requestRanges returns the ranges of content the request asks for, none for the whole content,
+// and false if no range is satisfiable
+func (ctx *Context) requestRanges(content RangeContent) ([]byteRange, bool) {
+	value := ctx.Request.Header.Get("Range")
+	if value == "" || ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead || !ctx.ifRangeMatches(content) {
+		return nil, true
+	}
+	specs, found := strings.CutPrefix(value, "bytes=")
+	if !found {
+		return nil, true
+	}
+	ranges := []byteRange{}
+	for _, spec := range strings.Split(specs, ",") {
+		first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+		if !found {
+			return nil, true
+		}
+		var r byteRange
+		if first == "" {
+			// a suffix range, the last bytes of the content
+			suffix, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, true
+			}
+			if suffix > content.Size {
+				suffix = content.Size
+			}
+			r = byteRange{start: content.Size - suffix, length: suffix}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, true
+			}
+			end := content.Size - 1
+			if last != "" {
+				if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+					return nil, true
+				}
+				if end >= content.Size {
+					end = content.Size - 1
+				}
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		if r.start < content.Size && r.length > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+	if len(ranges) > MaxRanges {
+		return nil, true
+	}
+	return ranges, len(ranges) > 0
+}
+
+// ifRangeMatches returns true if the request has no If-Range header or if it matches content
+func (ctx *Context) ifRangeMatches(content RangeContent) bool {
+	ifRange := ctx.Request.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		return content.ETag != "" && !strings.HasPrefix(content.ETag, "W/") && ifRange == content.ETag
+	}
+	date, err := http.ParseTime(ifRange)
+	return err == nil && !content.LastModified.IsZero() && content.LastModified.Truncate(time.Second).Equal(date)
+}
@@ -0,0 +1,72 @@
+package micro
+
+import (
+	"errors"
+	"fmt"
+)
+
+/**********************************/
+/*        DEVELOPMENT MODE        */
+/**********************************/
+
+// ErrNotDevMode is returned by Reload when the application is not in development mode
+var ErrNotDevMode = errors.New("routes can only be reloaded in development mode, use Micro.SetDevMode")
+
+// SetDevMode enables or disables the development mode, in which routes and templates
+// can be reloaded while the application is running. It must never be enabled in production.
+func (e *Micro) SetDevMode(devMode bool) {
+	e.devMode = devMode
+}
+
+// DevMode returns true if the application is in development mode
+func (e *Micro) DevMode() bool {
+	return e.devMode
+}
+
+// Reload replaces the routes of a booted application with the routes registered by routes
+// on a new collection, and clears the template cache of the renderer if it has one.
+// The new routes are swapped in atomically: in-flight requests complete with the previous routes.
+// Reload is meant to be called by a file watcher in development mode:
+//
+//	registerRoutes := func(routes *micro.ControllerCollection) {
+//		routes.Get("/", homeHandler)
+//	}
+//	app.SetDevMode(true)
+//	registerRoutes(app.ControllerCollection)
+//	watcher.OnChange(func() {
+//		if err := app.Reload(registerRoutes); err != nil {
+//			log.Println(err)
+//		}
+//	})
+//
+// routes may be nil to only clear the template cache. A panic while registering routes
+// is returned as an error and the previous routes are kept. URL and RouteTable use the reloaded routes.
+func (e *Micro) Reload(routes func(routes *ControllerCollection)) (err error) {
+	if !e.devMode {
+		return ErrNotDevMode
+	}
+	if renderer, ok := e.renderer.(interface{ ClearCache() }); ok {
+		renderer.ClearCache()
+	}
+	if routes == nil {
+		return nil
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("reload failed : %v", recovered)
+		}
+	}()
+	collection := NewControllerCollection()
+	routes(collection)
+	collection.Flush()
+	e.reloadedMatcher.Store(NewRequestMatcher(collection))
+	return nil
+}
+
+// routes returns the routes requests are matched against, the routes of the last Reload if any
+func (e *Micro) routes() []*Route {
+	if reloaded := e.reloadedMatcher.Load(); reloaded != nil {
+		return reloaded.routeCollection.Routes
+	}
+	return e.ControllerCollection.Routes
+}
@@ -0,0 +1,56 @@
+package micro
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+/**********************************/
+/*            RENDERER            */
+/**********************************/
+
+// ErrNoRenderer is returned by Context.Render when no renderer is set on the application
+var ErrNoRenderer = errors.New("no renderer set on the application, use Micro.SetRenderer")
+
+// Renderer renders named templates, it is used by Context.Render
+type Renderer interface {
+	Render(w io.Writer, templateName string, data interface{}) error
+}
+
+// SetRenderer sets the renderer used by Context.Render
+func (e *Micro) SetRenderer(renderer Renderer) {
+	e.renderer = renderer
+}
+
+// Renderer returns the renderer used by Context.Render
+func (e *Micro) Renderer() Renderer {
+	return e.renderer
+}
+
+// Render renders templateName with data using the application renderer
+// and writes the result with the given status code.
+// If the renderer is a ContextRenderer, it receives the request context.
+// The template is fully rendered before anything is written,
+// so the response is left untouched if rendering fails.
+func (ctx *Context) Render(status int, templateName string, data interface{}) error {
+	if ctx.app == nil || ctx.app.renderer == nil {
+		return ErrNoRenderer
+	}
+	var err error
+	buffer := new(bytes.Buffer)
+	if renderer, ok := ctx.app.renderer.(ContextRenderer); ok {
+		err = renderer.RenderContext(ctx, buffer, templateName, data)
+	} else {
+		err = ctx.app.renderer.Render(buffer, templateName, data)
+	}
+	if err != nil {
+		return err
+	}
+	if ctx.Response.Header().Get("Content-Type") == "" {
+		ctx.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	ctx.Response.WriteHeader(status)
+	_, err = buffer.WriteTo(ctx.Response)
+	return err
+}
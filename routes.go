@@ -0,0 +1,146 @@
+package micro
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+)
+
+/**********************************/
+/*          ROUTE TABLE           */
+/**********************************/
+
+// DebugRoutesOutput is where applications in debug mode print their route table when they boot,
+// route tables are not printed if it is nil:
+//
+//	micro.DebugRoutesOutput = os.Stderr
+var DebugRoutesOutput io.Writer
+
+// RoutesEnv is the environment variable which, when set, makes Boot write the route table
+// as JSON to the standard output and exit before the boot hooks are executed,
+// so the `micro routes` command lists the routes of an application without serving it
+var RoutesEnv = "MICRO_ROUTES"
+
+// RouteInfo describes a route of the route table
+type RouteInfo struct {
+	Name string `json:"name"`
+	// Methods are the methods handled by the route, all methods if empty
+	Methods []string `json:"methods"`
+	Path    string   `json:"path"`
+	// Handler is the name of the handler function
+	Handler string `json:"handler"`
+	// Passthrough is true for the routes created with Use
+	Passthrough bool `json:"passthrough"`
+	// Middlewares is the number of passthrough routes matching the path of the route registered before it
+	Middlewares int `json:"middlewares"`
+}
+
+// RouteTable returns the routes of the application in matching order.
+// Routes are listed once the application is booted and its routes are frozen, nil before.
+func (e *Micro) RouteTable() []RouteInfo {
+	if !e.ControllerCollection.IsFrozen() {
+		return nil
+	}
+	routes := e.routes()
+	table := make([]RouteInfo, 0, len(routes))
+	for i, route := range routes {
+		info := RouteInfo{
+			Name:        route.name,
+			Methods:     route.methods,
+			Path:        route.path,
+			Handler:     handlerName(route.handlerFunc),
+			Passthrough: route.passthrough,
+		}
+		for _, previous := range routes[:i] {
+			if previous.passthrough && previous.pattern.MatchString(route.path) && methodsOverlap(previous.methods, route.methods) {
+				info.Middlewares++
+			}
+		}
+		table = append(table, info)
+	}
+	return table
+}
+
+// PrintRoutes writes the route table of the application as aligned columns, for sanity checks during development.
+// Routes are listed once the application is booted.
+func (e *Micro) PrintRoutes(w io.Writer) error {
+	return PrintRouteTable(w, e.RouteTable())
+}
+
+// PrintRouteTable writes table as aligned columns: methods, path, name, handler and middleware count.
+// Passthrough routes are listed with the USE method, routes handling all methods with ALL.
+func PrintRouteTable(w io.Writer, table []RouteInfo) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "METHODS\tPATH\tNAME\tHANDLER\tMIDDLEWARES")
+	for _, route := range table {
+		methods := strings.Join(route.Methods, ",")
+		switch {
+		case route.Passthrough:
+			methods = "USE"
+		case methods == "" || methods == "*":
+			methods = "ALL"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\n", methods, route.Path, orDash(route.Name), route.Handler, route.Middlewares)
+	}
+	return writer.Flush()
+}
+
+// ServeRouteTable is a handler writing the route table as JSON, to be mounted on a debug endpoint
+// read by `micro routes -url`:
+//
+//	app.Get("/debug/routes", app.ServeRouteTable)
+func (e *Micro) ServeRouteTable(ctx *Context) error {
+	return ctx.WriteJSON(e.RouteTable())
+}
+
+// writeRouteTable writes the route table as JSON to w
+func (e *Micro) writeRouteTable(w io.Writer) error {
+	return json.NewEncoder(w).Encode(e.RouteTable())
+}
+
+// exitWithRouteTable writes the route table to the standard output and exits if RoutesEnv is set
+func (e *Micro) exitWithRouteTable() {
+	if os.Getenv(RoutesEnv) == "" {
+		return
+	}
+	if err := e.writeRouteTable(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// methodsOverlap returns true if a request can be handled by routes with methods a and b
+func methodsOverlap(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, method := range a {
+		if method == "*" {
+			return true
+		}
+		for _, other := range b {
+			if other == "*" || strings.EqualFold(method, other) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handlerName returns the name of the function of handler
+func handlerName(handler HandlerFunction) string {
+	function := reflect.ValueOf(handler)
+	if function.Kind() != reflect.Func || function.IsNil() {
+		return fmt.Sprintf("%T", handler)
+	}
+	if runtimeFunction := runtime.FuncForPC(function.Pointer()); runtimeFunction != nil {
+		return runtimeFunction.Name()
+	}
+	return function.Type().String()
+}
@@ -0,0 +1,187 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**********************************/
+/*            SCHEDULE            */
+/**********************************/
+
+// scheduleDescriptors are the shortcuts of common schedules
+var scheduleDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// anyDay and anyWeekday are true if the day of month and the day of week fields are *,
+	// when both are restricted a time matches either of them
+	anyDay, anyWeekday bool
+}
+
+// ParseSchedule parses a cron expression with five fields: minute, hour, day of month, month
+// and day of week (0 or 7 is sunday). Fields are *, values, ranges, lists and steps,
+// like "*/15 9-17 * * 1-5". The descriptors @yearly, @monthly, @weekly, @daily and @hourly are supported.
+func ParseSchedule(spec string) (*Schedule, error) {
+	expression := spec
+	if descriptor, ok := scheduleDescriptors[strings.TrimSpace(spec)]; ok {
+		expression = descriptor
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q : 5 fields expected, got %d", spec, len(fields))
+	}
+	schedule := &Schedule{anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	targets := [5]*uint64{&schedule.minutes, &schedule.hours, &schedule.days, &schedule.months, &schedule.weekdays}
+	for i, field := range fields {
+		bits, err := parseScheduleField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q : %w", spec, err)
+		}
+		*targets[i] = bits
+	}
+	// 7 is an alias of sunday
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+	return schedule, nil
+}
+
+// parseScheduleField returns the bit set of the values of a field between min and max
+func parseScheduleField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		valueRange, stepValue, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			parsed, err := strconv.Atoi(stepValue)
+			if err != nil || parsed <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepValue)
+			}
+			step = parsed
+		}
+		start, end := min, max
+		if valueRange != "*" {
+			from, to, isRange := strings.Cut(valueRange, "-")
+			var err error
+			if start, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", from)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", to)
+				}
+			} else if hasStep {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time after t matching the schedule, in the location of t.
+// It returns the zero time if no time matches within five years.
+func (schedule *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case schedule.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !schedule.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case schedule.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case schedule.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay returns true if the day of t matches the day of month or the day of week fields
+func (schedule *Schedule) matchesDay(t time.Time) bool {
+	day := schedule.days&(1<<uint(t.Day())) != 0
+	weekday := schedule.weekdays&(1<<uint(t.Weekday())) != 0
+	if schedule.anyDay || schedule.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// Schedule runs job periodically according to the cron expression spec, see ParseSchedule.
+// The job is a function whose arguments are resolved like the arguments of workers, see Go:
+//
+//	app.Schedule("0 3 * * *", func(ctx context.Context, db *sql.DB) error {
+//		_, err := db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at < now()")
+//		return err
+//	})
+//
+// A run is skipped if the previous one is still running. A job returning a non nil error
+// as its last result, or panicking, emits WorkerFailed and runs again at the next scheduled time.
+// Jobs run while the application is booted and their context is cancelled on Shutdown.
+//
+// Can Panic! if spec is not a valid cron expression or job is not a function.
+func (e *Micro) Schedule(spec string, job interface{}) {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		panic(err)
+	}
+	if reflect.TypeOf(job) == nil || reflect.TypeOf(job).Kind() != reflect.Func {
+		panic(fmt.Sprintf("job of schedule %s should be a function, got %T", spec, job))
+	}
+	name := "schedule " + spec
+	e.Go(name, func(ctx context.Context) {
+		var running atomic.Bool
+		for {
+			next := schedule.Next(time.Now())
+			if next.IsZero() {
+				return
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if !running.CompareAndSwap(false, true) {
+				e.Logger().Warn("job skipped, the previous run is still running", "schedule", spec)
+				continue
+			}
+			e.workers.running.Add(1)
+			go func() {
+				defer e.workers.running.Done()
+				defer running.Store(false)
+				if failure := e.runWorker(ctx, worker{name: name, function: job}); failure != nil {
+					e.Logger().Error("job failed", "schedule", spec, "error", failure.Err)
+					Publish(e.EventEmitter, WorkerFailed, failure)
+				}
+			}()
+		}
+	})
+}
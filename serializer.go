@@ -0,0 +1,109 @@
+package micro
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+/**********************************/
+/*          SERIALIZERS           */
+/**********************************/
+
+// Serializer encodes the values written by WriteAuto in a media type
+type Serializer interface {
+	Serialize(ctx *Context, w io.Writer, v interface{}) error
+}
+
+// SerializerFunc is a function implementing Serializer
+type SerializerFunc func(ctx *Context, w io.Writer, v interface{}) error
+
+// Serialize calls f
+func (f SerializerFunc) Serialize(ctx *Context, w io.Writer, v interface{}) error {
+	return f(ctx, w, v)
+}
+
+var (
+	// JSONSerializer encodes values as json, with the json configuration of the application
+	JSONSerializer = SerializerFunc(func(ctx *Context, w io.Writer, v interface{}) error {
+		if prefix := ctx.jsonConfig().Prefix; prefix != "" {
+			if _, err := io.WriteString(w, prefix); err != nil {
+				return err
+			}
+		}
+		return ctx.newJSONEncoder(w).Encode(v)
+	})
+	// XMLSerializer encodes values as xml
+	XMLSerializer = SerializerFunc(func(ctx *Context, w io.Writer, v interface{}) error {
+		return xml.NewEncoder(w).Encode(v)
+	})
+	// MsgPackSerializer encodes values as msgpack
+	MsgPackSerializer = SerializerFunc(func(ctx *Context, w io.Writer, v interface{}) error {
+		return NewMsgPackEncoder(w).Encode(v)
+	})
+)
+
+// registeredSerializer is a serializer of the registry of an application
+type registeredSerializer struct {
+	mediaType  string
+	serializer Serializer
+}
+
+// RegisterSerializer registers the serializer of mediaType used by WriteAuto, replacing the serializer
+// already registered for mediaType if any. Serializers are preferred in registration order when the client
+// accepts several media types equally, json, xml and msgpack are registered first:
+//
+//	app.RegisterSerializer("application/hal+json", micro.JSONSerializer)
+//	app.RegisterSerializer("application/cbor", micro.SerializerFunc(func(ctx *micro.Context, w io.Writer, v interface{}) error {
+//		return cbor.NewEncoder(w).Encode(v)
+//	}))
+func (e *Micro) RegisterSerializer(mediaType string, serializer Serializer) {
+	for i, registered := range e.serializers {
+		if strings.EqualFold(registered.mediaType, mediaType) {
+			e.serializers[i].serializer = serializer
+			return
+		}
+	}
+	e.serializers = append(e.serializers, registeredSerializer{mediaType: mediaType, serializer: serializer})
+}
+
+// defaultSerializers returns the serializers applications are created with
+func defaultSerializers() []registeredSerializer {
+	return []registeredSerializer{
+		{mediaType: MediaTypes["json"], serializer: JSONSerializer},
+		{mediaType: MediaTypes["xml"], serializer: XMLSerializer},
+		{mediaType: MediaTypes["msgpack"], serializer: MsgPackSerializer},
+	}
+}
+
+// WriteAuto writes v with the status code, encoded by the serializer of the media type the client prefers
+// according to the Accept header of the request, see RegisterSerializer and Negotiate. The first registered serializer
+// is used when the request has no Accept header. It sends a 406 Not Acceptable error if the client accepts
+// none of the media types, and only writes the status code if v is nil. Within an error handler, the first
+// registered serializer is used when the client accepts none of the media types.
+func (ctx *Context) WriteAuto(status int, v interface{}) error {
+	if v == nil {
+		ctx.Response.WriteHeader(status)
+		return nil
+	}
+	registry := defaultSerializers()
+	if ctx.app != nil {
+		registry = ctx.app.serializers
+	}
+	mediaTypes := make([]string, 0, len(registry))
+	for _, registered := range registry {
+		mediaTypes = append(mediaTypes, registered.mediaType)
+	}
+	ctx.Response.Header().Add("Vary", "Accept")
+	i := ctx.negotiate(mediaTypes)
+	if i < 0 && ctx.renderingError() {
+		i = 0
+	} else if i < 0 {
+		err := NotAcceptable(mediaTypes, ctx.Request.Header.Get("Accept"))
+		ctx.sendError(err.Code, err.Message, err)
+		return nil
+	}
+	ctx.Response.Header().Set("Content-Type", registry[i].mediaType)
+	ctx.Response.WriteHeader(status)
+	return registry[i].serializer.Serialize(ctx, ctx.Response, v)
+}
@@ -0,0 +1,291 @@
+package micro
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+/**********************************/
+/*             SERVER             */
+/**********************************/
+
+// ServerOption configures the http server of the application
+type ServerOption func(server *http.Server)
+
+// H2C enables HTTP/2 without TLS, also known as h2c, alongside HTTP/1,
+// for applications behind load balancers speaking HTTP/2 in cleartext:
+//
+//	app.SetServerOptions(micro.H2C())
+//	app.Run(":8080")
+func H2C() ServerOption {
+	return func(server *http.Server) {
+		if server.Protocols == nil {
+			server.Protocols = &http.Protocols{}
+			server.Protocols.SetHTTP1(true)
+			server.Protocols.SetHTTP2(true)
+		}
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+}
+
+// AltSvc sets the Alt-Svc header of responses to value,
+// to advertise the same application on another protocol such as HTTP/3:
+//
+//	app.SetServerOptions(micro.AltSvc(`h3=":443"; ma=86400`))
+func AltSvc(value string) ServerOption {
+	return func(server *http.Server) {
+		handler := server.Handler
+		server.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Alt-Svc", value)
+			handler.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// SetServerOptions sets the options of all the http servers of Run and its variants
+func (e *Micro) SetServerOptions(options ...ServerOption) {
+	e.serverOptions = options
+}
+
+// ServerOptions returns the options of the http servers of the application
+func (e *Micro) ServerOptions() []ServerOption {
+	return e.serverOptions
+}
+
+// ReadTimeout is the maximum duration for reading an entire request, including the body
+func ReadTimeout(timeout time.Duration) ServerOption {
+	return func(server *http.Server) { server.ReadTimeout = timeout }
+}
+
+// ReadHeaderTimeout is the maximum duration for reading the headers of a request
+func ReadHeaderTimeout(timeout time.Duration) ServerOption {
+	return func(server *http.Server) { server.ReadHeaderTimeout = timeout }
+}
+
+// WriteTimeout is the maximum duration before timing out writes of a response
+func WriteTimeout(timeout time.Duration) ServerOption {
+	return func(server *http.Server) { server.WriteTimeout = timeout }
+}
+
+// IdleTimeout is the maximum duration to wait for the next request when keep-alives are enabled
+func IdleTimeout(timeout time.Duration) ServerOption {
+	return func(server *http.Server) { server.IdleTimeout = timeout }
+}
+
+// MaxHeaderBytes is the maximum number of bytes of the request headers, including the request line
+func MaxHeaderBytes(size int) ServerOption {
+	return func(server *http.Server) { server.MaxHeaderBytes = size }
+}
+
+// KeepAlives enables or disables HTTP keep-alives, they are enabled by default
+func KeepAlives(enabled bool) ServerOption {
+	return func(server *http.Server) { server.SetKeepAlivesEnabled(enabled) }
+}
+
+// newServer returns the http server of the application listening on addr,
+// configured by the options of the application then options
+func (e *Micro) newServer(addr string, options ...ServerOption) *http.Server {
+	server := &http.Server{Addr: addr, Handler: e}
+	for _, option := range append(e.serverOptions[:len(e.serverOptions):len(e.serverOptions)], options...) {
+		option(server)
+	}
+	return server
+}
+
+// listen returns the listener inherited from the parent process if any, see Upgrade,
+// or listens on the TCP network address addr
+func (e *Micro) listen(addr string) (net.Listener, error) {
+	if listener, err := inheritedListener(); listener != nil || err != nil {
+		return listener, err
+	}
+	if addr == "" {
+		addr = ":http"
+	}
+	return net.Listen("tcp", addr)
+}
+
+// serve serves the application with server on listener,
+// over TLS if certFile and keyFile are set or server has a TLS configuration
+func (e *Micro) serve(server *http.Server, listener net.Listener, certFile string, keyFile string) error {
+	if err := e.Boot(); err != nil {
+		listener.Close()
+		return err
+	}
+	e.serverMutex.Lock()
+	e.servers = append(e.servers, server)
+	e.listeners = append(e.listeners, listener)
+	e.serverMutex.Unlock()
+	if err := notifyReady(); err != nil {
+		listener.Close()
+		return err
+	}
+	var err error
+	if server.TLSConfig != nil || certFile != "" {
+		err = server.ServeTLS(listener, certFile, keyFile)
+	} else {
+		err = server.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		// wait for in-flight requests and shutdown hooks
+		e.serverMutex.Lock()
+		done := e.shutdownDone
+		e.serverMutex.Unlock()
+		if done != nil {
+			<-done
+		}
+	}
+	return err
+}
+
+// Run listens on the TCP network address addr and serves the application.
+// options apply to this server in addition to the options of the application:
+//
+//	app.Run(":8080", micro.ReadHeaderTimeout(5*time.Second), micro.IdleTimeout(time.Minute))
+//
+// It always returns a non-nil error.
+func (e *Micro) Run(addr string, options ...ServerOption) error {
+	listener, err := e.listen(addr)
+	if err != nil {
+		return err
+	}
+	return e.serve(e.newServer(addr, options...), listener, "", "")
+}
+
+// Serve serves the application on the connections accepted by listener,
+// which is closed when Serve returns. It always returns a non-nil error.
+func (e *Micro) Serve(listener net.Listener, options ...ServerOption) error {
+	return e.serve(e.newServer(listener.Addr().String(), options...), listener, "", "")
+}
+
+// RunUnix listens on the unix domain socket path and serves the application,
+// for instance behind a reverse proxy on the same host. A stale socket file at path
+// is removed first, and the socket file gets the permissions perm.
+// It always returns a non-nil error.
+func (e *Micro) RunUnix(path string, perm fs.FileMode, options ...ServerOption) error {
+	if listener, err := inheritedListener(); listener != nil || err != nil {
+		if err != nil {
+			return err
+		}
+		return e.Serve(listener, options...)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		listener.Close()
+		return err
+	}
+	return e.Serve(listener, options...)
+}
+
+// RunTLS listens on the TCP network address addr and serves the application over HTTPS
+// with the certificate and matching private key of certFile and keyFile.
+// It always returns a non-nil error.
+func (e *Micro) RunTLS(addr string, certFile string, keyFile string, options ...ServerOption) error {
+	if addr == "" {
+		addr = ":https"
+	}
+	listener, err := e.listen(addr)
+	if err != nil {
+		return err
+	}
+	return e.serve(e.newServer(addr, options...), listener, certFile, keyFile)
+}
+
+// RunTLSConfig listens on the TCP network address addr and serves the application over HTTPS
+// with the certificates of config, which must have Certificates or GetCertificate set.
+// It always returns a non-nil error.
+func (e *Micro) RunTLSConfig(addr string, config *tls.Config, options ...ServerOption) error {
+	if addr == "" {
+		addr = ":https"
+	}
+	listener, err := e.listen(addr)
+	if err != nil {
+		return err
+	}
+	server := e.newServer(addr, options...)
+	server.TLSConfig = config
+	return e.serve(server, listener, "", "")
+}
+
+// DefaultShutdownTimeout is the duration ShutdownOn waits for in-flight requests and shutdown hooks
+// when the application has no shutdown timeout
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Shutdown gracefully shuts the servers of the application down, waiting for in-flight requests
+// until ctx is done, then cancels the workers and waits for them, then executes the shutdown hooks.
+// Run and its variants return http.ErrServerClosed once Shutdown is complete.
+func (e *Micro) Shutdown(ctx context.Context) error {
+	e.serverMutex.Lock()
+	servers := e.servers
+	e.servers, e.listeners = nil, nil
+	done := make(chan struct{})
+	e.shutdownDone = done
+	e.serverMutex.Unlock()
+	defer close(done)
+	var errs []error
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := e.stopWorkers(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	for _, hook := range e.shutdownHooks {
+		if err := hook(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetShutdownTimeout sets the duration ShutdownOn waits for in-flight requests and shutdown hooks
+func (e *Micro) SetShutdownTimeout(timeout time.Duration) {
+	e.shutdownTimeout = timeout
+}
+
+// ShutdownTimeout returns the duration ShutdownOn waits for in-flight requests and shutdown hooks
+func (e *Micro) ShutdownTimeout() time.Duration {
+	if e.shutdownTimeout == 0 {
+		return DefaultShutdownTimeout
+	}
+	return e.shutdownTimeout
+}
+
+// ShutdownOn shuts the application down with Shutdown when the process receives one of signals,
+// os.Interrupt and SIGTERM by default:
+//
+//	app.ShutdownOn()
+//	if err := app.Run(":8080"); !errors.Is(err, http.ErrServerClosed) {
+//		log.Fatal(err)
+//	}
+func (e *Micro) ShutdownOn(signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	notifications := make(chan os.Signal, 1)
+	signal.Notify(notifications, signals...)
+	go func() {
+		received := <-notifications
+		signal.Stop(notifications)
+		e.Logger().Info("shutting down", "signal", received.String())
+		ctx, cancel := context.WithTimeout(context.Background(), e.ShutdownTimeout())
+		defer cancel()
+		if err := e.Shutdown(ctx); err != nil {
+			e.Logger().Error("shutdown failed", "error", err)
+		}
+	}()
+}
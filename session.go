@@ -0,0 +1,298 @@
+package micro
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/**********************************/
+/*            SESSIONS            */
+/**********************************/
+
+// DefaultSessionCookieName is the name of the session cookie of SessionConfig without a cookie name
+var DefaultSessionCookieName = "micro_session"
+
+// DefaultSessionMaxAge is the lifetime of the sessions of SessionConfig without a max age
+var DefaultSessionMaxAge = 24 * time.Hour
+
+var (
+	// ErrSessionNotFound is returned by session stores loading a session which does not exist or expired
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionTampered is returned by session stores loading a session which was modified by the client
+	ErrSessionTampered = errors.New("session tampered")
+	// ErrSessionTooLarge is returned by session stores saving a session exceeding their size limit
+	ErrSessionTooLarge = errors.New("session too large")
+)
+
+// Session holds the values of a client between requests.
+// It is loaded by the Sessions middleware and injected in handlers:
+//
+//	app.Post("/login", func(ctx *micro.Context, session *micro.Session) {
+//		session.RenewID()
+//		session.Set("user", user.ID)
+//	})
+type Session struct {
+	// ID identifies the session, it is renewed by RenewID
+	ID string
+	// Values are the values of the session, modified with Set and Delete
+	Values map[string]string
+	// UserID identifies the user the session belongs to, set with SetUserID
+	UserID string
+	// ExpiresAt is when the session expires
+	ExpiresAt time.Time
+	mutex     sync.RWMutex
+	isNew     bool
+	modified  bool
+	destroyed bool
+	// previousID is the ID of the session before RenewID, deleted from the store when the session is saved
+	previousID string
+}
+
+// NewSession creates a session with a random ID
+func NewSession() *Session {
+	id := make([]byte, 32)
+	rand.Read(id)
+	return &Session{ID: base64.RawURLEncoding.EncodeToString(id), Values: map[string]string{}, isNew: true}
+}
+
+// Get returns the value of key, empty if it is not set
+func (session *Session) Get(key string) string {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+	return session.Values[key]
+}
+
+// Set sets the value of key
+func (session *Session) Set(key string, value string) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.Values[key] = value
+	session.modified = true
+}
+
+// Delete deletes the value of key
+func (session *Session) Delete(key string) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	delete(session.Values, key)
+	session.modified = true
+}
+
+// SetUserID associates the session with a user, so stores implementing UserSessionStore
+// can delete all the sessions of the user, on password change for instance
+func (session *Session) SetUserID(userID string) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.UserID = userID
+	session.modified = true
+}
+
+// RenewID gives a new ID to the session, the values are kept.
+// It should be called when the privileges of the client change, such as on login, to prevent session fixation.
+func (session *Session) RenewID() {
+	renewed := NewSession()
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if !session.isNew && session.previousID == "" {
+		session.previousID = session.ID
+	}
+	session.ID = renewed.ID
+	session.modified = true
+}
+
+// Destroy deletes the session from the store and the client once the request is handled
+func (session *Session) Destroy() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.Values = map[string]string{}
+	session.destroyed = true
+}
+
+// IsNew returns true if the session was created during the request
+func (session *Session) IsNew() bool {
+	return session.isNew
+}
+
+// SessionStore persists sessions. The cookie of the client holds a value returned by Save,
+// such as the ID of the session or the session itself.
+// Save and Delete are called with the session locked, they read its fields rather than calling its methods.
+type SessionStore interface {
+	// Load returns the session of the cookie value,
+	// ErrSessionNotFound if it does not exist or expired, ErrSessionTampered if it is invalid
+	Load(ctx context.Context, value string) (*Session, error)
+	// Save persists session until its ExpiresAt, and returns the value of the cookie of the client
+	Save(ctx context.Context, session *Session) (value string, err error)
+	// Delete deletes session
+	Delete(ctx context.Context, session *Session) error
+}
+
+// SessionToucher is implemented by session stores which can extend the expiration of a session
+// without saving its values, it is used by the Sessions middleware for sliding expiration
+type SessionToucher interface {
+	// Touch extends the expiration of session to its ExpiresAt
+	Touch(ctx context.Context, session *Session) error
+}
+
+// UserSessionStore is implemented by session stores which can delete the sessions of a user,
+// the sessions associated to the user with Session.SetUserID
+type UserSessionStore interface {
+	// DeleteUserSessions deletes the sessions of userID
+	DeleteUserSessions(ctx context.Context, userID string) error
+}
+
+// SessionConfig configures the Sessions middleware
+type SessionConfig struct {
+	Store SessionStore
+	// CookieName is the name of the session cookie, DefaultSessionCookieName if empty
+	CookieName string
+	// MaxAge is the lifetime of a session since it was last saved, DefaultSessionMaxAge if zero
+	MaxAge time.Duration
+	// Sliding extends the lifetime of sessions to MaxAge on every request, so only inactive sessions expire.
+	// Sessions are touched if the store implements SessionToucher, saved otherwise.
+	Sliding bool
+	// Path, Domain, Secure and SameSite are the attributes of the session cookie,
+	// the path is / and SameSite is lax by default
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// Sessions returns a middleware loading the session of the request from config.Store,
+// registering it in the request injector, and saving it before the response is written if it was modified.
+// Sessions without values are not saved, so anonymous clients do not receive a cookie:
+//
+//	app.Use("/", micro.Sessions(micro.SessionConfig{
+//		Store:  micro.NewCookieStore(currentKey, previousKey),
+//		Secure: true,
+//	}))
+//
+// Can Panic! if config has no store
+func Sessions(config SessionConfig) HandlerFunction {
+	if config.Store == nil {
+		panic("the sessions middleware requires a store")
+	}
+	if config.CookieName == "" {
+		config.CookieName = DefaultSessionCookieName
+	}
+	if config.MaxAge == 0 {
+		config.MaxAge = DefaultSessionMaxAge
+	}
+	if config.Path == "" {
+		config.Path = "/"
+	}
+	if config.SameSite == 0 {
+		config.SameSite = http.SameSiteLaxMode
+	}
+	return func(ctx *Context, rw *ResponseWriterWithCode, injector *Injector, next Next) {
+		session, value := config.load(ctx)
+		injector.Register(session)
+		saved := false
+		save := func() {
+			if !saved {
+				saved = true
+				config.save(ctx, session, value)
+			}
+		}
+		// the cookie must be set before the header is written
+		onWriteHeader := rw.onWriteHeader
+		rw.onWriteHeader = func() {
+			save()
+			if onWriteHeader != nil {
+				onWriteHeader()
+			}
+		}
+		next()
+		save()
+	}
+}
+
+// load returns the session of the request and the value of its cookie,
+// a new session if it has none or it cannot be loaded
+func (config *SessionConfig) load(ctx *Context) (*Session, string) {
+	cookie, err := ctx.Request.Cookie(config.CookieName)
+	if err != nil {
+		return NewSession(), ""
+	}
+	session, err := config.Store.Load(ctx.Request.Context(), cookie.Value)
+	if err != nil {
+		if !errors.Is(err, ErrSessionNotFound) {
+			ctx.logger().Warn("cannot load session", "error", err)
+		}
+		return NewSession(), ""
+	}
+	if session.Values == nil {
+		session.Values = map[string]string{}
+	}
+	return session, cookie.Value
+}
+
+// save saves, touches or deletes session and sets the session cookie of the response accordingly,
+// value is the value of the cookie session was loaded from
+func (config *SessionConfig) save(ctx *Context, session *Session, value string) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	requestContext := ctx.Request.Context()
+	if session.previousID != "" {
+		if err := config.Store.Delete(requestContext, &Session{ID: session.previousID}); err != nil {
+			ctx.logger().Error("cannot delete session", "error", err)
+		}
+	}
+	cookie := &http.Cookie{
+		Name:     config.CookieName,
+		Path:     config.Path,
+		Domain:   config.Domain,
+		Secure:   config.Secure,
+		HttpOnly: true,
+		SameSite: config.SameSite,
+	}
+	switch {
+	case session.destroyed:
+		// a renewed session was not saved yet, its previous ID is deleted above
+		if !session.isNew && session.previousID == "" {
+			if err := config.Store.Delete(requestContext, session); err != nil {
+				ctx.logger().Error("cannot delete session", "error", err)
+			}
+		}
+		cookie.MaxAge = -1
+	case session.modified && (len(session.Values) > 0 || session.UserID != "" || !session.isNew):
+		session.ExpiresAt = time.Now().Add(config.MaxAge)
+		saved, err := config.Store.Save(requestContext, session)
+		if err != nil {
+			ctx.logger().Error("cannot save session", "error", err)
+			return
+		}
+		cookie.Value, cookie.MaxAge = saved, int(config.MaxAge/time.Second)
+	case config.Sliding && !session.isNew:
+		session.ExpiresAt = time.Now().Add(config.MaxAge)
+		if toucher, ok := config.Store.(SessionToucher); ok {
+			if err := toucher.Touch(requestContext, session); err != nil {
+				ctx.logger().Error("cannot touch session", "error", err)
+				return
+			}
+		} else if saved, err := config.Store.Save(requestContext, session); err != nil {
+			ctx.logger().Error("cannot save session", "error", err)
+			return
+		} else {
+			value = saved
+		}
+		cookie.Value, cookie.MaxAge = value, int(config.MaxAge/time.Second)
+	default:
+		return
+	}
+	http.SetCookie(ctx.Response, cookie)
+}
+
+// Session returns the session loaded by the Sessions middleware, nil if the middleware is not used
+func (ctx *Context) Session() *Session {
+	if ctx.injector == nil {
+		return nil
+	}
+	session, _ := Resolve[*Session](ctx.injector)
+	return session
+}
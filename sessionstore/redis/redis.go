@@ -0,0 +1,137 @@
+//go:build adapters
+
+// Package redis stores micro sessions in Redis, so the instances of an application share them.
+//
+//	client := goredis.NewClient(&goredis.Options{Addr: "localhost:6379"})
+//	app.Use("/", micro.Sessions(micro.SessionConfig{Store: redis.New(client), Sliding: true}))
+//
+// Sessions are stored as JSON in keys expiring with them, so Redis discards abandoned sessions.
+// The IDs of the sessions of a user are kept in a set, which lets DeleteUserSessions
+// log a user out of all their devices.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/interactiv/micro"
+)
+
+/**********************************/
+/*          REDIS STORE           */
+/**********************************/
+
+// DefaultPrefix is the prefix of the keys of stores created by New
+var DefaultPrefix = "micro:session:"
+
+// Store is a micro.SessionStore keeping sessions in Redis keys expiring with the sessions.
+// The IDs of the sessions of a user are kept in a set, so they can be deleted together.
+type Store struct {
+	client goredis.UniversalClient
+	// Prefix is the prefix of the keys of the store
+	Prefix string
+}
+
+// New creates a store keeping sessions in the Redis of client
+func New(client goredis.UniversalClient) *Store {
+	return &Store{client: client, Prefix: DefaultPrefix}
+}
+
+// storedSession is the representation of a session in Redis
+type storedSession struct {
+	Values    map[string]string `json:"values"`
+	UserID    string            `json:"user_id,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Load returns the session whose ID is value
+func (store *Store) Load(ctx context.Context, value string) (*micro.Session, error) {
+	payload, err := store.client.Get(ctx, store.key(value)).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, micro.ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	stored := storedSession{}
+	if err := json.Unmarshal(payload, &stored); err != nil {
+		return nil, err
+	}
+	return &micro.Session{ID: value, Values: stored.Values, UserID: stored.UserID, ExpiresAt: stored.ExpiresAt}, nil
+}
+
+// Save stores session until it expires and returns its ID
+func (store *Store) Save(ctx context.Context, session *micro.Session) (string, error) {
+	payload, err := json.Marshal(storedSession{Values: session.Values, UserID: session.UserID, ExpiresAt: session.ExpiresAt})
+	if err != nil {
+		return "", err
+	}
+	ttl := time.Until(session.ExpiresAt)
+	_, err = store.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, store.key(session.ID), payload, ttl)
+		if session.UserID != "" {
+			store.index(ctx, pipe, session, ttl)
+		}
+		return nil
+	})
+	return session.ID, err
+}
+
+// Touch extends the expiration of session to its ExpiresAt
+func (store *Store) Touch(ctx context.Context, session *micro.Session) error {
+	ttl := time.Until(session.ExpiresAt)
+	_, err := store.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Expire(ctx, store.key(session.ID), ttl)
+		if session.UserID != "" {
+			store.index(ctx, pipe, session, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Delete deletes session
+func (store *Store) Delete(ctx context.Context, session *micro.Session) error {
+	_, err := store.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Del(ctx, store.key(session.ID))
+		if session.UserID != "" {
+			pipe.SRem(ctx, store.userKey(session.UserID), session.ID)
+		}
+		return nil
+	})
+	return err
+}
+
+// DeleteUserSessions deletes the sessions of userID
+func (store *Store) DeleteUserSessions(ctx context.Context, userID string) error {
+	ids, err := store.client.SMembers(ctx, store.userKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{store.userKey(userID)}
+	for _, id := range ids {
+		keys = append(keys, store.key(id))
+	}
+	return store.client.Del(ctx, keys...).Err()
+}
+
+// index adds session to the set of the sessions of its user, which expires with the last of them
+func (store *Store) index(ctx context.Context, pipe goredis.Pipeliner, session *micro.Session, ttl time.Duration) {
+	pipe.SAdd(ctx, store.userKey(session.UserID), session.ID)
+	pipe.ExpireGT(ctx, store.userKey(session.UserID), ttl)
+	// ExpireGT does not apply to a set created without expiration by SAdd
+	pipe.ExpireNX(ctx, store.userKey(session.UserID), ttl)
+}
+
+// key returns the key of the session whose ID is id
+func (store *Store) key(id string) string {
+	return store.Prefix + id
+}
+
+// userKey returns the key of the set of the sessions of userID
+func (store *Store) userKey(userID string) string {
+	return store.Prefix + "user:" + userID
+}
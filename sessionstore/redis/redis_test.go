@@ -0,0 +1,59 @@
+//go:build adapters
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/interactiv/expect"
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/interactiv/micro"
+)
+
+var (
+	_ micro.SessionStore     = (*Store)(nil)
+	_ micro.SessionToucher   = (*Store)(nil)
+	_ micro.UserSessionStore = (*Store)(nil)
+)
+
+func TestKeys(t *testing.T) {
+	e := expect.New(t)
+	store := New(goredis.NewClient(&goredis.Options{Addr: "localhost:6379"}))
+	e.Expect(store.key("abc")).ToBe("micro:session:abc")
+	e.Expect(store.userKey("42")).ToBe("micro:session:user:42")
+}
+
+// TestStore runs against the Redis server at REDIS_ADDR
+func TestStore(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	e := expect.New(t)
+	ctx := context.Background()
+	store := New(goredis.NewClient(&goredis.Options{Addr: addr}))
+	store.Prefix = "micro:test:" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":"
+	session := &micro.Session{ID: "first", Values: map[string]string{"theme": "dark"}, UserID: "42", ExpiresAt: time.Now().Add(time.Minute)}
+	id, err := store.Save(ctx, session)
+	e.Expect(err).ToBeNil()
+	loaded, err := store.Load(ctx, id)
+	e.Expect(err).ToBeNil()
+	e.Expect(loaded.Values["theme"]).ToBe("dark")
+	e.Expect(loaded.UserID).ToBe("42")
+	e.Expect(store.Touch(ctx, session)).ToBeNil()
+	_, err = store.Save(ctx, &micro.Session{ID: "second", Values: map[string]string{}, UserID: "42", ExpiresAt: time.Now().Add(time.Minute)})
+	e.Expect(err).ToBeNil()
+	e.Expect(store.DeleteUserSessions(ctx, "42")).ToBeNil()
+	for _, id := range []string{"first", "second"} {
+		_, err = store.Load(ctx, id)
+		e.Expect(errors.Is(err, micro.ErrSessionNotFound)).ToBeTrue()
+	}
+	_, err = store.Load(ctx, "missing")
+	e.Expect(errors.Is(err, micro.ErrSessionNotFound)).ToBeTrue()
+}
@@ -0,0 +1,156 @@
+// Package sql stores micro sessions in a SQL database, so the instances of an application share them.
+//
+// Sessions are stored in a table with the following columns, to be created by the application:
+//
+//	CREATE TABLE sessions (
+//		id VARCHAR(64) PRIMARY KEY,
+//		user_id VARCHAR(255) NOT NULL,
+//		data TEXT NOT NULL,
+//		expires_at TIMESTAMP NOT NULL
+//	);
+//	CREATE INDEX sessions_user_id ON sessions (user_id);
+//	CREATE INDEX sessions_expires_at ON sessions (expires_at);
+//
+// Expired sessions are never loaded, they are deleted with DeleteExpired, usually scheduled:
+//
+//	store := sql.New(db, "sessions", sql.PostgreSQL)
+//	app.Use("/", micro.Sessions(micro.SessionConfig{Store: store, Sliding: true}))
+//	app.Schedule("*/15 * * * *", func(ctx context.Context) error {
+//		_, err := store.DeleteExpired(ctx)
+//		return err
+//	})
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/interactiv/micro"
+)
+
+/**********************************/
+/*           SQL STORE            */
+/**********************************/
+
+// QuestionPlaceholder returns the ? placeholder of MySQL and SQLite
+func QuestionPlaceholder(int) string {
+	return "?"
+}
+
+// DollarPlaceholder returns the $n placeholder of PostgreSQL
+func DollarPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// Dialect is the SQL dialect of the database of a store
+type Dialect struct {
+	// Placeholder returns the placeholder of the nth argument of a query, starting at 1
+	Placeholder func(n int) string
+	// Upsert is the clause of the INSERT statement of Save replacing the columns of the session if it exists
+	Upsert string
+}
+
+// MySQL is the dialect of MySQL and MariaDB
+var MySQL = Dialect{
+	Placeholder: QuestionPlaceholder,
+	Upsert:      "ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), data = VALUES(data), expires_at = VALUES(expires_at)",
+}
+
+// PostgreSQL is the dialect of PostgreSQL
+var PostgreSQL = Dialect{
+	Placeholder: DollarPlaceholder,
+	Upsert:      "ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, data = excluded.data, expires_at = excluded.expires_at",
+}
+
+// SQLite is the dialect of SQLite, from version 3.24
+var SQLite = Dialect{
+	Placeholder: QuestionPlaceholder,
+	Upsert:      PostgreSQL.Upsert,
+}
+
+// Store is a micro.SessionStore keeping sessions in a table
+type Store struct {
+	db      *sql.DB
+	table   string
+	dialect Dialect
+}
+
+// New creates a store keeping sessions in table of db, queried in dialect
+func New(db *sql.DB, table string, dialect Dialect) *Store {
+	return &Store{db: db, table: table, dialect: dialect}
+}
+
+// Load returns the session whose ID is value, if it has not expired
+func (store *Store) Load(ctx context.Context, value string) (*micro.Session, error) {
+	session := &micro.Session{ID: value}
+	var data string
+	err := store.db.QueryRowContext(ctx,
+		store.query("SELECT user_id, data, expires_at FROM %s WHERE id = %s AND expires_at > %s"), value, time.Now().UTC()).
+		Scan(&session.UserID, &data, &session.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, micro.ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &session.Values); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Save inserts or updates session with the upsert statement of the dialect of the store and returns its ID
+func (store *Store) Save(ctx context.Context, session *micro.Session) (string, error) {
+	data, err := json.Marshal(session.Values)
+	if err != nil {
+		return "", err
+	}
+	_, err = store.db.ExecContext(ctx,
+		store.query("INSERT INTO %s (id, user_id, data, expires_at) VALUES (%s, %s, %s, %s) ")+store.dialect.Upsert,
+		session.ID, session.UserID, string(data), session.ExpiresAt.UTC())
+	if err != nil {
+		return "", err
+	}
+	return session.ID, nil
+}
+
+// Touch extends the expiration of session to its ExpiresAt
+func (store *Store) Touch(ctx context.Context, session *micro.Session) error {
+	_, err := store.db.ExecContext(ctx, store.query("UPDATE %s SET expires_at = %s WHERE id = %s"),
+		session.ExpiresAt.UTC(), session.ID)
+	return err
+}
+
+// Delete deletes session
+func (store *Store) Delete(ctx context.Context, session *micro.Session) error {
+	_, err := store.db.ExecContext(ctx, store.query("DELETE FROM %s WHERE id = %s"), session.ID)
+	return err
+}
+
+// DeleteUserSessions deletes the sessions of userID
+func (store *Store) DeleteUserSessions(ctx context.Context, userID string) error {
+	_, err := store.db.ExecContext(ctx, store.query("DELETE FROM %s WHERE user_id = %s"), userID)
+	return err
+}
+
+// DeleteExpired deletes the expired sessions and returns their number
+func (store *Store) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := store.db.ExecContext(ctx, store.query("DELETE FROM %s WHERE expires_at <= %s"), time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// query returns format with the table of the store and the placeholders of its arguments
+func (store *Store) query(format string) string {
+	arguments := []interface{}{store.table}
+	for n := 1; n < strings.Count(format, "%s"); n++ {
+		arguments = append(arguments, store.dialect.Placeholder(n))
+	}
+	return fmt.Sprintf(format, arguments...)
+}
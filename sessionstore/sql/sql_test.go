@@ -0,0 +1,150 @@
+package sql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/interactiv/expect"
+	"github.com/interactiv/micro"
+	sessionsql "github.com/interactiv/micro/sessionstore/sql"
+)
+
+// statement is a statement executed by a recordingConnector
+type statement struct {
+	query     string
+	arguments []driver.Value
+}
+
+// recordingConnector is a database recording the statements it executes,
+// queries return its rows and statements affect its affected rows
+type recordingConnector struct {
+	statements []statement
+	rows       [][]driver.Value
+	affected   int64
+}
+
+func (connector *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{connector}, nil
+}
+
+func (connector *recordingConnector) Driver() driver.Driver {
+	return nil
+}
+
+// recordingConn is a connection of a recordingConnector
+type recordingConn struct {
+	connector *recordingConnector
+}
+
+func (conn *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("statements are not prepared")
+}
+
+func (conn *recordingConn) Close() error {
+	return nil
+}
+
+func (conn *recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (conn *recordingConn) ExecContext(ctx context.Context, query string, arguments []driver.NamedValue) (driver.Result, error) {
+	conn.record(query, arguments)
+	return driver.RowsAffected(conn.connector.affected), nil
+}
+
+func (conn *recordingConn) QueryContext(ctx context.Context, query string, arguments []driver.NamedValue) (driver.Rows, error) {
+	conn.record(query, arguments)
+	return &recordingRows{rows: conn.connector.rows}, nil
+}
+
+// record records the statement query executed with arguments
+func (conn *recordingConn) record(query string, arguments []driver.NamedValue) {
+	recorded := statement{query: query}
+	for _, argument := range arguments {
+		recorded.arguments = append(recorded.arguments, argument.Value)
+	}
+	conn.connector.statements = append(conn.connector.statements, recorded)
+}
+
+// recordingRows are the rows of a query of a recordingConnector
+type recordingRows struct {
+	rows [][]driver.Value
+}
+
+func (rows *recordingRows) Columns() []string {
+	return []string{"user_id", "data", "expires_at"}
+}
+
+func (rows *recordingRows) Close() error {
+	return nil
+}
+
+func (rows *recordingRows) Next(destination []driver.Value) error {
+	if len(rows.rows) == 0 {
+		return io.EOF
+	}
+	copy(destination, rows.rows[0])
+	rows.rows = rows.rows[1:]
+	return nil
+}
+
+func TestSave(t *testing.T) {
+	e := expect.New(t)
+	expiresAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for dialect, query := range map[*sessionsql.Dialect]string{
+		&sessionsql.MySQL: "INSERT INTO sessions (id, user_id, data, expires_at) VALUES (?, ?, ?, ?) " +
+			"ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), data = VALUES(data), expires_at = VALUES(expires_at)",
+		&sessionsql.PostgreSQL: "INSERT INTO sessions (id, user_id, data, expires_at) VALUES ($1, $2, $3, $4) " +
+			"ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, data = excluded.data, expires_at = excluded.expires_at",
+		&sessionsql.SQLite: "INSERT INTO sessions (id, user_id, data, expires_at) VALUES (?, ?, ?, ?) " +
+			"ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, data = excluded.data, expires_at = excluded.expires_at",
+	} {
+		connector := &recordingConnector{}
+		store := sessionsql.New(sql.OpenDB(connector), "sessions", *dialect)
+		id, err := store.Save(context.Background(), &micro.Session{
+			ID: "abc", UserID: "42", Values: map[string]string{"theme": "dark"}, ExpiresAt: expiresAt,
+		})
+		e.Expect(err).ToBeNil()
+		e.Expect(id).ToBe("abc")
+		e.Expect(len(connector.statements)).ToBe(1)
+		e.Expect(connector.statements[0].query).ToBe(query)
+		e.Expect(connector.statements[0].arguments).ToEqual([]driver.Value{"abc", "42", `{"theme":"dark"}`, expiresAt})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	e := expect.New(t)
+	expiresAt := time.Now().Add(time.Hour).UTC()
+	connector := &recordingConnector{rows: [][]driver.Value{{"42", `{"theme":"dark"}`, expiresAt}}}
+	store := sessionsql.New(sql.OpenDB(connector), "sessions", sessionsql.PostgreSQL)
+	session, err := store.Load(context.Background(), "abc")
+	e.Expect(err).ToBeNil()
+	e.Expect(session.ID).ToBe("abc")
+	e.Expect(session.UserID).ToBe("42")
+	e.Expect(session.Values["theme"]).ToBe("dark")
+	e.Expect(session.ExpiresAt.Equal(expiresAt)).ToBeTrue()
+	e.Expect(connector.statements[0].query).ToBe("SELECT user_id, data, expires_at FROM sessions WHERE id = $1 AND expires_at > $2")
+
+	connector.rows = nil
+	_, err = store.Load(context.Background(), "abc")
+	e.Expect(err).ToBe(micro.ErrSessionNotFound)
+}
+
+func TestDeleteExpired(t *testing.T) {
+	e := expect.New(t)
+	connector := &recordingConnector{affected: 3}
+	store := sessionsql.New(sql.OpenDB(connector), "sessions", sessionsql.MySQL)
+	deleted, err := store.DeleteExpired(context.Background())
+	e.Expect(err).ToBeNil()
+	e.Expect(deleted).ToBe(int64(3))
+	e.Expect(connector.statements[0].query).ToBe("DELETE FROM sessions WHERE expires_at <= ?")
+	e.Expect(store.DeleteUserSessions(context.Background(), "42")).ToBeNil()
+	e.Expect(connector.statements[1].query).ToBe("DELETE FROM sessions WHERE user_id = ?")
+	e.Expect(connector.statements[1].arguments).ToEqual([]driver.Value{"42"})
+}
@@ -0,0 +1,140 @@
+package micro
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**********************************/
+/*       SERVER SENT EVENTS       */
+/**********************************/
+
+// SSEKeepAlive is the interval at which keep-alive comments are sent on event streams.
+// A zero or negative value disables keep-alive pings.
+var SSEKeepAlive = 15 * time.Second
+
+// ErrStreamClosed is returned when sending on a closed event stream
+var ErrStreamClosed = errors.New("event stream closed")
+
+// EventStream writes server-sent events to a client
+type EventStream struct {
+	response  http.ResponseWriter
+	flusher   http.Flusher
+	mutex     sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+	closed    bool
+}
+
+// SSE starts a server-sent events stream on the response.
+// Headers are sent immediately and keep-alive pings are written every SSEKeepAlive
+// until the stream is closed or the client goes away.
+// The stream is closed once the request is handled, it should be closed by the handler
+// as soon as it is done with it:
+//
+//	stream, err := ctx.SSE()
+//	if err != nil {
+//	    return
+//	}
+//	defer stream.Close()
+//
+// It returns an error if the response writer cannot be flushed.
+func (ctx *Context) SSE() (*EventStream, error) {
+	flusher, ok := ctx.Response.(http.Flusher)
+	if wrapper, wrapped := ctx.Response.(*ResponseWriterWithCode); wrapped {
+		ok = wrapper.Supports((*http.Flusher)(nil))
+	}
+	if !ok {
+		return nil, fmt.Errorf("%T does not implement http.Flusher, server-sent events are not supported", ctx.Response)
+	}
+	header := ctx.Response.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	ctx.Response.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	stream := &EventStream{response: ctx.Response, flusher: flusher, done: make(chan struct{})}
+	var clientGone <-chan struct{}
+	if ctx.Request != nil {
+		clientGone = ctx.Request.Context().Done()
+	}
+	// streams the handler forgets to close are closed when the response is complete
+	if ctx.injector != nil {
+		ctx.injector.onCleanup(stream.Close)
+	}
+	go stream.keepAlive(clientGone)
+	return stream, nil
+}
+
+// keepAlive pings the client until the stream is closed or the client goes away
+func (stream *EventStream) keepAlive(clientGone <-chan struct{}) {
+	if SSEKeepAlive <= 0 {
+		return
+	}
+	ticker := time.NewTicker(SSEKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if stream.write(": ping\n\n") != nil {
+				return
+			}
+		case <-clientGone:
+			stream.Close()
+			return
+		case <-stream.done:
+			return
+		}
+	}
+}
+
+// Send sends an event to the client. event and id are optional,
+// multiline data is sent as multiple data fields.
+func (stream *EventStream) Send(event string, id string, data string) error {
+	var message strings.Builder
+	if event != "" {
+		fmt.Fprintf(&message, "event: %s\n", event)
+	}
+	if id != "" {
+		fmt.Fprintf(&message, "id: %s\n", id)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&message, "data: %s\n", line)
+	}
+	message.WriteString("\n")
+	return stream.write(message.String())
+}
+
+func (stream *EventStream) write(message string) error {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	if stream.closed {
+		return ErrStreamClosed
+	}
+	if _, err := stream.response.Write([]byte(message)); err != nil {
+		return err
+	}
+	stream.flusher.Flush()
+	return nil
+}
+
+// Done returns a channel closed when the stream is closed,
+// either by Close or because the client went away.
+func (stream *EventStream) Done() <-chan struct{} {
+	return stream.done
+}
+
+// Close stops keep-alive pings, further sends return ErrStreamClosed
+func (stream *EventStream) Close() {
+	stream.closeOnce.Do(func() {
+		stream.mutex.Lock()
+		stream.closed = true
+		stream.mutex.Unlock()
+		close(stream.done)
+	})
+}
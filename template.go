@@ -0,0 +1,274 @@
+package micro
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+/**********************************/
+/*        TEMPLATE RENDERER       */
+/**********************************/
+
+// CSRFTokenVar is the Context.Vars key under which CSRF middlewares store the token of the request,
+// TemplateRenderer exposes it to templates as .CSRFToken
+const CSRFTokenVar = "csrf_token"
+
+// extendsDirective matches the directive a template uses to declare its layout:
+//
+//	{{/* extends "layouts/base.html" */}}
+var extendsDirective = regexp.MustCompile(`^\s*\{\{/\*\s*extends\s+"([^"]*)"\s*\*/\}\}`)
+
+// ContextRenderer is a Renderer that receives the request Context.
+// Context.Render prefers RenderContext over Render when the application renderer implements it.
+type ContextRenderer interface {
+	Renderer
+	RenderContext(ctx *Context, w io.Writer, templateName string, data interface{}) error
+}
+
+// TemplateOptions configures a TemplateRenderer
+type TemplateOptions struct {
+	// Extension is appended to template names that have none, ".html" by default
+	Extension string
+	// Layout is the layout of templates that do not declare one with an extends directive,
+	// a template opts out of it with {{/* extends "" */}}
+	Layout string
+	// Partials are glob patterns of templates parsed with every template,
+	// so they can be included with {{template "partials/header.html" .}}
+	Partials []string
+	// Funcs are custom functions available in all templates
+	Funcs template.FuncMap
+	// Data returns data injected in templates on each request, available as .Globals
+	Data func(ctx *Context) map[string]interface{}
+	// Cache keeps parsed templates in memory, it should be enabled in production.
+	// Templates are parsed on each render otherwise.
+	Cache bool
+}
+
+// TemplateData is the value templates of a TemplateRenderer are executed with
+type TemplateData struct {
+	// Context is the request context, nil when rendering outside of a request
+	Context *Context
+	// Data is the data given to Context.Render
+	Data interface{}
+	// Globals is the data returned by TemplateOptions.Data
+	Globals map[string]interface{}
+	// CSRFToken is the CSRF token of the request if any
+	CSRFToken string
+	// CSPNonce is the Content Security Policy nonce of the request if any, see CSP
+	CSPNonce string
+}
+
+// TemplateRenderer is the default html/template Renderer.
+//
+// Templates declare the layout they extend with a directive on their first line,
+// layouts can themselves extend other layouts:
+//
+//	{{/* extends "layouts/base.html" */}}
+//	{{define "content"}}Hello {{.Data.Name}}{{end}}
+//
+// where layouts/base.html defines the blocks its children may override:
+//
+//	<html><body>{{block "content" .}}{{end}}</body></html>
+type TemplateRenderer struct {
+	fsys    fs.FS
+	options TemplateOptions
+	mutex   sync.RWMutex
+	cache   map[string]*template.Template
+}
+
+// NewTemplateRenderer returns a TemplateRenderer loading templates from fsys
+func NewTemplateRenderer(fsys fs.FS, options TemplateOptions) *TemplateRenderer {
+	if options.Extension == "" {
+		options.Extension = ".html"
+	}
+	return &TemplateRenderer{fsys: fsys, options: options, cache: map[string]*template.Template{}}
+}
+
+// NewTemplateRendererFromDir returns a TemplateRenderer loading templates from the directory dir
+func NewTemplateRendererFromDir(dir string, options TemplateOptions) *TemplateRenderer {
+	return NewTemplateRenderer(os.DirFS(dir), options)
+}
+
+// Render renders templateName outside of a request
+func (renderer *TemplateRenderer) Render(w io.Writer, templateName string, data interface{}) error {
+	return renderer.RenderContext(nil, w, templateName, data)
+}
+
+// RenderContext renders templateName with data and the per request data of ctx
+func (renderer *TemplateRenderer) RenderContext(ctx *Context, w io.Writer, templateName string, data interface{}) error {
+	tmpl, err := renderer.Template(templateName)
+	if err != nil {
+		return err
+	}
+	templateData := TemplateData{Context: ctx, Data: data, Globals: map[string]interface{}{}}
+	if ctx != nil {
+		if renderer.options.Data != nil {
+			templateData.Globals = renderer.options.Data(ctx)
+		}
+		if token, ok := GetVar[string](ctx, CSRFTokenVar); ok {
+			templateData.CSRFToken = token
+		}
+		if nonce, ok := GetVar[string](ctx, CSPNonceVar); ok {
+			templateData.CSPNonce = nonce
+		}
+	}
+	return tmpl.Execute(w, templateData)
+}
+
+// ClearCache removes the parsed templates from the cache, they are parsed again on their next render
+func (renderer *TemplateRenderer) ClearCache() {
+	renderer.mutex.Lock()
+	defer renderer.mutex.Unlock()
+	renderer.cache = map[string]*template.Template{}
+}
+
+// Template returns the parsed template templateName with its layouts and partials
+func (renderer *TemplateRenderer) Template(templateName string) (*template.Template, error) {
+	templateName = renderer.templatePath(templateName)
+	if renderer.options.Cache {
+		renderer.mutex.RLock()
+		tmpl, ok := renderer.cache[templateName]
+		renderer.mutex.RUnlock()
+		if ok {
+			return tmpl, nil
+		}
+	}
+	tmpl, err := renderer.parse(templateName)
+	if err != nil {
+		return nil, err
+	}
+	if renderer.options.Cache {
+		renderer.mutex.Lock()
+		renderer.cache[templateName] = tmpl
+		renderer.mutex.Unlock()
+	}
+	return tmpl, nil
+}
+
+// TemplateError is a template which cannot be parsed
+type TemplateError struct {
+	Name string
+	Err  error
+}
+
+// TemplateErrors are the templates which cannot be parsed, returned by TemplateRenderer.Precompile
+type TemplateErrors []TemplateError
+
+func (errs TemplateErrors) Error() string {
+	lines := []string{fmt.Sprintf("%d broken templates", len(errs))}
+	for _, err := range errs {
+		lines = append(lines, fmt.Sprintf("  %s : %v", err.Name, err.Err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Precompile parses all the templates, the files with the template extension which are not partials,
+// and caches them if the cache is enabled. It returns TemplateErrors listing the templates which
+// cannot be parsed. Applications precompile the templates of their renderer at Boot outside of debug mode,
+// so broken templates are reported before the server starts.
+func (renderer *TemplateRenderer) Precompile() error {
+	partials := map[string]bool{}
+	for _, pattern := range renderer.options.Partials {
+		matches, err := fs.Glob(renderer.fsys, pattern)
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			partials[match] = true
+		}
+	}
+	errs := TemplateErrors{}
+	err := fs.WalkDir(renderer.fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || path.Ext(name) != renderer.options.Extension || partials[name] {
+			return nil
+		}
+		if _, err := renderer.Template(name); err != nil {
+			errs = append(errs, TemplateError{Name: name, Err: err})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// parse parses a template, the layouts it extends and the partials
+func (renderer *TemplateRenderer) parse(templateName string) (*template.Template, error) {
+	// the inheritance chain, from the template to the root layout
+	chain := []string{}
+	sources := map[string]string{}
+	for current := templateName; current != ""; {
+		if _, ok := sources[current]; ok {
+			return nil, fmt.Errorf("template %s: circular layout inheritance through %s", templateName, current)
+		}
+		content, err := fs.ReadFile(renderer.fsys, current)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, current)
+		sources[current] = string(content)
+		parent := ""
+		if match := extendsDirective.FindSubmatch(content); match != nil {
+			parent = string(match[1])
+		} else if current == templateName && renderer.options.Layout != "" && renderer.templatePath(renderer.options.Layout) != templateName {
+			parent = renderer.options.Layout
+		}
+		current = ""
+		if parent != "" {
+			current = renderer.templatePath(parent)
+		}
+	}
+	root := chain[len(chain)-1]
+	tmpl := template.New(root).Funcs(renderer.options.Funcs)
+	for _, pattern := range renderer.options.Partials {
+		partials, err := fs.Glob(renderer.fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, partial := range partials {
+			if _, ok := sources[partial]; ok {
+				continue
+			}
+			content, err := fs.ReadFile(renderer.fsys, partial)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := tmpl.New(partial).Parse(string(content)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// parse from the root layout down to the template so that children override the blocks of their parents
+	if _, err := tmpl.Parse(sources[root]); err != nil {
+		return nil, err
+	}
+	for i := len(chain) - 2; i >= 0; i-- {
+		if _, err := tmpl.New(chain[i]).Parse(sources[chain[i]]); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
+
+// templatePath cleans a template name and appends the default extension if it has none
+func (renderer *TemplateRenderer) templatePath(templateName string) string {
+	templateName = strings.TrimPrefix(path.Clean("/"+templateName), "/")
+	if path.Ext(templateName) == "" {
+		templateName += renderer.options.Extension
+	}
+	return templateName
+}
@@ -0,0 +1,169 @@
+package micro
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+/**********************************/
+/*            TENANCY             */
+/**********************************/
+
+// Tenant is a customer of a multi-tenant application
+type Tenant struct {
+	ID   string
+	Name string
+	// Plan is the subscription plan of the tenant, routes can be restricted to plans with ForPlans
+	Plan string
+	// Settings are the settings of the tenant, such as its locale or its theme
+	Settings map[string]string
+}
+
+// TenantStore finds tenants by their identifiers
+type TenantStore interface {
+	// FindTenant returns the tenant identified by id, nil if there is none
+	FindTenant(ctx context.Context, id string) (*Tenant, error)
+}
+
+// TenantStoreFunc is a function implementing TenantStore
+type TenantStoreFunc func(ctx context.Context, id string) (*Tenant, error)
+
+// FindTenant calls f
+func (f TenantStoreFunc) FindTenant(ctx context.Context, id string) (*Tenant, error) {
+	return f(ctx, id)
+}
+
+// tenantKey is the key of the tenant in the request context
+type tenantKey struct{}
+
+// TenantResolver identifies the tenant of the requests before routing. The *Tenant of a request
+// is registered in the request injector, nil for requests without tenant, and stored in the request
+// context, see TenantFrom:
+//
+//	app.SetTenantResolver(micro.TenantBySubdomain("example.com", tenants))
+//	app.Get("/", func(ctx *micro.Context, tenant *micro.Tenant) error {
+//		return ctx.WriteJSON(tenant)
+//	})
+//
+// Requests with an unknown tenant are answered with 404 Not Found.
+type TenantResolver struct {
+	store TenantStore
+	// identify returns the identifier of the tenant of request, and the request path without the identifier
+	// if the identifier is part of the path
+	identify func(request *http.Request) (id string, path string)
+	// Required answers the requests without tenant with 404 Not Found
+	Required bool
+}
+
+// TenantBySubdomain identifies tenants by the subdomain of domain the requests are sent to,
+// such as acme for acme.example.com
+func TenantBySubdomain(domain string, store TenantStore) *TenantResolver {
+	suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+	return &TenantResolver{store: store, identify: func(request *http.Request) (string, string) {
+		host := request.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		subdomain, found := strings.CutSuffix(strings.ToLower(host), suffix)
+		if !found {
+			return "", ""
+		}
+		return subdomain, ""
+	}}
+}
+
+// TenantByHeader identifies tenants by a request header, such as X-Tenant-ID
+func TenantByHeader(header string, store TenantStore) *TenantResolver {
+	return &TenantResolver{store: store, identify: func(request *http.Request) (string, string) {
+		return request.Header.Get(header), ""
+	}}
+}
+
+// TenantByPathPrefix identifies tenants by the first segment of the request path, which is stripped
+// before routing: /acme/projects is routed as /projects for the tenant acme
+func TenantByPathPrefix(store TenantStore) *TenantResolver {
+	return &TenantResolver{store: store, identify: func(request *http.Request) (string, string) {
+		id, path, _ := strings.Cut(strings.TrimPrefix(request.URL.Path, "/"), "/")
+		return id, "/" + path
+	}}
+}
+
+// SetTenantResolver sets the resolver identifying the tenant of the requests
+func (e *Micro) SetTenantResolver(resolver *TenantResolver) {
+	e.tenantResolver = resolver
+}
+
+// resolveTenant resolves the tenant of the request of ctx. It returns false if the request has been answered
+// because its tenant is unknown or cannot be found.
+func (e *Micro) resolveTenant(ctx *Context) bool {
+	var tenant *Tenant
+	id, path := e.tenantResolver.identify(ctx.Request)
+	if id != "" {
+		var err error
+		if tenant, err = e.tenantResolver.store.FindTenant(ctx, id); err != nil {
+			ctx.handlerError(err)
+			return false
+		}
+	}
+	if tenant == nil && (id != "" || e.tenantResolver.Required) {
+		ctx.handlerError(NotFound("unknown tenant"))
+		return false
+	}
+	ctx.injector.Register(tenant)
+	if tenant == nil {
+		return true
+	}
+	request := ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), tenantKey{}, tenant))
+	if path != "" {
+		requestURL := *request.URL
+		requestURL.Path, requestURL.RawPath = path, ""
+		request.URL = &requestURL
+	}
+	ctx.Request = request
+	ctx.syncInjector()
+	return true
+}
+
+// TenantFrom returns the tenant of a request from its context, nil if the request has no tenant
+func TenantFrom(ctx context.Context) *Tenant {
+	tenant, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return tenant
+}
+
+// tenantMatcher matches the requests whose tenant satisfies a condition
+type tenantMatcher func(tenant *Tenant) bool
+
+func (matcher tenantMatcher) Match(request *http.Request) bool {
+	tenant := TenantFrom(request.Context())
+	return tenant != nil && matcher(tenant)
+}
+
+// ForTenants returns a matcher of the requests of the tenants identified by ids,
+// to scope routes or route collections to tenants:
+//
+//	beta := micro.NewControllerCollection()
+//	beta.AddMatcher(micro.ForTenants("acme", "globex"))
+func ForTenants(ids ...string) Matcher {
+	return tenantMatcher(func(tenant *Tenant) bool {
+		return containsString(ids, tenant.ID)
+	})
+}
+
+// ForPlans returns a matcher of the requests of the tenants subscribed to plans
+func ForPlans(plans ...string) Matcher {
+	return tenantMatcher(func(tenant *Tenant) bool {
+		return containsString(plans, tenant.Plan)
+	})
+}
+
+// containsString returns true if values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
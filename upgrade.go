@@ -0,0 +1,122 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+/**********************************/
+/*            UPGRADE             */
+/**********************************/
+
+const (
+	// ListenFDEnv is the environment variable giving a process the file descriptor
+	// of the listener inherited from its parent
+	ListenFDEnv = "MICRO_LISTEN_FD"
+	// ReadyFDEnv is the environment variable giving a process the file descriptor
+	// it writes to once it serves requests
+	ReadyFDEnv = "MICRO_READY_FD"
+)
+
+// ErrUpgrade is returned by Upgrade when the new process cannot take over
+var ErrUpgrade = errors.New("upgrade failed")
+
+// inheritedListener returns the listener whose file descriptor is given by ListenFDEnv, if any.
+// The variable is unset so the listener is only inherited once.
+func inheritedListener() (net.Listener, error) {
+	value, ok := os.LookupEnv(ListenFDEnv)
+	if !ok {
+		return nil, nil
+	}
+	os.Unsetenv(ListenFDEnv)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %w", ListenFDEnv, err)
+	}
+	file := os.NewFile(uintptr(fd), "listener")
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// notifyReady tells the parent process, if any, that the process serves requests
+// by writing to the file descriptor given by ReadyFDEnv
+func notifyReady() error {
+	value, ok := os.LookupEnv(ReadyFDEnv)
+	if !ok {
+		return nil
+	}
+	os.Unsetenv(ReadyFDEnv)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s : %w", ReadyFDEnv, err)
+	}
+	file := os.NewFile(uintptr(fd), "ready")
+	defer file.Close()
+	_, err = file.Write([]byte{1})
+	return err
+}
+
+// Upgrade restarts the application without dropping connections, typically to deploy a new binary.
+// It starts the executable of the process again with the same arguments, hands it the listening socket
+// of the application, waits until the new process serves requests, then shuts the servers
+// of the current process down once in-flight requests are finished. Run returns http.ErrServerClosed then.
+//
+//	signals := make(chan os.Signal, 1)
+//	signal.Notify(signals, syscall.SIGHUP)
+//	go func() {
+//		for range signals {
+//			if err := app.Upgrade(); err != nil {
+//				log.Println(err)
+//			}
+//		}
+//	}()
+//	log.Println(app.Run(":8080"))
+//
+// The application must be served by a single listener. Upgrade is not supported on Windows.
+func (e *Micro) Upgrade() error {
+	e.serverMutex.Lock()
+	listeners := e.listeners
+	e.serverMutex.Unlock()
+	if len(listeners) != 1 {
+		return fmt.Errorf("%w : %d listeners, 1 expected", ErrUpgrade, len(listeners))
+	}
+	filer, ok := listeners[0].(interface{ File() (*os.File, error) })
+	if !ok {
+		return fmt.Errorf("%w : %T has no file descriptor", ErrUpgrade, listeners[0])
+	}
+	listenerFile, err := filer.File()
+	if err != nil {
+		return fmt.Errorf("%w : %v", ErrUpgrade, err)
+	}
+	defer listenerFile.Close()
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("%w : %v", ErrUpgrade, err)
+	}
+	defer ready.Close()
+	executable, err := os.Executable()
+	if err != nil {
+		readyWriter.Close()
+		return fmt.Errorf("%w : %v", ErrUpgrade, err)
+	}
+	command := exec.Command(executable, os.Args[1:]...)
+	command.Stdin, command.Stdout, command.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// extra files get the file descriptors 3 and following in the new process
+	command.ExtraFiles = []*os.File{listenerFile, readyWriter}
+	command.Env = append(os.Environ(), ListenFDEnv+"=3", ReadyFDEnv+"=4")
+	err = command.Start()
+	readyWriter.Close()
+	if err != nil {
+		return fmt.Errorf("%w : %v", ErrUpgrade, err)
+	}
+	if _, err := io.ReadFull(ready, make([]byte, 1)); err != nil {
+		return fmt.Errorf("%w : new process %d is not ready : %v", ErrUpgrade, command.Process.Pid, err)
+	}
+	return e.Shutdown(context.Background())
+}
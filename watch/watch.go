@@ -0,0 +1,105 @@
+//go:build adapters
+
+// Package watch reparses the templates of micro applications when their files change in debug mode,
+// so template edits are visible on the next request and template errors are logged as soon as files are saved.
+//
+// Changes are noticed with fsnotify, without polling, and directories created under the watched one are watched too.
+// Outside of debug mode Templates does nothing, so it can be called unconditionally:
+//
+//	renderer := micro.NewTemplateRenderer(os.DirFS("templates"), micro.TemplateOptions{Cache: true})
+//	app.SetRenderer(renderer)
+//	stop, err := watch.Templates(app, renderer, "templates")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer stop()
+package watch
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/interactiv/micro"
+)
+
+/**********************************/
+/*        TEMPLATE WATCHER        */
+/**********************************/
+
+// Renderer is a renderer whose templates can be reparsed, such as *micro.TemplateRenderer
+type Renderer interface {
+	ClearCache()
+	Precompile() error
+}
+
+// Templates watches the directory dir the templates of renderer are loaded from, and its subdirectories.
+// When a file changes, the template cache is cleared and the templates are reparsed,
+// their errors are logged with the logger of app.
+// Outside of debug mode it does nothing. The returned function stops watching.
+func Templates(app *micro.Micro, renderer Renderer, dir string) (stop func() error, err error) {
+	if !app.Debug() {
+		return func() error { return nil }, nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		return watcher.Add(path)
+	})
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// new directories are watched too
+				if event.Has(fsnotify.Create) {
+					if stat, err := os.Stat(event.Name); err == nil && stat.IsDir() {
+						watcher.Add(event.Name)
+					}
+				}
+				if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+					continue
+				}
+				reparse(app, renderer, event.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				app.Logger().Error("template watcher error", "error", err)
+			}
+		}
+	}()
+	return watcher.Close, nil
+}
+
+// reparse clears the template cache of renderer and reparses its templates after the file name changed
+func reparse(app *micro.Micro, renderer Renderer, name string) {
+	renderer.ClearCache()
+	err := renderer.Precompile()
+	var templateErrors micro.TemplateErrors
+	if errors.As(err, &templateErrors) {
+		for _, templateError := range templateErrors {
+			app.Logger().Error("broken template", "template", templateError.Name, "error", templateError.Err)
+		}
+		return
+	}
+	if err != nil {
+		app.Logger().Error("cannot reparse templates", "error", err)
+		return
+	}
+	app.Logger().Info("templates reparsed", "changed", name)
+}
@@ -0,0 +1,65 @@
+//go:build adapters
+
+package watch_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/interactiv/expect"
+	"github.com/interactiv/micro"
+	"github.com/interactiv/micro/watch"
+)
+
+// renderer records the reparsing of its templates
+type renderer struct {
+	reparsed chan struct{}
+}
+
+func (renderer *renderer) ClearCache() {}
+
+func (renderer *renderer) Precompile() error {
+	select {
+	case renderer.reparsed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func TestTemplates(t *testing.T) {
+	e := expect.New(t)
+	dir := t.TempDir()
+	app := micro.New()
+	app.SetDebug(true)
+	templates := &renderer{reparsed: make(chan struct{}, 1)}
+	stop, err := watch.Templates(app, templates, dir)
+	e.Expect(err).ToBeNil()
+	defer stop()
+	e.Expect(os.Mkdir(filepath.Join(dir, "partials"), 0755)).ToBeNil()
+	<-templates.reparsed
+	// the new directory is watched too
+	time.Sleep(50 * time.Millisecond)
+	e.Expect(os.WriteFile(filepath.Join(dir, "partials", "header.html"), []byte("<h1>{{.}}</h1>"), 0644)).ToBeNil()
+	select {
+	case <-templates.reparsed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the templates are not reparsed when a file changes")
+	}
+}
+
+func TestTemplatesOutsideDebugMode(t *testing.T) {
+	e := expect.New(t)
+	dir := t.TempDir()
+	templates := &renderer{reparsed: make(chan struct{}, 1)}
+	stop, err := watch.Templates(micro.New(), templates, dir)
+	e.Expect(err).ToBeNil()
+	e.Expect(os.WriteFile(filepath.Join(dir, "index.html"), []byte("index"), 0644)).ToBeNil()
+	select {
+	case <-templates.reparsed:
+		t.Fatal("the templates are reparsed outside of debug mode")
+	case <-time.After(100 * time.Millisecond):
+	}
+	e.Expect(stop()).ToBeNil()
+}
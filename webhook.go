@@ -0,0 +1,211 @@
+package micro
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**********************************/
+/*            WEBHOOKS            */
+/**********************************/
+
+// WebhookMaxBodySize is the maximum size of the bodies of webhook requests
+var WebhookMaxBodySize int64 = 1 << 20
+
+// DefaultWebhookTolerance is the maximum age of the timestamped webhook requests of the Stripe and Slack schemes
+const DefaultWebhookTolerance = 5 * time.Minute
+
+// Webhook verification errors, sent to the client as 401 Unauthorized HTTPErrors
+var (
+	ErrWebhookSignature = errors.New("invalid webhook signature")
+	ErrWebhookTimestamp = errors.New("webhook timestamp outside of tolerance")
+	ErrWebhookReplay    = errors.New("webhook replayed")
+)
+
+// WebhookScheme is how the senders of webhooks sign their requests
+type WebhookScheme struct {
+	// Tolerance is the maximum age of requests, for schemes signing a timestamp.
+	// Requests whose signature has already been verified within the tolerance are rejected as replays.
+	Tolerance time.Duration
+	// verify returns the time the request with header and body was signed at if it is signed with secret,
+	// a zero time for schemes without timestamps, and the signature of the request
+	verify func(header http.Header, body []byte, secret []byte) (time.Time, string, error)
+}
+
+// WebhookSecretProvider returns the secrets requests can be signed with, several secrets
+// allow rotating them. The context gives access to the route params, for per tenant secrets.
+type WebhookSecretProvider func(ctx *Context) ([]string, error)
+
+// WebhookSecrets returns a provider of constant secrets
+func WebhookSecrets(secrets ...string) WebhookSecretProvider {
+	return func(ctx *Context) ([]string, error) {
+		return secrets, nil
+	}
+}
+
+// HMACWebhook is the scheme of requests whose header contains prefix followed by
+// the hexadecimal HMAC-SHA256 of their body
+func HMACWebhook(header string, prefix string) WebhookScheme {
+	return WebhookScheme{verify: func(headers http.Header, body []byte, secret []byte) (time.Time, string, error) {
+		signature, found := strings.CutPrefix(headers.Get(header), prefix)
+		if !found || !hmacEqual(secret, body, signature) {
+			return time.Time{}, "", ErrWebhookSignature
+		}
+		return time.Time{}, signature, nil
+	}}
+}
+
+// GitHubWebhook is the scheme of GitHub webhooks, signed in the X-Hub-Signature-256 header.
+// GitHub does not sign timestamps, so its requests are not checked for replays.
+func GitHubWebhook() WebhookScheme {
+	return HMACWebhook("X-Hub-Signature-256", "sha256=")
+}
+
+// StripeWebhook is the scheme of Stripe webhooks, signed with their timestamp in the Stripe-Signature header
+func StripeWebhook() WebhookScheme {
+	return WebhookScheme{Tolerance: DefaultWebhookTolerance, verify: func(header http.Header, body []byte, secret []byte) (time.Time, string, error) {
+		timestamp, signatures := "", []string{}
+		for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				signatures = append(signatures, value)
+			}
+		}
+		signedAt, err := parseUnixTimestamp(timestamp)
+		if err != nil {
+			return time.Time{}, "", ErrWebhookSignature
+		}
+		payload := append([]byte(timestamp+"."), body...)
+		for _, signature := range signatures {
+			if hmacEqual(secret, payload, signature) {
+				return signedAt, signature, nil
+			}
+		}
+		return time.Time{}, "", ErrWebhookSignature
+	}}
+}
+
+// SlackWebhook is the scheme of Slack requests, signed with their timestamp in the X-Slack-Signature header
+func SlackWebhook() WebhookScheme {
+	return WebhookScheme{Tolerance: DefaultWebhookTolerance, verify: func(header http.Header, body []byte, secret []byte) (time.Time, string, error) {
+		timestamp := header.Get("X-Slack-Request-Timestamp")
+		signedAt, err := parseUnixTimestamp(timestamp)
+		if err != nil {
+			return time.Time{}, "", ErrWebhookSignature
+		}
+		signature, found := strings.CutPrefix(header.Get("X-Slack-Signature"), "v0=")
+		if !found || !hmacEqual(secret, append([]byte("v0:"+timestamp+":"), body...), signature) {
+			return time.Time{}, "", ErrWebhookSignature
+		}
+		return signedAt, signature, nil
+	}}
+}
+
+// VerifyWebhook returns a middleware verifying the signature of webhook requests with the secrets of provider.
+// Requests with an invalid signature, an expired timestamp or which are replayed are answered with 401 Unauthorized.
+// The body is read to be verified, and replaced by a copy so handlers can still read it:
+//
+//	app.Use("/webhooks/stripe", micro.VerifyWebhook(micro.StripeWebhook(), micro.WebhookSecrets(secret)))
+//	app.Post("/webhooks/stripe", func(ctx *micro.Context) error {
+//		event := &StripeEvent{}
+//		if err := ctx.ReadJSON(event); err != nil {
+//			return err
+//		}
+//		...
+//	})
+//
+// Bodies larger than WebhookMaxBodySize are answered with 413 Request Entity Too Large.
+func VerifyWebhook(scheme WebhookScheme, provider WebhookSecretProvider) HandlerFunction {
+	replays := &webhookReplays{seen: map[string]time.Time{}}
+	return func(ctx *Context, next Next) error {
+		body, err := io.ReadAll(http.MaxBytesReader(ctx.Response, ctx.Request.Body, WebhookMaxBodySize))
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return NewHTTPError(http.StatusRequestEntityTooLarge, "")
+		} else if err != nil {
+			return err
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		ctx.Request.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		secrets, err := provider(ctx)
+		if err != nil {
+			return err
+		}
+		err = ErrWebhookSignature
+		var signedAt time.Time
+		var signature string
+		for _, secret := range secrets {
+			if signedAt, signature, err = scheme.verify(ctx.Request.Header, body, []byte(secret)); err == nil {
+				break
+			}
+		}
+		// signatures are hexadecimal, verified whatever their case, so replays are detected in lower case
+		if err == nil && scheme.Tolerance > 0 && !signedAt.IsZero() {
+			if age := time.Since(signedAt); age > scheme.Tolerance || age < -scheme.Tolerance {
+				err = ErrWebhookTimestamp
+			} else if !replays.add(strings.ToLower(signature), signedAt.Add(scheme.Tolerance)) {
+				err = ErrWebhookReplay
+			}
+		}
+		if err != nil {
+			return Unauthorized(err.Error()).WithInternal(err)
+		}
+		next()
+		return nil
+	}
+}
+
+// webhookReplays are the signatures verified within the tolerance of a scheme
+type webhookReplays struct {
+	mutex sync.Mutex
+	seen  map[string]time.Time
+}
+
+// add adds signature, expiring at expiresAt, and returns false if it has already been added
+func (replays *webhookReplays) add(signature string, expiresAt time.Time) bool {
+	replays.mutex.Lock()
+	defer replays.mutex.Unlock()
+	now := time.Now()
+	for seen, expiry := range replays.seen {
+		if expiry.Before(now) {
+			delete(replays.seen, seen)
+		}
+	}
+	if _, seen := replays.seen[signature]; seen {
+		return false
+	}
+	replays.seen[signature] = expiresAt
+	return true
+}
+
+// hmacEqual returns true if signature is the hexadecimal HMAC-SHA256 of message with key
+func hmacEqual(key []byte, message []byte, signature string) bool {
+	decoded, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return hmac.Equal(mac.Sum(nil), decoded)
+}
+
+// parseUnixTimestamp parses a timestamp in seconds since the epoch
+func parseUnixTimestamp(timestamp string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
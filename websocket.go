@@ -0,0 +1,409 @@
+package micro
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+/**********************************/
+/*           WEBSOCKETS           */
+/**********************************/
+
+// WebSocket message types
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+)
+
+// WebSocket close codes
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+)
+
+// frame opcodes
+const (
+	continuationFrame = 0
+	closeFrame        = 8
+	pingFrame         = 9
+	pongFrame         = 10
+)
+
+// webSocketGUID is concatenated to the key of the client to compute the accept key of the handshake
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// WebSocketKeepAlive is the interval at which pings are sent on websocket connections.
+	// A zero or negative value disables keep-alive pings.
+	WebSocketKeepAlive = 30 * time.Second
+	// WebSocketReadLimit is the default maximum size of the messages read from websocket connections
+	WebSocketReadLimit int64 = 32 << 20
+	// WebSocketCheckOrigin returns true if the websocket handshake of request is allowed,
+	// the default only allows requests without an Origin header or with an Origin matching the Host header
+	WebSocketCheckOrigin = sameOrigin
+)
+
+// webSocketChunk is the capacity the payloads of frames are allocated with, they grow as they are read
+// so a length announced in a frame header does not allocate memory the peer has not sent
+const webSocketChunk = 4096
+
+// ErrWebSocketClosed is returned when writing on a closed websocket connection
+var ErrWebSocketClosed = errors.New("websocket connection closed")
+
+// CloseError is returned by WSConn.ReadMessage when the peer closes the connection
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (err *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed : %d %s", err.Code, err.Reason)
+}
+
+// WSConn is a websocket connection
+type WSConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+	done       chan struct{}
+	closed     bool
+	// readLimit is the maximum size of the messages read
+	readLimit int64
+}
+
+// WebSocket creates a GET route upgrading requests to websocket connections.
+// handler runs until the connection is closed, the connection is closed when it returns:
+//
+//	app.WebSocket("/echo", func(conn *micro.WSConn, ctx *micro.Context) {
+//		for {
+//			messageType, message, err := conn.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			conn.WriteMessage(messageType, message)
+//		}
+//	})
+//
+// Requests which are not websocket handshakes are answered with a 400 Bad Request,
+// and cross-origin handshakes with a 403 Forbidden, see WebSocketCheckOrigin.
+func (rc *ControllerCollection) WebSocket(path string, handler func(conn *WSConn, ctx *Context)) *Route {
+	route := rc.All(path, func(ctx *Context) {
+		conn, err := ctx.upgrade()
+		if err != nil {
+			var httpError *HTTPError
+			if errors.As(err, &httpError) {
+				ctx.sendError(httpError.Code, httpError.Message, httpError)
+			}
+			return
+		}
+		defer conn.Close()
+		handler(conn, ctx)
+	})
+	route.SetMethods([]string{"GET"})
+	return route
+}
+
+// upgrade performs the websocket handshake and hijacks the connection of the request
+func (ctx *Context) upgrade() (*WSConn, error) {
+	request, header := ctx.Request, ctx.Request.Header
+	if !headerContainsToken(header, "Connection", "upgrade") || !headerContainsToken(header, "Upgrade", "websocket") {
+		return nil, BadRequest("not a websocket handshake")
+	}
+	if header.Get("Sec-WebSocket-Version") != "13" {
+		ctx.Response.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, NewHTTPError(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, BadRequest("invalid websocket key")
+	}
+	if !WebSocketCheckOrigin(request) {
+		return nil, Forbidden("cross-origin websocket handshake")
+	}
+	hijacker, ok := ctx.Response.(http.Hijacker)
+	if !ok {
+		return nil, InternalServerError(fmt.Sprintf("%T does not implement http.Hijacker, websockets are not supported", ctx.Response))
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// the deadlines of the server do not apply to websocket connections
+	conn.SetDeadline(time.Time{})
+	if _, err := fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	wsConn := &WSConn{conn: conn, reader: buffer.Reader, done: make(chan struct{}), readLimit: WebSocketReadLimit}
+	go wsConn.keepAlive()
+	return wsConn, nil
+}
+
+// acceptKey returns the Sec-WebSocket-Accept header answering the Sec-WebSocket-Key key
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// headerContainsToken returns true if the comma separated values of the header name contain token
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin returns true if request has no Origin header or an Origin matching its Host header
+func sameOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(parsed.Host, request.Host)
+}
+
+// keepAlive pings the peer until the connection is closed
+func (conn *WSConn) keepAlive() {
+	if WebSocketKeepAlive <= 0 {
+		return
+	}
+	ticker := time.NewTicker(WebSocketKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if conn.Ping(nil) != nil {
+				return
+			}
+		case <-conn.done:
+			return
+		}
+	}
+}
+
+// SetReadLimit sets the maximum size of the messages read, larger messages close the connection
+func (conn *WSConn) SetReadLimit(limit int64) {
+	conn.readLimit = limit
+}
+
+// SetReadDeadline sets the deadline of the next reads, a zero value means no deadline
+func (conn *WSConn) SetReadDeadline(t time.Time) error {
+	return conn.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of the next writes, a zero value means no deadline
+func (conn *WSConn) SetWriteDeadline(t time.Time) error {
+	return conn.conn.SetWriteDeadline(t)
+}
+
+// RemoteAddr returns the address of the peer
+func (conn *WSConn) RemoteAddr() net.Addr {
+	return conn.conn.RemoteAddr()
+}
+
+// Done returns a channel closed when the connection is closed
+func (conn *WSConn) Done() <-chan struct{} {
+	return conn.done
+}
+
+// ReadMessage reads the next text or binary message.
+// Pings are answered and pongs are discarded while reading.
+// It returns a *CloseError when the peer closes the connection.
+func (conn *WSConn) ReadMessage() (messageType int, message []byte, err error) {
+	for {
+		final, opcode, payload, err := conn.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case pingFrame:
+			if err := conn.writeFrame(pongFrame, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case pongFrame:
+			continue
+		case closeFrame:
+			return 0, nil, conn.peerClosed(payload)
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, conn.fail(CloseProtocolError, "unexpected data frame")
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, conn.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, conn.fail(CloseProtocolError, "unknown opcode")
+		}
+		if int64(len(message)+len(payload)) > conn.readLimit {
+			return 0, nil, conn.fail(CloseMessageTooBig, "message too big")
+		}
+		message = append(message, payload...)
+		if final {
+			if messageType == TextMessage && !utf8.Valid(message) {
+				return 0, nil, conn.fail(CloseInvalidPayload, "invalid UTF-8")
+			}
+			return messageType, message, nil
+		}
+	}
+}
+
+// readFrame reads a frame sent by the client
+func (conn *WSConn) readFrame() (final bool, opcode int, payload []byte, err error) {
+	header := make([]byte, 2, 8)
+	if _, err = io.ReadFull(conn.reader, header); err != nil {
+		return
+	}
+	final, opcode = header[0]&0x80 != 0, int(header[0]&0x0f)
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, conn.fail(CloseProtocolError, "reserved bits set")
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, conn.fail(CloseProtocolError, "unmasked client frame")
+	}
+	length := int64(header[1] & 0x7f)
+	if opcode >= closeFrame && (length > 125 || !final) {
+		return false, 0, nil, conn.fail(CloseProtocolError, "invalid control frame")
+	}
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err = io.ReadFull(conn.reader, extended); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err = io.ReadFull(conn.reader, extended); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(extended))
+	}
+	if length < 0 || length > conn.readLimit {
+		return false, 0, nil, conn.fail(CloseMessageTooBig, "message too big")
+	}
+	mask := make([]byte, 4)
+	if _, err = io.ReadFull(conn.reader, mask); err != nil {
+		return
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, min(length, webSocketChunk)))
+	if _, err = io.CopyN(buffer, conn.reader, length); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	payload = buffer.Bytes()
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// WriteMessage writes a text or binary message
+func (conn *WSConn) WriteMessage(messageType int, message []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("invalid websocket message type %d", messageType)
+	}
+	return conn.writeFrame(messageType, message)
+}
+
+// WriteText writes a text message
+func (conn *WSConn) WriteText(message string) error {
+	return conn.writeFrame(TextMessage, []byte(message))
+}
+
+// Ping sends a ping with data, the peer answers with a pong
+func (conn *WSConn) Ping(data []byte) error {
+	return conn.writeFrame(pingFrame, data)
+}
+
+// writeFrame writes a final unmasked frame
+func (conn *WSConn) writeFrame(opcode int, payload []byte) error {
+	conn.writeMutex.Lock()
+	defer conn.writeMutex.Unlock()
+	if conn.closed {
+		return ErrWebSocketClosed
+	}
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|byte(opcode))
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	frame = append(frame, payload...)
+	if opcode == closeFrame {
+		conn.closed = true
+	}
+	_, err := conn.conn.Write(frame)
+	return err
+}
+
+// peerClosed answers the close frame of the peer and returns its CloseError
+func (conn *WSConn) peerClosed(payload []byte) error {
+	closeError := &CloseError{Code: CloseNoStatusReceived}
+	if len(payload) >= 2 {
+		closeError.Code, closeError.Reason = int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+	}
+	conn.CloseWithCode(CloseNormalClosure, "")
+	return closeError
+}
+
+// fail closes the connection with code because of a protocol violation of the peer
+func (conn *WSConn) fail(code int, reason string) error {
+	conn.CloseWithCode(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// Close closes the connection normally
+func (conn *WSConn) Close() error {
+	return conn.CloseWithCode(CloseNormalClosure, "")
+}
+
+// CloseWithCode sends a close frame with code and reason and closes the connection,
+// subsequent calls do nothing
+func (conn *WSConn) CloseWithCode(code int, reason string) error {
+	var err error
+	conn.closeOnce.Do(func() {
+		payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+		conn.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		conn.writeFrame(closeFrame, append(payload, reason...))
+		close(conn.done)
+		err = conn.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,151 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync"
+)
+
+/**********************************/
+/*            WORKERS             */
+/**********************************/
+
+// WorkerFailed is emitted when a worker returns an error or panics
+var WorkerFailed = NewEvent[*WorkerError]("worker.failed")
+
+// WorkerError is the failure of a worker, the payload of WorkerFailed
+type WorkerError struct {
+	// Worker is the name of the worker
+	Worker string
+	// Err is the error returned by the worker, or the error of its panic
+	Err error
+	// Stack is the stack trace of the panic, if any
+	Stack []byte
+}
+
+func (err *WorkerError) Error() string {
+	return fmt.Sprintf("worker %s failed : %v", err.Worker, err.Err)
+}
+
+// Unwrap returns the error of the worker
+func (err *WorkerError) Unwrap() error {
+	return err.Err
+}
+
+// worker is a named function running in the background
+type worker struct {
+	name     string
+	function interface{}
+}
+
+// workers are the background workers of an application
+type workers struct {
+	mutex      sync.Mutex
+	registered []worker
+	ctx        context.Context
+	cancel     context.CancelFunc
+	running    sync.WaitGroup
+}
+
+// Go registers a worker, a function running in the background alongside the http server,
+// such as a queue consumer or a cache refresher. Workers start when the application boots,
+// or immediately if it is booted. Their arguments are resolved by a child of the application injector
+// in which the context.Context of the worker is registered, the context is cancelled on Shutdown:
+//
+//	app.Go("mailer", func(ctx context.Context, queue *Queue) error {
+//		for {
+//			select {
+//			case <-ctx.Done():
+//				return nil
+//			case message := <-queue.Messages():
+//				send(message)
+//			}
+//		}
+//	})
+//
+// A worker returning a non nil error as its last result, or panicking, emits WorkerFailed.
+//
+// Can Panic! if worker is not a function.
+func (e *Micro) Go(name string, function interface{}) {
+	if reflect.TypeOf(function) == nil || reflect.TypeOf(function).Kind() != reflect.Func {
+		panic(fmt.Sprintf("worker %s should be a function, got %T", name, function))
+	}
+	e.workers.mutex.Lock()
+	defer e.workers.mutex.Unlock()
+	e.workers.registered = append(e.workers.registered, worker{name: name, function: function})
+	if e.workers.ctx != nil {
+		e.startWorker(e.workers.ctx, e.workers.registered[len(e.workers.registered)-1])
+	}
+}
+
+// startWorkers starts the registered workers
+func (e *Micro) startWorkers() {
+	e.workers.mutex.Lock()
+	defer e.workers.mutex.Unlock()
+	if e.workers.ctx != nil {
+		return
+	}
+	e.workers.ctx, e.workers.cancel = context.WithCancel(context.Background())
+	for _, registered := range e.workers.registered {
+		e.startWorker(e.workers.ctx, registered)
+	}
+}
+
+// startWorker runs a worker in a goroutine
+func (e *Micro) startWorker(ctx context.Context, registered worker) {
+	e.workers.running.Add(1)
+	go func() {
+		defer e.workers.running.Done()
+		if err := e.runWorker(ctx, registered); err != nil {
+			e.Logger().Error("worker failed", "worker", registered.name, "error", err.Err)
+			Publish(e.EventEmitter, WorkerFailed, err)
+		}
+	}()
+}
+
+// runWorker calls a worker and returns its failure if any
+func (e *Micro) runWorker(ctx context.Context, registered worker) (failure *WorkerError) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			failure = &WorkerError{Worker: registered.name, Err: fmt.Errorf("panic: %v", recovered), Stack: debug.Stack()}
+		}
+	}()
+	injector := e.injector.Child()
+	injector.registerAs(ctx, contextType)
+	defer injector.Cleanup()
+	results, err := injector.Call(registered.function)
+	if err != nil {
+		return &WorkerError{Worker: registered.name, Err: err}
+	}
+	if len(results) > 0 {
+		if err, ok := results[len(results)-1].Interface().(error); ok && err != nil {
+			return &WorkerError{Worker: registered.name, Err: err}
+		}
+	}
+	return nil
+}
+
+// stopWorkers cancels the context of the workers and waits for them until ctx is done
+func (e *Micro) stopWorkers(ctx context.Context) error {
+	e.workers.mutex.Lock()
+	cancel := e.workers.cancel
+	e.workers.ctx, e.workers.cancel = nil, nil
+	e.workers.mutex.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	stopped := make(chan struct{})
+	go func() {
+		e.workers.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers not stopped : %w", ctx.Err())
+	}
+}